@@ -0,0 +1,309 @@
+// kpimon-decode decodes E2AP PDUs and bare E2SM-KPM indication headers and
+// messages outside a running xApp, e.g. payloads copied from a pcap or from a
+// vendor hex dump.
+//
+//	kpimon-decode e2ap|header|message [-input auto|hex|base64|binary] [-output json|xer] [-file path] [payload]
+//
+// The payload is taken from the command line, from -file or from stdin. The
+// payload kind comes before the flags since xapp-frame parses the command line
+// itself when the control package is loaded.
+//
+// JSON output holds the decoded indication, header and message. XER output
+// dumps any E2AP PDU, followed by the indication header and message when the
+// PDU is a RIC indication.
+//
+// Exit codes:
+//
+//	0 decoded
+//	1 output could not be written
+//	2 usage error or unreadable payload
+//	3 E2AP decode failed
+//	4 E2SM indication header decode failed
+//	5 E2SM indication message decode failed
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"gerrit.o-ran-sc.org/r/scp/ric-app/kpimon/control"
+)
+
+const (
+	exitOK = iota
+	exitOutput
+	exitUsage
+	exitE2AP
+	exitHeader
+	exitMessage
+)
+
+const usageText = `usage: kpimon-decode e2ap|header|message [flags] [payload]
+
+  e2ap     E2AP PDU, RIC indications are decoded down to the KPM message
+  header   E2SM-KPM indication header
+  message  E2SM-KPM indication message
+
+The payload is read from the command line, from -file or from stdin.
+`
+
+// decoded is the JSON output, stages that were not run or failed are omitted
+type decoded struct {
+	Indication *control.DecodedIndicationMessage `json:"indication,omitempty"`
+	Header     *control.IndicationHeader         `json:"header,omitempty"`
+	Message    *control.IndicationMessage        `json:"message,omitempty"`
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usageText)
+		return exitUsage
+	}
+
+	kind := args[0]
+	switch kind {
+	case "e2ap", "header", "message":
+	case "help":
+		fmt.Fprint(stdout, usageText)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "kpimon-decode: unknown payload kind %q\n", kind)
+		fmt.Fprint(stderr, usageText)
+		return exitUsage
+	}
+
+	flags := flag.NewFlagSet("kpimon-decode "+kind, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	input := flags.String("input", "auto", "payload encoding: auto, hex, base64 or binary")
+	output := flags.String("output", "json", "output format: json or xer")
+	file := flags.String("file", "", "read the payload from a file, - for stdin")
+	if err := flags.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *output != "json" && *output != "xer" {
+		fmt.Fprintf(stderr, "kpimon-decode: unknown output format %q\n", *output)
+		return exitUsage
+	}
+
+	data, text, err := readPayload(flags.Args(), *file, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "kpimon-decode: %v\n", err)
+		return exitUsage
+	}
+	payload, err := decodePayload(data, *input, text)
+	if err != nil {
+		fmt.Fprintf(stderr, "kpimon-decode: %v\n", err)
+		return exitUsage
+	}
+
+	if *output == "xer" {
+		return printXER(kind, payload, stdout, stderr)
+	}
+	return printJSON(kind, payload, stdout, stderr)
+}
+
+// readPayload returns the raw payload and whether it was given on the command
+// line, which rules out binary input
+func readPayload(args []string, file string, stdin io.Reader) (data []byte, text bool, err error) {
+	switch {
+	case len(args) > 1:
+		return nil, false, errors.New("more than one payload given")
+	case len(args) == 1 && file != "":
+		return nil, false, errors.New("payload given both on the command line and with -file")
+	case len(args) == 1:
+		return []byte(args[0]), true, nil
+	case file == "" || file == "-":
+		data, err = ioutil.ReadAll(stdin)
+	default:
+		data, err = ioutil.ReadFile(file)
+	}
+	return
+}
+
+// decodePayload turns hex or base64 text into the encoded PDU. Auto detection
+// tries hex, then base64, and falls back to binary for files and stdin.
+func decodePayload(data []byte, input string, text bool) (payload []byte, err error) {
+	switch input {
+	case "hex":
+		payload, err = parseHex(string(data))
+	case "base64":
+		payload, err = parseBase64(string(data))
+	case "binary":
+		payload = data
+	case "auto":
+		if payload, err = parseHex(string(data)); err == nil {
+			break
+		}
+		if payload, err = parseBase64(string(data)); err == nil {
+			break
+		}
+		if text {
+			return nil, errors.New("payload is neither hex nor base64")
+		}
+		payload, err = data, nil
+	default:
+		return nil, fmt.Errorf("unknown input encoding %q", input)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s payload: %v", input, err)
+	}
+	if len(payload) == 0 {
+		return nil, errors.New("empty payload")
+	}
+	return
+}
+
+// parseHex accepts plain hex streams as well as bytes separated by spaces or
+// colons, each optionally prefixed with 0x
+func parseHex(s string) ([]byte, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ':' || r == ' ' || r == '\t' || r == '\r' || r == '\n'
+	})
+	for i, f := range fields {
+		if strings.HasPrefix(f, "0x") || strings.HasPrefix(f, "0X") {
+			fields[i] = f[2:]
+		}
+	}
+	return hex.DecodeString(strings.Join(fields, ""))
+}
+
+func parseBase64(s string) ([]byte, error) {
+	s = strings.Join(strings.Fields(s), "")
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+func printJSON(kind string, payload []byte, stdout, stderr io.Writer) int {
+	var e2ap *control.E2ap
+	var e2sm *control.E2sm
+	var out decoded
+	code := exitOK
+
+	header, message := payload, payload
+	if kind == "e2ap" {
+		ind, err := e2ap.GetIndicationMessage(payload)
+		if err != nil {
+			fmt.Fprintf(stderr, "kpimon-decode: E2AP: %v\n", err)
+			return exitE2AP
+		}
+		out.Indication = ind
+		header, message = ind.IndHeader, ind.IndMessage
+	}
+
+	if kind != "message" {
+		if hdr, err := decodeHeader(e2sm, header); err != nil {
+			fmt.Fprintf(stderr, "kpimon-decode: E2SM indication header: %v\n", err)
+			code = exitHeader
+		} else {
+			out.Header = hdr
+		}
+	}
+	if kind != "header" {
+		if msg, err := decodeMessage(e2sm, message); err != nil {
+			fmt.Fprintf(stderr, "kpimon-decode: E2SM indication message: %v\n", err)
+			if code == exitOK {
+				code = exitMessage
+			}
+		} else {
+			out.Message = msg
+		}
+	}
+
+	if out.Indication == nil && out.Header == nil && out.Message == nil {
+		return code
+	}
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		fmt.Fprintf(stderr, "kpimon-decode: %v\n", err)
+		return exitOutput
+	}
+	if _, err = fmt.Fprintf(stdout, "%s\n", b); err != nil {
+		fmt.Fprintf(stderr, "kpimon-decode: %v\n", err)
+		return exitOutput
+	}
+	return code
+}
+
+func printXER(kind string, payload []byte, stdout, stderr io.Writer) int {
+	var e2ap *control.E2ap
+	var e2sm *control.E2sm
+	var dumps []string
+	code := exitOK
+
+	header, message := payload, payload
+	if kind == "e2ap" {
+		xer, err := e2ap.PrintPDU(payload)
+		if err != nil {
+			fmt.Fprintf(stderr, "kpimon-decode: E2AP: %v\n", err)
+			return exitE2AP
+		}
+		dumps = append(dumps, xer)
+
+		// Only RIC indications carry a KPM header and message
+		ind, err := e2ap.GetIndicationMessage(payload)
+		if err != nil {
+			kind = ""
+		} else {
+			header, message = ind.IndHeader, ind.IndMessage
+		}
+	}
+
+	if kind == "e2ap" || kind == "header" {
+		if xer, err := e2sm.PrintIndicationHeader(header); err != nil {
+			fmt.Fprintf(stderr, "kpimon-decode: E2SM indication header: %v\n", err)
+			code = exitHeader
+		} else {
+			dumps = append(dumps, xer)
+		}
+	}
+	if kind == "e2ap" || kind == "message" {
+		if xer, err := e2sm.PrintIndicationMessage(message); err != nil {
+			fmt.Fprintf(stderr, "kpimon-decode: E2SM indication message: %v\n", err)
+			if code == exitOK {
+				code = exitMessage
+			}
+		} else {
+			dumps = append(dumps, xer)
+		}
+	}
+
+	for _, xer := range dumps {
+		if _, err := io.WriteString(stdout, xer); err != nil {
+			fmt.Fprintf(stderr, "kpimon-decode: %v\n", err)
+			return exitOutput
+		}
+	}
+	return code
+}
+
+// decodeHeader guards the wrapper against empty buffers, which it cannot take
+func decodeHeader(e2sm *control.E2sm, buffer []byte) (*control.IndicationHeader, error) {
+	if len(buffer) == 0 {
+		return nil, errors.New("empty buffer")
+	}
+	return e2sm.GetIndicationHeader(buffer)
+}
+
+func decodeMessage(e2sm *control.E2sm, buffer []byte) (*control.IndicationMessage, error) {
+	if len(buffer) == 0 {
+		return nil, errors.New("empty buffer")
+	}
+	return e2sm.GetIndicationMessage(buffer)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// RIC indication of request 123 and RAN function 2, with a format 1 header of
+// sender gnb-1 and a format 1 message reporting DRB.UEThpDl of cell-1
+const (
+	testHeader     = "08e63c8a00000005676e622d31"
+	testMessage    = "0a000600000663656c6c2d31000040504452422e5545546870446c0108000009000001000204d2"
+	testIndication = "00054060000007001d000500007b0005000500020002000f000101001b0002002a001c0001000019000e0d" +
+		testHeader + "001a002827" + testMessage
+)
+
+// corrupt replaces the octets of part in the indication, keeping the E2AP
+// encoding valid
+func corrupt(indication string, parts ...string) string {
+	for _, part := range parts {
+		indication = strings.Replace(indication, part, strings.Repeat("ff", len(part)/2), 1)
+	}
+	return indication
+}
+
+func TestRun(t *testing.T) {
+	pdu, err := hex.DecodeString(testIndication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name   string
+		args   []string
+		stdin  []byte
+		code   int
+		stdout []string //substrings of stdout, none expected when empty
+		stderr string
+	}{
+		{
+			name:   "hex indication",
+			args:   []string{"e2ap", testIndication},
+			stdout: []string{`"requestId": 123`, `"functionId": 2`, `"senderName": "gnb-1"`, `"cellObjId": "cell-1"`, `"measurement": "DRB.UEThpDl"`},
+		},
+		{
+			name:   "base64 indication on stdin",
+			args:   []string{"e2ap"},
+			stdin:  []byte(base64.StdEncoding.EncodeToString(pdu) + "\n"),
+			stdout: []string{`"requestId": 123`, `"value": 1234`},
+		},
+		{
+			name:   "binary indication on stdin",
+			args:   []string{"e2ap", "-file", "-"},
+			stdin:  pdu,
+			stdout: []string{`"requestId": 123`, `"value": 1234`},
+		},
+		{
+			name:   "header",
+			args:   []string{"header", testHeader},
+			stdout: []string{`"senderName": "gnb-1"`},
+		},
+		{
+			name:   "message",
+			args:   []string{"message", "-input", "hex", testMessage},
+			stdout: []string{`"cellObjId": "cell-1"`},
+		},
+		{
+			name:   "XER indication",
+			args:   []string{"e2ap", "-output", "xer", testIndication},
+			stdout: []string{"<E2AP-PDU>", "<procedureCode>5</procedureCode>", "gnb-1", "DRB.UEThpDl"},
+		},
+		{
+			name:   "corrupted E2AP",
+			args:   []string{"e2ap", "ff" + testIndication[2:]},
+			code:   exitE2AP,
+			stderr: "E2AP",
+		},
+		{
+			name:   "corrupted header",
+			args:   []string{"e2ap", corrupt(testIndication, testHeader)},
+			code:   exitHeader,
+			stdout: []string{`"requestId": 123`, `"cellObjId": "cell-1"`},
+			stderr: "E2SM indication header",
+		},
+		{
+			name:   "corrupted message",
+			args:   []string{"e2ap", corrupt(testIndication, testMessage)},
+			code:   exitMessage,
+			stdout: []string{`"requestId": 123`, `"senderName": "gnb-1"`},
+			stderr: "E2SM indication message",
+		},
+		{
+			name:   "corrupted header and message",
+			args:   []string{"e2ap", corrupt(testIndication, testHeader, testMessage)},
+			code:   exitHeader,
+			stdout: []string{`"requestId": 123`},
+		},
+		{
+			name:   "XER corrupted header",
+			args:   []string{"e2ap", "-output", "xer", corrupt(testIndication, testHeader)},
+			code:   exitHeader,
+			stdout: []string{"<E2AP-PDU>", "DRB.UEThpDl"},
+		},
+		{
+			name:   "corrupted bare message",
+			args:   []string{"message", corrupt(testMessage, testMessage)},
+			code:   exitMessage,
+			stderr: "E2SM indication message",
+		},
+		{name: "no arguments", code: exitUsage, stderr: "usage"},
+		{name: "help", args: []string{"help"}, stdout: []string{"usage"}},
+		{name: "unknown kind", args: []string{"indication", testIndication}, code: exitUsage, stderr: "unknown payload kind"},
+		{name: "unknown output", args: []string{"e2ap", "-output", "yaml", testIndication}, code: exitUsage, stderr: "unknown output format"},
+		{name: "unknown input", args: []string{"e2ap", "-input", "octal", testIndication}, code: exitUsage, stderr: "unknown input encoding"},
+		{name: "two payloads", args: []string{"e2ap", testHeader, testMessage}, code: exitUsage, stderr: "more than one payload"},
+		{name: "payload and file", args: []string{"e2ap", "-file", "pdu.bin", testIndication}, code: exitUsage, stderr: "both"},
+		{name: "missing file", args: []string{"e2ap", "-file", "missing.bin"}, code: exitUsage},
+		{name: "text neither hex nor base64", args: []string{"e2ap", "not a pdu!"}, code: exitUsage, stderr: "neither hex nor base64"},
+		{name: "empty stdin", args: []string{"e2ap"}, code: exitUsage, stderr: "empty payload"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(c.args, bytes.NewReader(c.stdin), &stdout, &stderr); code != c.code {
+				t.Fatalf("got exit code %d, want %d, stderr: %s", code, c.code, stderr.String())
+			}
+			if len(c.stdout) == 0 && stdout.Len() > 0 {
+				t.Errorf("got output %s", stdout.String())
+			}
+			for _, s := range c.stdout {
+				if !strings.Contains(stdout.String(), s) {
+					t.Errorf("output without %s: %s", s, stdout.String())
+				}
+			}
+			if !strings.Contains(stderr.String(), c.stderr) {
+				t.Errorf("got stderr %q, want %q", stderr.String(), c.stderr)
+			}
+		})
+	}
+}
+
+func TestDecodePayload(t *testing.T) {
+	for _, c := range []struct {
+		data  string
+		input string
+		text  bool
+		want  string //hex of the payload, error text when prefixed by !
+	}{
+		{"0102ff", "auto", true, "0102ff"},
+		{"01:02:FF\n", "auto", true, "0102ff"},
+		{"0x01 0x02 0XfF", "auto", true, "0102ff"},
+		{"0102", "auto", true, "0102"}, //valid base64 too, hex comes first
+		{"AQL/", "auto", true, "0102ff"},
+		{"AQ\nL/\n", "auto", true, "0102ff"},
+		{"AQI", "auto", true, "0102"}, //unpadded
+		{"AQL/", "hex", true, "!invalid hex payload"},
+		{"0102ff", "base64", true, "d35d367d"},
+		{"A", "base64", true, "!invalid base64 payload"},
+		{"\x01\x02", "auto", true, "!payload is neither hex nor base64"},
+		{"\x01\x02", "auto", false, "0102"},
+		{"0102", "binary", false, "30313032"},
+		{"", "auto", false, "!empty payload"},
+		{" \n", "hex", true, "!empty payload"},
+		{"0102", "ascii", true, "!unknown input encoding"},
+	} {
+		payload, err := decodePayload([]byte(c.data), c.input, c.text)
+		got := fmt.Sprintf("%x", payload)
+		if err != nil {
+			got = "!" + err.Error()
+		}
+		if !strings.HasPrefix(got, c.want) || (err == nil && got != c.want) {
+			t.Errorf("decodePayload(%q, %s, %v) = %s, want %s", c.data, c.input, c.text, got, c.want)
+		}
+	}
+}
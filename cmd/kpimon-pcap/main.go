@@ -0,0 +1,321 @@
+// kpimon-pcap reads E2 traffic captured with tcpdump or Wireshark on the E2
+// termination and replays it through kpimon offline.
+//
+//	kpimon-pcap import|list [-ppid 70] [-ran ip[:port]=name ...] [-sinks influxdb,sql,export] [-connect-timeout 30s] [-log path] capture.pcap|capture.pcapng ...
+//
+// SCTP DATA chunks carrying E2AP are reassembled per association and stream,
+// with IPv4 fragments, bundled chunks and retransmissions taken care of.
+//
+// list prints one line per E2AP PDU. import runs the RIC indications and the
+// subscription messages through kpimon's decoders and sinks, configured from
+// the same environment as the xApp, with the capture time in place of the wall
+// clock: a historic capture ends up in InfluxDB as if kpimon had received it
+// live. Captures are read in the order given on the command line.
+//
+// import writes to InfluxDB, the SQL database and the export files, those of
+// them that are configured. Kafka, MQTT and VES feed live consumers and are
+// written to only when named in -sinks, which then lists every sink to write
+// to. import gives up when InfluxDB is not reachable within -connect-timeout.
+//
+// The E2 node of a PDU is named after its IP address unless -ran maps it to
+// the RAN name used by the xApp.
+//
+// Exit codes:
+//
+//	0 capture read, every PDU handled
+//	1 capture unreadable, PDUs failed to import or a sink not available
+//	2 usage error
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"gerrit.o-ran-sc.org/r/scp/ric-app/kpimon/control"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+const (
+	exitOK = iota
+	exitFailed
+	exitUsage
+)
+
+const e2apPPID = 70 //SCTP payload protocol identifier assigned to E2AP
+
+const usageText = `usage: kpimon-pcap import|list [flags] capture ...
+
+  import  store the RIC indications and subscription messages of the captures
+  list    print the E2AP PDUs found in the captures
+
+Captures may be pcap or pcapng files.
+`
+
+// E2AP procedure names by procedure code
+var procedures = map[int64]string{
+	1: "E2setup",
+	2: "ErrorIndication",
+	3: "Reset",
+	4: "RICcontrol",
+	5: "RICindication",
+	6: "RICserviceQuery",
+	7: "RICserviceUpdate",
+	8: "RICsubscription",
+	9: "RICsubscriptionDelete",
+}
+
+var messageTypes = map[int32]string{
+	1: "initiatingMessage",
+	2: "successfulOutcome",
+	3: "unsuccessfulOutcome",
+}
+
+// ranNames maps E2 node endpoints to RAN names, given as -ran ip[:port]=name
+type ranNames map[string]string
+
+func (r ranNames) String() string {
+	var pairs []string
+	for endpoint, name := range r {
+		pairs = append(pairs, endpoint+"="+name)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (r ranNames) Set(value string) error {
+	i := strings.LastIndex(value, "=")
+	if i <= 0 || i == len(value)-1 {
+		return errors.New("expected ip[:port]=name")
+	}
+	endpoint := value[:i]
+	if host, port, err := net.SplitHostPort(endpoint); err == nil {
+		endpoint = net.JoinHostPort(host, port)
+	} else if net.ParseIP(endpoint) == nil {
+		return fmt.Errorf("invalid address %q", endpoint)
+	}
+	r[endpoint] = value[i+1:]
+	return nil
+}
+
+// lookup prefers the exact endpoint, then the address, then the address itself
+func (r ranNames) lookup(endpoint, ip string) string {
+	if name, ok := r[endpoint]; ok {
+		return name
+	}
+	if name, ok := r[ip]; ok {
+		return name
+	}
+	return ip
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usageText)
+		return exitUsage
+	}
+
+	mode := args[0]
+	switch mode {
+	case "import", "list":
+	case "help":
+		fmt.Fprint(stdout, usageText)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "kpimon-pcap: unknown command %q\n", mode)
+		fmt.Fprint(stderr, usageText)
+		return exitUsage
+	}
+
+	names := ranNames{}
+	flags := flag.NewFlagSet("kpimon-pcap "+mode, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	ppid := flags.Int("ppid", e2apPPID, "SCTP payload protocol identifier of E2AP, -1 for any")
+	flags.Var(names, "ran", "RAN name of an E2 node as ip[:port]=name, may be repeated")
+	logPath := flags.String("log", "", "write kpimon's log to a file instead of discarding it")
+	sinks := flags.String("sinks", "", "comma separated sinks to import into, of influxdb, sql, export, kafka, mqtt and ves (default configured of influxdb, sql and export)")
+	connectTimeout := flags.Duration("connect-timeout", 30*time.Second, "how long import waits for InfluxDB")
+	if err := flags.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "kpimon-pcap: no capture given")
+		return exitUsage
+	}
+
+	// The control package logs every PDU, keep it out of the tool's output
+	log.SetOutput(ioutil.Discard)
+	xapp.Logger.SetLevel(1)
+	if *logPath != "" {
+		logFile, err := os.OpenFile(*logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintf(stderr, "kpimon-pcap: %v\n", err)
+			return exitUsage
+		}
+		defer logFile.Close()
+		log.SetOutput(logFile)
+	}
+
+	var importer *control.Importer
+	var e2ap *control.E2ap
+	if mode == "import" {
+		opts := control.ImportOptions{ConnectTimeout: *connectTimeout}
+		if *sinks != "" {
+			opts.Sinks = strings.Split(*sinks, ",")
+		}
+		var err error
+		if importer, err = control.NewImporter(opts); err != nil {
+			fmt.Fprintf(stderr, "kpimon-pcap: %v\n", err)
+			return exitFailed
+		}
+	}
+
+	code := exitOK
+	handle := func(m message) error {
+		messageType, procedureCode, err := e2ap.GetPDUProcedure(m.Payload)
+		if err != nil {
+			return fmt.Errorf("%s %s > %s: %v", m.Time.UTC().Format(time.RFC3339Nano), m.Src, m.Dst, err)
+		}
+
+		endpoint, ip := m.Dst, m.DstIP
+		if fromNode(messageType, procedureCode) {
+			endpoint, ip = m.Src, m.SrcIP
+		}
+		ranName := names.lookup(endpoint, ip)
+
+		if importer == nil {
+			_, err = fmt.Fprintf(stdout, "%s %s > %s %s %s %s %d\n", m.Time.UTC().Format(time.RFC3339Nano), m.Src, m.Dst,
+				ranName, procedureName(procedureCode), messageTypes[messageType], len(m.Payload))
+			return err
+		}
+		if err = importer.Import(ranName, m.Time, m.Payload); err != nil {
+			return fmt.Errorf("%s %s %s: %v", m.Time.UTC().Format(time.RFC3339Nano), ranName, procedureName(procedureCode), err)
+		}
+		return nil
+	}
+
+	a := newAssembler(*ppid)
+	for _, path := range flags.Args() {
+		if err := readCapture(path, a, func(m message) {
+			if err := handle(m); err != nil {
+				fmt.Fprintf(stderr, "kpimon-pcap: %v\n", err)
+				code = exitFailed
+			}
+		}); err != nil {
+			fmt.Fprintf(stderr, "kpimon-pcap: %s: %v\n", path, err)
+			code = exitFailed
+		}
+	}
+
+	s := a.stats
+	fmt.Fprintf(stderr, "kpimon-pcap: %d SCTP packets, %d DATA chunks, %d PDUs, %d duplicate chunks, %d lost fragments, %d truncated packets\n",
+		s.Packets, s.Chunks, s.Messages, s.Duplicates, s.Lost, s.Truncated)
+
+	if importer != nil {
+		stats, err := importer.Close()
+		if err != nil {
+			fmt.Fprintf(stderr, "kpimon-pcap: %v\n", err)
+			code = exitFailed
+		}
+		fmt.Fprintf(stderr, "kpimon-pcap: imported %d indications, %d subscription messages, %d setup messages, skipped %d PDUs, %d failed\n",
+			stats.Indications, stats.SubscriptionMessages, stats.SetupMessages, stats.Skipped, stats.Failed)
+	}
+	return code
+}
+
+// fromNode tells whether a PDU is sent by the E2 node rather than by the RIC
+func fromNode(messageType int32, procedureCode int64) bool {
+	switch procedureCode {
+	case 1, 5, 7: //E2setup, RICindication and RICserviceUpdate are started by the node
+		return messageType == 1
+	case 2, 3: //ErrorIndication and Reset are started by either side
+		return false
+	}
+	return messageType != 1
+}
+
+func procedureName(procedureCode int64) string {
+	if name, ok := procedures[procedureCode]; ok {
+		return name
+	}
+	return fmt.Sprintf("procedure%d", procedureCode)
+}
+
+// readCapture passes the E2AP PDUs of a pcap or pcapng file to handle in
+// capture order
+func readCapture(path string, a *assembler, handle func(m message)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(4)
+	if err != nil {
+		return errors.New("not a capture file")
+	}
+
+	var readPacket func() ([]byte, gopacket.CaptureInfo, layers.LinkType, error)
+	if bytes.Equal(magic, []byte{0x0a, 0x0d, 0x0d, 0x0a}) {
+		ng, err := pcapgo.NewNgReader(r, pcapgo.NgReaderOptions{WantMixedLinkType: true})
+		if err != nil {
+			return err
+		}
+		readPacket = func() ([]byte, gopacket.CaptureInfo, layers.LinkType, error) {
+			data, ci, err := ng.ReadPacketData()
+			linkType := ng.LinkType()
+			if err == nil && len(ci.AncillaryData) > 0 {
+				if lt, ok := ci.AncillaryData[0].(layers.LinkType); ok {
+					linkType = lt
+				}
+			}
+			return data, ci, linkType, err
+		}
+	} else {
+		pcap, err := pcapgo.NewReader(r)
+		if err != nil {
+			return err
+		}
+		readPacket = func() ([]byte, gopacket.CaptureInfo, layers.LinkType, error) {
+			data, ci, err := pcap.ReadPacketData()
+			return data, ci, pcap.LinkType(), err
+		}
+	}
+
+	for {
+		data, ci, linkType, err := readPacket()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if ci.CaptureLength < ci.Length {
+			a.stats.Truncated++
+			continue
+		}
+		packet := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+		for _, m := range a.add(packet, ci.Timestamp) {
+			handle(m)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/ip4defrag"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	sctpChunkData  = 0
+	sctpFlagEnd    = 0x1
+	sctpFlagBegin  = 0x2
+	sctpFlagUnord  = 0x4
+	sctpDataHeader = 16
+	maxSeenTSNs    = 1 << 16 //DATA chunks remembered per capture to drop retransmissions
+)
+
+// message is a user message reassembled from the DATA chunks of an SCTP
+// association, for E2 one E2AP PDU
+type message struct {
+	Time    time.Time //capture time of the last chunk
+	Src     string    //sending endpoint as host:port
+	Dst     string
+	SrcIP   string
+	DstIP   string
+	Payload []byte
+}
+
+// assemblerStats counts what the assembler saw in the capture
+type assemblerStats struct {
+	Packets    int //SCTP packets
+	Chunks     int //DATA chunks with a matching payload protocol
+	Messages   int //complete user messages
+	Duplicates int //retransmitted or twice captured DATA chunks
+	Lost       int //fragmented messages dropped because a fragment is missing
+	Truncated  int //packets cut short by the capture length
+}
+
+type fragmentKey struct {
+	flow      string
+	stream    uint16
+	unordered bool
+}
+
+// fragments is a user message whose fragments are being collected. The
+// fragments of a message carry consecutive TSNs.
+type fragments struct {
+	nextTSN uint32
+	data    []byte
+}
+
+type tsnKey struct {
+	flow string
+	tsn  uint32
+}
+
+// assembler reassembles the SCTP user messages of one payload protocol from
+// captured packets. IPv4 fragments are reassembled first, DATA chunks bundled
+// into one packet are handled one by one.
+type assembler struct {
+	ppid    int //payload protocol identifier, -1 for any
+	defrag  *ip4defrag.IPv4Defragmenter
+	partial map[fragmentKey]*fragments
+	seen    map[tsnKey]bool
+	order   []tsnKey //seen TSNs in arrival order, the oldest are forgotten first
+	stats   assemblerStats
+}
+
+func newAssembler(ppid int) *assembler {
+	return &assembler{
+		ppid:    ppid,
+		defrag:  ip4defrag.NewIPv4Defragmenter(),
+		partial: make(map[fragmentKey]*fragments),
+		seen:    make(map[tsnKey]bool),
+	}
+}
+
+// add returns the user messages completed by a captured packet
+func (a *assembler) add(packet gopacket.Packet, ts time.Time) (messages []message) {
+	var network gopacket.Flow
+	layer := packet.Layer(layers.LayerTypeSCTP)
+
+	if ip4, ok := packet.NetworkLayer().(*layers.IPv4); ok {
+		if ip4.Protocol != layers.IPProtocolSCTP {
+			return nil
+		}
+		if ip4.Flags&layers.IPv4MoreFragments != 0 || ip4.FragOffset != 0 {
+			whole, err := a.defrag.DefragIPv4WithTimestamp(ip4, ts)
+			if err != nil || whole == nil {
+				return nil
+			}
+			ip4 = whole
+			layer = gopacket.NewPacket(whole.Payload, layers.LayerTypeSCTP, gopacket.NoCopy).Layer(layers.LayerTypeSCTP)
+		}
+		network = ip4.NetworkFlow()
+	} else if nl := packet.NetworkLayer(); nl != nil {
+		network = nl.NetworkFlow()
+	}
+
+	sctp, ok := layer.(*layers.SCTP)
+	if !ok {
+		return nil
+	}
+	a.stats.Packets++
+
+	srcIP, dstIP := network.Src().String(), network.Dst().String()
+	src := net.JoinHostPort(srcIP, strconv.Itoa(int(sctp.SrcPort)))
+	dst := net.JoinHostPort(dstIP, strconv.Itoa(int(sctp.DstPort)))
+	flow := src + ">" + dst
+
+	chunks := sctp.Payload
+	for len(chunks) >= 4 {
+		length := int(binary.BigEndian.Uint16(chunks[2:4]))
+		if length < 4 || length > len(chunks) {
+			a.stats.Truncated++
+			break
+		}
+		if chunks[0] == sctpChunkData && length >= sctpDataHeader {
+			if payload, done := a.data(flow, chunks[:length]); done {
+				a.stats.Messages++
+				messages = append(messages, message{Time: ts, Src: src, Dst: dst, SrcIP: srcIP, DstIP: dstIP, Payload: payload})
+			}
+		}
+		padded := (length + 3) &^ 3
+		if padded >= len(chunks) {
+			break
+		}
+		chunks = chunks[padded:]
+	}
+	return
+}
+
+// data adds a DATA chunk and returns the user message it completes
+func (a *assembler) data(flow string, chunk []byte) (payload []byte, done bool) {
+	flags := chunk[1]
+	tsn := binary.BigEndian.Uint32(chunk[4:8])
+	stream := binary.BigEndian.Uint16(chunk[8:10])
+	ppid := binary.BigEndian.Uint32(chunk[12:16])
+	if a.ppid >= 0 && ppid != uint32(a.ppid) {
+		return nil, false
+	}
+	a.stats.Chunks++
+
+	if !a.remember(tsnKey{flow: flow, tsn: tsn}) {
+		a.stats.Duplicates++
+		return nil, false
+	}
+
+	data := chunk[sctpDataHeader:]
+	key := fragmentKey{flow: flow, stream: stream, unordered: flags&sctpFlagUnord != 0}
+	begin, end := flags&sctpFlagBegin != 0, flags&sctpFlagEnd != 0
+
+	if begin {
+		if _, ok := a.partial[key]; ok {
+			a.stats.Lost++
+			delete(a.partial, key)
+		}
+		if end {
+			return append([]byte(nil), data...), true
+		}
+		a.partial[key] = &fragments{nextTSN: tsn + 1, data: append([]byte(nil), data...)}
+		return nil, false
+	}
+
+	f, ok := a.partial[key]
+	if !ok || f.nextTSN != tsn {
+		if ok {
+			delete(a.partial, key)
+		}
+		a.stats.Lost++
+		return nil, false
+	}
+	f.data = append(f.data, data...)
+	f.nextTSN++
+	if !end {
+		return nil, false
+	}
+	delete(a.partial, key)
+	return f.data, true
+}
+
+// remember returns false for a DATA chunk seen before
+func (a *assembler) remember(key tsnKey) bool {
+	if a.seen[key] {
+		return false
+	}
+	a.seen[key] = true
+	a.order = append(a.order, key)
+	if len(a.order) > maxSeenTSNs {
+		delete(a.seen, a.order[0])
+		a.order = a.order[1:]
+	}
+	return true
+}
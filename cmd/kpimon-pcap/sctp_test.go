@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// dataChunk returns a DATA chunk padded to a multiple of 4 bytes
+func dataChunk(flags byte, tsn uint32, stream uint16, ppid uint32, payload string) []byte {
+	chunk := make([]byte, sctpDataHeader, sctpDataHeader+len(payload)+3)
+	chunk[0], chunk[1] = sctpChunkData, flags
+	binary.BigEndian.PutUint16(chunk[2:4], uint16(sctpDataHeader+len(payload)))
+	binary.BigEndian.PutUint32(chunk[4:8], tsn)
+	binary.BigEndian.PutUint16(chunk[8:10], stream)
+	binary.BigEndian.PutUint32(chunk[12:16], ppid)
+	chunk = append(chunk, payload...)
+	for len(chunk)%4 != 0 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// sackChunk is a SACK without gap blocks, bundled with DATA chunks
+var sackChunk = []byte{3, 0, 0, 16, 0, 0, 0, 1, 0, 0, 0xff, 0xff, 0, 0, 0, 0}
+
+// sctpPacket returns an IPv4 packet from the E2 node to the RIC carrying the
+// chunks
+func sctpPacket(t *testing.T, chunks ...[]byte) gopacket.Packet {
+	var payload []byte
+	for _, chunk := range chunks {
+		payload = append(payload, chunk...)
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolSCTP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	sctp := &layers.SCTP{SrcPort: 36422, DstPort: 36421, VerificationTag: 1}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, sctp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+}
+
+// flags of a DATA chunk carrying a whole user message
+const sctpFlagsWhole = sctpFlagBegin | sctpFlagEnd
+
+func TestAssembler(t *testing.T) {
+	truncated := dataChunk(sctpFlagsWhole, 2, 0, e2apPPID, "cut")
+	binary.BigEndian.PutUint16(truncated[2:4], 64)
+
+	for _, c := range []struct {
+		name     string
+		packets  [][][]byte
+		messages []string
+		stats    assemblerStats
+	}{
+		{
+			name: "bundled chunks",
+			packets: [][][]byte{{
+				dataChunk(sctpFlagsWhole, 1, 0, e2apPPID, "setup"),
+				sackChunk,
+				dataChunk(sctpFlagsWhole, 2, 1, e2apPPID, "indication"),
+			}},
+			messages: []string{"setup", "indication"},
+			stats:    assemblerStats{Packets: 1, Chunks: 2, Messages: 2},
+		},
+		{
+			name: "multi-fragment message",
+			packets: [][][]byte{
+				{dataChunk(sctpFlagBegin, 1, 0, e2apPPID, "indi")},
+				{dataChunk(0, 2, 0, e2apPPID, "cat")},
+				{dataChunk(sctpFlagEnd, 3, 0, e2apPPID, "ion")},
+			},
+			messages: []string{"indication"},
+			stats:    assemblerStats{Packets: 3, Chunks: 3, Messages: 1},
+		},
+		{
+			name: "missing fragment",
+			packets: [][][]byte{
+				{dataChunk(sctpFlagBegin, 1, 0, e2apPPID, "indi")},
+				{dataChunk(sctpFlagEnd, 3, 0, e2apPPID, "ion")},
+				{dataChunk(sctpFlagBegin, 4, 0, e2apPPID, "lost")},
+				{dataChunk(sctpFlagsWhole, 6, 0, e2apPPID, "indication")},
+			},
+			messages: []string{"indication"},
+			stats:    assemblerStats{Packets: 4, Chunks: 4, Messages: 1, Lost: 2},
+		},
+		{
+			name: "retransmitted TSNs",
+			packets: [][][]byte{
+				{dataChunk(sctpFlagBegin, 1, 0, e2apPPID, "indi")},
+				{dataChunk(sctpFlagBegin, 1, 0, e2apPPID, "indi")},
+				{dataChunk(sctpFlagEnd, 2, 0, e2apPPID, "cation")},
+				{dataChunk(sctpFlagEnd, 2, 0, e2apPPID, "cation")},
+			},
+			messages: []string{"indication"},
+			stats:    assemblerStats{Packets: 4, Chunks: 4, Messages: 1, Duplicates: 2},
+		},
+		{
+			name:     "truncated chunk length",
+			packets:  [][][]byte{{dataChunk(sctpFlagsWhole, 1, 0, e2apPPID, "setup"), truncated}},
+			messages: []string{"setup"},
+			stats:    assemblerStats{Packets: 1, Chunks: 1, Messages: 1, Truncated: 1},
+		},
+		{
+			name:     "other payload protocol",
+			packets:  [][][]byte{{dataChunk(sctpFlagsWhole, 1, 0, 60, "s1ap"), dataChunk(sctpFlagsWhole, 2, 0, e2apPPID, "e2ap")}},
+			messages: []string{"e2ap"},
+			stats:    assemblerStats{Packets: 1, Chunks: 1, Messages: 1},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			a := newAssembler(e2apPPID)
+			at := time.Unix(1600000000, 0)
+			var messages []string
+			for i, chunks := range c.packets {
+				for _, m := range a.add(sctpPacket(t, chunks...), at.Add(time.Duration(i)*time.Second)) {
+					if m.Src != "10.0.0.1:36422" || m.Dst != "10.0.0.2:36421" || m.SrcIP != "10.0.0.1" || !m.Time.Equal(at.Add(time.Duration(i)*time.Second)) {
+						t.Errorf("got message %+v", m)
+					}
+					messages = append(messages, string(m.Payload))
+				}
+			}
+			if strings.Join(messages, ",") != strings.Join(c.messages, ",") {
+				t.Errorf("got messages %q, want %q", messages, c.messages)
+			}
+			if a.stats != c.stats {
+				t.Errorf("got stats %+v, want %+v", a.stats, c.stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package control
+
+import (
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go/alarm"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+const (
+	defaultAlarmManagedObject   = "RIC"
+	defaultAlarmApplication     = "kpimon"
+	defaultAlarmSpecificProblem = 8100
+)
+
+// ActiveAlarm is an alarm raised by kpimon and not cleared yet
+type ActiveAlarm struct {
+	SeriesLabels
+	ID              string    `json:"id"` //identifying info of the alarm
+	Source          string    `json:"source"`
+	Severity        string    `json:"severity"`
+	SpecificProblem int       `json:"specificProblem"`
+	Value           float64   `json:"value"`
+	Threshold       float64   `json:"threshold"`
+	Description     string    `json:"description"`
+	Raised          time.Time `json:"raised"`
+}
+
+// alarmer delivers raised and cleared alarms to the alarm system
+type alarmer interface {
+	raise(a *ActiveAlarm) error
+	clear(a *ActiveAlarm) error
+}
+
+// xappAlarmer delivers alarms through the xapp-frame alarm client
+type xappAlarmer struct {
+	client *xapp.AlarmClient
+}
+
+func newXappAlarmer() (*xappAlarmer, error) {
+	managedObject := os.Getenv("alarmManagedObject")
+	if managedObject == "" {
+		managedObject = defaultAlarmManagedObject
+	}
+	client, err := xapp.NewAlarmClient(managedObject, defaultAlarmApplication)
+	if err != nil {
+		return nil, err
+	}
+	return &xappAlarmer{client: client}, nil
+}
+
+func (x *xappAlarmer) raise(a *ActiveAlarm) error {
+	return x.client.Raise(x.client.NewAlarm(a.SpecificProblem, alarm.Severity(a.Severity), a.Description, a.ID))
+}
+
+func (x *xappAlarmer) clear(a *ActiveAlarm) error {
+	return x.client.Clear(x.client.NewAlarm(a.SpecificProblem, alarm.Severity(a.Severity), a.Description, a.ID))
+}
+
+// alarmManager keeps the active alarms and deduplicates raises and clears, an
+// alarm is raised once until it is cleared
+type alarmManager struct {
+	mu       sync.Mutex
+	alarmer  alarmer
+	active   map[string]*ActiveAlarm
+	onChange func(a *ActiveAlarm, raised bool) //called for every alarm raised or cleared
+}
+
+func newAlarmManager(a alarmer) *alarmManager {
+	return &alarmManager{alarmer: a, active: make(map[string]*ActiveAlarm)}
+}
+
+// raise reports whether the alarm is active, false when it could not be raised
+func (m *alarmManager) raise(a *ActiveAlarm) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.active[a.ID]; ok {
+		return true
+	}
+	if err := m.alarmer.raise(a); err != nil {
+		xapp.Logger.Error("Failed to raise alarm %s: %v", a.ID, err)
+		log.Printf("Failed to raise alarm %s: %v", a.ID, err)
+		return false
+	}
+	xapp.Logger.Warn("Alarm %s raised: %s", a.ID, a.Description)
+	log.Printf("Alarm %s raised: %s", a.ID, a.Description)
+	m.active[a.ID] = a
+	if m.onChange != nil {
+		m.onChange(a, true)
+	}
+	return true
+}
+
+// clear reports whether the alarm is cleared, false when it could not be cleared
+func (m *alarmManager) clear(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.active[id]
+	if !ok {
+		return true
+	}
+	if err := m.alarmer.clear(a); err != nil {
+		xapp.Logger.Error("Failed to clear alarm %s: %v", id, err)
+		log.Printf("Failed to clear alarm %s: %v", id, err)
+		return false
+	}
+	xapp.Logger.Info("Alarm %s cleared", id)
+	log.Printf("Alarm %s cleared", id)
+	delete(m.active, id)
+	if m.onChange != nil {
+		m.onChange(a, false)
+	}
+	return true
+}
+
+func (m *alarmManager) list() []ActiveAlarm {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alarms := make([]ActiveAlarm, 0, len(m.active))
+	for _, a := range m.active {
+		alarms = append(alarms, *a)
+	}
+	sort.Slice(alarms, func(i, j int) bool { return alarms[i].Raised.Before(alarms[j].Raised) })
+	return alarms
+}
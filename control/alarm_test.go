@@ -0,0 +1,89 @@
+package control
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeAlarmer records the alarms raised and cleared
+type fakeAlarmer struct {
+	raised  []*ActiveAlarm
+	cleared []*ActiveAlarm
+	err     error
+}
+
+func (f *fakeAlarmer) raise(a *ActiveAlarm) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.raised = append(f.raised, a)
+	return nil
+}
+
+func (f *fakeAlarmer) clear(a *ActiveAlarm) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.cleared = append(f.cleared, a)
+	return nil
+}
+
+func TestAlarmManager(t *testing.T) {
+	alarmer := &fakeAlarmer{}
+	m := newAlarmManager(alarmer)
+	var changes []string
+	m.onChange = func(a *ActiveAlarm, raised bool) {
+		if raised {
+			changes = append(changes, "raised "+a.ID)
+		} else {
+			changes = append(changes, "cleared "+a.ID)
+		}
+	}
+
+	at := time.Unix(1600000000, 0)
+	if !m.raise(&ActiveAlarm{ID: "b", Raised: at.Add(time.Second)}) || !m.raise(&ActiveAlarm{ID: "a", Raised: at}) {
+		t.Fatal("alarms not raised")
+	}
+	if !m.raise(&ActiveAlarm{ID: "a", Raised: at.Add(time.Minute)}) || len(alarmer.raised) != 2 {
+		t.Fatalf("raised %d alarms, want an active alarm raised once", len(alarmer.raised))
+	}
+	if alarms := m.list(); len(alarms) != 2 || alarms[0].ID != "a" || !alarms[0].Raised.Equal(at) || alarms[1].ID != "b" {
+		t.Fatalf("got alarms %+v, want them by the time raised first", alarms)
+	}
+
+	if !m.clear("unknown") || len(alarmer.cleared) != 0 {
+		t.Error("clearing an inactive alarm reached the alarm system")
+	}
+	if !m.clear("a") || len(alarmer.cleared) != 1 || alarmer.cleared[0].ID != "a" {
+		t.Fatalf("cleared %+v", alarmer.cleared)
+	}
+	if alarms := m.list(); len(alarms) != 1 || alarms[0].ID != "b" {
+		t.Errorf("got alarms %+v after clearing", alarms)
+	}
+	if len(changes) != 3 || changes[0] != "raised b" || changes[1] != "raised a" || changes[2] != "cleared a" {
+		t.Errorf("got changes %v", changes)
+	}
+}
+
+func TestAlarmManagerFailures(t *testing.T) {
+	alarmer := &fakeAlarmer{err: errors.New("alarm manager unavailable")}
+	m := newAlarmManager(alarmer)
+
+	if m.raise(&ActiveAlarm{ID: "a"}) || len(m.list()) != 0 {
+		t.Fatal("alarm active although raising it failed")
+	}
+	alarmer.err = nil
+	if !m.raise(&ActiveAlarm{ID: "a"}) || len(alarmer.raised) != 1 {
+		t.Fatal("alarm not raised again")
+	}
+
+	alarmer.err = errors.New("alarm manager unavailable")
+	if m.clear("a") || len(m.list()) != 1 {
+		t.Fatal("alarm inactive although clearing it failed")
+	}
+	alarmer.err = nil
+	if !m.clear("a") || len(m.list()) != 0 || len(alarmer.cleared) != 1 {
+		t.Error("alarm not cleared again")
+	}
+}
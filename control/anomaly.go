@@ -0,0 +1,295 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+const (
+	anomalyMethodEWMA     = "ewma"
+	anomalyMethodSeasonal = "seasonal"
+)
+
+const (
+	defaultAnomalySensitivity   = 3.0 //z-score beyond which a value is anomalous
+	defaultAnomalyAlpha         = 0.1 //weight of a new value in the baseline
+	defaultAnomalyWarmup        = 30  //values learned before a baseline is used
+	defaultAnomalySeasonPeriod  = 86400
+	defaultAnomalySeasonBuckets = 24
+	defaultAnomalyMaxSeries     = 5000
+	defaultAnomalySeriesTTL     = 604800 //seconds without a value before the baselines of a series are removed
+	anomalySaveInterval         = time.Minute
+	anomalyMinRelStdDev         = 0.01 //floor of the standard deviation relative to the mean, so that flat series are scored
+	anomalyMinStdDev            = 1e-6
+	anomalySpecificProblem      = 8101
+)
+
+// AnomalyEvent is a KPI value that deviates from the baseline of its series
+type AnomalyEvent struct {
+	SeriesLabels
+	Time     time.Time `json:"time"`
+	Value    float64   `json:"value"`
+	Expected float64   `json:"expected"`
+	StdDev   float64   `json:"stdDev"`
+	Score    float64   `json:"score"` //z-score of the value
+	Method   string    `json:"method"`
+}
+
+// baseline is an exponentially weighted mean and variance
+type baseline struct {
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+	Count    int     `json:"count"`
+}
+
+// anomalySeries is the detector state of one series, a single baseline for
+// EWMA or one baseline per bucket of the season
+type anomalySeries struct {
+	Labels    SeriesLabels `json:"labels"`
+	Baselines []baseline   `json:"baselines"`
+	Last      time.Time    `json:"last"`
+	Received  time.Time    `json:"received"` //of the last value, series are expired on the clock of the receiver
+}
+
+// anomalyDetector scores every cell and slice KPI against the baseline of its
+// series. The state is saved to a file periodically, so that the baselines
+// survive restarts.
+type anomalyDetector struct {
+	mu           sync.Mutex
+	method       string
+	sensitivity  float64
+	alpha        float64
+	warmup       int
+	season       time.Duration
+	buckets      int
+	maxSeries    int
+	ttl          time.Duration
+	measurements map[string]bool //measurements scored, all when empty
+	stateFile    string
+	series       map[string]*anomalySeries
+	skipped      uint64 //samples not scored because the series limit was reached
+	full         bool   //series limit reached, logged once until series expire
+	alarms       *alarmManager
+}
+
+// newAnomalyDetector returns nil when anomaly detection is not enabled
+func newAnomalyDetector(alarms *alarmManager) (*anomalyDetector, error) {
+	method := os.Getenv("anomalyDetection")
+	if method == "" {
+		return nil, nil
+	}
+	if method != anomalyMethodEWMA && method != anomalyMethodSeasonal {
+		return nil, errors.New("unknown anomaly detection method " + method)
+	}
+
+	d := &anomalyDetector{
+		method:       method,
+		sensitivity:  getEnvFloat("anomalySensitivity", defaultAnomalySensitivity),
+		alpha:        getEnvFloat("anomalyAlpha", defaultAnomalyAlpha),
+		warmup:       getEnvInt("anomalyWarmup", defaultAnomalyWarmup),
+		season:       time.Duration(getEnvInt("anomalySeasonPeriod", defaultAnomalySeasonPeriod)) * time.Second,
+		buckets:      1,
+		maxSeries:    getEnvInt("anomalyMaxSeries", defaultAnomalyMaxSeries),
+		ttl:          time.Duration(getEnvInt("anomalySeriesTTL", defaultAnomalySeriesTTL)) * time.Second,
+		measurements: make(map[string]bool),
+		stateFile:    os.Getenv("anomalyStateFile"),
+		series:       make(map[string]*anomalySeries),
+		alarms:       alarms,
+	}
+	if method == anomalyMethodSeasonal {
+		d.buckets = getEnvInt("anomalySeasonBuckets", defaultAnomalySeasonBuckets)
+	}
+	if d.alpha >= 1 {
+		return nil, errors.New("anomalyAlpha must be below 1")
+	}
+	for _, m := range strings.Split(os.Getenv("anomalyMeasurements"), ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			d.measurements[m] = true
+		}
+	}
+
+	if err := d.load(); err != nil {
+		xapp.Logger.Warn("Failed to load anomaly detector state: %v", err)
+		log.Printf("Failed to load anomaly detector state: %v", err)
+	}
+	d.expire(time.Now().Add(-d.ttl))
+	return d, nil
+}
+
+// detect scores the samples and learns them into the baselines. A value
+// beyond the sensitivity raises an alarm for its series, which is cleared by
+// the next normal value.
+func (d *anomalyDetector) detect(samples []kpiSample, received time.Time) (events []AnomalyEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, sample := range samples {
+		if sample.UeID != "" || (len(d.measurements) > 0 && !d.measurements[sample.Measurement]) {
+			continue
+		}
+		labels := sampleLabels(sample)
+		key := labels.key()
+		s, ok := d.series[key]
+		if !ok {
+			if len(d.series) >= d.maxSeries {
+				d.skipped++
+				if !d.full {
+					d.full = true
+					xapp.Logger.Warn("Anomaly detection is limited to %d series, new series are not scored", d.maxSeries)
+					log.Printf("Anomaly detection is limited to %d series, new series are not scored", d.maxSeries)
+				}
+				continue
+			}
+			s = &anomalySeries{Labels: labels, Baselines: make([]baseline, d.buckets)}
+			d.series[key] = s
+		}
+		if !sample.Time.After(s.Last) {
+			continue
+		}
+		s.Last = sample.Time
+		s.Received = received
+
+		b := &s.Baselines[d.bucket(sample.Time)]
+		id := "anomaly:" + labels.id()
+		if b.Count >= d.warmup {
+			stdDev := math.Max(math.Sqrt(b.Variance), math.Max(math.Abs(b.Mean)*anomalyMinRelStdDev, anomalyMinStdDev))
+			score := (sample.Value - b.Mean) / stdDev
+			if math.Abs(score) >= d.sensitivity {
+				event := AnomalyEvent{SeriesLabels: labels, Time: sample.Time, Value: sample.Value, Expected: b.Mean, StdDev: stdDev, Score: score, Method: d.method}
+				events = append(events, event)
+				d.alarms.raise(&ActiveAlarm{
+					SeriesLabels:    labels,
+					ID:              id,
+					Source:          "anomaly",
+					Severity:        "WARNING",
+					SpecificProblem: anomalySpecificProblem,
+					Value:           sample.Value,
+					Threshold:       b.Mean,
+					Description:     fmt.Sprintf("%s: %g deviates from the expected %g by %.1f standard deviations", sample.Measurement, sample.Value, b.Mean, score),
+					Raised:          sample.Time,
+				})
+			} else {
+				d.alarms.clear(id)
+			}
+		}
+		b.learn(sample.Value, d.alpha)
+	}
+	return
+}
+
+// expire removes the series without a value received since cutoff and the
+// alarms raised for them
+func (d *anomalyDetector) expire(cutoff time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, s := range d.series {
+		if s.Received.Before(cutoff) {
+			delete(d.series, key)
+			d.alarms.clear("anomaly:" + s.Labels.id())
+		}
+	}
+	if len(d.series) < d.maxSeries {
+		d.full = false
+	}
+}
+
+// stats returns the number of series and of samples skipped at the series limit
+func (d *anomalyDetector) stats() (series int, skipped uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.series), d.skipped
+}
+
+// bucket returns the baseline of the season a time falls into
+func (d *anomalyDetector) bucket(t time.Time) int {
+	if d.buckets == 1 {
+		return 0
+	}
+	offset := time.Duration(t.UnixNano()) % d.season
+	return int(offset * time.Duration(d.buckets) / d.season)
+}
+
+func (b *baseline) learn(value float64, alpha float64) {
+	if b.Count == 0 {
+		b.Mean = value
+	} else {
+		diff := value - b.Mean
+		b.Mean += alpha * diff
+		b.Variance = (1 - alpha) * (b.Variance + alpha*diff*diff)
+	}
+	b.Count++
+}
+
+func (d *anomalyDetector) load() error {
+	if d.stateFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(d.stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var series []*anomalySeries
+	if err := json.Unmarshal(data, &series); err != nil {
+		return err
+	}
+	for _, s := range series {
+		if len(s.Baselines) != d.buckets {
+			continue //saved with another method or season
+		}
+		if s.Received.IsZero() {
+			s.Received = s.Last //saved without the receive time
+		}
+		d.series[s.Labels.key()] = s
+	}
+	return nil
+}
+
+// save writes the state to a temporary file that replaces the state file
+func (d *anomalyDetector) save() error {
+	if d.stateFile == "" {
+		return nil
+	}
+	d.mu.Lock()
+	series := make([]*anomalySeries, 0, len(d.series))
+	for _, s := range d.series {
+		series = append(series, s)
+	}
+	data, err := json.Marshal(series)
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := d.stateFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.stateFile)
+}
+
+// saveLoop expires the stale series and saves the state periodically
+func (d *anomalyDetector) saveLoop() {
+	ticker := time.NewTicker(anomalySaveInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		d.expire(now.Add(-d.ttl))
+		if err := d.save(); err != nil {
+			xapp.Logger.Error("Failed to save anomaly detector state: %v", err)
+			log.Printf("Failed to save anomaly detector state: %v", err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package control
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAnomalyDetectorExpire(t *testing.T) {
+	defer setEnv(map[string]string{"anomalyDetection": anomalyMethodEWMA, "anomalyWarmup": "5", "anomalyMaxSeries": "2"})()
+	alarmer := &fakeAlarmer{}
+	d, err := newAnomalyDetector(newAlarmManager(alarmer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(1600000000, 0)
+	for i := 0; i < 10; i++ {
+		at := start.Add(time.Duration(i) * time.Second)
+		d.detect([]kpiSample{{RanName: "gnb-1", CellID: "cell-1", Measurement: "DRB.UEThpDl", Value: 10 + float64(i%2), Time: at}}, at)
+		// the clock of the node of cell-2 is an hour behind the receiver
+		d.detect([]kpiSample{{RanName: "gnb-1", CellID: "cell-2", Measurement: "DRB.UEThpDl", Value: 10 + float64(i%2), Time: at}}, at.Add(time.Hour))
+	}
+	if events := d.detect([]kpiSample{{RanName: "gnb-1", CellID: "cell-1", Measurement: "DRB.UEThpDl", Value: 100, Time: start.Add(time.Minute)}}, start.Add(time.Minute)); len(events) != 1 || len(alarmer.raised) != 1 {
+		t.Fatalf("got events %+v", events)
+	}
+
+	d.detect([]kpiSample{{RanName: "gnb-1", CellID: "cell-3", Measurement: "DRB.UEThpDl", Value: 10, Time: start}}, start)
+	if series, skipped := d.stats(); series != 2 || skipped != 1 {
+		t.Errorf("got %d series, %d skipped at the limit", series, skipped)
+	}
+
+	d.expire(start.Add(30 * time.Minute))
+	if series, _ := d.stats(); series != 1 {
+		t.Errorf("got %d series after expiring", series)
+	}
+	if len(alarmer.cleared) != 1 || alarmer.cleared[0].CellID != "cell-1" {
+		t.Errorf("got cleared alarms %+v", alarmer.cleared)
+	}
+
+	d.detect([]kpiSample{{RanName: "gnb-1", CellID: "cell-3", Measurement: "DRB.UEThpDl", Value: 10, Time: start}}, start)
+	if series, skipped := d.stats(); series != 2 || skipped != 1 {
+		t.Errorf("got %d series, %d skipped after expiring", series, skipped)
+	}
+}
+
+func TestAnomalyDetectorEWMA(t *testing.T) {
+	defer setEnv(map[string]string{"anomalyDetection": anomalyMethodEWMA, "anomalyWarmup": "10", "anomalyMeasurements": "DRB.UEThpDl, RRU.PrbUsedDl"})()
+	alarmer := &fakeAlarmer{}
+	d, err := newAnomalyDetector(newAlarmManager(alarmer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(1600000000, 0)
+	sample := func(i int, cellID string, value float64) kpiSample {
+		return kpiSample{RanName: "gnb-1", CellID: cellID, Measurement: "DRB.UEThpDl", Value: value, Time: start.Add(time.Duration(i) * time.Second)}
+	}
+	for i := 0; i < 10; i++ {
+		if events := d.detect([]kpiSample{sample(i, "flat", 10), sample(i, "noisy", 10+float64(i%2))}, start); len(events) != 0 {
+			t.Fatalf("got events %+v while warming up", events)
+		}
+	}
+
+	tests := []struct {
+		sample  kpiSample
+		anomaly bool
+	}{
+		{sample(10, "flat", 10), false},
+		{sample(10, "noisy", 11), false},
+		{sample(11, "flat", 1000), true},
+		{sample(11, "noisy", 10.5), false},
+		{sample(12, "noisy", 30), true},
+		{sample(12, "flat", 2000), true}, //1000 is learned, the baseline is still far below
+		{sample(13, "flat", 10), false},
+		{sample(5, "noisy", 1000), false}, //older than the last value
+		{kpiSample{RanName: "gnb-1", CellID: "flat", UeID: "17", Measurement: "DRB.UEThpDl", Value: 1000, Time: start.Add(time.Minute)}, false},
+		{kpiSample{RanName: "gnb-1", CellID: "flat", Measurement: "RRU.PrbAvailDl", Value: 1000, Time: start.Add(time.Minute)}, false},
+	}
+	for _, test := range tests {
+		events := d.detect([]kpiSample{test.sample}, start)
+		if (len(events) == 1) != test.anomaly {
+			t.Errorf("%s = %g: got events %+v", test.sample.CellID, test.sample.Value, events)
+		}
+	}
+
+	if len(alarmer.raised) != 2 || len(alarmer.cleared) != 1 {
+		t.Fatalf("raised %d, cleared %d alarms", len(alarmer.raised), len(alarmer.cleared))
+	}
+	a := alarmer.raised[0]
+	if a.ID != "anomaly:gnb-1/flat/DRB.UEThpDl" || a.Source != "anomaly" || a.Value != 1000 || a.Threshold != 10 || a.SpecificProblem != anomalySpecificProblem {
+		t.Errorf("raised %+v", a)
+	}
+	if alarmer.cleared[0].ID != a.ID {
+		t.Errorf("cleared %+v", alarmer.cleared[0])
+	}
+}
+
+func TestAnomalyDetectorSeasonal(t *testing.T) {
+	defer setEnv(map[string]string{"anomalyDetection": anomalyMethodSeasonal, "anomalyWarmup": "3", "anomalySeasonPeriod": "86400", "anomalySeasonBuckets": "24"})()
+	d, err := newAnomalyDetector(newAlarmManager(&fakeAlarmer{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	midnight := time.Unix(1600041600, 0) //a multiple of the season
+	for offset, want := range map[time.Duration]int{
+		0:                             0,
+		90 * time.Minute:              1,
+		23*time.Hour + 59*time.Minute: 23,
+		24 * time.Hour:                0,
+		36 * time.Hour:                12,
+	} {
+		if got := d.bucket(midnight.Add(offset)); got != want {
+			t.Errorf("bucket of midnight + %v: got %d, want %d", offset, got, want)
+		}
+	}
+
+	sample := func(day int, hour int, value float64) kpiSample {
+		at := midnight.Add(time.Duration(day)*24*time.Hour + time.Duration(hour)*time.Hour)
+		return kpiSample{RanName: "gnb-1", CellID: "cell-1", Measurement: "RRU.PrbUsedDl", Value: value, Time: at}
+	}
+	for day := 0; day < 3; day++ {
+		d.detect([]kpiSample{sample(day, 3, 10), sample(day, 12, 90)}, midnight)
+	}
+	if events := d.detect([]kpiSample{sample(3, 3, 10), sample(3, 12, 90)}, midnight); len(events) != 0 {
+		t.Errorf("got events %+v for the usual values of each hour", events)
+	}
+	if events := d.detect([]kpiSample{sample(4, 3, 90)}, midnight); len(events) != 1 || events[0].Expected != 10 {
+		t.Errorf("got events %+v for the midday value at night", events)
+	}
+}
+
+func TestAnomalyDetectorSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anomaly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.json")
+
+	restore := setEnv(map[string]string{"anomalyDetection": anomalyMethodEWMA, "anomalyStateFile": stateFile})
+	d, err := newAnomalyDetector(newAlarmManager(&fakeAlarmer{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		d.detect([]kpiSample{{RanName: "gnb-1", CellID: "cell-1", Measurement: "RRU.PrbUsedDl", Value: float64(10 + i), Time: now.Add(time.Duration(i-10) * time.Second)}}, now)
+		stale := now.Add(-30 * 24 * time.Hour)
+		d.detect([]kpiSample{{RanName: "gnb-1", CellID: "cell-2", Measurement: "RRU.PrbUsedDl", Value: 50, Time: now}}, stale)
+	}
+	if err := d.save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stateFile + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary state file left: %v", err)
+	}
+
+	loaded, err := newAnomalyDetector(newAlarmManager(&fakeAlarmer{}))
+	restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.series) != 1 {
+		t.Fatalf("loaded %d series, want the stale one expired", len(loaded.series))
+	}
+	for key, s := range loaded.series {
+		saved := d.series[key]
+		if saved == nil || !reflect.DeepEqual(s.Baselines, saved.Baselines) || !s.Last.Equal(saved.Last) || !s.Received.Equal(saved.Received) || s.Labels != saved.Labels {
+			t.Errorf("loaded %+v, saved %+v", s, saved)
+		}
+	}
+
+	defer setEnv(map[string]string{"anomalyDetection": anomalyMethodSeasonal, "anomalyStateFile": stateFile})()
+	seasonal, err := newAnomalyDetector(newAlarmManager(&fakeAlarmer{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seasonal.series) != 0 {
+		t.Errorf("loaded %d EWMA series into the seasonal detector", len(seasonal.series))
+	}
+}
@@ -0,0 +1,251 @@
+package control
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const apiPrefix = "/ric/v1/kpimon"
+
+func (c *Control) injectRoutes() {
+	xapp.Resource.InjectRoute(apiPrefix+"/loss", c.getLossStats, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/pipeline", c.getPipelineStats, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/spool", c.getSpoolStats, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/subscriptions", c.getSubscriptions, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/nodes", c.getNodes, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/nodes/{ranName}/cells", c.getCells, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/nodes/{ranName}/cells/{cellID}", c.getCell, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/nodes/{ranName}/cells/{cellID}/slices/{sliceID}", c.getSlice, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/nodes/{ranName}/ues/{ueID}", c.getUe, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/series", c.getSeries, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/series/query", c.querySeries, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/stream", c.stream.serve, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/topology", c.getTopology, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/clock", c.getClockSkew, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/alarms", c.getAlarms, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/reports/subscriptions", c.getReportSubscriptions, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/catalog", c.getCatalog, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/catalog/nodes/{ranName}", c.getMeasurementMappings, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/catalog/nodes/{ranName}", c.putMeasurementMappings, "PUT")
+	xapp.Resource.InjectRoute(apiPrefix+"/topology/{ranName}", c.getNodeTopology, "GET")
+	xapp.Resource.InjectRoute(apiPrefix+"/schemas/avro/{name}", c.getAvroSchema, "GET")
+	xapp.Resource.InjectRoute("/metrics", promhttp.Handler().ServeHTTP, "GET")
+}
+
+func (c *Control) getLossStats(w http.ResponseWriter, r *http.Request) {
+	stats := c.indSN.lossStats()
+	sort.Slice(stats, func(i, j int) bool { return stats[i].RanName < stats[j].RanName })
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (c *Control) getPipelineStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, c.pipe.stats())
+}
+
+func (c *Control) getSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subs := c.subs.list()
+	sort.Slice(subs, func(i, j int) bool { return subs[i].RanName < subs[j].RanName })
+	writeJSON(w, http.StatusOK, subs)
+}
+
+func (c *Control) getCatalog(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, c.catalog.list())
+}
+
+func (c *Control) getAvroSchema(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	schema, ok := avroSchemas[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown schema "+name)
+		return
+	}
+	writeJSON(w, http.StatusOK, json.RawMessage(schema))
+}
+
+func (c *Control) getMeasurementMappings(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, c.catalog.getMappings(mux.Vars(r)["ranName"]))
+}
+
+// putMeasurementMappings replaces the MeasurementTypeID mapping of a node
+func (c *Control) putMeasurementMappings(w http.ResponseWriter, r *http.Request) {
+	var mappings []MeasurementMapping
+	if err := json.NewDecoder(r.Body).Decode(&mappings); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid measurement mapping: "+err.Error())
+		return
+	}
+	for _, mapping := range mappings {
+		if mapping.Name == "" {
+			writeError(w, http.StatusBadRequest, "measurement mapping without name")
+			return
+		}
+	}
+	ranName := mux.Vars(r)["ranName"]
+	c.catalog.setMappings(ranName, mappings)
+	writeJSON(w, http.StatusOK, c.catalog.getMappings(ranName))
+}
+
+func (c *Control) getAlarms(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, c.alarms.list())
+}
+
+func (c *Control) getSpoolStats(w http.ResponseWriter, r *http.Request) {
+	if c.influx == nil || c.influx.spool == nil {
+		writeError(w, http.StatusNotFound, "spooling is disabled")
+		return
+	}
+	writeJSON(w, http.StatusOK, c.influx.spool.stats())
+}
+
+func (c *Control) getReportSubscriptions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, c.publisher.list())
+}
+
+func (c *Control) getClockSkew(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, c.clock.list())
+}
+
+func (c *Control) getTopology(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, c.topology.list())
+}
+
+func (c *Control) getNodeTopology(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	node, ok := c.topology.get(vars["ranName"])
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown node "+vars["ranName"])
+		return
+	}
+	writeJSON(w, http.StatusOK, node)
+}
+
+func (c *Control) getNodes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, c.latest.listNodes())
+}
+
+func (c *Control) getCells(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cells, ok := c.latest.listCells(vars["ranName"])
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown node "+vars["ranName"])
+		return
+	}
+	writeJSON(w, http.StatusOK, cells)
+}
+
+func (c *Control) getCell(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cell, ok := c.latest.cell(vars["ranName"], vars["cellID"])
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown cell "+vars["cellID"]+" of node "+vars["ranName"])
+		return
+	}
+	writeJSON(w, http.StatusOK, cell)
+}
+
+func (c *Control) getSlice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	slice, ok := c.latest.slice(vars["ranName"], vars["cellID"], vars["sliceID"])
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown slice "+vars["sliceID"]+" of cell "+vars["cellID"]+" of node "+vars["ranName"])
+		return
+	}
+	writeJSON(w, http.StatusOK, slice)
+}
+
+func (c *Control) getUe(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ue, ok := c.latest.ue(vars["ranName"], vars["ueID"])
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown UE "+vars["ueID"]+" of node "+vars["ranName"])
+		return
+	}
+	writeJSON(w, http.StatusOK, ue)
+}
+
+func (c *Control) getSeries(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, c.series.list(querySeriesFilter(r)))
+}
+
+// querySeries returns the points of the matching series, from and to are
+// RFC3339 times, unix seconds or durations relative to now such as -15m
+func (c *Control) querySeries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	now := time.Now()
+
+	from, err := parseTimeParam(query.Get("from"), now.Add(-c.series.window), now)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+	to, err := parseTimeParam(query.Get("to"), now, now)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+
+	var step time.Duration
+	if str := query.Get("step"); str != "" {
+		step, err = time.ParseDuration(str)
+		if err != nil || step <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid step "+str)
+			return
+		}
+	}
+
+	agg := query.Get("agg")
+	if agg == "" {
+		agg = "avg"
+	}
+
+	data, err := c.series.query(querySeriesFilter(r), from, to, step, agg)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, data)
+}
+
+func querySeriesFilter(r *http.Request) seriesFilter {
+	query := r.URL.Query()
+	return seriesFilter{
+		RanName:     query.Get("node"),
+		CellID:      query.Get("cell"),
+		UeID:        query.Get("ue"),
+		SliceID:     query.Get("slice"),
+		Measurement: query.Get("measurement"),
+	}
+}
+
+func parseTimeParam(str string, def time.Time, now time.Time) (time.Time, error) {
+	if str == "" {
+		return def, nil
+	}
+	if d, err := time.ParseDuration(str); err == nil {
+		return now.Add(d), nil
+	}
+	if sec, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, str)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		xapp.Logger.Error("Failed to encode REST response: %v", err)
+		log.Printf("Failed to encode REST response: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package control
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// Avro schema of the KPI records written to Kafka
+const KPIRecordAvroSchema = `{
+  "type": "record",
+  "name": "KPIRecord",
+  "namespace": "org.oran.kpimon",
+  "fields": [
+    {"name": "ranName", "type": "string"},
+    {"name": "measurement", "type": "string"},
+    {"name": "unit", "type": "string"},
+    {"name": "value", "type": "double"},
+    {"name": "time", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "cellId", "type": "string"},
+    {"name": "ueId", "type": "string"},
+    {"name": "plmnId", "type": "string"},
+    {"name": "sliceId", "type": "string"},
+    {"name": "fiveQI", "type": "long"},
+    {"name": "qci", "type": "long"},
+    {"name": "nodeId", "type": "string"},
+    {"name": "duId", "type": "string"},
+    {"name": "cuUpId", "type": "string"}
+  ]
+}`
+
+// Avro schema of the indication records written to Kafka, self-contained with
+// the KPIRecord definition inlined
+const KPIIndicationAvroSchema = `{
+  "type": "record",
+  "name": "KPIIndication",
+  "namespace": "org.oran.kpimon",
+  "fields": [
+    {"name": "ranName", "type": "string"},
+    {"name": "received", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "start", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "granulPeriod", "type": "long"},
+    {"name": "requestId", "type": "int"},
+    {"name": "indicationSN", "type": "int"},
+    {"name": "records", "type": {"type": "array", "items": ` + KPIRecordAvroSchema + `}}
+  ]
+}`
+
+// avroSchemas are the Avro schemas served by the REST API, for registering
+// them in a schema registry
+var avroSchemas = map[string]string{
+	"KPIRecord":     KPIRecordAvroSchema,
+	"KPIIndication": KPIIndicationAvroSchema,
+}
+
+// avroSample appends the Avro binary encoding of a sample as a KPIRecord
+func avroSample(buf []byte, sample kpiSample) []byte {
+	buf = avroString(buf, sample.RanName)
+	buf = avroString(buf, sample.Measurement)
+	buf = avroString(buf, sample.Unit)
+	buf = avroDouble(buf, sample.Value)
+	buf = avroLong(buf, avroMillis(sample.Time))
+	for _, s := range []string{sample.CellID, sample.UeID, sample.PLMNID, sample.SliceID} {
+		buf = avroString(buf, s)
+	}
+	buf = avroLong(buf, sample.FiveQI)
+	buf = avroLong(buf, sample.QCI)
+	for _, s := range []string{sample.NodeID, sample.DUID, sample.CUUPID} {
+		buf = avroString(buf, s)
+	}
+	return buf
+}
+
+// avroIndication appends the Avro binary encoding of an indication as a
+// KPIIndication
+func avroIndication(buf []byte, ind *indication) []byte {
+	buf = avroString(buf, ind.RanName)
+	buf = avroLong(buf, avroMillis(ind.Received))
+	buf = avroLong(buf, avroMillis(indicationTime(ind)))
+	buf = avroLong(buf, int64(ind.Granul/time.Millisecond))
+	buf = avroLong(buf, int64(ind.Msg.RequestID))
+	buf = avroLong(buf, int64(ind.Msg.IndSN))
+	if len(ind.Samples) > 0 {
+		buf = avroLong(buf, int64(len(ind.Samples)))
+		for _, sample := range ind.Samples {
+			buf = avroSample(buf, sample)
+		}
+	}
+	return avroLong(buf, 0) //end of the array blocks
+}
+
+func avroMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// avroLong appends a zig-zag varint, which is also the encoding of int
+func avroLong(buf []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func avroString(buf []byte, s string) []byte {
+	buf = avroLong(buf, int64(len(s)))
+	return append(buf, s...)
+}
+
+func avroDouble(buf []byte, v float64) []byte {
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(v))
+	return append(buf, tmp[:]...)
+}
@@ -0,0 +1,116 @@
+package control
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// avroDecode decodes a value of the schema types the encoders use: records,
+// arrays, strings, doubles, ints and longs
+func avroDecode(schema interface{}, buf []byte) (interface{}, []byte, error) {
+	switch s := schema.(type) {
+	case string:
+		switch s {
+		case "string":
+			n, rest, err := avroDecodeLong(buf)
+			if err != nil || int64(len(rest)) < n {
+				return nil, nil, errors.New("short string")
+			}
+			return string(rest[:n]), rest[n:], nil
+		case "double":
+			if len(buf) < 8 {
+				return nil, nil, errors.New("short double")
+			}
+			return math.Float64frombits(binary.LittleEndian.Uint64(buf)), buf[8:], nil
+		case "int", "long":
+			return avroDecodeLong(buf)
+		}
+	case map[string]interface{}:
+		switch s["type"] {
+		case "record":
+			record := make(map[string]interface{})
+			for _, f := range s["fields"].([]interface{}) {
+				field := f.(map[string]interface{})
+				v, rest, err := avroDecode(field["type"], buf)
+				if err != nil {
+					return nil, nil, err
+				}
+				record[field["name"].(string)] = v
+				buf = rest
+			}
+			return record, buf, nil
+		case "array":
+			var items []interface{}
+			for {
+				n, rest, err := avroDecodeLong(buf)
+				if err != nil {
+					return nil, nil, err
+				}
+				buf = rest
+				if n == 0 {
+					return items, buf, nil
+				}
+				for ; n > 0; n-- {
+					v, rest, err := avroDecode(s["items"], buf)
+					if err != nil {
+						return nil, nil, err
+					}
+					items = append(items, v)
+					buf = rest
+				}
+			}
+		default:
+			return avroDecode(s["type"], buf) //logical type
+		}
+	}
+	return nil, nil, errors.New("unsupported schema")
+}
+
+func avroDecodeLong(buf []byte) (int64, []byte, error) {
+	v, n := binary.Varint(buf)
+	if n <= 0 {
+		return 0, nil, errors.New("invalid long")
+	}
+	return v, buf[n:], nil
+}
+
+func TestAvroSchemas(t *testing.T) {
+	at := time.Unix(1600000000, 0)
+	sample := kpiSample{RanName: "gnb-1", Measurement: "DRB.UEThpDl", Unit: "kbit/s", Value: 12.5, Time: at, CellID: "cell-1", SliceID: "1-010203", FiveQI: 9, NodeID: "gnb_001_001_00000001"}
+	ind := &indication{RanName: "gnb-1", Received: at, Granul: time.Second, Msg: &DecodedIndicationMessage{RequestID: 1001, IndSN: 7}, Samples: []kpiSample{sample, sample}}
+
+	tests := []struct {
+		name    string
+		encoded []byte
+		check   func(v map[string]interface{}) bool
+	}{
+		{"KPIRecord", avroSample(nil, sample), func(v map[string]interface{}) bool {
+			return v["measurement"] == "DRB.UEThpDl" && v["value"] == 12.5 && v["fiveQI"] == int64(9) && v["cuUpId"] == ""
+		}},
+		{"KPIIndication", avroIndication(nil, ind), func(v map[string]interface{}) bool {
+			records := v["records"].([]interface{})
+			return v["requestId"] == int64(1001) && v["indicationSN"] == int64(7) && len(records) == 2 &&
+				records[1].(map[string]interface{})["nodeId"] == "gnb_001_001_00000001"
+		}},
+	}
+	for _, test := range tests {
+		var schema interface{}
+		if err := json.Unmarshal([]byte(avroSchemas[test.name]), &schema); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		v, rest, err := avroDecode(schema, test.encoded)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if len(rest) != 0 {
+			t.Errorf("%s: %d bytes left after decoding", test.name, len(rest))
+		}
+		if record := v.(map[string]interface{}); !test.check(record) {
+			t.Errorf("%s: decoded %v", test.name, record)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	valueTypeInteger = "integer"
+	valueTypeReal    = "real"
+)
+
+const (
+	kindCumulative = "cumulative" //counted over the granularity period
+	kindGauge      = "gauge"      //sampled or averaged over the granularity period
+)
+
+// defaultMappingNode holds the ID to name mapping used for nodes without
+// their own mapping
+const defaultMappingNode = "*"
+
+type MeasurementDef struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Unit        string   `json:"unit"`
+	ValueType   string   `json:"valueType"`
+	Kind        string   `json:"kind"`
+	Aliases     []string `json:"aliases,omitempty"`
+}
+
+// MeasurementMapping is a MeasurementTypeID advertised by a node, with the
+// factor that converts the node's values to the unit of the catalog
+type MeasurementMapping struct {
+	ID    int64   `json:"id"`
+	Name  string  `json:"name"`
+	Scale float64 `json:"scale,omitempty"`
+}
+
+type catalogFile struct {
+	Measurements []MeasurementDef                `json:"measurements"`
+	Nodes        map[string][]MeasurementMapping `json:"nodes"`
+}
+
+// measurements of 3GPP TS 28.552 known without configuration
+var builtinMeasurements = []MeasurementDef{
+	{Name: "RRU.PrbAvailDl", Description: "Mean number of PRBs available for downlink", Unit: "PRB", ValueType: valueTypeInteger, Kind: kindGauge},
+	{Name: "RRU.PrbAvailUl", Description: "Mean number of PRBs available for uplink", Unit: "PRB", ValueType: valueTypeInteger, Kind: kindGauge},
+	{Name: "RRU.PrbUsedDl", Description: "Mean number of PRBs used for downlink", Unit: "PRB", ValueType: valueTypeInteger, Kind: kindGauge},
+	{Name: "RRU.PrbUsedUl", Description: "Mean number of PRBs used for uplink", Unit: "PRB", ValueType: valueTypeInteger, Kind: kindGauge},
+	{Name: "RRU.PrbTotDl", Description: "Total usage of downlink PRBs", Unit: "%", ValueType: valueTypeInteger, Kind: kindGauge},
+	{Name: "RRU.PrbTotUl", Description: "Total usage of uplink PRBs", Unit: "%", ValueType: valueTypeInteger, Kind: kindGauge},
+	{Name: "RRU.MaxLayerDlMimo", Description: "Maximum number of downlink MIMO layers", Unit: "layers", ValueType: valueTypeInteger, Kind: kindGauge},
+	{Name: "DRB.PdcpSduVolumeDL", Description: "Downlink PDCP SDU data volume", Unit: "Mbit", ValueType: valueTypeInteger, Kind: kindCumulative, Aliases: []string{"DRB.PdcpSduVolumeDl"}},
+	{Name: "DRB.PdcpSduVolumeUL", Description: "Uplink PDCP SDU data volume", Unit: "Mbit", ValueType: valueTypeInteger, Kind: kindCumulative, Aliases: []string{"DRB.PdcpSduVolumeUl"}},
+	{Name: "DRB.UEThpDl", Description: "Average downlink UE throughput", Unit: "kbit/s", ValueType: valueTypeReal, Kind: kindGauge},
+	{Name: "DRB.UEThpUl", Description: "Average uplink UE throughput", Unit: "kbit/s", ValueType: valueTypeReal, Kind: kindGauge},
+	{Name: "DRB.RlcSduDelayDl", Description: "Average delay of downlink RLC SDUs", Unit: "0.1ms", ValueType: valueTypeReal, Kind: kindGauge},
+	{Name: "DRB.AirIfDelayUl", Description: "Average uplink air interface delay", Unit: "0.1ms", ValueType: valueTypeReal, Kind: kindGauge},
+	{Name: "DRB.PacketLossRateUl", Description: "Uplink packet loss rate", Unit: "1e-6", ValueType: valueTypeInteger, Kind: kindGauge},
+	{Name: "DRB.MeanActiveUeDl", Description: "Mean number of UEs with active downlink DRBs", Unit: "UE", ValueType: valueTypeInteger, Kind: kindGauge},
+	{Name: "DRB.MeanActiveUeUl", Description: "Mean number of UEs with active uplink DRBs", Unit: "UE", ValueType: valueTypeInteger, Kind: kindGauge},
+	{Name: "DRB.EstabAtt.5QI", Description: "Number of DRB setup attempts", Unit: "count", ValueType: valueTypeInteger, Kind: kindCumulative},
+	{Name: "DRB.EstabSucc.5QI", Description: "Number of successful DRB setups", Unit: "count", ValueType: valueTypeInteger, Kind: kindCumulative},
+	{Name: "RRC.ConnMean", Description: "Mean number of RRC connections", Unit: "UE", ValueType: valueTypeInteger, Kind: kindGauge},
+	{Name: "RRC.ConnMax", Description: "Maximum number of RRC connections", Unit: "UE", ValueType: valueTypeInteger, Kind: kindGauge},
+	{Name: "RRC.ConnEstabAtt.Sum", Description: "Number of RRC connection establishment attempts", Unit: "count", ValueType: valueTypeInteger, Kind: kindCumulative},
+	{Name: "RRC.ConnEstabSucc.Sum", Description: "Number of successful RRC connection establishments", Unit: "count", ValueType: valueTypeInteger, Kind: kindCumulative},
+	{Name: "TB.TotNbrDl", Description: "Total number of downlink transport blocks", Unit: "count", ValueType: valueTypeInteger, Kind: kindCumulative},
+	{Name: "TB.ErrTotalNbrDl", Description: "Number of erroneous downlink transport blocks", Unit: "count", ValueType: valueTypeInteger, Kind: kindCumulative},
+	{Name: "TB.TotNbrUl", Description: "Total number of uplink transport blocks", Unit: "count", ValueType: valueTypeInteger, Kind: kindCumulative},
+	{Name: "TB.ErrTotalNbrUl", Description: "Number of erroneous uplink transport blocks", Unit: "count", ValueType: valueTypeInteger, Kind: kindCumulative},
+	{Name: "PEE.AvgPower", Description: "Average power consumed", Unit: "W", ValueType: valueTypeReal, Kind: kindGauge},
+	{Name: "PEE.Energy", Description: "Energy consumed", Unit: "kWh", ValueType: valueTypeReal, Kind: kindCumulative},
+}
+
+// measurementCatalog resolves the measurements reported by the nodes to the
+// canonical names and units of the catalog
+type measurementCatalog struct {
+	mu         sync.RWMutex
+	defs       map[string]*MeasurementDef
+	aliases    map[string]string                       //lower case name or alias to canonical name
+	mappings   map[string]map[int64]MeasurementMapping //ID mapping by RAN name
+	advertised map[string]map[int64]MeasurementMapping //ID mapping advertised by the nodes, by RAN name
+}
+
+func newMeasurementCatalog() (*measurementCatalog, error) {
+	c := &measurementCatalog{
+		defs:       make(map[string]*MeasurementDef),
+		aliases:    make(map[string]string),
+		mappings:   make(map[string]map[int64]MeasurementMapping),
+		advertised: make(map[string]map[int64]MeasurementMapping),
+	}
+	for i := range builtinMeasurements {
+		c.define(builtinMeasurements[i])
+	}
+
+	file := os.Getenv("measCatalogFile")
+	if file == "" {
+		return c, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config catalogFile
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	for _, def := range config.Measurements {
+		if err := validateMeasurement(def); err != nil {
+			return nil, err
+		}
+		c.define(def)
+	}
+	for ranName, mappings := range config.Nodes {
+		c.setMappings(ranName, mappings)
+	}
+	return c, nil
+}
+
+func validateMeasurement(def MeasurementDef) error {
+	if def.Name == "" {
+		return errors.New("measurement without name in catalog")
+	}
+	if def.ValueType != valueTypeInteger && def.ValueType != valueTypeReal {
+		return errors.New("illegal value type " + def.ValueType + " of measurement " + def.Name)
+	}
+	if def.Kind != kindCumulative && def.Kind != kindGauge {
+		return errors.New("illegal kind " + def.Kind + " of measurement " + def.Name)
+	}
+	return nil
+}
+
+// define adds a measurement, replacing a definition of the same name
+func (c *measurementCatalog) define(def MeasurementDef) {
+	c.defs[def.Name] = &def
+	c.aliases[strings.ToLower(def.Name)] = def.Name
+	for _, alias := range def.Aliases {
+		c.aliases[strings.ToLower(alias)] = def.Name
+	}
+}
+
+func (c *measurementCatalog) setMappings(ranName string, mappings []MeasurementMapping) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ids := make(map[int64]MeasurementMapping, len(mappings))
+	for _, mapping := range mappings {
+		ids[mapping.ID] = mapping
+	}
+	c.mappings[ranName] = ids
+}
+
+// advertise adds the MeasurementTypeIDs a node advertises in its RAN function
+// description. The configured mapping of the node takes precedence, it may
+// scale the values. E2 Setup reaches the E2 manager of the RIC rather than
+// kpimon, so the IDs are advertised by the E2 Setup Requests and RIC Service
+// Updates of captures only.
+func (c *measurementCatalog) advertise(ranName string, mappings []MeasurementMapping) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ids, ok := c.advertised[ranName]
+	if !ok {
+		ids = make(map[int64]MeasurementMapping, len(mappings))
+		c.advertised[ranName] = ids
+	}
+	for _, mapping := range mappings {
+		ids[mapping.ID] = mapping
+	}
+}
+
+// getMappings returns the configured mapping of a node together with the IDs
+// it advertised
+func (c *measurementCatalog) getMappings(ranName string) []MeasurementMapping {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	mappings := make([]MeasurementMapping, 0, len(c.mappings[ranName]))
+	for _, mapping := range c.mappings[ranName] {
+		mappings = append(mappings, mapping)
+	}
+	for id, mapping := range c.advertised[ranName] {
+		if _, ok := c.mappings[ranName][id]; !ok {
+			mappings = append(mappings, mapping)
+		}
+	}
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].ID < mappings[j].ID })
+	return mappings
+}
+
+func (c *measurementCatalog) list() []MeasurementDef {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	defs := make([]MeasurementDef, 0, len(c.defs))
+	for _, def := range c.defs {
+		defs = append(defs, *def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// lookup returns the definition of a canonical measurement name
+func (c *measurementCatalog) lookup(name string) (MeasurementDef, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	def, ok := c.defs[name]
+	if !ok {
+		return MeasurementDef{}, false
+	}
+	return *def, true
+}
+
+// normalise replaces the measurement IDs and aliases of the samples of a node
+// by the canonical names and sets the unit of the catalog. An ID is resolved
+// by the configured mapping of the node, the IDs the node advertised and the
+// default mapping, in that order. The values of a measurement reported by ID
+// are multiplied by the scale of its mapping, values reported by name are
+// taken to be in the unit of the catalog already. Unknown measurements are
+// kept as reported.
+func (c *measurementCatalog) normalise(ranName string, samples []kpiSample) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for i := range samples {
+		sample := &samples[i]
+		name := sample.Measurement
+		if strings.HasPrefix(name, "id:") {
+			id, err := strconv.ParseInt(strings.TrimPrefix(name, "id:"), 10, 64)
+			if err != nil {
+				continue
+			}
+			mapping, ok := c.mappings[ranName][id]
+			if !ok {
+				mapping, ok = c.advertised[ranName][id]
+			}
+			if !ok {
+				mapping, ok = c.mappings[defaultMappingNode][id]
+			}
+			if !ok {
+				continue
+			}
+			name = mapping.Name
+			if mapping.Scale != 0 {
+				sample.Value *= mapping.Scale
+			}
+		}
+
+		if canonical, ok := c.aliases[strings.ToLower(name)]; ok {
+			name = canonical
+			sample.Unit = c.defs[canonical].Unit
+		}
+		sample.Measurement = name
+	}
+}
@@ -0,0 +1,105 @@
+package control
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestMeasurementCatalogNormalise(t *testing.T) {
+	c, err := newMeasurementCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.setMappings("gnb-1", []MeasurementMapping{{ID: 1, Name: "RRU.PrbUsedDl", Scale: 2}})
+	c.setMappings(defaultMappingNode, []MeasurementMapping{{ID: 5, Name: "RRC.ConnMean"}})
+	c.advertise("gnb-1", []MeasurementMapping{{ID: 1, Name: "DRB.UEThpDl"}, {ID: 2, Name: "drb.uethpdl"}})
+
+	samples := []kpiSample{
+		{Measurement: "id:1", Value: 10},
+		{Measurement: "id:2", Value: 10},
+		{Measurement: "id:5", Value: 10},
+		{Measurement: "id:9", Value: 10},
+		{Measurement: "id:x", Value: 10},
+		{Measurement: "DRB.PdcpSduVolumeDl", Value: 10},
+		{Measurement: "Vendor.Kpi", Value: 10},
+	}
+	c.normalise("gnb-1", samples)
+	want := []string{
+		"RRU.PrbUsedDl 20 PRB",
+		"DRB.UEThpDl 10 kbit/s",
+		"RRC.ConnMean 10 UE",
+		"id:9 10 ",
+		"id:x 10 ",
+		"DRB.PdcpSduVolumeDL 10 Mbit",
+		"Vendor.Kpi 10 ",
+	}
+	for i, sample := range samples {
+		if got := fmt.Sprint(sample.Measurement, " ", sample.Value, " ", sample.Unit); got != want[i] {
+			t.Errorf("sample %d: got %q, want %q", i, got, want[i])
+		}
+	}
+
+	other := []kpiSample{{Measurement: "id:2", Value: 10}}
+	c.normalise("gnb-2", other)
+	if other[0].Measurement != "id:2" {
+		t.Errorf("got %s, want the IDs advertised by gnb-1 not used for gnb-2", other[0].Measurement)
+	}
+
+	if mappings := c.getMappings("gnb-1"); fmt.Sprint(mappings) != "[{1 RRU.PrbUsedDl 2} {2 drb.uethpdl 0}]" {
+		t.Errorf("got mappings %v, want the configured one to take precedence", mappings)
+	}
+}
+
+func TestMeasurementCatalogFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "kpimon-catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+	defer setEnv(map[string]string{"measCatalogFile": f.Name()})()
+
+	valid := `{
+		"measurements": [{"name": "Vendor.Kpi", "unit": "ms", "valueType": "real", "kind": "gauge", "aliases": ["Vendor.KpiOld"]}],
+		"nodes": {"gnb-1": [{"id": 7, "name": "vendor.kpiold"}]}
+	}`
+	if err := ioutil.WriteFile(f.Name(), []byte(valid), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := newMeasurementCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def, ok := c.lookup("Vendor.Kpi"); !ok || def.Unit != "ms" {
+		t.Errorf("got %+v, %v", def, ok)
+	}
+	if _, ok := c.lookup("RRU.PrbUsedDl"); !ok {
+		t.Error("built-in measurement missing")
+	}
+	samples := []kpiSample{{Measurement: "id:7"}}
+	c.normalise("gnb-1", samples)
+	if samples[0].Measurement != "Vendor.Kpi" || samples[0].Unit != "ms" {
+		t.Errorf("got %+v", samples[0])
+	}
+
+	for _, invalid := range []string{
+		`{"measurements": [{"valueType": "real", "kind": "gauge"}]}`,
+		`{"measurements": [{"name": "Vendor.Kpi", "valueType": "string", "kind": "gauge"}]}`,
+		`{"measurements": [{"name": "Vendor.Kpi", "valueType": "real", "kind": "counter"}]}`,
+		`{"measurements": {}}`,
+	} {
+		if err := ioutil.WriteFile(f.Name(), []byte(invalid), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := newMeasurementCatalog(); err == nil {
+			t.Errorf("catalog %s accepted", invalid)
+		}
+	}
+
+	os.Remove(f.Name())
+	if _, err := newMeasurementCatalog(); err == nil {
+		t.Error("missing catalog file accepted")
+	}
+}
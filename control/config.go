@@ -0,0 +1,60 @@
+package control
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// getEnvSecret returns the value of key, or the content of the file named by
+// key+"File" such as a mounted Kubernetes secret
+func getEnvSecret(key string) (string, error) {
+	if value := os.Getenv(key); value != "" {
+		return value, nil
+	}
+	file := os.Getenv(key + "File")
+	if file == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// getEnvTLSConfig loads the CA and the client certificate named by the
+// <prefix>CaFile, <prefix>CertFile and <prefix>KeyFile variables, nil when
+// none of them is set and certificate verification is not skipped
+func getEnvTLSConfig(prefix string) (*tls.Config, error) {
+	caFile := os.Getenv(prefix + "CaFile")
+	certFile := os.Getenv(prefix + "CertFile")
+	keyFile := os.Getenv(prefix + "KeyFile")
+	insecure := os.Getenv(prefix+"InsecureSkipVerify") == "true"
+	if caFile == "" && certFile == "" && !insecure {
+		return nil, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate in " + caFile)
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
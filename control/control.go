@@ -4,70 +4,209 @@ import (
 	"errors"
 	"log"
 	"os"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
-	influxdb "github.com/influxdata/influxdb1-client/v2"
 )
 
 type Control struct {
-	ranList            []string             //nodeB list
-	eventCreateExpired int32                //maximum time for the RIC Subscription Request event creation procedure in the E2 Node
-	eventDeleteExpired int32                //maximum time for the RIC Subscription Request event deletion procedure in the E2 Node
-	rcChan             chan *xapp.RMRParams //channel for receiving rmr message
-	client             influxdb.Client      //influxdb client
-	eventCreateExpiredMap map[string]bool //map for recording the RIC Subscription Request event creation procedure is expired or not
-	eventDeleteExpiredMap map[string]bool //map for recording the RIC Subscription Request event deletion procedure is expired or not
-	eventCreateExpiredMu  *sync.Mutex     //mutex for eventCreateExpiredMap
-	eventDeleteExpiredMu  *sync.Mutex     //mutex for eventDeleteExpiredMap
+	ranList               []string              //nodeB list
+	eventCreateExpired    int32                 //maximum time for the RIC Subscription Request event creation procedure in the E2 Node
+	eventDeleteExpired    int32                 //maximum time for the RIC Subscription Request event deletion procedure in the E2 Node
+	pipe                  *pipeline             //intake, decode and storage stages for received rmr messages
+	sinks                 []sink                //storage backends, each written from its own queue of the storage stage
+	influx                *influxSink           //InfluxDB sink, the first of the sinks, nil when not enabled
+	eventCreateExpiredMap map[string]bool       //map for recording the RIC Subscription Request event creation procedure is expired or not
+	eventDeleteExpiredMap map[string]bool       //map for recording the RIC Subscription Request event deletion procedure is expired or not
+	eventCreateExpiredMu  *sync.Mutex           //mutex for eventCreateExpiredMap
+	eventDeleteExpiredMu  *sync.Mutex           //mutex for eventDeleteExpiredMap
+	indSN                 *indicationSNTracker  //RICindicationSN gap and duplicate tracking per subscription
+	subs                  *subscriptionRegistry //RIC subscription state per nodeB
+	metrics               *kpiMetrics           //prometheus metrics
+	latest                *latestStore          //latest KPI values served by the REST API
+	series                *seriesStore          //recent KPI samples per series served by the REST API
+	stream                *streamHub            //live stream of decoded indications
+	topology              *topology             //node, DU, CU-CP and CU-UP topology learned from the indications
+	clock                 *clockSkewTracker     //clock skew between the nodes and the RIC
+	catalog               *measurementCatalog   //KPM measurement definitions and the ID mapping of the nodes
+	derived               *derivedEngine        //derived KPIs computed from the reported measurements
+	rollup                *rollupStore          //windowed rollups of the cell and slice KPIs
+	alarms                *alarmManager         //alarms raised by kpimon
+	rules                 *ruleEngine           //KPI threshold rules raising alarms
+	anomaly               *anomalyDetector      //anomaly detection on the KPI series, nil when disabled
+	publisher             *kpiPublisher         //KPI reports published to other xApps over RMR
+	ves                   *vesSink              //VES export to the SMO collector, nil when not configured
+	export                *exportSink           //JSON lines or CSV file export, nil when not configured
 }
 
 func init() {
 	file := "/opt/kpimon.log"
 	logFile, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0766)
 	if err != nil {
-		panic(err)
+		// Tools importing this package run outside the container, keep logging to stderr
+		log.Printf("Failed to open %s, logging to stderr: %v", file, err)
+	} else {
+		log.SetOutput(logFile)
 	}
-	log.SetOutput(logFile)
 	log.SetPrefix("[qSkipTool]")
 	log.SetFlags(log.LstdFlags | log.Lshortfile | log.LUTC)
 	xapp.Logger.SetLevel(4)
 }
 
 func NewControl() Control {
-	str := os.Getenv("ranList")
-	url := os.Getenv("influxAddr")
-	client, err := influxdb.NewHTTPClient(influxdb.HTTPConfig{
-		Addr:     url,
-		Username: "admin",
-		Password: "",
-	})
+	c, err := newControl(func(string) bool { return true })
 	if err != nil {
 		panic(err)
 	}
+	return c
+}
+
+// newControl sets up the xApp writing to the configured sinks for which
+// enabled returns true, by sink name
+func newControl(enabled func(sink string) bool) (Control, error) {
+	str := os.Getenv("ranList")
+	catalog, err := newMeasurementCatalog()
+	if err != nil {
+		return Control{}, err
+	}
+
+	derived, err := newDerivedEngine()
+	if err != nil {
+		return Control{}, err
+	}
+
+	rollup, err := newRollupStore()
+	if err != nil {
+		return Control{}, err
+	}
 
-	return Control{strings.Split(str, ","),
-		5, 5,
-		make(chan *xapp.RMRParams),
-		client,
-		make(map[string]bool),
-		make(map[string]bool),
-		&sync.Mutex{},
-		&sync.Mutex{}}
+	var sinks []sink
+	var influx *influxSink
+	if enabled("influxdb") {
+		if influx, err = newInfluxSink(); err != nil {
+			return Control{}, err
+		}
+		sinks = append(sinks, influx)
+	}
+	var ves *vesSink
+	if enabled("ves") {
+		if ves, err = newVesSink(); err != nil {
+			return Control{}, err
+		}
+		if ves != nil {
+			sinks = append(sinks, ves)
+		}
+	}
+	if enabled("kafka") {
+		kafka, err := newKafkaSink()
+		if err != nil {
+			return Control{}, err
+		}
+		if kafka != nil {
+			sinks = append(sinks, kafka)
+		}
+	}
+	if enabled("mqtt") {
+		mqtt, err := newMqttSink()
+		if err != nil {
+			return Control{}, err
+		}
+		if mqtt != nil {
+			sinks = append(sinks, mqtt)
+		}
+	}
+	if enabled("sql") {
+		sql, err := newSQLSink(catalog)
+		if err != nil {
+			return Control{}, err
+		}
+		if sql != nil {
+			sinks = append(sinks, sql)
+		}
+	}
+	var export *exportSink
+	if enabled("export") {
+		if export, err = newExportSink(); err != nil {
+			return Control{}, err
+		}
+		if export != nil {
+			sinks = append(sinks, export)
+		}
+	}
+
+	alarmer, err := newXappAlarmer()
+	if err != nil {
+		return Control{}, err
+	}
+	alarms := newAlarmManager(alarmer)
+	if ves != nil {
+		alarms.onChange = ves.alarm
+	}
+	rules, err := newRuleEngine(alarms)
+	if err != nil {
+		return Control{}, err
+	}
+
+	anomaly, err := newAnomalyDetector(alarms)
+	if err != nil {
+		return Control{}, err
+	}
+
+	pipe := newPipeline(sinks)
+	metrics := newKpiMetrics(pipe)
+	if influx != nil && influx.spool != nil {
+		metrics.registerSpool(influx.name(), influx.spool)
+	}
+	metrics.registerRollup(rollup)
+	if anomaly != nil {
+		metrics.registerAnomaly(anomaly)
+	}
+	subs := newSubscriptionRegistry()
+	subs.onChange = metrics.subscriptionState
+
+	return Control{
+		ranList:               strings.Split(str, ","),
+		eventCreateExpired:    5,
+		eventDeleteExpired:    5,
+		pipe:                  pipe,
+		sinks:                 sinks,
+		influx:                influx,
+		eventCreateExpiredMap: make(map[string]bool),
+		eventDeleteExpiredMap: make(map[string]bool),
+		eventCreateExpiredMu:  &sync.Mutex{},
+		eventDeleteExpiredMu:  &sync.Mutex{},
+		indSN:                 newIndicationSNTracker(),
+		subs:                  subs,
+		metrics:               metrics,
+		latest:                newLatestStore(),
+		series:                newSeriesStore(),
+		stream:                newStreamHub(),
+		topology:              newTopology(),
+		clock:                 newClockSkewTracker(),
+		catalog:               catalog,
+		derived:               derived,
+		rollup:                rollup,
+		alarms:                alarms,
+		rules:                 rules,
+		anomaly:               anomaly,
+		publisher:             newKpiPublisher(rmrTransport{}),
+		ves:                   ves,
+		export:                export,
+	}, nil
 }
 
 func ReadyCB(i interface{}) {
 	c := i.(*Control)
 
 	c.startTimerSubReq()
-	go c.controlLoop()
+	c.startPipeline()
 }
 
 func (c *Control) Run() {
 	if len(c.ranList) > 0 {
+		c.injectRoutes()
 		xapp.SetReadyCB(ReadyCB, c)
 		xapp.Run(c)
 	} else {
@@ -99,7 +238,12 @@ func (c *Control) startTimerSubReq() {
 }
 
 func (c *Control) Consume(rp *xapp.RMRParams) (err error) {
-	c.rcChan <- rp
+	c.metrics.message(rp.Mtype)
+	err = c.pipe.enqueue(rp)
+	if err != nil {
+		xapp.Logger.Error("Failed to consume message: %v", err)
+		log.Printf("Failed to consume message: %v", err)
+	}
 	return
 }
 
@@ -121,36 +265,13 @@ func (c *Control) rmrReplyToSender(params *xapp.RMRParams) (err error) {
 	return
 }
 
-func (c *Control) controlLoop() {
-	for {
-		msg := <-c.rcChan
-		xapp.Logger.Debug("Received message type: %d", msg.Mtype)
-		log.Printf("Received message type: %d", msg.Mtype)
-		switch msg.Mtype {
-		case 12050:
-			c.handleIndication(msg)
-		case 12011:
-			c.handleSubscriptionResponse(msg)
-		case 12012:
-			c.handleSubscriptionFailure(msg)
-		case 12021:
-			c.handleSubscriptionDeleteResponse(msg)
-		case 12022:
-			c.handleSubscriptionDeleteFailure(msg)
-		default:
-			err := errors.New("Message Type " + strconv.Itoa(msg.Mtype) + " is discarded")
-			xapp.Logger.Error("Unknown message type: %v", err)
-			log.Printf("Unknown message type: %v", err)
-		}
-	}
-}
-
-func (c *Control) handleIndication(params *xapp.RMRParams) (err error) {
+func (c *Control) handleIndication(params *xapp.RMRParams, received time.Time) (ind *indication, err error) {
 	var e2ap *E2ap
 	var e2sm *E2sm
 
 	indicationMsg, err := e2ap.GetIndicationMessage(params.Payload)
 	if err != nil {
+		c.metrics.decodeError(decodeStageE2ap)
 		xapp.Logger.Error("Failed to decode RIC Indication message: %v", err)
 		log.Printf("Failed to decode RIC Indication message: %v", err)
 		return
@@ -167,8 +288,27 @@ func (c *Control) handleIndication(params *xapp.RMRParams) (err error) {
 	log.Printf("IndicationMessage: %x", indicationMsg.IndMessage)
 	log.Printf("CallProcessID: %x", indicationMsg.CallProcessID)
 
+	result, lost := c.indSN.track(params.Meid.RanName, indicationMsg)
+	c.metrics.indicationSN(params.Meid.RanName, result, lost)
+	if result == indicationDuplicate {
+		xapp.Logger.Warn("Duplicate RIC Indication from {%s} with IndicationSN %d is dropped", params.Meid.RanName, indicationMsg.IndSN)
+		log.Printf("Duplicate RIC Indication from {%s} with IndicationSN %d is dropped", params.Meid.RanName, indicationMsg.IndSN)
+		return nil, nil
+	}
+	if result == indicationRestarted {
+		xapp.Logger.Warn("RICindicationSN of {%s} restarted at %d", params.Meid.RanName, indicationMsg.IndSN)
+		log.Printf("RICindicationSN of {%s} restarted at %d", params.Meid.RanName, indicationMsg.IndSN)
+	}
+	if lost > 0 {
+		xapp.Logger.Warn("%d RIC Indication(s) from {%s} not received by IndicationSN %d", lost, params.Meid.RanName, indicationMsg.IndSN)
+		log.Printf("%d RIC Indication(s) from {%s} not received by IndicationSN %d", lost, params.Meid.RanName, indicationMsg.IndSN)
+	} else if result == indicationReordered {
+		log.Printf("Reordered RIC Indication from {%s} with IndicationSN %d received", params.Meid.RanName, indicationMsg.IndSN)
+	}
+
 	indicationHdr, err := e2sm.GetIndicationHeader(indicationMsg.IndHeader)
 	if err != nil {
+		c.metrics.decodeError(decodeStageE2smHeader)
 		xapp.Logger.Error("Failed to decode RIC Indication Header: %v", err)
 		log.Printf("Failed to decode RIC Indication Header: %v", err)
 		return
@@ -247,6 +387,9 @@ func (c *Control) handleIndication(params *xapp.RMRParams) (err error) {
 
 		if indHdrFormat1.ColletStartTime != nil {
 			log.Printf("ColletStartTime: %x", indHdrFormat1.ColletStartTime.Buf)
+			if start, err := ntpTime(octets(*indHdrFormat1.ColletStartTime)); err == nil {
+				log.Printf("ColletStartTime: %s", start.Format(time.RFC3339Nano))
+			}
 		}
 
 		if indHdrFormat1.FileFormatVersion != nil {
@@ -272,6 +415,7 @@ func (c *Control) handleIndication(params *xapp.RMRParams) (err error) {
 
 	indMsg, err := e2sm.GetIndicationMessage(indicationMsg.IndMessage)
 	if err != nil {
+		c.metrics.decodeError(decodeStageE2smMsg)
 		xapp.Logger.Error("Failed to decode RIC Indication Message: %v", err)
 		log.Printf("Failed to decode RIC Indication Message: %v", err)
 		return
@@ -300,13 +444,12 @@ func (c *Control) handleIndication(params *xapp.RMRParams) (err error) {
 				log.Printf("MeasInfoList[%d]: ", i)
 				MeasInfo := indMsgFormat1.MeasInfoList[i]
 
-				if MeasInfo.MeasType == 1 {
-					ID := MeasInfo.Measurement.(MeasID)
-					log.Printf("MeasID: %d", ID)
-				} else if MeasInfo.MeasType == 2 {
-					Name := MeasInfo.Measurement.(MeasName)
-					log.Printf("MeasName: %x", Name.Buf)
-				} else {
+				switch Measurement := MeasInfo.Measurement.(type) {
+				case *PrintableString:
+					log.Printf("MeasName: %s", Measurement.Buf)
+				case int64:
+					log.Printf("MeasID: %d", Measurement)
+				default:
 					xapp.Logger.Error("Unknown Measurement Type: %d", MeasInfo.MeasType)
 					log.Printf("Unknown Measurement Type: %d", MeasInfo.MeasType)
 				}
@@ -341,57 +484,6 @@ func (c *Control) handleIndication(params *xapp.RMRParams) (err error) {
 						log.Printf("DistBinZ: %d", LabelInfo.DistBinZ)
 						log.Printf("PreLabelOverride: %d", LabelInfo.PreLabelOverride)
 						log.Printf("StartEndInd: %d", LabelInfo.StartEndInd)
-
-						database := os.Getenv("influxDatabase")
-						precision := os.Getenv("influxPrecision")
-						bp, err := influxdb.NewBatchPoints(influxdb.BatchPointsConfig{
-							Database:  database,
-							Precision: precision,
-						})
-						if err != nil {
-							xapp.Logger.Error("Failed to create batch points for influx: %v", err)
-							log.Printf("Failed to create batch points for influx: %v", err)
-						}
-
-						tags := make(map[string]string)
-						if LabelInfo.PLMNID != nil {
-							tags["PLMNID"] = string(LabelInfo.PLMNID.Buf)
-						}
-						if LabelInfo.SliceID != nil {
-							tags["SliceID.SST"] = string(LabelInfo.SliceID.SST.Buf)
-							if LabelInfo.SliceID.SD != nil {
-								tags["SliceID.SD"] = string(LabelInfo.SliceID.SD.Buf)
-							}
-						}
-
-						fields := make(map[string]interface{})
-						fields["FiveQI"] = LabelInfo.FiveQI
-						fields["QCI"] = LabelInfo.QCI
-						fields["QCImax"] = LabelInfo.QCImax
-						fields["QCImin"] = LabelInfo.QCImin
-						fields["ARPmax"] = LabelInfo.ARPmax
-						fields["ARPmin"] = LabelInfo.ARPmin
-						fields["BitrateRange"] = LabelInfo.BitrateRange
-						fields["LayerMU_MIMO"] = LabelInfo.LayerMU_MIMO
-						fields["SUM"] = LabelInfo.SUM
-						fields["DistBinX"] = LabelInfo.DistBinX
-						fields["DistBinY"] = LabelInfo.DistBinY
-						fields["DistBinZ"] = LabelInfo.DistBinZ
-						fields["PreLabelOverride"] = LabelInfo.PreLabelOverride
-						fields["StartEndInd"] = LabelInfo.StartEndInd
-
-						pt, err := influxdb.NewPoint("metrics", tags, fields, time.Now())
-						if err != nil {
-							xapp.Logger.Error("Failed to create point for influx: %v", err)
-							log.Printf("Failed to create point for influx: %v", err)
-						}
-
-						bp.AddPoint(pt)
-						err = c.client.Write(bp)
-						if err != nil {
-							xapp.Logger.Error("Failed to write influxdb: %v", err)
-							log.Printf("Failed to write influxdb: %v", err)
-						}
 					}
 				}
 			}
@@ -411,16 +503,14 @@ func (c *Control) handleIndication(params *xapp.RMRParams) (err error) {
 						log.Printf("MeasRecordList[%d]: ", j)
 						MeasRecord := MeasData.MeasRecord[j]
 
-						if MeasRecord.MeasRecordType == 1 {
-							Value := MeasRecord.MeasRecordValue.(Integer)
+						switch Value := MeasRecord.MeasRecordValue.(type) {
+						case int64:
 							log.Printf("Integer: %d", Value)
-						} else if MeasRecord.MeasRecordType == 2 {
-							Value := MeasRecord.MeasRecordValue.(Real)
+						case float64:
 							log.Printf("Real: %f", Value)
-						} else if MeasRecord.MeasRecordType == 3 {
-							Value := MeasRecord.MeasRecordValue.(Null)
+						case int32:
 							log.Printf("NoValue: %d", Value)
-						} else {
+						default:
 							xapp.Logger.Error("Unknown Measured Value Type: %d", MeasRecord.MeasRecordType)
 							log.Printf("Unknown Measured Value Type: %d", MeasRecord.MeasRecordType)
 						}
@@ -449,13 +539,12 @@ func (c *Control) handleIndication(params *xapp.RMRParams) (err error) {
 				log.Printf("MeasInfoUeidList[%d]: ", i)
 				MeasInfoUeid := indMsgFormat2.MeasInfoUeidList[i]
 
-				if MeasInfoUeid.MeasType == 1 {
-					ID := MeasInfoUeid.Measurement.(MeasID)
-					log.Printf("MeasID: %d", ID)
-				} else if MeasInfoUeid.MeasType == 2 {
-					Name := MeasInfoUeid.Measurement.(MeasName)
-					log.Printf("MeasName: %x", Name.Buf)
-				} else {
+				switch Measurement := MeasInfoUeid.Measurement.(type) {
+				case *PrintableString:
+					log.Printf("MeasName: %s", Measurement.Buf)
+				case int64:
+					log.Printf("MeasID: %d", Measurement)
+				default:
 					xapp.Logger.Error("Unknown Measurement Type: %d", MeasInfoUeid.MeasType)
 					log.Printf("Unknown Measurement Type: %d", MeasInfoUeid.MeasType)
 				}
@@ -464,8 +553,7 @@ func (c *Control) handleIndication(params *xapp.RMRParams) (err error) {
 				for j := 0; j < MeasInfoUeid.MatchingCondCount; j++ {
 					log.Printf("MatchingCondList[%d]: ", j)
 					MatchingCondition := MeasInfoUeid.MatchingCondList[j]
-					if MatchingCondition.ConditionType == 1 {
-						LabelInfo := MatchingCondition.Condition.(MeasLabelInfo)
+					if LabelInfo := matchingCondLabel(MatchingCondition); LabelInfo != nil {
 						if LabelInfo.PLMNID != nil {
 							log.Printf("PLMNID: %x", LabelInfo.PLMNID.Buf)
 						}
@@ -490,80 +578,17 @@ func (c *Control) handleIndication(params *xapp.RMRParams) (err error) {
 						log.Printf("DistBinZ: %d", LabelInfo.DistBinZ)
 						log.Printf("PreLabelOverride: %d", LabelInfo.PreLabelOverride)
 						log.Printf("StartEndInd: %d", LabelInfo.StartEndInd)
-
-						database := os.Getenv("influxDatabase")
-						precision := os.Getenv("influxPrecision")
-						bp, err := influxdb.NewBatchPoints(influxdb.BatchPointsConfig{
-							Database:  database,
-							Precision: precision,
-						})
-						if err != nil {
-							xapp.Logger.Error("Failed to create batch points for influx: %v", err)
-							log.Printf("Failed to create batch points for influx: %v", err)
-						}
-
-						tags := make(map[string]string)
-						if LabelInfo.PLMNID != nil {
-							tags["PLMNID"] = string(LabelInfo.PLMNID.Buf)
-						}
-						if LabelInfo.SliceID != nil {
-							tags["SliceID.SST"] = string(LabelInfo.SliceID.SST.Buf)
-							if LabelInfo.SliceID.SD != nil {
-								tags["SliceID.SD"] = string(LabelInfo.SliceID.SD.Buf)
-							}
-						}
-
-						fields := make(map[string]interface{})
-						fields["FiveQI"] = LabelInfo.FiveQI
-						fields["QCI"] = LabelInfo.QCI
-						fields["QCImax"] = LabelInfo.QCImax
-						fields["QCImin"] = LabelInfo.QCImin
-						fields["ARPmax"] = LabelInfo.ARPmax
-						fields["ARPmin"] = LabelInfo.ARPmin
-						fields["BitrateRange"] = LabelInfo.BitrateRange
-						fields["LayerMU_MIMO"] = LabelInfo.LayerMU_MIMO
-						fields["SUM"] = LabelInfo.SUM
-						fields["DistBinX"] = LabelInfo.DistBinX
-						fields["DistBinY"] = LabelInfo.DistBinY
-						fields["DistBinZ"] = LabelInfo.DistBinZ
-						fields["PreLabelOverride"] = LabelInfo.PreLabelOverride
-						fields["StartEndInd"] = LabelInfo.StartEndInd
-
-						pt, err := influxdb.NewPoint("metrics", tags, fields, time.Now())
-						if err != nil {
-							xapp.Logger.Error("Failed to create point for influx: %v", err)
-							log.Printf("Failed to create point for influx: %v", err)
-						}
-
-						bp.AddPoint(pt)
-						err = c.client.Write(bp)
-						if err != nil {
-							xapp.Logger.Error("Failed to write influxdb: %v", err)
-							log.Printf("Failed to write influxdb: %v", err)
-						}
-					} else if MatchingCondition.ConditionType == 2 {
-						TestCondInfo := MatchingCondition.Condition.(TestConditionInfo)
+					} else if TestCondInfo, ok := MatchingCondition.Condition.(*TestConditionInfo); ok {
 						log.Printf("TestConditionType: %d", TestCondInfo.TestConditionType)
 						log.Printf("Expression: %d", TestCondInfo.Expression)
-						if TestCondInfo.ValueType == 1 {
-							TestCondValue := TestCondInfo.Value.(int64)
+						switch TestCondValue := TestCondInfo.Value.(type) {
+						case int64:
 							log.Printf("Integer: %d", TestCondValue)
-						} else if TestCondInfo.ValueType == 2 {
-							TestCondValue := TestCondInfo.Value.(int64)
-							log.Printf("Enumerated: %d", TestCondValue)
-						} else if TestCondInfo.ValueType == 3 {
-							TestCondValue := TestCondInfo.Value.(int32)
-							log.Printf("Boolean: %d", TestCondValue)
-						} else if TestCondInfo.ValueType == 4 {
-							TestCondValue := TestCondInfo.Value.(BitString)
+						case *BitString:
 							log.Printf("Bit string: %x, Unused: %d", TestCondValue.Buf, TestCondValue.BitsUnused)
-						} else if TestCondInfo.ValueType == 5 {
-							TestCondValue := TestCondInfo.Value.(OctetString)
+						case *OctetString:
 							log.Printf("Octet string: %x", TestCondValue.Buf)
-						} else if TestCondInfo.ValueType == 6 {
-							TestCondValue := TestCondInfo.Value.(PrintableString)
-							log.Printf("Printable string: %x", TestCondValue.Buf)
-						} else {
+						default:
 							xapp.Logger.Error("Unknown Test Condition Value Type: %d", TestCondInfo.ValueType)
 							log.Printf("Unknown Test Condition Value Type: %d", TestCondInfo.ValueType)
 						}
@@ -594,16 +619,14 @@ func (c *Control) handleIndication(params *xapp.RMRParams) (err error) {
 						log.Printf("MeasRecordList[%d]: ", j)
 						MeasRecord := MeasData.MeasRecord[j]
 
-						if MeasRecord.MeasRecordType == 1 {
-							Value := MeasRecord.MeasRecordValue.(Integer)
+						switch Value := MeasRecord.MeasRecordValue.(type) {
+						case int64:
 							log.Printf("Integer: %d", Value)
-						} else if MeasRecord.MeasRecordType == 2 {
-							Value := MeasRecord.MeasRecordValue.(Real)
+						case float64:
 							log.Printf("Real: %f", Value)
-						} else if MeasRecord.MeasRecordType == 3 {
-							Value := MeasRecord.MeasRecordValue.(Null)
+						case int32:
 							log.Printf("NoValue: %d", Value)
-						} else {
+						default:
 							xapp.Logger.Error("Unknown Measured Value Type: %d", MeasRecord.MeasRecordType)
 							log.Printf("Unknown Measured Value Type: %d", MeasRecord.MeasRecordType)
 						}
@@ -617,7 +640,29 @@ func (c *Control) handleIndication(params *xapp.RMRParams) (err error) {
 		return
 	}
 
-	return nil
+	ind = &indication{
+		RanName:  params.Meid.RanName,
+		Received: received,
+		Msg:      indicationMsg,
+		Header:   indicationHdr,
+		Message:  indMsg,
+	}
+
+	if start, granul, ok := collectionPeriod(ind); ok {
+		ind.Start = start
+		ind.Granul = granul
+		end := start.Add(time.Duration(measDataCount(ind)) * granul)
+		skew, exceeded := c.clock.observe(ind.RanName, end, ind.Received)
+		c.metrics.clockSkew(ind.RanName, skew, exceeded)
+		if exceeded {
+			xapp.Logger.Warn("Clock skew of %v between {%s} and the RIC exceeds the threshold", skew, ind.RanName)
+			log.Printf("Clock skew of %v between {%s} and the RIC exceeds the threshold", skew, ind.RanName)
+		}
+	}
+	ind.Samples = indicationSamples(ind)
+	c.catalog.normalise(ind.RanName, ind.Samples)
+	ind.Samples = append(ind.Samples, c.derived.derive(ind)...)
+	return ind, nil
 }
 
 func (c *Control) handleSubscriptionResponse(params *xapp.RMRParams) (err error) {
@@ -637,6 +682,9 @@ func (c *Control) handleSubscriptionResponse(params *xapp.RMRParams) (err error)
 		c.eventCreateExpiredMu.Unlock()
 	}
 
+	c.subs.setState(ranName, subStateActive)
+	c.indSN.reset(ranName)
+
 	var cep *E2ap
 	subscriptionResp, err := cep.GetSubscriptionResponseMessage(params.Payload)
 	if err != nil {
@@ -682,6 +730,8 @@ func (c *Control) handleSubscriptionFailure(params *xapp.RMRParams) (err error)
 		c.eventCreateExpiredMu.Unlock()
 	}
 
+	c.subs.setState(ranName, subStateFailed)
+
 	return nil
 }
 
@@ -702,6 +752,8 @@ func (c *Control) handleSubscriptionDeleteResponse(params *xapp.RMRParams) (err
 		c.eventDeleteExpiredMu.Unlock()
 	}
 
+	c.subs.setState(ranName, subStateDeleted)
+
 	return nil
 }
 
@@ -722,6 +774,8 @@ func (c *Control) handleSubscriptionDeleteFailure(params *xapp.RMRParams) (err e
 		c.eventDeleteExpiredMu.Unlock()
 	}
 
+	c.subs.setState(ranName, subStateActive)
+
 	return nil
 }
 
@@ -745,6 +799,7 @@ func (c *Control) setEventCreateExpiredTimer(ranName string) {
 				if !isResponsed {
 					xapp.Logger.Debug("RIC_SUB_REQ[%s]: RIC Event Create Timer experied!", ranName)
 					log.Printf("RIC_SUB_REQ[%s]: RIC Event Create Timer experied!", ranName)
+					c.subs.setState(ranName, subStateExpired)
 					// c.sendRicSubDelRequest(subID, requestSN, funcID)
 					return
 				}
@@ -876,6 +931,7 @@ func (c *Control) sendRicSubRequest(subID int, requestSN int, funcID int) (err e
 			return err
 		}
 
+		c.subs.requested(params.Meid.RanName, subID, requestSN, funcID)
 		c.setEventCreateExpiredTimer(params.Meid.RanName)
 		//c.ranList = append(c.ranList[:index], c.ranList[index+1:]...)
 		//index--
@@ -917,6 +973,7 @@ func (c *Control) sendRicSubDelRequest(subID int, requestSN int, funcID int) (er
 		return err
 	}
 
+	c.subs.setState(params.Meid.RanName, subStateDeleting)
 	c.setEventDeleteExpiredTimer(params.Meid.RanName)
 
 	return nil
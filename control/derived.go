@@ -0,0 +1,256 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	derivedDelta = "delta" //increase of a counter since the previous report
+	derivedRate  = "rate"  //increase per second, or value per second of the granularity period
+	derivedRatio = "ratio" //source divided by denominator
+	derivedSum   = "sum"   //source summed over PLMNs, slices, 5QIs and QCIs
+)
+
+const defaultDerivedStateTTL = 900 //seconds without update before the counter state of a series is removed
+
+// DerivedRule computes the measurement Name from the samples of Source. Rules
+// are applied in order and may use the output of the rules before them.
+type DerivedRule struct {
+	Name        string  `json:"name"`
+	Type        string  `json:"type"`
+	Source      string  `json:"source"`
+	Denominator string  `json:"denominator,omitempty"` //ratio only
+	Scale       float64 `json:"scale,omitempty"`       //factor applied to the result, 1 when not set
+	PerPeriod   bool    `json:"perPeriod,omitempty"`   //rate only, the source is reset every granularity period
+	Unit        string  `json:"unit,omitempty"`
+}
+
+// derived KPIs computed without configuration
+var defaultDerivedRules = []DerivedRule{
+	{Name: "RRU.PrbUtilDl", Type: derivedRatio, Source: measPrbUsedDL, Denominator: measPrbAvailDL, Scale: 100, Unit: "%"},
+	{Name: "RRU.PrbUtilUl", Type: derivedRatio, Source: measPrbUsedUL, Denominator: measPrbAvailUL, Scale: 100, Unit: "%"},
+	{Name: "DRB.PdcpSduThpDl", Type: derivedRate, Source: measPdcpSduVolumeDL, PerPeriod: true, Scale: 1000, Unit: "kbit/s"},
+	{Name: "DRB.PdcpSduThpUl", Type: derivedRate, Source: measPdcpSduVolumeUL, PerPeriod: true, Scale: 1000, Unit: "kbit/s"},
+	{Name: "DRB.PdcpSduVolumeDL.Sum", Type: derivedSum, Source: measPdcpSduVolumeDL, Unit: "Mbit"},
+	{Name: "DRB.PdcpSduVolumeUL.Sum", Type: derivedSum, Source: measPdcpSduVolumeUL, Unit: "Mbit"},
+}
+
+type counterState struct {
+	value    float64
+	time     time.Time //sample time of the value
+	received time.Time //receiver time of the value, the state expires on it
+}
+
+// derivedEngine computes derived KPIs from the samples of an indication. The
+// state of counters is kept per rule and series for deltas and rates.
+type derivedEngine struct {
+	mu       sync.Mutex
+	rules    []DerivedRule
+	ttl      time.Duration
+	counters map[string]counterState
+}
+
+func newDerivedEngine() (*derivedEngine, error) {
+	e := &derivedEngine{
+		rules:    defaultDerivedRules,
+		ttl:      time.Duration(getEnvInt("derivedStateTTL", defaultDerivedStateTTL)) * time.Second,
+		counters: make(map[string]counterState),
+	}
+
+	file := os.Getenv("derivedKpiFile")
+	if file == "" {
+		return e, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []DerivedRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if err := validateDerivedRule(rule); err != nil {
+			return nil, err
+		}
+	}
+	e.rules = rules
+	return e, nil
+}
+
+func validateDerivedRule(rule DerivedRule) error {
+	if rule.Name == "" || rule.Source == "" {
+		return errors.New("derived KPI without name or source")
+	}
+	switch rule.Type {
+	case derivedDelta, derivedRate, derivedSum:
+	case derivedRatio:
+		if rule.Denominator == "" {
+			return errors.New("ratio " + rule.Name + " without denominator")
+		}
+	default:
+		return errors.New("unknown type " + rule.Type + " of derived KPI " + rule.Name)
+	}
+	return nil
+}
+
+// derive returns the derived samples of an indication
+func (e *derivedEngine) derive(ind *indication) (derived []kpiSample) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	samples := ind.Samples
+	for _, rule := range e.rules {
+		var out []kpiSample
+		switch rule.Type {
+		case derivedDelta, derivedRate:
+			out = e.counter(rule, samples, ind.Granul, ind.Received)
+		case derivedRatio:
+			out = ratio(rule, samples)
+		case derivedSum:
+			out = sum(rule, samples)
+		}
+		for i := range out {
+			out[i].Measurement = rule.Name
+			out[i].Unit = rule.Unit
+			if rule.Scale != 0 {
+				out[i].Value *= rule.Scale
+			}
+		}
+		derived = append(derived, out...)
+		samples = append(samples[:len(samples):len(samples)], out...)
+	}
+	return
+}
+
+// counter computes deltas and rates. A value below the previous one is taken
+// as a counter reset, the increase is then the value itself.
+func (e *derivedEngine) counter(rule DerivedRule, samples []kpiSample, granul time.Duration, received time.Time) (out []kpiSample) {
+	for _, sample := range samples {
+		if sample.Measurement != rule.Source {
+			continue
+		}
+
+		if rule.Type == derivedRate && rule.PerPeriod {
+			if granul > 0 {
+				sample.Value /= granul.Seconds()
+				out = append(out, sample)
+			}
+			continue
+		}
+
+		key := rule.Name + "\x00" + sampleLabels(sample).key()
+		prev, ok := e.counters[key]
+		if ok && !sample.Time.After(prev.time) {
+			continue
+		}
+		e.counters[key] = counterState{value: sample.Value, time: sample.Time, received: received}
+		if !ok {
+			continue
+		}
+
+		delta := sample.Value - prev.value
+		if delta < 0 {
+			delta = sample.Value
+		}
+		if rule.Type == derivedRate {
+			delta /= sample.Time.Sub(prev.time).Seconds()
+		}
+		sample.Value = delta
+		out = append(out, sample)
+	}
+	return
+}
+
+// ratio divides every source sample by the denominator with the same labels
+// and time, falling back to the denominator of the whole cell or UE
+func ratio(rule DerivedRule, samples []kpiSample) (out []kpiSample) {
+	denominators := make(map[string]float64)
+	for _, sample := range samples {
+		if sample.Measurement == rule.Denominator {
+			denominators[timedKey(sample)] = sample.Value
+		}
+	}
+
+	for _, sample := range samples {
+		if sample.Measurement != rule.Source {
+			continue
+		}
+		sample.Measurement = rule.Denominator
+		denominator, ok := denominators[timedKey(sample)]
+		if !ok {
+			denominator, ok = denominators[timedKey(unlabelled(sample))]
+		}
+		if !ok || denominator == 0 {
+			continue
+		}
+		sample.Value /= denominator
+		out = append(out, sample)
+	}
+	return
+}
+
+// sum adds up the labelled source samples of every cell or UE
+func sum(rule DerivedRule, samples []kpiSample) (out []kpiSample) {
+	index := make(map[string]int)
+	for _, sample := range samples {
+		if sample.Measurement != rule.Source || !labelled(sample) {
+			continue
+		}
+		total := unlabelled(sample)
+		key := timedKey(total)
+		if i, ok := index[key]; ok {
+			out[i].Value += sample.Value
+			continue
+		}
+		index[key] = len(out)
+		out = append(out, total)
+	}
+	return
+}
+
+func labelled(sample kpiSample) bool {
+	return sample.PLMNID != "" || sample.SliceID != "" || sample.FiveQI != 0 || sample.QCI != 0
+}
+
+func unlabelled(sample kpiSample) kpiSample {
+	sample.PLMNID = ""
+	sample.SliceID = ""
+	sample.FiveQI = 0
+	sample.QCI = 0
+	return sample
+}
+
+func timedKey(sample kpiSample) string {
+	return sampleLabels(sample).key() + "\x00" + strconv.FormatInt(sample.Time.UnixNano(), 10)
+}
+
+// expireLoop removes the counter state of series that are no longer reported
+func (e *derivedEngine) expireLoop() {
+	ticker := time.NewTicker(e.ttl / 2)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		e.expire(now.Add(-e.ttl))
+	}
+}
+
+// expire removes the counter state of series not received since cutoff. The
+// receive time is used rather than the sample time, so that the state of a
+// node whose clock is behind is kept.
+func (e *derivedEngine) expire(cutoff time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for key, state := range e.counters {
+		if state.received.Before(cutoff) {
+			delete(e.counters, key)
+		}
+	}
+}
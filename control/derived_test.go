@@ -0,0 +1,40 @@
+package control
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDerivedEngineExpire(t *testing.T) {
+	e := &derivedEngine{
+		rules:    []DerivedRule{{Name: "RRC.ConnEstabAtt.Delta", Type: derivedDelta, Source: "RRC.ConnEstabAtt"}},
+		ttl:      15 * time.Minute,
+		counters: make(map[string]counterState),
+	}
+	received := time.Unix(1600000000, 0)
+	report := func(ranName string, value float64, at time.Time) []kpiSample {
+		// the clock of the node is an hour behind the receiver
+		sample := kpiSample{RanName: ranName, CellID: "cell-1", Measurement: "RRC.ConnEstabAtt", Value: value, Time: at.Add(-time.Hour)}
+		return e.derive(&indication{RanName: ranName, Received: at, Samples: []kpiSample{sample}})
+	}
+
+	report("gnb-1", 10, received)
+	report("gnb-2", 10, received)
+	report("gnb-2", 15, received.Add(10*time.Minute))
+
+	e.expire(received.Add(10 * time.Minute).Add(-e.ttl))
+	if len(e.counters) != 2 {
+		t.Fatalf("got %d counter states, want those received within the TTL kept", len(e.counters))
+	}
+	e.expire(received.Add(time.Minute))
+	if len(e.counters) != 1 {
+		t.Fatalf("got %d counter states, want the one of gnb-1 expired", len(e.counters))
+	}
+
+	if out := report("gnb-1", 30, received.Add(20*time.Minute)); len(out) != 0 {
+		t.Errorf("got %+v from an expired counter, want it started again", out)
+	}
+	if out := report("gnb-2", 40, received.Add(20*time.Minute)); len(out) != 1 || out[0].Value != 25 {
+		t.Errorf("got %+v, want the delta to the kept counter", out)
+	}
+}
@@ -57,6 +57,22 @@ func (c *E2ap) SetSubscriptionRequestSequenceNumber(payload []byte, newSubscript
 	return
 }
 
+func (c *E2ap) GetSubscriptionRequestMessage(payload []byte) (decodedMsg *DecodedSubscriptionRequestMessage, err error) {
+	cptr := unsafe.Pointer(&payload[0])
+	decodedMsg = &DecodedSubscriptionRequestMessage{}
+	decodedCMsg := C.e2ap_decode_ric_subscription_request_message(cptr, C.size_t(len(payload)))
+	defer C.free(unsafe.Pointer(decodedCMsg))
+
+	if decodedCMsg == nil {
+		return decodedMsg, errors.New("e2ap wrapper is unable to decode subscription request message due to wrong or invalid payload")
+	}
+
+	decodedMsg.RequestID = int32(decodedCMsg.requestorID)
+	decodedMsg.RequestSequenceNumber = int32(decodedCMsg.requestSequenceNumber)
+	decodedMsg.FuncID = int32(decodedCMsg.ranfunctionID)
+	return
+}
+
 func (c *E2ap) SetSubscriptionRequestPayload(payload []byte, ricRequestorID uint16, ricRequestSequenceNumber uint16, ranFunctionID uint16, eventTriggerDefinition []byte, eventTriggerDefinitionSize int, actionCount int, actionIds []int64, actionTypes []int64, actionDefinitions []ActionDefinition, subsequentActions []SubsequentAction) (newPayload []byte, err error) {
 	cptr := unsafe.Pointer(&payload[0])
 	eventTrigger := unsafe.Pointer(&eventTriggerDefinition[0])
@@ -239,6 +255,7 @@ func (c *E2ap) GetIndicationMessage(payload []byte) (decodedMsg *DecodedIndicati
 	decodedMsg.FuncID = int32(decodedCMsg.ranfunctionID)
 	decodedMsg.ActionID = int32(decodedCMsg.actionID)
 	decodedMsg.IndSN = int32(decodedCMsg.indicationSN)
+	decodedMsg.IndSNPresent = decodedCMsg.indicationSNPresent != 0
 	decodedMsg.IndType = int32(decodedCMsg.indicationType)
 	indhdr := unsafe.Pointer(decodedCMsg.indicationHeader)
 	decodedMsg.IndHeader = C.GoBytes(indhdr, C.int(decodedCMsg.indicationHeaderSize))
@@ -251,3 +268,59 @@ func (c *E2ap) GetIndicationMessage(payload []byte) (decodedMsg *DecodedIndicati
 	decodedMsg.CallProcessIDLength = int32(decodedCMsg.callProcessIDSize)
 	return
 }
+
+// PrintPDU returns the XER dump of an encoded E2AP PDU of any procedure
+func (c *E2ap) PrintPDU(payload []byte) (xer string, err error) {
+	if len(payload) == 0 {
+		return "", errors.New("e2ap wrapper is unable to print PDU due to empty payload")
+	}
+	cptr := unsafe.Pointer(&payload[0])
+	cxer := C.e2ap_print_pdu(cptr, C.size_t(len(payload)))
+	if cxer == nil {
+		return "", errors.New("e2ap wrapper is unable to print PDU due to wrong or invalid payload")
+	}
+	defer C.free(unsafe.Pointer(cxer))
+	return C.GoString(cxer), nil
+}
+
+// GetPDUProcedure returns the message type of an E2AP PDU, 1 for an
+// initiatingMessage, 2 for a successfulOutcome and 3 for an
+// unsuccessfulOutcome, together with its procedure code
+func (c *E2ap) GetPDUProcedure(payload []byte) (messageType int32, procedureCode int64, err error) {
+	if len(payload) == 0 {
+		return 0, 0, errors.New("e2ap wrapper is unable to get PDU procedure due to empty payload")
+	}
+	cptr := unsafe.Pointer(&payload[0])
+	var code C.long
+	present := C.e2ap_get_pdu_procedure(cptr, C.size_t(len(payload)), &code)
+	if present < 0 {
+		return 0, 0, errors.New("e2ap wrapper is unable to get PDU procedure due to wrong or invalid payload")
+	}
+	return int32(present), int64(code), nil
+}
+
+/* E2setupRequest, RICserviceUpdate */
+
+// GetRanFunctionDefinitions returns the RAN functions added by an E2 Setup
+// Request, or added and modified by a RIC Service Update
+func (c *E2ap) GetRanFunctionDefinitions(payload []byte) (ranFunctions []RanFunctionDefinition, err error) {
+	if len(payload) == 0 {
+		return nil, errors.New("e2ap wrapper is unable to decode RAN function definitions due to empty payload")
+	}
+	cptr := unsafe.Pointer(&payload[0])
+	decodedCList := C.e2ap_decode_ran_function_definitions(cptr, C.size_t(len(payload)))
+	if decodedCList == nil {
+		return nil, errors.New("e2ap wrapper is unable to decode RAN function definitions due to wrong or invalid payload")
+	}
+	defer C.e2ap_free_decoded_ran_function_definitions(decodedCList)
+
+	for index := 0; index < int(decodedCList.count); index++ {
+		item := decodedCList.ranFunction[index]
+		ranFunctions = append(ranFunctions, RanFunctionDefinition{
+			ID:         int64(item.ranFunctionID),
+			Revision:   int64(item.ranFunctionRevision),
+			Definition: C.GoBytes(unsafe.Pointer(item.ranFunctionDefinition), C.int(item.ranFunctionDefinitionSize)),
+		})
+	}
+	return
+}
@@ -20,6 +20,7 @@
 package control
 
 /*
+#include <stdlib.h>
 #include <e2sm/wrapper.h>
 #cgo LDFLAGS: -le2smwrapper -lm
 #cgo CFLAGS: -I/usr/local/include/e2sm
@@ -30,7 +31,6 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
-	"strconv"
 	"unsafe"
 )
 
@@ -306,12 +306,12 @@ func (c *E2sm) GetIndicationMessage(buffer []byte) (indMsg *IndicationMessage, e
 
 		if indMsgFormat1_C.measInfoList != nil {
 			indMsgFormat1.MeasInfoCount = int(indMsgFormat1_C.measInfoList.list.count)
-			MeasInfoList := []MeasInfoItem{}
+			MeasInfoList := make([]MeasInfoItem, indMsgFormat1.MeasInfoCount)
 
 			for i := 0; i < indMsgFormat1.MeasInfoCount; i++ {
 				var sizeof_MeasurementInfoItem_t *C.MeasurementInfoItem_t
 				MeasInfoItem_C := *(**C.MeasurementInfoItem_t)(unsafe.Pointer(uintptr(unsafe.Pointer(indMsgFormat1_C.measInfoList.list.array)) + (uintptr)(i)*unsafe.Sizeof(sizeof_MeasurementInfoItem_t)))
-				MeasInfoItem := MeasInfoList[i]
+				MeasInfoItem := &MeasInfoList[i]
 
 				if MeasInfoItem_C.measType.present > 0 {
 					if int32(MeasInfoItem_C.measType.present) == 1 {
@@ -323,18 +323,18 @@ func (c *E2sm) GetIndicationMessage(buffer []byte) (indMsg *IndicationMessage, e
 						MeasInfoItem.Measurement = MeasName
 					} else if int32(MeasInfoItem_C.measType.present) == 2 {
 						MeasInfoItem.MeasType = 2
-						MeasInfoItem.Measurement = int64(MeasInfoItem_C.measType.choice[0])
+						MeasInfoItem.Measurement = int64(*(*C.MeasurementTypeID_t)(unsafe.Pointer(&MeasInfoItem_C.measType.choice[0])))
 					}
 				}
 
 				if MeasInfoItem_C.labelInfoList.list.count > 0 {
 					MeasInfoItem.LabelInfoCount = int(MeasInfoItem_C.labelInfoList.list.count)
-					LabelInfoList := []MeasLabelInfo{}
+					LabelInfoList := make([]MeasLabelInfo, MeasInfoItem.LabelInfoCount)
 
 					for j := 0; j < MeasInfoItem.LabelInfoCount; j++ {
 						var sizeof_MeasurementLabel_t *C.MeasurementLabel_t
 						LabelInfo_C := *(**C.MeasurementLabel_t)(unsafe.Pointer(uintptr(unsafe.Pointer(MeasInfoItem_C.labelInfoList.list.array)) + (uintptr)(j)*unsafe.Sizeof(sizeof_MeasurementLabel_t)))
-						LabelInfo := LabelInfoList[j]
+						LabelInfo := &LabelInfoList[j]
 
 						if LabelInfo_C.plmnID != nil {
 							LabelInfo.PLMNID = &OctetString{}
@@ -413,6 +413,7 @@ func (c *E2sm) GetIndicationMessage(buffer []byte) (indMsg *IndicationMessage, e
 							LabelInfo.StartEndInd = int64(*LabelInfo_C.startEndInd)
 						}
 					}
+					MeasInfoItem.LabelInfoList = LabelInfoList
 				}
 			}
 
@@ -421,24 +422,25 @@ func (c *E2sm) GetIndicationMessage(buffer []byte) (indMsg *IndicationMessage, e
 
 		if indMsgFormat1_C.measData.list.count > 0 {
 			indMsgFormat1.MeasDataCount = int(indMsgFormat1_C.measData.list.count)
-			MeasDataList := []MeasurementRecord{}
+			MeasDataList := make([]MeasurementRecord, indMsgFormat1.MeasDataCount)
 
 			for i := 0; i < indMsgFormat1.MeasDataCount; i++ {
 				var sizeof_MeasurementRecord_t *C.MeasurementRecord_t
 				MeasRecord_C := *(**C.MeasurementRecord_t)(unsafe.Pointer(uintptr(unsafe.Pointer(indMsgFormat1_C.measData.list.array)) + (uintptr)(i)*unsafe.Sizeof(sizeof_MeasurementRecord_t)))
 				MeasDataList[i].MeasRecordCount = int(MeasRecord_C.list.count)
+				MeasDataList[i].MeasRecord = make([]MeasurementRecordItem, MeasDataList[i].MeasRecordCount)
 
 				for j := 0; j < MeasDataList[i].MeasRecordCount; j++ {
 					var sizeof_MeasurementRecordItem_t *C.MeasurementRecordItem_t
-					MeasRecordItem_C := *(**C.MeasurementRecordItem_t)(unsafe.Pointer(uintptr(unsafe.Pointer(indMsgFormat1_C.measData.list.array)) + (uintptr)(j)*unsafe.Sizeof(sizeof_MeasurementRecordItem_t)))
+					MeasRecordItem_C := *(**C.MeasurementRecordItem_t)(unsafe.Pointer(uintptr(unsafe.Pointer(MeasRecord_C.list.array)) + (uintptr)(j)*unsafe.Sizeof(sizeof_MeasurementRecordItem_t)))
 					MeasDataList[i].MeasRecord[j].MeasRecordType = int32(MeasRecordItem_C.present)
 
 					if MeasDataList[i].MeasRecord[j].MeasRecordType == 1 {
-						MeasDataList[i].MeasRecord[j].MeasRecordValue = int64(MeasRecordItem_C.choice[0])
+						MeasDataList[i].MeasRecord[j].MeasRecordValue = int64(*(*C.long)(unsafe.Pointer(&MeasRecordItem_C.choice[0])))
 					} else if MeasDataList[i].MeasRecord[j].MeasRecordType == 2 {
-						MeasDataList[i].MeasRecord[j].MeasRecordValue = float64(MeasRecordItem_C.choice[0])
+						MeasDataList[i].MeasRecord[j].MeasRecordValue = float64(*(*C.double)(unsafe.Pointer(&MeasRecordItem_C.choice[0])))
 					} else if MeasDataList[i].MeasRecord[j].MeasRecordType == 3 {
-						MeasDataList[i].MeasRecord[j].MeasRecordValue = int32(MeasRecordItem_C.choice[0])
+						MeasDataList[i].MeasRecord[j].MeasRecordValue = int32(0)
 					}
 				}
 			}
@@ -472,12 +474,12 @@ func (c *E2sm) GetIndicationMessage(buffer []byte) (indMsg *IndicationMessage, e
 		}
 
 		indMsgFormat2.MeasInfoUeidCount = int(indMsgFormat2_C.measCondUEidList.list.count)
-		MeasInfoUeidList := []MeasInfoUeidItem{}
+		MeasInfoUeidList := make([]MeasInfoUeidItem, indMsgFormat2.MeasInfoUeidCount)
 
 		for i := 0; i < indMsgFormat2.MeasInfoUeidCount; i++ {
 			var sizeof_MeasurementCondUEidItem_t *C.MeasurementCondUEidItem_t
 			MeasInfoUeidItem_C := *(**C.MeasurementCondUEidItem_t)(unsafe.Pointer(uintptr(unsafe.Pointer(indMsgFormat2_C.measCondUEidList.list.array)) + (uintptr)(i)*unsafe.Sizeof(sizeof_MeasurementCondUEidItem_t)))
-			MeasInfoUeidItem := MeasInfoUeidList[i]
+			MeasInfoUeidItem := &MeasInfoUeidList[i]
 
 			if MeasInfoUeidItem_C.measType.present > 0 {
 				if int32(MeasInfoUeidItem_C.measType.present) == 1 {
@@ -489,17 +491,17 @@ func (c *E2sm) GetIndicationMessage(buffer []byte) (indMsg *IndicationMessage, e
 					MeasInfoUeidItem.Measurement = MeasName
 				} else if int32(MeasInfoUeidItem_C.measType.present) == 2 {
 					MeasInfoUeidItem.MeasType = 2
-					MeasInfoUeidItem.Measurement = int64(MeasInfoUeidItem_C.measType.choice[0])
+					MeasInfoUeidItem.Measurement = int64(*(*C.MeasurementTypeID_t)(unsafe.Pointer(&MeasInfoUeidItem_C.measType.choice[0])))
 				}
 			}
 
 			MeasInfoUeidItem.MatchingCondCount = int(MeasInfoUeidItem_C.matchingCond.list.count)
-			MatchingCondList := []MatchingCond{}
+			MatchingCondList := make([]MatchingCond, MeasInfoUeidItem.MatchingCondCount)
 
 			for j := 0; j < MeasInfoUeidItem.MatchingCondCount; j++ {
 				var sizeof_MatchingCondItem_t *C.MatchingCondItem_t
 				MatchingCondItem_C := *(**C.MatchingCondItem_t)(unsafe.Pointer(uintptr(unsafe.Pointer(MeasInfoUeidItem_C.matchingCond.list.array)) + (uintptr)(j)*unsafe.Sizeof(sizeof_MatchingCondItem_t)))
-				MatchingCond := MatchingCondList[j]
+				MatchingCond := &MatchingCondList[j]
 
 				MatchingCond.ConditionType = int32(MatchingCondItem_C.present)
 				if MatchingCond.ConditionType == 1 {
@@ -591,19 +593,22 @@ func (c *E2sm) GetIndicationMessage(buffer []byte) (indMsg *IndicationMessage, e
 					TestInfo.TestConditionType = int32(TestInfo_C.testType.present)
 					TestInfo.Expression = int32(TestInfo_C.testExpr)
 					ValueType := int32(TestInfo_C.testValue.present)
+					TestInfo.ValueType = ValueType
 					switch ValueType {
-					case 1, 2, 3:
-						TestInfo.Value = int64(TestInfo_C.testValue.choice[0])
+					case 1, 2:
+						TestInfo.Value = int64(*(*C.long)(unsafe.Pointer(&TestInfo_C.testValue.choice[0])))
+					case 3:
+						TestInfo.Value = int64(*(*C.BOOLEAN_t)(unsafe.Pointer(&TestInfo_C.testValue.choice[0])))
 					case 4:
 						Value := &BitString{}
-						TestValue := **(**C.BIT_STRING_t)(unsafe.Pointer(&TestInfo_C.testValue.choice[0]))
+						TestValue := *(*C.BIT_STRING_t)(unsafe.Pointer(&TestInfo_C.testValue.choice[0]))
 						Value.Size = int(TestValue.size)
 						Value.Buf = C.GoBytes(unsafe.Pointer(TestValue.buf), C.int(TestValue.size))
 						Value.BitsUnused = int(TestValue.bits_unused)
 						TestInfo.Value = Value
 					case 5, 6:
 						Value := &OctetString{}
-						TestValue := **(**C.OCTET_STRING_t)(unsafe.Pointer(&TestInfo_C.testValue.choice[0]))
+						TestValue := *(*C.OCTET_STRING_t)(unsafe.Pointer(&TestInfo_C.testValue.choice[0]))
 						Value.Size = int(TestValue.size)
 						Value.Buf = C.GoBytes(unsafe.Pointer(TestValue.buf), C.int(TestValue.size))
 						TestInfo.Value = Value
@@ -616,30 +621,44 @@ func (c *E2sm) GetIndicationMessage(buffer []byte) (indMsg *IndicationMessage, e
 					return indMsg, errors.New("Unknown Test Condition type")
 				}
 			}
+			MeasInfoUeidItem.MatchingCondList = MatchingCondList
 
+			if MeasInfoUeidItem_C.matchingUEidList != nil {
+				MeasInfoUeidItem.MatchedUeidCount = int(MeasInfoUeidItem_C.matchingUEidList.list.count)
+				MatchedUeidList := make([]OctetString, MeasInfoUeidItem.MatchedUeidCount)
+
+				for j := 0; j < MeasInfoUeidItem.MatchedUeidCount; j++ {
+					var sizeof_MatchingUEidItem_t *C.MatchingUEidItem_t
+					MatchingUEidItem_C := *(**C.MatchingUEidItem_t)(unsafe.Pointer(uintptr(unsafe.Pointer(MeasInfoUeidItem_C.matchingUEidList.list.array)) + (uintptr)(j)*unsafe.Sizeof(sizeof_MatchingUEidItem_t)))
+					MatchedUeidList[j].Size = int(MatchingUEidItem_C.ueID.size)
+					MatchedUeidList[j].Buf = C.GoBytes(unsafe.Pointer(MatchingUEidItem_C.ueID.buf), C.int(MatchingUEidItem_C.ueID.size))
+				}
+				MeasInfoUeidItem.MatchedUeidList = MatchedUeidList
+			}
 		}
 		indMsgFormat2.MeasInfoUeidList = MeasInfoUeidList
 
 		if indMsgFormat2_C.measData.list.count > 0 {
 			indMsgFormat2.MeasDataCount = int(indMsgFormat2_C.measData.list.count)
-			MeasDataList := []MeasurementRecord{}
+			MeasDataList := make([]MeasurementRecord, indMsgFormat2.MeasDataCount)
 
 			for i := 0; i < indMsgFormat2.MeasDataCount; i++ {
 				var sizeof_MeasurementRecord_t *C.MeasurementRecord_t
 				MeasRecord_C := *(**C.MeasurementRecord_t)(unsafe.Pointer(uintptr(unsafe.Pointer(indMsgFormat2_C.measData.list.array)) + (uintptr)(i)*unsafe.Sizeof(sizeof_MeasurementRecord_t)))
 				MeasDataList[i].MeasRecordCount = int(MeasRecord_C.list.count)
+				MeasDataList[i].MeasRecord = make([]MeasurementRecordItem, MeasDataList[i].MeasRecordCount)
 
 				for j := 0; j < MeasDataList[i].MeasRecordCount; j++ {
 					var sizeof_MeasurementRecordItem_t *C.MeasurementRecordItem_t
-					MeasRecordItem_C := *(**C.MeasurementRecordItem_t)(unsafe.Pointer(uintptr(unsafe.Pointer(indMsgFormat2_C.measData.list.array)) + (uintptr)(j)*unsafe.Sizeof(sizeof_MeasurementRecordItem_t)))
+					MeasRecordItem_C := *(**C.MeasurementRecordItem_t)(unsafe.Pointer(uintptr(unsafe.Pointer(MeasRecord_C.list.array)) + (uintptr)(j)*unsafe.Sizeof(sizeof_MeasurementRecordItem_t)))
 					MeasDataList[i].MeasRecord[j].MeasRecordType = int32(MeasRecordItem_C.present)
 
 					if MeasDataList[i].MeasRecord[j].MeasRecordType == 1 {
-						MeasDataList[i].MeasRecord[j].MeasRecordValue = int64(MeasRecordItem_C.choice[0])
+						MeasDataList[i].MeasRecord[j].MeasRecordValue = int64(*(*C.long)(unsafe.Pointer(&MeasRecordItem_C.choice[0])))
 					} else if MeasDataList[i].MeasRecord[j].MeasRecordType == 2 {
-						MeasDataList[i].MeasRecord[j].MeasRecordValue = float64(MeasRecordItem_C.choice[0])
+						MeasDataList[i].MeasRecord[j].MeasRecordValue = float64(*(*C.double)(unsafe.Pointer(&MeasRecordItem_C.choice[0])))
 					} else if MeasDataList[i].MeasRecord[j].MeasRecordType == 3 {
-						MeasDataList[i].MeasRecord[j].MeasRecordValue = int32(MeasRecordItem_C.choice[0])
+						MeasDataList[i].MeasRecord[j].MeasRecordValue = int32(0)
 					}
 				}
 			}
@@ -655,85 +674,60 @@ func (c *E2sm) GetIndicationMessage(buffer []byte) (indMsg *IndicationMessage, e
 	return
 }
 
-func (c *E2sm) ParseNRCGI(nRCGI NRCGIType) (CellID string, err error) {
-	var plmnID OctetString
-	var nrCellID BitString
-
-	plmnID = nRCGI.PlmnID
-	CellID, _ = c.ParsePLMNIdentity(plmnID.Buf, plmnID.Size)
-
-	nrCellID = nRCGI.NRCellID
-
-	if plmnID.Size != 3 || nrCellID.Size != 5 {
-		return "", errors.New("Invalid input: illegal length of NRCGI")
+// PrintIndicationHeader returns the XER dump of an encoded IndicationHeader
+func (c *E2sm) PrintIndicationHeader(buffer []byte) (xer string, err error) {
+	if len(buffer) == 0 {
+		return "", errors.New("e2sm wrapper is unable to print IndicationHeader due to empty input")
 	}
+	cptr := unsafe.Pointer(&buffer[0])
+	cxer := C.e2sm_print_ric_indication_header(cptr, C.size_t(len(buffer)))
+	if cxer == nil {
+		return "", errors.New("e2sm wrapper is unable to print IndicationHeader due to wrong or invalid input")
+	}
+	defer C.free(unsafe.Pointer(cxer))
+	return C.GoString(cxer), nil
+}
 
-	var former []uint8 = make([]uint8, 3)
-	var latter []uint8 = make([]uint8, 6)
-
-	former[0] = nrCellID.Buf[0] >> 4
-	former[1] = nrCellID.Buf[0] & 0xf
-	former[2] = nrCellID.Buf[1] >> 4
-	latter[0] = nrCellID.Buf[1] & 0xf
-	latter[1] = nrCellID.Buf[2] >> 4
-	latter[2] = nrCellID.Buf[2] & 0xf
-	latter[3] = nrCellID.Buf[3] >> 4
-	latter[4] = nrCellID.Buf[3] & 0xf
-	latter[5] = nrCellID.Buf[4] >> uint(nrCellID.BitsUnused)
-
-	CellID = CellID + strconv.Itoa(int(former[0])) + strconv.Itoa(int(former[1])) + strconv.Itoa(int(former[2])) + strconv.Itoa(int(latter[0])) + strconv.Itoa(int(latter[1])) + strconv.Itoa(int(latter[2])) + strconv.Itoa(int(latter[3])) + strconv.Itoa(int(latter[4])) + strconv.Itoa(int(latter[5]))
+// PrintIndicationMessage returns the XER dump of an encoded IndicationMessage
+func (c *E2sm) PrintIndicationMessage(buffer []byte) (xer string, err error) {
+	if len(buffer) == 0 {
+		return "", errors.New("e2sm wrapper is unable to print IndicationMessage due to empty input")
+	}
+	cptr := unsafe.Pointer(&buffer[0])
+	cxer := C.e2sm_print_ric_indication_message(cptr, C.size_t(len(buffer)))
+	if cxer == nil {
+		return "", errors.New("e2sm wrapper is unable to print IndicationMessage due to wrong or invalid input")
+	}
+	defer C.free(unsafe.Pointer(cxer))
+	return C.GoString(cxer), nil
+}
 
-	return
+func (c *E2sm) ParseNRCGI(nRCGI NRCGIType) (CellID string, err error) {
+	return DecodeNRCGI(nRCGI)
 }
 
 func (c *E2sm) ParsePLMNIdentity(buffer []byte, size int) (PlmnID string, err error) {
-	if size != 3 {
+	if size != 3 || len(buffer) < size {
 		return "", errors.New("Invalid input: illegal length of PlmnID")
 	}
 
-	var mcc []uint8 = make([]uint8, 3)
-	var mnc []uint8 = make([]uint8, 3)
-
-	mcc[0] = buffer[0] >> 4
-	mcc[1] = buffer[0] & 0xf
-	mcc[2] = buffer[1] >> 4
-	mnc[0] = buffer[1] & 0xf
-	mnc[1] = buffer[2] >> 4
-	mnc[2] = buffer[2] & 0xf
-
-	if mnc[0] == 0xf {
-		PlmnID = strconv.Itoa(int(mcc[0])) + strconv.Itoa(int(mcc[1])) + strconv.Itoa(int(mcc[2])) + strconv.Itoa(int(mnc[1])) + strconv.Itoa(int(mnc[2]))
-	} else {
-		PlmnID = strconv.Itoa(int(mcc[0])) + strconv.Itoa(int(mcc[1])) + strconv.Itoa(int(mcc[2])) + strconv.Itoa(int(mnc[0])) + strconv.Itoa(int(mnc[1])) + strconv.Itoa(int(mnc[2]))
+	plmn, err := DecodePLMNIdentity(buffer[:size])
+	if err != nil {
+		return "", err
 	}
-
-	return
+	return plmn.String(), nil
 }
 
 func (c *E2sm) ParseSliceID(sliceID SliceIDType) (combined int32, err error) {
-	if sliceID.SST.Size != 1 || (sliceID.SD != nil && sliceID.SD.Size != 3) {
-		return 0, errors.New("Invalid input: illegal length of sliceID")
+	snssai, err := DecodeSNSSAI(sliceID)
+	if err != nil {
+		return 0, err
 	}
 
-	var temp uint8
-	var sst int32
-	var sd int32
-
-	byteBuffer := bytes.NewBuffer(sliceID.SST.Buf)
-	binary.Read(byteBuffer, binary.BigEndian, &temp)
-	sst = int32(temp)
-
-	if sliceID.SD == nil {
-		combined = sst << 24
-	} else {
-		for i := 0; i < sliceID.SD.Size; i++ {
-			byteBuffer = bytes.NewBuffer(sliceID.SD.Buf[i : i+1])
-			binary.Read(byteBuffer, binary.BigEndian, &temp)
-			sd = sd*256 + int32(temp)
-		}
-		combined = sst<<24 + sd
+	combined = int32(snssai.SST) << 24
+	if snssai.SD != nil {
+		combined += int32(*snssai.SD)
 	}
-
 	return
 }
 
@@ -751,24 +745,62 @@ func (c *E2sm) ParseInteger(buffer []byte, size int) (value int64, err error) {
 }
 
 func (c *E2sm) ParseTimestamp(buffer []byte, size int) (timestamp *Timestamp, err error) {
-	var temp uint8
-	var byteBuffer *bytes.Buffer
-	var index int
-	var sec int64
-	var nsec int64
+	if size > len(buffer) {
+		return nil, errors.New("Invalid input: illegal length of TimeStamp")
+	}
 
-	for index := 0; index < size-8; index++ {
-		byteBuffer = bytes.NewBuffer(buffer[index : index+1])
-		binary.Read(byteBuffer, binary.BigEndian, &temp)
-		sec = sec*256 + int64(temp)
+	t, err := ntpTime(buffer[:size])
+	if err != nil {
+		return nil, err
 	}
 
-	for index = size - 8; index < size; index++ {
-		byteBuffer = bytes.NewBuffer(buffer[index : index+1])
-		binary.Read(byteBuffer, binary.BigEndian, &temp)
-		nsec = nsec*256 + int64(temp)
+	timestamp = &Timestamp{TVsec: t.Unix(), TVnsec: int64(t.Nanosecond())}
+	return
+}
+
+// GetMeasurementMappings returns the MeasurementTypeIDs a node advertises in
+// the report styles of its E2SM-KPM RAN function description. Measurements
+// advertised without an ID are left out.
+func (c *E2sm) GetMeasurementMappings(buffer []byte) (mappings []MeasurementMapping, err error) {
+	if len(buffer) == 0 {
+		return nil, errors.New("e2sm wrapper is unable to get RAN function description due to empty input")
+	}
+	cptr := unsafe.Pointer(&buffer[0])
+	desc := C.e2sm_decode_ran_function_description(cptr, C.size_t(len(buffer)))
+	if desc == nil {
+		return nil, errors.New("e2sm wrapper is unable to get RAN function description due to wrong or invalid input")
+	}
+	defer C.e2sm_free_ran_function_description(desc)
+
+	shortName := C.GoBytes(unsafe.Pointer(desc.ranFunction_Name.ranFunction_ShortName.buf), C.int(desc.ranFunction_Name.ranFunction_ShortName.size))
+	if !bytes.Contains(shortName, []byte("KPM")) {
+		return nil, errors.New("RAN function " + string(shortName) + " is not E2SM-KPM")
+	}
+	if desc.ric_ReportStyle_List == nil {
+		return
 	}
 
-	timestamp = &Timestamp{TVsec: sec, TVnsec: nsec}
+	seen := make(map[int64]bool)
+	for i := 0; i < int(desc.ric_ReportStyle_List.list.count); i++ {
+		var sizeof_RIC_ReportStyle_Item_t *C.RIC_ReportStyle_Item_t
+		ReportStyle_C := *(**C.RIC_ReportStyle_Item_t)(unsafe.Pointer(uintptr(unsafe.Pointer(desc.ric_ReportStyle_List.list.array)) + (uintptr)(i)*unsafe.Sizeof(sizeof_RIC_ReportStyle_Item_t)))
+
+		for j := 0; j < int(ReportStyle_C.measInfo_Action_List.list.count); j++ {
+			var sizeof_MeasurementInfo_Action_Item_t *C.MeasurementInfo_Action_Item_t
+			ActionItem_C := *(**C.MeasurementInfo_Action_Item_t)(unsafe.Pointer(uintptr(unsafe.Pointer(ReportStyle_C.measInfo_Action_List.list.array)) + (uintptr)(j)*unsafe.Sizeof(sizeof_MeasurementInfo_Action_Item_t)))
+			if ActionItem_C.measID == nil {
+				continue
+			}
+			id := int64(*ActionItem_C.measID)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			mappings = append(mappings, MeasurementMapping{
+				ID:   id,
+				Name: string(C.GoBytes(unsafe.Pointer(ActionItem_C.measName.buf), C.int(ActionItem_C.measName.size))),
+			})
+		}
+	}
 	return
 }
@@ -0,0 +1,1066 @@
+package control
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// JSON encodings of the decoded E2AP and E2SM types:
+//
+//	OCTET STRING       hex, "0a0b0c"
+//	PrintableString    string, "DRB.UEThpDl"
+//	INTEGER            number, or "0x" and the hex of the two's complement
+//	                   octets when it does not fit 64 bits, 1234
+//	BIT STRING         hex of the octets and the length in bits,
+//	                   {"value": "b5c67788", "bits": 32}
+//	PLMN identity      canonical form, or "0x" and the hex of the octets when
+//	                   it is not a valid TBCD PLMN identity, "310410"
+//	CHOICE             the number of the alternative in the type field next to
+//	                   the value, {"format": 1, "message": {...}}
+//	measurement value  record type 1 integer, 2 real, 3 no value,
+//	                   {"type": 2, "value": 12.5}
+//	SEQUENCE OF        array of the used elements, element counts and buffer
+//	                   lengths are omitted and restored when decoding
+//
+// Every encoding decodes back to the same Go value.
+
+// alternatives of the CHOICE types by number, holding a value of the Go type
+// the decoders use for the alternative
+var (
+	gnbIDAlternatives    = map[int]interface{}{1: (*GNBID)(nil)}
+	engnbIDAlternatives  = map[int]interface{}{1: (*ENGNBID)(nil)}
+	ngenbIDAlternatives  = map[int]interface{}{1: (*NGENBID_Macro)(nil), 2: (*NGENBID_ShortMacro)(nil), 3: (*NGENBID_LongMacro)(nil)}
+	enbIDAlternatives    = map[int]interface{}{1: (*ENBID_Macro)(nil), 2: (*ENBID_Home)(nil), 3: (*ENBID_ShortMacro)(nil), 4: (*ENBID_LongMacro)(nil)}
+	nodeIDAlternatives   = map[int]interface{}{1: (*GlobalKPMnodegNBIDType)(nil), 2: (*GlobalKPMnodeengNBIDType)(nil), 3: (*GlobalKPMnodengeNBIDType)(nil), 4: (*GlobalKPMnodeeNBIDType)(nil)}
+	gnbNameAlternatives  = map[int]interface{}{1: (*GNB_DU_Name)(nil), 2: (*GNB_CU_CP_Name)(nil), 3: (*GNB_CU_UP_Name)(nil)}
+	headerAlternatives   = map[int]interface{}{1: (*IndicationHeaderFormat1)(nil)}
+	messageAlternatives  = map[int]interface{}{1: (*IndicationMessageFormat1)(nil), 2: (*IndicationMessageFormat2)(nil)}
+	pfAlternatives       = map[int]interface{}{1: (*ODUPFContainerType)(nil), 2: (*OCUCPPFContainerType)(nil), 3: (*OCUUPPFContainerType)(nil)}
+	ranAlternatives      = map[int]interface{}{1: (*DUUsageReportType)(nil), 2: (*CUCPUsageReportType)(nil), 3: (*CUUPUsageReportType)(nil)}
+	measTypeAlternatives = map[int]interface{}{1: (*PrintableString)(nil), 2: int64(0)}
+	recordAlternatives   = map[int]interface{}{1: int64(0), 2: float64(0), 3: int32(0)}
+	condAlternatives     = map[int]interface{}{1: (*MeasLabelInfo)(nil), 2: (*TestConditionInfo)(nil)}
+	testAlternatives     = map[int]interface{}{1: int64(0), 2: int64(0), 3: int64(0), 4: (*BitString)(nil), 5: (*OctetString)(nil), 6: (*OctetString)(nil)}
+)
+
+// unmarshalChoice decodes the value of a CHOICE as the alternative n, an
+// absent value leaves the CHOICE empty
+func unmarshalChoice(raw json.RawMessage, alternatives map[int]interface{}, n int, value *interface{}) error {
+	*value = nil
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	alternative, ok := alternatives[n]
+	if !ok {
+		return fmt.Errorf("unknown CHOICE alternative %d", n)
+	}
+	t := reflect.TypeOf(alternative)
+	if t.Kind() == reflect.Ptr {
+		v := reflect.New(t.Elem())
+		if err := unmarshalValue(raw, v.Elem()); err != nil {
+			return err
+		}
+		*value = v.Interface()
+		return nil
+	}
+	v := reflect.New(t)
+	if err := json.Unmarshal(raw, v.Interface()); err != nil {
+		return err
+	}
+	*value = v.Elem().Interface()
+	return nil
+}
+
+// hexBytes is a byte slice encoded in hex instead of base64
+type hexBytes []byte
+
+func (b hexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(b))
+}
+
+func (b *hexBytes) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	buf, err := hex.DecodeString(str)
+	if err != nil {
+		return err
+	}
+	*b = buf
+	return nil
+}
+
+// parseHex decodes the hex form of the INTEGER and PLMN identity encodings
+func parseHex(str string) ([]byte, bool, error) {
+	if !strings.HasPrefix(str, "0x") {
+		return nil, false, nil
+	}
+	buf, err := hex.DecodeString(str[2:])
+	return buf, true, err
+}
+
+func (o OctetString) MarshalJSON() ([]byte, error) {
+	return hexBytes(octets(o)).MarshalJSON()
+}
+
+func (o *OctetString) UnmarshalJSON(data []byte) error {
+	var buf hexBytes
+	if err := buf.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*o = OctetString{Buf: buf, Size: len(buf)}
+	return nil
+}
+
+func (p PrintableString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(octets(OctetString(p))))
+}
+
+func (p *PrintableString) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	*p = PrintableString{Buf: []byte(str), Size: len(str)}
+	return nil
+}
+
+func (i Integer) MarshalJSON() ([]byte, error) {
+	buf := octets(OctetString(i))
+	if len(buf) == 0 || len(buf) > 8 {
+		return json.Marshal("0x" + hex.EncodeToString(buf))
+	}
+	value := int64(int8(buf[0]))
+	for _, b := range buf[1:] {
+		value = value<<8 | int64(b)
+	}
+	return json.Marshal(value)
+}
+
+// UnmarshalJSON encodes a number in the minimal two's complement octets, as
+// the ASN.1 decoder does
+func (i *Integer) UnmarshalJSON(data []byte) error {
+	var str string
+	if json.Unmarshal(data, &str) == nil {
+		buf, ok, err := parseHex(str)
+		if err != nil {
+			return err
+		} else if !ok {
+			return errors.New("invalid INTEGER " + str)
+		}
+		*i = Integer{Buf: buf, Size: len(buf)}
+		return nil
+	}
+
+	var value int64
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(value))
+	for len(buf) > 1 && (buf[0] == 0 && buf[1]&0x80 == 0 || buf[0] == 0xff && buf[1]&0x80 != 0) {
+		buf = buf[1:]
+	}
+	*i = Integer{Buf: buf, Size: len(buf)}
+	return nil
+}
+
+type bitStringJSON struct {
+	Value string `json:"value"`
+	Bits  int    `json:"bits"`
+}
+
+func (b BitString) MarshalJSON() ([]byte, error) {
+	buf := b.Buf
+	if b.Size >= 0 && b.Size <= len(buf) {
+		buf = buf[:b.Size]
+	}
+	return json.Marshal(bitStringJSON{Value: hex.EncodeToString(buf), Bits: len(buf)*8 - b.BitsUnused})
+}
+
+func (b *BitString) UnmarshalJSON(data []byte) error {
+	var v bitStringJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	buf, err := hex.DecodeString(v.Value)
+	if err != nil {
+		return err
+	}
+	unused := len(buf)*8 - v.Bits
+	if unused < 0 || unused > 7 {
+		return fmt.Errorf("invalid BIT STRING length %d for %d octets", v.Bits, len(buf))
+	}
+	*b = BitString{Buf: buf, Size: len(buf), BitsUnused: unused}
+	return nil
+}
+
+func (id GNBID) MarshalJSON() ([]byte, error) {
+	return BitString(id).MarshalJSON()
+}
+
+func (id *GNBID) UnmarshalJSON(data []byte) error {
+	return (*BitString)(id).UnmarshalJSON(data)
+}
+
+func (id ENGNBID) MarshalJSON() ([]byte, error) {
+	return BitString(id).MarshalJSON()
+}
+
+func (id *ENGNBID) UnmarshalJSON(data []byte) error {
+	return (*BitString)(id).UnmarshalJSON(data)
+}
+
+func (id NGENBID_Macro) MarshalJSON() ([]byte, error) {
+	return BitString(id).MarshalJSON()
+}
+
+func (id *NGENBID_Macro) UnmarshalJSON(data []byte) error {
+	return (*BitString)(id).UnmarshalJSON(data)
+}
+
+func (id NGENBID_ShortMacro) MarshalJSON() ([]byte, error) {
+	return BitString(id).MarshalJSON()
+}
+
+func (id *NGENBID_ShortMacro) UnmarshalJSON(data []byte) error {
+	return (*BitString)(id).UnmarshalJSON(data)
+}
+
+func (id NGENBID_LongMacro) MarshalJSON() ([]byte, error) {
+	return BitString(id).MarshalJSON()
+}
+
+func (id *NGENBID_LongMacro) UnmarshalJSON(data []byte) error {
+	return (*BitString)(id).UnmarshalJSON(data)
+}
+
+func (id ENBID_Macro) MarshalJSON() ([]byte, error) {
+	return BitString(id).MarshalJSON()
+}
+
+func (id *ENBID_Macro) UnmarshalJSON(data []byte) error {
+	return (*BitString)(id).UnmarshalJSON(data)
+}
+
+func (id ENBID_Home) MarshalJSON() ([]byte, error) {
+	return BitString(id).MarshalJSON()
+}
+
+func (id *ENBID_Home) UnmarshalJSON(data []byte) error {
+	return (*BitString)(id).UnmarshalJSON(data)
+}
+
+func (id ENBID_ShortMacro) MarshalJSON() ([]byte, error) {
+	return BitString(id).MarshalJSON()
+}
+
+func (id *ENBID_ShortMacro) UnmarshalJSON(data []byte) error {
+	return (*BitString)(id).UnmarshalJSON(data)
+}
+
+func (id ENBID_LongMacro) MarshalJSON() ([]byte, error) {
+	return BitString(id).MarshalJSON()
+}
+
+func (id *ENBID_LongMacro) UnmarshalJSON(data []byte) error {
+	return (*BitString)(id).UnmarshalJSON(data)
+}
+
+func (n MeasName) MarshalJSON() ([]byte, error) {
+	return PrintableString(n).MarshalJSON()
+}
+
+func (n *MeasName) UnmarshalJSON(data []byte) error {
+	return (*PrintableString)(n).UnmarshalJSON(data)
+}
+
+func (n GNB_DU_Name) MarshalJSON() ([]byte, error) {
+	return PrintableString(n).MarshalJSON()
+}
+
+func (n *GNB_DU_Name) UnmarshalJSON(data []byte) error {
+	return (*PrintableString)(n).UnmarshalJSON(data)
+}
+
+func (n GNB_CU_CP_Name) MarshalJSON() ([]byte, error) {
+	return PrintableString(n).MarshalJSON()
+}
+
+func (n *GNB_CU_CP_Name) UnmarshalJSON(data []byte) error {
+	return (*PrintableString)(n).UnmarshalJSON(data)
+}
+
+func (n GNB_CU_UP_Name) MarshalJSON() ([]byte, error) {
+	return PrintableString(n).MarshalJSON()
+}
+
+func (n *GNB_CU_UP_Name) UnmarshalJSON(data []byte) error {
+	return (*PrintableString)(n).UnmarshalJSON(data)
+}
+
+func (d ActionDefinition) MarshalJSON() ([]byte, error) {
+	return OctetString(d).MarshalJSON()
+}
+
+func (d *ActionDefinition) UnmarshalJSON(data []byte) error {
+	return (*OctetString)(d).UnmarshalJSON(data)
+}
+
+// plmnJSON is an OCTET STRING holding a PLMN identity
+type plmnJSON OctetString
+
+func (p plmnJSON) MarshalJSON() ([]byte, error) {
+	buf := octets(OctetString(p))
+	plmn, err := DecodePLMNIdentity(buf)
+	if err != nil {
+		return json.Marshal("0x" + hex.EncodeToString(buf))
+	}
+	return json.Marshal(plmn.String())
+}
+
+func (p *plmnJSON) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	buf, ok, err := parseHex(str)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		plmn, err := ParsePLMN(str)
+		if err != nil {
+			return err
+		}
+		buf = plmn.Encode()
+	}
+	*p = plmnJSON{Buf: buf, Size: len(buf)}
+	return nil
+}
+
+func (m DecodedIndicationMessage) MarshalJSON() ([]byte, error) {
+	type plain DecodedIndicationMessage
+	var indSN *int32
+	if m.IndSNPresent {
+		indSN = &m.IndSN
+	}
+	return json.Marshal(struct {
+		plain
+		IndSN         *int32   `json:"indicationSN,omitempty"`
+		IndHeader     hexBytes `json:"indicationHeader"`
+		IndMessage    hexBytes `json:"indicationMessage"`
+		CallProcessID hexBytes `json:"callProcessId"`
+	}{plain(m), indSN, m.IndHeader, m.IndMessage, m.CallProcessID})
+}
+
+func (m *DecodedIndicationMessage) UnmarshalJSON(data []byte) error {
+	type plain DecodedIndicationMessage
+	v := struct {
+		*plain
+		IndSN         *int32   `json:"indicationSN"`
+		IndHeader     hexBytes `json:"indicationHeader"`
+		IndMessage    hexBytes `json:"indicationMessage"`
+		CallProcessID hexBytes `json:"callProcessId"`
+	}{plain: (*plain)(m)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	m.IndSN, m.IndSNPresent = 0, v.IndSN != nil
+	if v.IndSN != nil {
+		m.IndSN = *v.IndSN
+	}
+	m.IndHeader, m.IndHeaderLength = v.IndHeader, int32(len(v.IndHeader))
+	m.IndMessage, m.IndMessageLength = v.IndMessage, int32(len(v.IndMessage))
+	m.CallProcessID, m.CallProcessIDLength = v.CallProcessID, int32(len(v.CallProcessID))
+	return nil
+}
+
+func (l ActionAdmittedListType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.ActionID[:clampCount(l.Count, len(l.ActionID))])
+}
+
+func (l *ActionAdmittedListType) UnmarshalJSON(data []byte) error {
+	var ids []int32
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return err
+	}
+	if len(ids) > len(l.ActionID) {
+		return fmt.Errorf("more than %d admitted actions", len(l.ActionID))
+	}
+	*l = ActionAdmittedListType{Count: len(ids)}
+	copy(l.ActionID[:], ids)
+	return nil
+}
+
+type actionNotAdmittedJSON struct {
+	ActionID int32         `json:"actionId"`
+	Cause    CauseItemType `json:"cause"`
+}
+
+func (l ActionNotAdmittedListType) MarshalJSON() ([]byte, error) {
+	actions := []actionNotAdmittedJSON{}
+	for i := 0; i < clampCount(l.Count, len(l.ActionID)); i++ {
+		actions = append(actions, actionNotAdmittedJSON{ActionID: l.ActionID[i], Cause: l.Cause[i]})
+	}
+	return json.Marshal(actions)
+}
+
+func (l *ActionNotAdmittedListType) UnmarshalJSON(data []byte) error {
+	var actions []actionNotAdmittedJSON
+	if err := json.Unmarshal(data, &actions); err != nil {
+		return err
+	}
+	if len(actions) > len(l.ActionID) {
+		return fmt.Errorf("more than %d not admitted actions", len(l.ActionID))
+	}
+	*l = ActionNotAdmittedListType{Count: len(actions)}
+	for i, action := range actions {
+		l.ActionID[i], l.Cause[i] = action.ActionID, action.Cause
+	}
+	return nil
+}
+
+func (g GlobalgNBIDType) MarshalJSON() ([]byte, error) {
+	type plain GlobalgNBIDType
+	return json.Marshal(struct {
+		plain
+		PlmnID plmnJSON `json:"plmnId"`
+	}{plain(g), plmnJSON(g.PlmnID)})
+}
+
+func (g *GlobalgNBIDType) UnmarshalJSON(data []byte) error {
+	type plain GlobalgNBIDType
+	v := struct {
+		*plain
+		PlmnID plmnJSON        `json:"plmnId"`
+		GnbID  json.RawMessage `json:"gnbId"`
+	}{plain: (*plain)(g)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	g.PlmnID = OctetString(v.PlmnID)
+	return unmarshalChoice(v.GnbID, gnbIDAlternatives, g.GnbIDType, &g.GnbID)
+}
+
+func (g GlobalKPMnodeengNBIDType) MarshalJSON() ([]byte, error) {
+	type plain GlobalKPMnodeengNBIDType
+	return json.Marshal(struct {
+		plain
+		PlmnID plmnJSON `json:"plmnId"`
+	}{plain(g), plmnJSON(g.PlmnID)})
+}
+
+func (g *GlobalKPMnodeengNBIDType) UnmarshalJSON(data []byte) error {
+	type plain GlobalKPMnodeengNBIDType
+	v := struct {
+		*plain
+		PlmnID plmnJSON        `json:"plmnId"`
+		GnbID  json.RawMessage `json:"gnbId"`
+	}{plain: (*plain)(g)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	g.PlmnID = OctetString(v.PlmnID)
+	return unmarshalChoice(v.GnbID, engnbIDAlternatives, g.GnbIDType, &g.GnbID)
+}
+
+func (g GlobalKPMnodengeNBIDType) MarshalJSON() ([]byte, error) {
+	type plain GlobalKPMnodengeNBIDType
+	return json.Marshal(struct {
+		plain
+		PlmnID plmnJSON `json:"plmnId"`
+	}{plain(g), plmnJSON(g.PlmnID)})
+}
+
+func (g *GlobalKPMnodengeNBIDType) UnmarshalJSON(data []byte) error {
+	type plain GlobalKPMnodengeNBIDType
+	v := struct {
+		*plain
+		PlmnID plmnJSON        `json:"plmnId"`
+		EnbID  json.RawMessage `json:"enbId"`
+	}{plain: (*plain)(g)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	g.PlmnID = OctetString(v.PlmnID)
+	return unmarshalChoice(v.EnbID, ngenbIDAlternatives, g.EnbIDType, &g.EnbID)
+}
+
+func (g GlobalKPMnodeeNBIDType) MarshalJSON() ([]byte, error) {
+	type plain GlobalKPMnodeeNBIDType
+	return json.Marshal(struct {
+		plain
+		PlmnID plmnJSON `json:"plmnId"`
+	}{plain(g), plmnJSON(g.PlmnID)})
+}
+
+func (g *GlobalKPMnodeeNBIDType) UnmarshalJSON(data []byte) error {
+	type plain GlobalKPMnodeeNBIDType
+	v := struct {
+		*plain
+		PlmnID plmnJSON        `json:"plmnId"`
+		EnbID  json.RawMessage `json:"enbId"`
+	}{plain: (*plain)(g)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	g.PlmnID = OctetString(v.PlmnID)
+	return unmarshalChoice(v.EnbID, enbIDAlternatives, g.EnbIDType, &g.EnbID)
+}
+
+func (n NRCGIType) MarshalJSON() ([]byte, error) {
+	type plain NRCGIType
+	return json.Marshal(struct {
+		plain
+		PlmnID plmnJSON `json:"plmnId"`
+	}{plain(n), plmnJSON(n.PlmnID)})
+}
+
+func (n *NRCGIType) UnmarshalJSON(data []byte) error {
+	type plain NRCGIType
+	v := struct {
+		*plain
+		PlmnID plmnJSON `json:"plmnId"`
+	}{plain: (*plain)(n)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	n.PlmnID = OctetString(v.PlmnID)
+	return nil
+}
+
+func (h IndicationHeaderFormat1) MarshalJSON() ([]byte, error) {
+	type plain IndicationHeaderFormat1
+	return json.Marshal(struct {
+		plain
+		PlmnID *plmnJSON `json:"plmnId,omitempty"`
+	}{plain(h), (*plmnJSON)(h.PlmnID)})
+}
+
+func (h *IndicationHeaderFormat1) UnmarshalJSON(data []byte) error {
+	type plain IndicationHeaderFormat1
+	v := struct {
+		*plain
+		PlmnID          *plmnJSON       `json:"plmnId"`
+		GlobalKPMnodeID json.RawMessage `json:"globalKPMnodeId"`
+		GnbName         json.RawMessage `json:"gnbName"`
+	}{plain: (*plain)(h)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	h.PlmnID = (*OctetString)(v.PlmnID)
+	if err := unmarshalChoice(v.GlobalKPMnodeID, nodeIDAlternatives, int(h.GlobalKPMnodeIDType), &h.GlobalKPMnodeID); err != nil {
+		return err
+	}
+	return unmarshalChoice(v.GnbName, gnbNameAlternatives, int(h.GnbNameType), &h.GnbName)
+}
+
+func (h *IndicationHeader) UnmarshalJSON(data []byte) error {
+	type plain IndicationHeader
+	v := struct {
+		*plain
+		IndHdr json.RawMessage `json:"header"`
+	}{plain: (*plain)(h)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return unmarshalChoice(v.IndHdr, headerAlternatives, int(h.IndHdrType), &h.IndHdr)
+}
+
+func (s ServedPlmnPerCellType) MarshalJSON() ([]byte, error) {
+	type plain ServedPlmnPerCellType
+	return json.Marshal(struct {
+		plain
+		PlmnID  plmnJSON    `json:"plmnId"`
+		DUPM5GC interface{} `json:"duPm5gc,omitempty"`
+		DUPMEPC interface{} `json:"duPmEpc,omitempty"`
+	}{plain(s), plmnJSON(s.PlmnID), counted(s.DUPM5GC), counted(s.DUPMEPC)})
+}
+
+func (s *ServedPlmnPerCellType) UnmarshalJSON(data []byte) error {
+	type plain ServedPlmnPerCellType
+	v := struct {
+		*plain
+		PlmnID  plmnJSON        `json:"plmnId"`
+		DUPM5GC json.RawMessage `json:"duPm5gc"`
+		DUPMEPC json.RawMessage `json:"duPmEpc"`
+	}{plain: (*plain)(s)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	s.PlmnID = OctetString(v.PlmnID)
+	if err := unmarshalCountedPtr(v.DUPM5GC, &s.DUPM5GC); err != nil {
+		return err
+	}
+	return unmarshalCountedPtr(v.DUPMEPC, &s.DUPMEPC)
+}
+
+func (p CUUPPlmnType) MarshalJSON() ([]byte, error) {
+	type plain CUUPPlmnType
+	return json.Marshal(struct {
+		plain
+		PlmnID    plmnJSON    `json:"plmnId"`
+		CUUPPM5GC interface{} `json:"cuUpPm5gc,omitempty"`
+		CUUPPMEPC interface{} `json:"cuUpPmEpc,omitempty"`
+	}{plain(p), plmnJSON(p.PlmnID), counted(p.CUUPPM5GC), counted(p.CUUPPMEPC)})
+}
+
+func (p *CUUPPlmnType) UnmarshalJSON(data []byte) error {
+	type plain CUUPPlmnType
+	v := struct {
+		*plain
+		PlmnID    plmnJSON        `json:"plmnId"`
+		CUUPPM5GC json.RawMessage `json:"cuUpPm5gc"`
+		CUUPPMEPC json.RawMessage `json:"cuUpPmEpc"`
+	}{plain: (*plain)(p)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	p.PlmnID = OctetString(v.PlmnID)
+	if err := unmarshalCountedPtr(v.CUUPPM5GC, &p.CUUPPM5GC); err != nil {
+		return err
+	}
+	return unmarshalCountedPtr(v.CUUPPMEPC, &p.CUUPPMEPC)
+}
+
+func (c PFContainerType) MarshalJSON() ([]byte, error) {
+	type plain PFContainerType
+	return json.Marshal(struct {
+		plain
+		Container interface{} `json:"container,omitempty"`
+	}{plain(c), counted(c.Container)})
+}
+
+func (c *PFContainerType) UnmarshalJSON(data []byte) error {
+	type plain PFContainerType
+	v := struct {
+		*plain
+		Container json.RawMessage `json:"container"`
+	}{plain: (*plain)(c)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return unmarshalChoice(v.Container, pfAlternatives, int(c.ContainerType), &c.Container)
+}
+
+func (c RANContainerType) MarshalJSON() ([]byte, error) {
+	type plain RANContainerType
+	return json.Marshal(struct {
+		plain
+		Container interface{} `json:"container,omitempty"`
+	}{plain(c), counted(c.Container)})
+}
+
+func (c *RANContainerType) UnmarshalJSON(data []byte) error {
+	type plain RANContainerType
+	v := struct {
+		*plain
+		Container json.RawMessage `json:"container"`
+	}{plain: (*plain)(c)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return unmarshalChoice(v.Container, ranAlternatives, int(c.ContainerType), &c.Container)
+}
+
+func (l MeasLabelInfo) MarshalJSON() ([]byte, error) {
+	type plain MeasLabelInfo
+	return json.Marshal(struct {
+		plain
+		PLMNID *plmnJSON `json:"plmnId,omitempty"`
+	}{plain(l), (*plmnJSON)(l.PLMNID)})
+}
+
+func (l *MeasLabelInfo) UnmarshalJSON(data []byte) error {
+	type plain MeasLabelInfo
+	v := struct {
+		*plain
+		PLMNID *plmnJSON `json:"plmnId"`
+	}{plain: (*plain)(l)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	l.PLMNID = (*OctetString)(v.PLMNID)
+	return nil
+}
+
+func (m *MeasInfoItem) UnmarshalJSON(data []byte) error {
+	type plain MeasInfoItem
+	v := struct {
+		*plain
+		Measurement json.RawMessage `json:"measurement"`
+	}{plain: (*plain)(m)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	m.LabelInfoCount = len(m.LabelInfoList)
+	return unmarshalChoice(v.Measurement, measTypeAlternatives, int(m.MeasType), &m.Measurement)
+}
+
+func (t *TestConditionInfo) UnmarshalJSON(data []byte) error {
+	type plain TestConditionInfo
+	v := struct {
+		*plain
+		Value json.RawMessage `json:"value"`
+	}{plain: (*plain)(t)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return unmarshalChoice(v.Value, testAlternatives, int(t.ValueType), &t.Value)
+}
+
+func (c *MatchingCond) UnmarshalJSON(data []byte) error {
+	type plain MatchingCond
+	v := struct {
+		*plain
+		Condition json.RawMessage `json:"condition"`
+	}{plain: (*plain)(c)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return unmarshalChoice(v.Condition, condAlternatives, int(c.ConditionType), &c.Condition)
+}
+
+func (m *MeasInfoUeidItem) UnmarshalJSON(data []byte) error {
+	type plain MeasInfoUeidItem
+	v := struct {
+		*plain
+		Measurement json.RawMessage `json:"measurement"`
+	}{plain: (*plain)(m)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	m.MatchingCondCount = len(m.MatchingCondList)
+	m.MatchedUeidCount = len(m.MatchedUeidList)
+	return unmarshalChoice(v.Measurement, measTypeAlternatives, int(m.MeasType), &m.Measurement)
+}
+
+func (r *MeasurementRecordItem) UnmarshalJSON(data []byte) error {
+	type plain MeasurementRecordItem
+	v := struct {
+		*plain
+		Value json.RawMessage `json:"value"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return unmarshalChoice(v.Value, recordAlternatives, int(r.MeasRecordType), &r.MeasRecordValue)
+}
+
+func (r *MeasurementRecord) UnmarshalJSON(data []byte) error {
+	type plain MeasurementRecord
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	r.MeasRecordCount = len(r.MeasRecord)
+	return nil
+}
+
+func (m *IndicationMessageFormat1) UnmarshalJSON(data []byte) error {
+	type plain IndicationMessageFormat1
+	if err := json.Unmarshal(data, (*plain)(m)); err != nil {
+		return err
+	}
+	m.MeasInfoCount = len(m.MeasInfoList)
+	m.MeasDataCount = len(m.MeasData)
+	return nil
+}
+
+func (m *IndicationMessageFormat2) UnmarshalJSON(data []byte) error {
+	type plain IndicationMessageFormat2
+	if err := json.Unmarshal(data, (*plain)(m)); err != nil {
+		return err
+	}
+	m.MeasInfoUeidCount = len(m.MeasInfoUeidList)
+	m.MeasDataCount = len(m.MeasData)
+	return nil
+}
+
+func (m *IndicationMessage) UnmarshalJSON(data []byte) error {
+	type plain IndicationMessage
+	v := struct {
+		*plain
+		IndMsg json.RawMessage `json:"message"`
+	}{plain: (*plain)(m)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return unmarshalChoice(v.IndMsg, messageAlternatives, int(m.IndMsgType), &m.IndMsg)
+}
+
+// countedArray is a list of an E2SM-KPM container, held in a fixed size
+// array, and the field with its number of used elements
+type countedArray struct {
+	array string
+	count string
+}
+
+// countedArrays lists the containers encoded by marshalCounted with their
+// lists. The containers have no JSON methods of their own: they are encoded
+// as part of the PF and RAN container CHOICEs and the PLMN entries pointing
+// to them, walked by reflection, as some of them are megabytes large and
+// neither a copy for a method call nor a value that is not addressable may
+// decide how they are encoded.
+var countedArrays = map[reflect.Type][]countedArray{
+	reflect.TypeOf((*SlicePerPlmnPerCellType)(nil)).Elem():                   {{"FQIPERSlicesPerPlmnPerCells", "FQIPERSlicesPerPlmnPerCellCount"}},
+	reflect.TypeOf((*DUPM5GCContainerType)(nil)).Elem():                      {{"SlicePerPlmnPerCells", "SlicePerPlmnPerCellCount"}},
+	reflect.TypeOf((*DUPMEPCContainerType)(nil)).Elem():                      {{"PerQCIReports", "PerQCIReportCount"}},
+	reflect.TypeOf((*CellResourceReportType)(nil)).Elem():                    {{"ServedPlmnPerCells", "ServedPlmnPerCellCount"}},
+	reflect.TypeOf((*ODUPFContainerType)(nil)).Elem():                        {{"CellResourceReports", "CellResourceReportCount"}},
+	reflect.TypeOf((*SliceToReportType)(nil)).Elem():                         {{"FQIPERSlicesPerPlmns", "FQIPERSlicesPerPlmnCount"}},
+	reflect.TypeOf((*CUUPPM5GCType)(nil)).Elem():                             {{"SliceToReports", "SliceToReportCount"}},
+	reflect.TypeOf((*CUUPPMEPCType)(nil)).Elem():                             {{"CUUPPMEPCPerQCIReports", "CUUPPMEPCPerQCIReportCount"}},
+	reflect.TypeOf((*CUUPMeasurementContainerType)(nil)).Elem():              {{"CUUPPlmns", "CUUPPlmnCount"}},
+	reflect.TypeOf((*CUUPPFContainerItemType)(nil)).Elem():                   nil, //holds a CUUPMeasurementContainerType
+	reflect.TypeOf((*OCUUPPFContainerType)(nil)).Elem():                      {{"CUUPPFContainerItems", "CUUPPFContainerItemCount"}},
+	reflect.TypeOf((*DUUsageReportCellResourceReportItemType)(nil)).Elem():   {{"UeResourceReportItems", "UeResourceReportItemCount"}},
+	reflect.TypeOf((*DUUsageReportType)(nil)).Elem():                         {{"CellResourceReportItems", "CellResourceReportItemCount"}},
+	reflect.TypeOf((*CUCPUsageReportCellResourceReportItemType)(nil)).Elem(): {{"UeResourceReportItems", "UeResourceReportItemCount"}},
+	reflect.TypeOf((*CUCPUsageReportType)(nil)).Elem():                       {{"CellResourceReportItems", "CellResourceReportItemCount"}},
+	reflect.TypeOf((*CUUPUsageReportCellResourceReportItemType)(nil)).Elem(): {{"UeResourceReportItems", "UeResourceReportItemCount"}},
+	reflect.TypeOf((*CUUPUsageReportType)(nil)).Elem():                       {{"CellResourceReportItems", "CellResourceReportItemCount"}},
+}
+
+// countedJSON encodes the container v refers to with marshalCounted and
+// decodes into it with unmarshalCounted
+type countedJSON struct {
+	v reflect.Value
+}
+
+func (c countedJSON) MarshalJSON() ([]byte, error) {
+	return marshalCounted(c.v)
+}
+
+func (c countedJSON) UnmarshalJSON(data []byte) error {
+	return unmarshalCounted(data, c.v)
+}
+
+// counted returns the value to encode in place of v, a countedJSON when v
+// points to a container
+func counted(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || !isCounted(rv.Type().Elem()) {
+		return v
+	}
+	if rv.IsNil() {
+		return nil
+	}
+	return countedJSON{rv.Elem()}
+}
+
+// unmarshalCountedPtr decodes a container into a new value set to the pointer
+// p points to, an absent value leaves it nil
+func unmarshalCountedPtr(raw json.RawMessage, p interface{}) error {
+	ptr := reflect.ValueOf(p).Elem()
+	ptr.Set(reflect.Zero(ptr.Type()))
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	v := reflect.New(ptr.Type().Elem())
+	if err := unmarshalCounted(raw, v.Elem()); err != nil {
+		return err
+	}
+	ptr.Set(v)
+	return nil
+}
+
+func isCounted(t reflect.Type) bool {
+	_, ok := countedArrays[t]
+	return ok
+}
+
+func clampCount(count int, max int) int {
+	if count < 0 {
+		return 0
+	} else if count > max {
+		return max
+	}
+	return count
+}
+
+// jsonName returns the name of a field in the JSON object, empty when the
+// field is not encoded
+func jsonName(f reflect.StructField) (name string, omitEmpty bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = f.Name
+	}
+	for _, option := range parts[1:] {
+		omitEmpty = omitEmpty || option == "omitempty"
+	}
+	return
+}
+
+// countedFields returns the count field index by array field index of a
+// container, failing when countedArrays does not match the type
+func countedFields(t reflect.Type) (map[int]int, error) {
+	arrays, ok := countedArrays[t]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a counted container", t)
+	}
+	counts := make(map[int]int, len(arrays))
+	for _, a := range arrays {
+		array, ok := t.FieldByName(a.array)
+		if !ok || array.Type.Kind() != reflect.Array {
+			return nil, fmt.Errorf("%s has no array %s", t, a.array)
+		}
+		count, ok := t.FieldByName(a.count)
+		if !ok || count.Type.Kind() != reflect.Int {
+			return nil, fmt.Errorf("%s has no int %s counting %s", t, a.count, a.array)
+		}
+		counts[array.Index[0]] = count.Index[0]
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := counts[i]; !ok && t.Field(i).Type.Kind() == reflect.Array {
+			return nil, fmt.Errorf("array %s of %s has no count", t.Field(i).Name, t)
+		}
+	}
+	return counts, nil
+}
+
+// marshalCounted encodes a container with its arrays cut to the number of
+// used elements
+func marshalCounted(rv reflect.Value) ([]byte, error) {
+	rt := rv.Type()
+	counts, err := countedFields(rt)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		name, omitEmpty := jsonName(f)
+		field := rv.Field(i)
+		if name == "" || omitEmpty && (field.Kind() == reflect.Ptr || field.Kind() == reflect.Interface) && field.IsNil() {
+			continue
+		}
+
+		var data []byte
+		if count, ok := counts[i]; ok {
+			data, err = marshalElements(field, clampCount(int(rv.Field(count).Int()), field.Len()))
+		} else {
+			data, err = marshalValue(field)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// marshalElements encodes the first n elements of an array
+func marshalElements(array reflect.Value, n int) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i := 0; i < n; i++ {
+		data, err := marshalValue(array.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(data)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// marshalValue encodes a field or element of a container, walking into the
+// containers it holds
+func marshalValue(v reflect.Value) ([]byte, error) {
+	switch {
+	case isCounted(v.Type()):
+		return marshalCounted(v)
+	case v.Kind() == reflect.Ptr && isCounted(v.Type().Elem()):
+		if v.IsNil() {
+			return []byte("null"), nil
+		}
+		return marshalCounted(v.Elem())
+	case v.CanAddr():
+		return json.Marshal(v.Addr().Interface())
+	}
+	return json.Marshal(v.Interface())
+}
+
+// unmarshalCounted decodes a container encoded by marshalCounted into the
+// addressable rv, setting the number of used elements of the arrays
+func unmarshalCounted(data []byte, rv reflect.Value) error {
+	rt := rv.Type()
+	counts, err := countedFields(rt)
+	if err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	rv.Set(reflect.Zero(rt))
+
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		name, _ := jsonName(f)
+		raw, ok := fields[name]
+		if name == "" || !ok {
+			continue
+		}
+
+		field := rv.Field(i)
+		count, ok := counts[i]
+		if !ok {
+			if err := unmarshalValue(raw, field); err != nil {
+				return err
+			}
+			continue
+		}
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return err
+		}
+		if len(elems) > field.Len() {
+			return fmt.Errorf("more than %d elements in %s", field.Len(), name)
+		}
+		for j, elem := range elems {
+			if err := unmarshalValue(elem, field.Index(j)); err != nil {
+				return err
+			}
+		}
+		rv.Field(count).SetInt(int64(len(elems)))
+	}
+	return nil
+}
+
+// unmarshalValue decodes a field or element of a container into the
+// addressable v
+func unmarshalValue(raw json.RawMessage, v reflect.Value) error {
+	switch {
+	case isCounted(v.Type()):
+		return unmarshalCounted(raw, v)
+	case v.Kind() == reflect.Ptr && isCounted(v.Type().Elem()):
+		return unmarshalCountedPtr(raw, v.Addr().Interface())
+	}
+	return json.Unmarshal(raw, v.Addr().Interface())
+}
@@ -0,0 +1,313 @@
+package control
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func octetString(b ...byte) OctetString {
+	return OctetString{Buf: b, Size: len(b)}
+}
+
+func printableString(s string) *PrintableString {
+	return &PrintableString{Buf: []byte(s), Size: len(s)}
+}
+
+var (
+	testPLMNOctets = octetString(0x13, 0x00, 0x14)
+	testSlice      = SliceIDType{SST: octetString(1), SD: &OctetString{Buf: []byte{1, 2, 3}, Size: 3}}
+	testNRCGI      = EncodeNRCGI(PLMNIdentity{MCC: "310", MNC: "410"}, 0xb5c6701)
+	testPDCPBytes  = &Integer{Buf: []byte{0x01, 0x00}, Size: 2}
+)
+
+func bitString(value uint64, bits int) *BitString {
+	bs := EncodeBitString(value, bits)
+	return &bs
+}
+
+func gnbNodeHeader(nameType int32, name interface{}) *IndicationHeader {
+	gnbID := GNBID(*bitString(0xb5c67788, 32))
+	return &IndicationHeader{IndHdrType: 1, IndHdr: &IndicationHeaderFormat1{
+		GlobalKPMnodeIDType: 1,
+		GlobalKPMnodeID: &GlobalKPMnodegNBIDType{
+			GlobalgNBID: GlobalgNBIDType{PlmnID: testPLMNOctets, GnbIDType: 1, GnbID: &gnbID},
+			GnbCUUPID:   &Integer{Buf: []byte{0x00, 0x80}, Size: 2},
+			GnbDUID:     &Integer{Buf: []byte{0x01}, Size: 1},
+		},
+		ColletStartTime: &OctetString{Buf: []byte{1, 2, 3, 4}, Size: 4},
+		SenderName:      printableString("du1"),
+		NRCGI:           &testNRCGI,
+		PlmnID:          &OctetString{Buf: []byte{0xab, 0xcd, 0xef}, Size: 3}, //not TBCD, kept as hex
+		SliceID:         &testSlice,
+		GnbNameType:     nameType,
+		GnbName:         name,
+		GlobalgNBID:     &GlobalgNBIDType{PlmnID: testPLMNOctets, GnbIDType: 1, GnbID: &gnbID},
+	}}
+}
+
+func nodeHeader(nodeType int32, node interface{}) *IndicationHeader {
+	return &IndicationHeader{IndHdrType: 1, IndHdr: &IndicationHeaderFormat1{GlobalKPMnodeIDType: nodeType, GlobalKPMnodeID: node}}
+}
+
+func oduContainer() *ODUPFContainerType {
+	odu := &ODUPFContainerType{CellResourceReportCount: 2}
+	for i := 0; i < 2; i++ {
+		report := &odu.CellResourceReports[i]
+		report.NRCGI = testNRCGI
+		report.TotalofAvailablePRBs = IntPair64{DL: 100, UL: 50}
+		report.ServedPlmnPerCellCount = 2
+		m5gc := &DUPM5GCContainerType{SlicePerPlmnPerCellCount: 1}
+		m5gc.SlicePerPlmnPerCells[0].SliceID = testSlice
+		m5gc.SlicePerPlmnPerCells[0].FQIPERSlicesPerPlmnPerCellCount = 2
+		m5gc.SlicePerPlmnPerCells[0].FQIPERSlicesPerPlmnPerCells[0] = FQIPERSlicesPerPlmnPerCellType{FiveQI: 9, PrbUsage: IntPair64{DL: 10, UL: 5}}
+		m5gc.SlicePerPlmnPerCells[0].FQIPERSlicesPerPlmnPerCells[1] = FQIPERSlicesPerPlmnPerCellType{FiveQI: 7}
+		report.ServedPlmnPerCells[0] = ServedPlmnPerCellType{PlmnID: testPLMNOctets, DUPM5GC: m5gc}
+		epc := &DUPMEPCContainerType{PerQCIReportCount: 1}
+		epc.PerQCIReports[0] = DUPMEPCPerQCIReportType{QCI: 5, PrbUsage: IntPair64{DL: 1, UL: 2}}
+		report.ServedPlmnPerCells[1] = ServedPlmnPerCellType{PlmnID: testPLMNOctets, DUPMEPC: epc}
+	}
+	return odu
+}
+
+func ocuupContainer() *OCUUPPFContainerType {
+	ocuup := &OCUUPPFContainerType{GNBCUUPName: printableString("cu-up"), CUUPPFContainerItemCount: 2}
+	for i := 0; i < 2; i++ {
+		item := &ocuup.CUUPPFContainerItems[i]
+		item.InterfaceType = int64(i + 1)
+		item.OCUUPPMContainer.CUUPPlmnCount = 1
+		m5gc := &CUUPPM5GCType{SliceToReportCount: 1}
+		m5gc.SliceToReports[0].SliceID = testSlice
+		m5gc.SliceToReports[0].FQIPERSlicesPerPlmnCount = 1
+		m5gc.SliceToReports[0].FQIPERSlicesPerPlmns[0] = FQIPERSlicesPerPlmnType{FiveQI: 9, PDCPBytesDL: testPDCPBytes}
+		epc := &CUUPPMEPCType{CUUPPMEPCPerQCIReportCount: 1}
+		epc.CUUPPMEPCPerQCIReports[0] = CUUPPMEPCPerQCIReportType{QCI: 5, PDCPBytesUL: testPDCPBytes}
+		item.OCUUPPMContainer.CUUPPlmns[0] = CUUPPlmnType{PlmnID: testPLMNOctets, CUUPPM5GC: m5gc, CUUPPMEPC: epc}
+	}
+	return ocuup
+}
+
+func duUsageReport() *DUUsageReportType {
+	report := &DUUsageReportType{CellResourceReportItemCount: 1}
+	report.CellResourceReportItems[0].NRCGI = testNRCGI
+	report.CellResourceReportItems[0].UeResourceReportItemCount = 2
+	report.CellResourceReportItems[0].UeResourceReportItems[0] = DUUsageReportUeResourceReportItemType{CRNTI: Integer{Buf: []byte{0x12}, Size: 1}, PRBUsageDL: 3}
+	report.CellResourceReportItems[0].UeResourceReportItems[1] = DUUsageReportUeResourceReportItemType{CRNTI: Integer{Buf: []byte{0x13}, Size: 1}, PRBUsageUL: 4}
+	return report
+}
+
+func cucpUsageReport() *CUCPUsageReportType {
+	report := &CUCPUsageReportType{CellResourceReportItemCount: 1}
+	report.CellResourceReportItems[0].NRCGI = testNRCGI
+	report.CellResourceReportItems[0].UeResourceReportItemCount = 1
+	report.CellResourceReportItems[0].UeResourceReportItems[0] = CUCPUsageReportUeResourceReportItemType{
+		CRNTI: Integer{Buf: []byte{0x12}, Size: 1}, ServingCellRF: &OctetString{Buf: []byte{0x0a}, Size: 1}}
+	return report
+}
+
+func cuupUsageReport() *CUUPUsageReportType {
+	report := &CUUPUsageReportType{CellResourceReportItemCount: 1}
+	report.CellResourceReportItems[0].NRCGI = testNRCGI
+	report.CellResourceReportItems[0].UeResourceReportItemCount = 1
+	report.CellResourceReportItems[0].UeResourceReportItems[0] = CUUPUsageReportUeResourceReportItemType{
+		CRNTI: Integer{Buf: []byte{0x12}, Size: 1}, PDCPBytesDL: testPDCPBytes}
+	return report
+}
+
+func format1Message(measurements ...MeasInfoItem) *IndicationMessage {
+	records := make([]MeasurementRecordItem, 0, 3)
+	records = append(records,
+		MeasurementRecordItem{MeasRecordType: 1, MeasRecordValue: int64(3)},
+		MeasurementRecordItem{MeasRecordType: 2, MeasRecordValue: float64(1.5)},
+		MeasurementRecordItem{MeasRecordType: 3, MeasRecordValue: int32(0)})
+	return &IndicationMessage{IndMsgType: 1, IndMsg: &IndicationMessageFormat1{
+		SubscriptID:   &Integer{Buf: []byte{0xff}, Size: 1},
+		CellObjID:     printableString("cell-1"),
+		GranulPeriod:  100,
+		MeasInfoCount: len(measurements),
+		MeasInfoList:  measurements,
+		MeasDataCount: 1,
+		MeasData:      []MeasurementRecord{{MeasRecordCount: len(records), MeasRecord: records}},
+	}}
+}
+
+func format2Message(conditions ...MatchingCond) *IndicationMessage {
+	ueids := []OctetString{octetString(9)}
+	return &IndicationMessage{IndMsgType: 2, IndMsg: &IndicationMessageFormat2{
+		GranulPeriod:      100,
+		MeasInfoUeidCount: 1,
+		MeasInfoUeidList: []MeasInfoUeidItem{{
+			MeasType: 1, Measurement: printableString("DRB.UEThpDl"),
+			MatchingCondCount: len(conditions), MatchingCondList: conditions,
+			MatchedUeidCount: len(ueids), MatchedUeidList: ueids,
+		}},
+		MeasDataCount: 1,
+		MeasData:      []MeasurementRecord{{MeasRecordCount: 1, MeasRecord: []MeasurementRecordItem{{MeasRecordType: 1, MeasRecordValue: int64(7)}}}},
+	}}
+}
+
+func testCondition(valueType int32, value interface{}) MatchingCond {
+	return MatchingCond{ConditionType: 2, Condition: &TestConditionInfo{TestConditionType: 1, Expression: 2, ValueType: valueType, Value: value}}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	engnbID := ENGNBID(*bitString(0x1234, 22))
+	ngMacro := NGENBID_Macro(*bitString(0xabcde, 20))
+	ngShort := NGENBID_ShortMacro(*bitString(0x3ffff, 18))
+	ngLong := NGENBID_LongMacro(*bitString(0x1fffff, 21))
+	enbMacro := ENBID_Macro(*bitString(0xabcde, 20))
+	enbHome := ENBID_Home(*bitString(0xabcdef1, 28))
+	enbShort := ENBID_ShortMacro(*bitString(0x3ffff, 18))
+	enbLong := ENBID_LongMacro(*bitString(0x1fffff, 21))
+
+	sub := &DecodedSubscriptionResponseMessage{RequestID: 1, RequestSequenceNumber: 2, FuncID: 3}
+	sub.ActionAdmittedList.Count = 1
+	sub.ActionAdmittedList.ActionID[0] = 4
+	sub.ActionNotAdmittedList.Count = 1
+	sub.ActionNotAdmittedList.ActionID[0] = 5
+	sub.ActionNotAdmittedList.Cause[0] = CauseItemType{CauseType: 1, CauseID: 2}
+
+	tests := []struct {
+		name string
+		in   interface{} //pointer to the value
+	}{
+		{"indication", &DecodedIndicationMessage{RequestID: 1, FuncID: 2, IndSN: 3, IndSNPresent: true, IndHeader: []byte{1, 2}, IndHeaderLength: 2,
+			IndMessage: []byte{3}, IndMessageLength: 1, CallProcessID: []byte{}}},
+		{"indication without sn", &DecodedIndicationMessage{RequestID: 1, IndHeader: []byte{}, IndMessage: []byte{}, CallProcessID: []byte{4}, CallProcessIDLength: 1}},
+		{"subscription response", sub},
+		{"gNB DU name", gnbNodeHeader(1, &GNB_DU_Name{Buf: []byte("du"), Size: 2})},
+		{"gNB CU-CP name", gnbNodeHeader(2, &GNB_CU_CP_Name{Buf: []byte("cu-cp"), Size: 5})},
+		{"gNB CU-UP name", gnbNodeHeader(3, &GNB_CU_UP_Name{Buf: []byte("cu-up"), Size: 5})},
+		{"en-gNB", nodeHeader(2, &GlobalKPMnodeengNBIDType{PlmnID: testPLMNOctets, GnbIDType: 1, GnbID: &engnbID})},
+		{"ng-eNB macro", nodeHeader(3, &GlobalKPMnodengeNBIDType{PlmnID: testPLMNOctets, EnbIDType: 1, EnbID: &ngMacro})},
+		{"ng-eNB short macro", nodeHeader(3, &GlobalKPMnodengeNBIDType{PlmnID: testPLMNOctets, EnbIDType: 2, EnbID: &ngShort})},
+		{"ng-eNB long macro", nodeHeader(3, &GlobalKPMnodengeNBIDType{PlmnID: testPLMNOctets, EnbIDType: 3, EnbID: &ngLong})},
+		{"eNB macro", nodeHeader(4, &GlobalKPMnodeeNBIDType{PlmnID: testPLMNOctets, EnbIDType: 1, EnbID: &enbMacro})},
+		{"eNB home", nodeHeader(4, &GlobalKPMnodeeNBIDType{PlmnID: testPLMNOctets, EnbIDType: 2, EnbID: &enbHome})},
+		{"eNB short macro", nodeHeader(4, &GlobalKPMnodeeNBIDType{PlmnID: testPLMNOctets, EnbIDType: 3, EnbID: &enbShort})},
+		{"eNB long macro", nodeHeader(4, &GlobalKPMnodeeNBIDType{PlmnID: testPLMNOctets, EnbIDType: 4, EnbID: &enbLong})},
+		{"format 1 by name and id", format1Message(
+			MeasInfoItem{MeasType: 1, Measurement: printableString("DRB.UEThpDl"), LabelInfoCount: 1,
+				LabelInfoList: []MeasLabelInfo{{PLMNID: &testPLMNOctets, SliceID: &testSlice, FiveQI: 9}}},
+			MeasInfoItem{MeasType: 2, Measurement: int64(7), LabelInfoList: []MeasLabelInfo{}})},
+		{"format 2 label condition", format2Message(MatchingCond{ConditionType: 1, Condition: &MeasLabelInfo{PLMNID: &testPLMNOctets, QCI: 5}})},
+		{"format 2 test conditions", format2Message(
+			testCondition(1, int64(1)),
+			testCondition(2, int64(2)),
+			testCondition(3, int64(3)),
+			testCondition(4, bitString(0xa5, 8)),
+			testCondition(5, &OctetString{Buf: []byte{1, 2}, Size: 2}),
+			testCondition(6, &OctetString{Buf: []byte("abc"), Size: 3}))},
+		{"O-DU PF container", &PFContainerType{ContainerType: 1, Container: oduContainer()}},
+		{"O-CU-CP PF container", &PFContainerType{ContainerType: 2, Container: &OCUCPPFContainerType{
+			GNBCUCPName: printableString("cu-cp"), CUCPResourceStatus: CUCPResourceStatusType{NumberOfActiveUEs: 12}}}},
+		{"O-CU-UP PF container", &PFContainerType{ContainerType: 3, Container: ocuupContainer()}},
+		{"empty PF container", &PFContainerType{ContainerType: 1}},
+		{"DU usage report", &RANContainerType{Timestamp: octetString(1, 2, 3, 4, 5, 6, 7, 8), ContainerType: 1, Container: duUsageReport()}},
+		{"CU-CP usage report", &RANContainerType{Timestamp: octetString(1, 2, 3, 4, 5, 6, 7, 8), ContainerType: 2, Container: cucpUsageReport()}},
+		{"CU-UP usage report", &RANContainerType{Timestamp: octetString(1, 2, 3, 4, 5, 6, 7, 8), ContainerType: 3, Container: cuupUsageReport()}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(test.in)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			out := reflect.New(reflect.TypeOf(test.in).Elem())
+			if err := json.Unmarshal(data, out.Interface()); err != nil {
+				t.Fatalf("unmarshal %s: %v", data, err)
+			}
+			if !reflect.DeepEqual(out.Interface(), test.in) {
+				t.Fatalf("%s decoded to a different value\ngot  %+v\nwant %+v", data, out.Elem(), reflect.ValueOf(test.in).Elem())
+			}
+			again, err := json.Marshal(out.Interface())
+			if err != nil {
+				t.Fatalf("marshal again: %v", err)
+			}
+			if !bytes.Equal(again, data) {
+				t.Fatalf("encoded differently\nfirst  %s\nsecond %s", data, again)
+			}
+		})
+	}
+}
+
+func TestCountedArraysMatchTypes(t *testing.T) {
+	for typ := range countedArrays {
+		if _, err := countedFields(typ); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestCountedFieldsRejectsMismatch(t *testing.T) {
+	type container struct {
+		Items     [4]int
+		ItemCount int
+		Others    [4]int
+	}
+	typ := reflect.TypeOf(container{})
+
+	if _, err := countedFields(typ); err == nil {
+		t.Error("type not in countedArrays accepted")
+	}
+	tests := []struct {
+		name   string
+		arrays []countedArray
+	}{
+		{"missing array", []countedArray{{"Item", "ItemCount"}, {"Others", "ItemCount"}}},
+		{"missing count", []countedArray{{"Items", "Count"}, {"Others", "ItemCount"}}},
+		{"count not int", []countedArray{{"Items", "Others"}, {"Others", "ItemCount"}}},
+		{"array not listed", []countedArray{{"Items", "ItemCount"}}},
+	}
+	defer delete(countedArrays, typ)
+	for _, test := range tests {
+		countedArrays[typ] = test.arrays
+		if _, err := countedFields(typ); err == nil {
+			t.Errorf("%s: accepted", test.name)
+		}
+		if _, err := marshalCounted(reflect.ValueOf(container{})); err == nil {
+			t.Errorf("%s: marshalled", test.name)
+		}
+	}
+}
+
+func TestCountedNotAddressable(t *testing.T) {
+	ocuup := ocuupContainer()
+	addressable, err := marshalCounted(reflect.ValueOf(ocuup).Elem())
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, err := marshalCounted(reflect.ValueOf(*ocuup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(copied, addressable) {
+		t.Errorf("encoded differently when not addressable\ncopy %s\nwant %s", copied, addressable)
+	}
+	if n := strings.Count(string(copied), `"plmnId"`); n != 2 {
+		t.Errorf("got %d PLMNs in %s, want the 2 used", n, copied)
+	}
+
+	byValue, err := json.Marshal(PFContainerType{ContainerType: 3, Container: ocuup})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPointer, err := json.Marshal(&PFContainerType{ContainerType: 3, Container: ocuup})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(byValue, byPointer) {
+		t.Errorf("encoded differently by value\nvalue   %s\npointer %s", byValue, byPointer)
+	}
+
+	ran, err := json.Marshal([]RANContainerType{{ContainerType: 1, Container: duUsageReport()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(ran), `"cRnti"`); n != 2 {
+		t.Errorf("got %d UEs in %s, want the 2 used", n, ran)
+	}
+}
@@ -0,0 +1,482 @@
+package control
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+const (
+	exportFormatJSON       = "json"
+	exportFormatCSV        = "csv"
+	exportFilePrefix       = "kpimon-"
+	exportPartSuffix       = ".part"
+	exportCorruptSuffix    = ".corrupt"
+	defaultExportMaxSize   = 64     //MiB per file
+	defaultExportInterval  = 60     //minutes per file
+	defaultExportRetention = 7 * 24 //hours
+	defaultExportFlush     = 10     //seconds
+	exportFileTimeFormat   = "20060102T150405.000Z"
+	exportFileMode         = 0644
+	exportDirMode          = 0755
+	exportCSVTimeFormat    = time.RFC3339Nano
+)
+
+// columns of the flattened CSV export, one row per measurement record
+var exportCSVColumns = []string{
+	"ranName", "received", "requestId", "requestSequenceNumber", "functionId", "actionId", "indicationSN", "format",
+	"globalKPMnodeIdType", "headerPlmnId", "headerNodeId", "granulPeriod", "cellObjId", "colletStartTime",
+	"fileFormatVersion", "senderName", "senderType", "vendorName",
+	"time", "measurement", "unit", "value", "cellId", "ueId", "plmnId", "sliceId", "fiveQI", "qci", "nodeId", "duId", "cuUpId",
+}
+
+// ExportLabel is the label information of a measurement
+type ExportLabel struct {
+	PLMNID           string `json:"plmnId,omitempty"`
+	SliceID          string `json:"sliceId,omitempty"`
+	FiveQI           int64  `json:"fiveQI,omitempty"`
+	QCI              int64  `json:"qci,omitempty"`
+	QCImax           int64  `json:"qciMax,omitempty"`
+	QCImin           int64  `json:"qciMin,omitempty"`
+	ARPmax           int64  `json:"arpMax,omitempty"`
+	ARPmin           int64  `json:"arpMin,omitempty"`
+	BitrateRange     int64  `json:"bitrateRange,omitempty"`
+	LayerMU_MIMO     int64  `json:"layerMuMimo,omitempty"`
+	SUM              int64  `json:"sum,omitempty"`
+	DistBinX         int64  `json:"distBinX,omitempty"`
+	DistBinY         int64  `json:"distBinY,omitempty"`
+	DistBinZ         int64  `json:"distBinZ,omitempty"`
+	PreLabelOverride int64  `json:"preLabelOverride,omitempty"`
+	StartEndInd      int64  `json:"startEndInd,omitempty"`
+}
+
+type ExportMeasInfo struct {
+	StreamMeasInfo
+	LabelInfo []ExportLabel `json:"labelInfo,omitempty"`
+}
+
+// ExportIndication is a line of the JSON export: the stream event of the
+// indication with the complete label information of its measurements
+type ExportIndication struct {
+	*StreamEvent
+	RequestSequenceNumber int32            `json:"requestSequenceNumber"`
+	IndType               int32            `json:"indicationType"`
+	MeasInfo              []ExportMeasInfo `json:"measInfo"`
+}
+
+// exportFile is the file written to, named after the time it was opened and
+// suffixed by .part until it is closed
+type exportFile struct {
+	path   string
+	opened time.Time
+	file   *os.File
+	size   *countingWriter
+	gzip   *gzip.Writer //nil when not compressed
+	buf    *bufio.Writer
+	csv    *csv.Writer //nil for the JSON lines format
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// exportSink writes every decoded indication to rotating JSON lines or CSV
+// files for offline analysis. A file is rotated when it exceeds the size or
+// age limit, closed files older than the retention are removed.
+type exportSink struct {
+	mu        sync.Mutex
+	dir       string
+	format    string
+	compress  bool
+	maxSize   int64
+	interval  time.Duration
+	retention time.Duration
+	maxFiles  int //0 for no limit
+	flush     time.Duration
+	current   *exportFile
+}
+
+// newExportSink returns nil when no export directory is configured
+func newExportSink() (*exportSink, error) {
+	dir := os.Getenv("exportDir")
+	if dir == "" {
+		return nil, nil
+	}
+	s := &exportSink{
+		dir:       dir,
+		format:    os.Getenv("exportFormat"),
+		compress:  os.Getenv("exportCompress") != "false",
+		maxSize:   int64(getEnvInt("exportMaxSize", defaultExportMaxSize)) << 20,
+		interval:  time.Duration(getEnvInt("exportInterval", defaultExportInterval)) * time.Minute,
+		retention: time.Duration(getEnvInt("exportRetention", defaultExportRetention)) * time.Hour,
+		maxFiles:  getEnvInt("exportMaxFiles", 0),
+		flush:     time.Duration(getEnvInt("exportFlushInterval", defaultExportFlush)) * time.Second,
+	}
+	if s.format == "" {
+		s.format = exportFormatJSON
+	}
+	if s.format != exportFormatJSON && s.format != exportFormatCSV {
+		return nil, errors.New("invalid exportFormat " + s.format + ", expected json or csv")
+	}
+	if err := os.MkdirAll(dir, exportDirMode); err != nil {
+		return nil, err
+	}
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+	s.enforceRetention()
+	return s, nil
+}
+
+func (s *exportSink) name() string {
+	return "export"
+}
+
+func (s *exportSink) extension() string {
+	ext := ".jsonl"
+	if s.format == exportFormatCSV {
+		ext = ".csv"
+	}
+	if s.compress {
+		ext += ".gz"
+	}
+	return ext
+}
+
+func (s *exportSink) write(b *batch) error {
+	if b.ind == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current != nil && (s.current.size.n >= s.maxSize || time.Since(s.current.opened) >= s.interval) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	if s.current == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	if s.format == exportFormatCSV {
+		return s.writeCSV(b.ind)
+	}
+	data, err := json.Marshal(newExportIndication(b.ind))
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := s.current.buf.Write(data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *exportSink) writeCSV(ind *indication) error {
+	event := newStreamEvent(ind)
+	row := []string{
+		event.RanName,
+		event.Received.UTC().Format(exportCSVTimeFormat),
+		strconv.FormatInt(int64(event.RequestID), 10),
+		strconv.FormatInt(int64(ind.Msg.RequestSequenceNumber), 10),
+		strconv.FormatInt(int64(event.FuncID), 10),
+		strconv.FormatInt(int64(event.ActionID), 10),
+		strconv.FormatInt(int64(event.IndSN), 10),
+		strconv.FormatInt(int64(event.Format), 10),
+		strconv.FormatInt(int64(event.Header.GlobalKPMnodeIDType), 10),
+		event.Header.PlmnID,
+		event.Header.NodeID,
+		strconv.FormatInt(event.GranulPeriod, 10),
+		event.CellObjID,
+		event.Header.ColletStartTime,
+		event.Header.FileFormatVersion,
+		event.Header.SenderName,
+		event.Header.SenderType,
+		event.Header.VendorName,
+	}
+	for _, r := range event.Records {
+		record := append(row[:len(row):len(row)],
+			r.Time.UTC().Format(exportCSVTimeFormat),
+			r.Measurement,
+			r.Unit,
+			strconv.FormatFloat(r.Value, 'g', -1, 64),
+			r.CellID,
+			r.UeID,
+			r.PLMNID,
+			r.SliceID,
+			strconv.FormatInt(r.FiveQI, 10),
+			strconv.FormatInt(r.QCI, 10),
+			r.NodeID,
+			r.DUID,
+			r.CUUPID,
+		)
+		if err := s.current.csv.Write(record); err != nil {
+			return err
+		}
+	}
+	s.current.csv.Flush()
+	return s.current.csv.Error()
+}
+
+// open starts a new file, CSV files begin with the header row
+func (s *exportSink) open() error {
+	now := time.Now()
+	path := s.path(now)
+	f, err := createExportFile(path)
+	for os.IsExist(err) {
+		// a file was opened within the same millisecond
+		now = now.Add(time.Millisecond)
+		path = s.path(now)
+		f, err = createExportFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	current := &exportFile{path: path, opened: now, file: f, size: &countingWriter{w: f}}
+	var w io.Writer = current.size
+	if s.compress {
+		current.gzip = gzip.NewWriter(w)
+		w = current.gzip
+	}
+	current.buf = bufio.NewWriter(w)
+	if s.format == exportFormatCSV {
+		current.csv = csv.NewWriter(current.buf)
+		if err := current.csv.Write(exportCSVColumns); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	s.current = current
+	return nil
+}
+
+func (s *exportSink) path(opened time.Time) string {
+	return filepath.Join(s.dir, exportFilePrefix+opened.UTC().Format(exportFileTimeFormat)+s.extension())
+}
+
+// createExportFile creates the .part file of path, failing with an error
+// satisfying os.IsExist when either of them exists
+func createExportFile(path string) (*os.File, error) {
+	if _, err := os.Lstat(path); err == nil {
+		return nil, os.ErrExist
+	}
+	return os.OpenFile(path+exportPartSuffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, exportFileMode)
+}
+
+// rotate closes the current file, renames it to its final name and applies
+// the retention to the closed files
+func (s *exportSink) rotate() error {
+	current := s.current
+	s.current = nil
+	if current == nil {
+		return nil
+	}
+
+	err := current.buf.Flush()
+	if current.gzip != nil {
+		if e := current.gzip.Close(); err == nil {
+			err = e
+		}
+	}
+	if e := current.file.Close(); err == nil {
+		err = e
+	}
+	if e := os.Rename(current.path+exportPartSuffix, current.path); err == nil {
+		err = e
+	}
+	s.enforceRetention()
+	return err
+}
+
+// close finishes the current file, e.g. at the end of an import
+func (s *exportSink) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rotate()
+}
+
+// flushLoop flushes the current file regularly so that it can be tailed, and
+// rotates it once it is too old even when no indication arrives
+func (s *exportSink) flushLoop() {
+	for range time.Tick(s.flush) {
+		s.mu.Lock()
+		var err error
+		if s.current != nil && time.Since(s.current.opened) >= s.interval {
+			err = s.rotate()
+		} else if s.current != nil {
+			err = s.current.buf.Flush()
+			if err == nil && s.current.gzip != nil {
+				err = s.current.gzip.Flush()
+			}
+		}
+		s.mu.Unlock()
+		if err != nil {
+			xapp.Logger.Error("Failed to write export file: %v", err)
+			log.Printf("Failed to write export file: %v", err)
+		}
+	}
+}
+
+// recover gives the files left open by a previous run their final name. Their
+// content is kept up to the last complete line flushed, and compressed files
+// are written again with the gzip trailer missing after a crash. Files that
+// cannot be read are suffixed by .corrupt instead.
+func (s *exportSink) recover() error {
+	parts, err := filepath.Glob(filepath.Join(s.dir, exportFilePrefix+"*"+exportPartSuffix))
+	if err != nil {
+		return err
+	}
+	for _, part := range parts {
+		path := strings.TrimSuffix(part, exportPartSuffix)
+		if err := recoverExportFile(part); err != nil {
+			xapp.Logger.Warn("Failed to recover export file %s, kept as %s: %v", part, path+exportCorruptSuffix, err)
+			log.Printf("Failed to recover export file %s, kept as %s: %v", part, path+exportCorruptSuffix, err)
+			path += exportCorruptSuffix
+		}
+		if err := os.Rename(part, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recoverExportFile truncates the .part file after its last complete line
+func recoverExportFile(part string) error {
+	data, err := ioutil.ReadFile(part)
+	if err != nil {
+		return err
+	}
+	compressed := strings.HasSuffix(strings.TrimSuffix(part, exportPartSuffix), ".gz")
+	if compressed && len(data) > 0 {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		// the stream is readable up to the last flush, then ends without trailer
+		if data, err = ioutil.ReadAll(r); err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+	}
+	data = data[:bytes.LastIndexByte(data, '\n')+1]
+
+	var out bytes.Buffer
+	if compressed {
+		w := gzip.NewWriter(&out)
+		w.Write(data)
+		w.Close()
+	} else {
+		out.Write(data)
+	}
+	return ioutil.WriteFile(part, out.Bytes(), exportFileMode)
+}
+
+// enforceRetention removes the closed files older than the retention and the
+// oldest ones beyond the maximum number of files
+func (s *exportSink) enforceRetention() {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		xapp.Logger.Error("Failed to list export files: %v", err)
+		log.Printf("Failed to list export files: %v", err)
+		return
+	}
+
+	var closed []os.FileInfo
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), exportFilePrefix) && !strings.HasSuffix(f.Name(), exportPartSuffix) {
+			closed = append(closed, f)
+		}
+	}
+	sort.Slice(closed, func(i, j int) bool { return closed[i].Name() < closed[j].Name() })
+
+	for i, f := range closed {
+		expired := s.retention > 0 && time.Since(f.ModTime()) > s.retention
+		excess := s.maxFiles > 0 && len(closed)-i > s.maxFiles
+		if !expired && !excess {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, f.Name())); err != nil {
+			xapp.Logger.Error("Failed to remove export file: %v", err)
+			log.Printf("Failed to remove export file: %v", err)
+		}
+	}
+}
+
+func newExportIndication(ind *indication) *ExportIndication {
+	export := &ExportIndication{
+		StreamEvent:           newStreamEvent(ind),
+		RequestSequenceNumber: ind.Msg.RequestSequenceNumber,
+		IndType:               ind.Msg.IndType,
+		MeasInfo:              []ExportMeasInfo{},
+	}
+
+	measInfo := export.StreamEvent.MeasInfo
+	switch msg := ind.Message.IndMsg.(type) {
+	case *IndicationMessageFormat1:
+		for i, info := range msg.MeasInfoList {
+			item := ExportMeasInfo{StreamMeasInfo: measInfo[i]}
+			for j := range info.LabelInfoList {
+				item.LabelInfo = append(item.LabelInfo, newExportLabel(&info.LabelInfoList[j]))
+			}
+			export.MeasInfo = append(export.MeasInfo, item)
+		}
+	case *IndicationMessageFormat2:
+		for i, info := range msg.MeasInfoUeidList {
+			item := ExportMeasInfo{StreamMeasInfo: measInfo[i]}
+			for _, cond := range info.MatchingCondList {
+				if label := matchingCondLabel(cond); label != nil {
+					item.LabelInfo = append(item.LabelInfo, newExportLabel(label))
+				}
+			}
+			export.MeasInfo = append(export.MeasInfo, item)
+		}
+	}
+	return export
+}
+
+func newExportLabel(label *MeasLabelInfo) ExportLabel {
+	return ExportLabel{
+		PLMNID:           plmnString(label.PLMNID),
+		SliceID:          sliceString(label.SliceID),
+		FiveQI:           label.FiveQI,
+		QCI:              label.QCI,
+		QCImax:           label.QCImax,
+		QCImin:           label.QCImin,
+		ARPmax:           label.ARPmax,
+		ARPmin:           label.ARPmin,
+		BitrateRange:     label.BitrateRange,
+		LayerMU_MIMO:     label.LayerMU_MIMO,
+		SUM:              label.SUM,
+		DistBinX:         label.DistBinX,
+		DistBinY:         label.DistBinY,
+		DistBinZ:         label.DistBinZ,
+		PreLabelOverride: label.PreLabelOverride,
+		StartEndInd:      label.StartEndInd,
+	}
+}
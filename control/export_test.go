@@ -0,0 +1,274 @@
+package control
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestExportSink(t *testing.T, env map[string]string) (*exportSink, string, func()) {
+	dir, err := ioutil.TempDir("", "kpimon-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env["exportDir"] = dir
+	s := newTestSink(t, env, func() (interface{}, error) {
+		s, err := newExportSink()
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+		return s, err
+	})
+	return s.(*exportSink), dir, func() { os.RemoveAll(dir) }
+}
+
+// exportFiles returns the names of the export files in dir, sorted
+func exportFiles(t *testing.T, dir string) []string {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readExportFile returns the content of an export file, uncompressed
+func readExportFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.HasSuffix(path, ".gz") {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err = ioutil.ReadAll(r); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+	}
+	return string(data)
+}
+
+func TestExportSinkJSON(t *testing.T) {
+	s, dir, cleanup := newTestExportSink(t, map[string]string{})
+	defer cleanup()
+
+	ind := testIndication()
+	ind.Msg.RequestSequenceNumber = 3
+	ind.Message = format1Message(MeasInfoItem{MeasType: 1, Measurement: printableString("DRB.UEThpDl"), LabelInfoCount: 1,
+		LabelInfoList: []MeasLabelInfo{{PLMNID: &testPLMNOctets, SliceID: &testSlice, FiveQI: 9}}})
+	if err := s.write(&batch{ind: ind}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.write(&batch{rollups: []Rollup{{}}}); err != nil {
+		t.Fatal(err)
+	}
+	if names := exportFiles(t, dir); len(names) != 1 || !strings.HasSuffix(names[0], ".jsonl.gz"+exportPartSuffix) {
+		t.Fatalf("got files %v while open", names)
+	}
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names := exportFiles(t, dir)
+	if len(names) != 1 || !strings.HasSuffix(names[0], ".jsonl.gz") {
+		t.Fatalf("got files %v after closing", names)
+	}
+	lines := strings.Split(strings.TrimSuffix(readExportFile(t, filepath.Join(dir, names[0])), "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want the indication only", len(lines))
+	}
+	var export ExportIndication
+	if err := json.Unmarshal([]byte(lines[0]), &export); err != nil {
+		t.Fatal(err)
+	}
+	if export.RanName != "gnb-1" || export.RequestSequenceNumber != 3 || export.GranulPeriod != 100 || len(export.Records) != 2 {
+		t.Errorf("got export %+v", export)
+	}
+	if len(export.MeasInfo) != 1 || export.MeasInfo[0].Measurement != "DRB.UEThpDl" ||
+		len(export.MeasInfo[0].LabelInfo) != 1 || export.MeasInfo[0].LabelInfo[0].FiveQI != 9 || export.MeasInfo[0].LabelInfo[0].SliceID != "1-010203" {
+		t.Errorf("got measurement info %+v", export.MeasInfo)
+	}
+}
+
+func TestExportSinkCSV(t *testing.T) {
+	s, dir, cleanup := newTestExportSink(t, map[string]string{"exportFormat": "csv", "exportCompress": "false"})
+	defer cleanup()
+
+	ind := testIndication()
+	ind.Msg.RequestSequenceNumber = 3
+	ind.Header = gnbNodeHeader(0, nil)
+	ind.Message = format1Message()
+	if err := s.write(&batch{ind: ind}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names := exportFiles(t, dir)
+	if len(names) != 1 || !strings.HasSuffix(names[0], ".csv") {
+		t.Fatalf("got files %v", names)
+	}
+	rows, err := csv.NewReader(strings.NewReader(readExportFile(t, filepath.Join(dir, names[0])))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || strings.Join(rows[0], ",") != strings.Join(exportCSVColumns, ",") {
+		t.Fatalf("got rows %v, want the header and a row per sample", rows)
+	}
+	column := make(map[string]int)
+	for i, name := range exportCSVColumns {
+		column[name] = i
+	}
+	for i, want := range []map[string]string{
+		{"ranName": "gnb-1", "received": "2020-09-13T12:26:40Z", "requestId": "1001", "requestSequenceNumber": "3", "indicationSN": "7", "format": "1",
+			"granulPeriod": "100", "cellObjId": "cell-1", "senderName": "du1", "measurement": "RRU.PrbUsedDl", "value": "42", "cellId": "cell-1", "fiveQI": "0"},
+		{"ranName": "gnb-1", "measurement": "DRB.UEThpDl", "value": "12.5", "cellId": "cell-2", "sliceId": "1-010203", "fiveQI": "9", "ueId": ""},
+	} {
+		for name, value := range want {
+			if got := rows[i+1][column[name]]; got != value {
+				t.Errorf("row %d: got %s %q, want %q", i+1, name, got, value)
+			}
+		}
+	}
+}
+
+func TestExportSinkRotation(t *testing.T) {
+	s, dir, cleanup := newTestExportSink(t, map[string]string{"exportCompress": "false"})
+	defer cleanup()
+
+	// rotated by size once the buffered lines reach the file
+	s.maxSize = 1
+	for i := 0; i < 50; i++ {
+		if err := s.write(&batch{ind: testIndication()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+	names := exportFiles(t, dir)
+	if len(names) < 2 {
+		t.Fatalf("got files %v, want rotated by size", names)
+	}
+	lines := 0
+	for _, name := range names {
+		if strings.HasSuffix(name, exportPartSuffix) {
+			t.Errorf("file %s left open", name)
+		}
+		lines += strings.Count(readExportFile(t, filepath.Join(dir, name)), "\n")
+	}
+	if lines != 50 {
+		t.Errorf("got %d lines in %d files, want 50", lines, len(names))
+	}
+
+	// rotated by age
+	for _, name := range names {
+		os.Remove(filepath.Join(dir, name))
+	}
+	s.maxSize = 1 << 20
+	s.write(&batch{ind: testIndication()})
+	s.current.opened = s.current.opened.Add(-s.interval)
+	s.write(&batch{ind: testIndication()})
+	if names = exportFiles(t, dir); len(names) != 2 || strings.HasSuffix(names[0], exportPartSuffix) || !strings.HasSuffix(names[1], exportPartSuffix) {
+		t.Errorf("got files %v, want the file older than the interval closed", names)
+	}
+	s.close()
+}
+
+func TestExportSinkRecover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kpimon-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name string, data []byte) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, exportFileMode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// flushed but not closed, the gzip trailer is missing
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write([]byte("line-1\nline-2\nline-"))
+	w.Flush()
+	write("kpimon-20200913T122640.000Z.jsonl.gz.part", compressed.Bytes())
+	write("kpimon-20200913T122641.000Z.jsonl.part", []byte("line-1\nline-"))
+	write("kpimon-20200913T122642.000Z.jsonl.gz.part", nil)
+	write("kpimon-20200913T122643.000Z.jsonl.gz.part", []byte("not compressed"))
+
+	restore := setEnv(map[string]string{"exportDir": dir})
+	_, err = newExportSink()
+	restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"kpimon-20200913T122640.000Z.jsonl.gz",
+		"kpimon-20200913T122641.000Z.jsonl",
+		"kpimon-20200913T122642.000Z.jsonl.gz",
+		"kpimon-20200913T122643.000Z.jsonl.gz" + exportCorruptSuffix,
+	}
+	if names := exportFiles(t, dir); strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("got files %v, want %v", names, want)
+	}
+	for i, content := range []string{"line-1\nline-2\n", "line-1\n", ""} {
+		if got := readExportFile(t, filepath.Join(dir, want[i])); got != content {
+			t.Errorf("%s: got %q, want %q", want[i], got, content)
+		}
+	}
+}
+
+func TestExportSinkRetention(t *testing.T) {
+	s, dir, cleanup := newTestExportSink(t, map[string]string{})
+	defer cleanup()
+	s.retention = time.Hour
+	s.maxFiles = 2
+
+	now := time.Now()
+	for _, f := range []struct {
+		name     string
+		modified time.Time
+	}{
+		{"kpimon-20200913T122640.000Z.jsonl.gz", now.Add(-2 * time.Hour)},
+		{"kpimon-20200913T122641.000Z.jsonl.gz", now},
+		{"kpimon-20200913T122642.000Z.jsonl.gz", now},
+		{"kpimon-20200913T122643.000Z.jsonl.gz", now},
+		{"kpimon-20200913T122644.000Z.jsonl.gz.part", now.Add(-2 * time.Hour)},
+		{"notes.txt", now.Add(-2 * time.Hour)},
+	} {
+		path := filepath.Join(dir, f.name)
+		if err := ioutil.WriteFile(path, nil, exportFileMode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, f.modified, f.modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.enforceRetention()
+	want := []string{
+		"kpimon-20200913T122642.000Z.jsonl.gz",
+		"kpimon-20200913T122643.000Z.jsonl.gz",
+		"kpimon-20200913T122644.000Z.jsonl.gz.part",
+		"notes.txt",
+	}
+	if names := exportFiles(t, dir); strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("got files %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,419 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Canonical string forms of the RAN identifiers used for tags and keys:
+//
+//	PLMN identity   MCC followed by MNC, "310410" or "00101"
+//	NR CGI          PLMN and 36 bit NR cell identity in hex, "310410-00b5c6701"
+//	E-UTRA CGI      PLMN and 28 bit E-UTRA cell identity in hex, "310410-b5c6701"
+//	node ID         type, MCC, MNC and ID in hex, "gnb_310_410_b5c67788", with
+//	                the ID length appended when it is not the default of the type
+//	S-NSSAI         SST in decimal, followed by SD in hex when present, "1-0a0b0c"
+
+const (
+	nodeTypeGNB   = "gnb"
+	nodeTypeENGNB = "en_gnb"
+	nodeTypeNGENB = "ng_enb"
+	nodeTypeENB   = "enb"
+)
+
+const (
+	nrCellIdentityBits    = 36
+	eutraCellIdentityBits = 28
+	gnbIDMinBits          = 22
+	gnbIDMaxBits          = 32
+)
+
+// default ID length of every node type, other lengths are part of the node ID
+var nodeIDDefaultBits = map[string]int{
+	nodeTypeGNB:   32,
+	nodeTypeENGNB: 32,
+	nodeTypeNGENB: 20,
+	nodeTypeENB:   20,
+}
+
+// ID length of the eNB and ng-eNB ID choices
+const (
+	enbMacroBits      = 20
+	enbHomeBits       = 28
+	enbShortMacroBits = 18
+	enbLongMacroBits  = 21
+)
+
+type PLMNIdentity struct {
+	MCC string
+	MNC string
+}
+
+type NodeIdentity struct {
+	Type string
+	PLMN PLMNIdentity
+	ID   uint64
+	Bits int
+}
+
+type SNSSAI struct {
+	SST uint8
+	SD  *uint32
+}
+
+// DecodePLMNIdentity decodes the 3 octet TBCD PLMN identity of TS 38.413,
+// where a filler digit 0xf marks a 2 digit MNC.
+func DecodePLMNIdentity(buf []byte) (plmn PLMNIdentity, err error) {
+	if len(buf) != 3 {
+		return plmn, errors.New("Invalid input: illegal length of PLMN identity")
+	}
+
+	digits := []byte{buf[0] & 0xf, buf[0] >> 4, buf[1] & 0xf, buf[1] >> 4, buf[2] & 0xf, buf[2] >> 4}
+	for i, d := range digits {
+		if d > 9 && !(i == 3 && d == 0xf) {
+			return plmn, errors.New("Invalid input: illegal digit in PLMN identity")
+		}
+	}
+
+	plmn.MCC = string([]byte{'0' + digits[0], '0' + digits[1], '0' + digits[2]})
+	if digits[3] == 0xf {
+		plmn.MNC = string([]byte{'0' + digits[4], '0' + digits[5]})
+	} else {
+		plmn.MNC = string([]byte{'0' + digits[4], '0' + digits[5], '0' + digits[3]})
+	}
+	return
+}
+
+// ParsePLMN parses the canonical form of a PLMN identity, MCC and MNC may
+// also be separated by a "-" or "_"
+func ParsePLMN(str string) (plmn PLMNIdentity, err error) {
+	str = strings.NewReplacer("-", "", "_", "").Replace(str)
+	if len(str) != 5 && len(str) != 6 {
+		return plmn, errors.New("Invalid input: illegal length of PLMN " + str)
+	}
+	for _, c := range str {
+		if c < '0' || c > '9' {
+			return plmn, errors.New("Invalid input: illegal digit in PLMN " + str)
+		}
+	}
+	return PLMNIdentity{MCC: str[:3], MNC: str[3:]}, nil
+}
+
+func (p PLMNIdentity) Encode() []byte {
+	digit := func(s string, i int) byte { return s[i] - '0' }
+	mnc3 := byte(0xf)
+	if len(p.MNC) == 3 {
+		mnc3 = digit(p.MNC, 2)
+	}
+	return []byte{
+		digit(p.MCC, 1)<<4 | digit(p.MCC, 0),
+		mnc3<<4 | digit(p.MCC, 2),
+		digit(p.MNC, 1)<<4 | digit(p.MNC, 0),
+	}
+}
+
+func (p PLMNIdentity) String() string {
+	return p.MCC + p.MNC
+}
+
+// DecodeBitString returns the value and the length in bits of a BIT STRING
+func DecodeBitString(bs BitString) (value uint64, bits int, err error) {
+	if bs.BitsUnused < 0 || bs.BitsUnused > 7 || len(bs.Buf) > 8 || len(bs.Buf) < bs.Size {
+		return 0, 0, errors.New("Invalid input: illegal bit string")
+	}
+	for i := 0; i < bs.Size; i++ {
+		value = value<<8 | uint64(bs.Buf[i])
+	}
+	return value >> uint(bs.BitsUnused), bs.Size*8 - bs.BitsUnused, nil
+}
+
+// EncodeBitString returns the BIT STRING of the given length holding value
+func EncodeBitString(value uint64, bits int) BitString {
+	size := (bits + 7) / 8
+	unused := size*8 - bits
+	value <<= uint(unused)
+	buf := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		buf[i] = byte(value)
+		value >>= 8
+	}
+	return BitString{Buf: buf, Size: size, BitsUnused: unused}
+}
+
+// DecodeNRCGI returns the canonical form of an NR CGI
+func DecodeNRCGI(nrcgi NRCGIType) (string, error) {
+	plmn, err := DecodePLMNIdentity(octets(nrcgi.PlmnID))
+	if err != nil {
+		return "", err
+	}
+	nci, bits, err := DecodeBitString(nrcgi.NRCellID)
+	if err != nil {
+		return "", err
+	}
+	if bits != nrCellIdentityBits {
+		return "", errors.New("Invalid input: illegal length of NR cell identity")
+	}
+	return fmt.Sprintf("%s-%09x", plmn, nci), nil
+}
+
+func EncodeNRCGI(plmn PLMNIdentity, nci uint64) NRCGIType {
+	return NRCGIType{
+		PlmnID:   OctetString{Buf: plmn.Encode(), Size: 3},
+		NRCellID: EncodeBitString(nci, nrCellIdentityBits),
+	}
+}
+
+// DecodeEUTRACGI returns the canonical form of an E-UTRA CGI
+func DecodeEUTRACGI(plmnID OctetString, cellID BitString) (string, error) {
+	plmn, err := DecodePLMNIdentity(octets(plmnID))
+	if err != nil {
+		return "", err
+	}
+	eci, bits, err := DecodeBitString(cellID)
+	if err != nil {
+		return "", err
+	}
+	if bits != eutraCellIdentityBits {
+		return "", errors.New("Invalid input: illegal length of E-UTRA cell identity")
+	}
+	return fmt.Sprintf("%s-%07x", plmn, eci), nil
+}
+
+// ParseCGI parses the canonical form of an NR or E-UTRA CGI
+func ParseCGI(str string) (plmn PLMNIdentity, cellID uint64, err error) {
+	parts := strings.Split(str, "-")
+	if len(parts) != 2 {
+		return plmn, 0, errors.New("Invalid input: illegal CGI " + str)
+	}
+	plmn, err = ParsePLMN(parts[0])
+	if err != nil {
+		return
+	}
+	cellID, err = strconv.ParseUint(parts[1], 16, 64)
+	return
+}
+
+// DecodeGlobalKPMnodeID resolves any of the four GlobalKPMnode-ID choices
+func DecodeGlobalKPMnodeID(nodeIDType int32, nodeID interface{}) (node NodeIdentity, err error) {
+	var plmnID OctetString
+	var id *BitString
+	var expectBits int
+
+	switch n := nodeID.(type) {
+	case *GlobalKPMnodegNBIDType:
+		node.Type = nodeTypeGNB
+		plmnID = n.GlobalgNBID.PlmnID
+		if gnbID, ok := n.GlobalgNBID.GnbID.(*GNBID); ok {
+			id = (*BitString)(gnbID)
+		}
+	case *GlobalKPMnodeengNBIDType:
+		node.Type = nodeTypeENGNB
+		plmnID = n.PlmnID
+		if gnbID, ok := n.GnbID.(*ENGNBID); ok {
+			id = (*BitString)(gnbID)
+		}
+	case *GlobalKPMnodengeNBIDType:
+		node.Type = nodeTypeNGENB
+		plmnID = n.PlmnID
+		switch enbID := n.EnbID.(type) {
+		case *NGENBID_Macro:
+			id, expectBits = (*BitString)(enbID), enbMacroBits
+		case *NGENBID_ShortMacro:
+			id, expectBits = (*BitString)(enbID), enbShortMacroBits
+		case *NGENBID_LongMacro:
+			id, expectBits = (*BitString)(enbID), enbLongMacroBits
+		}
+	case *GlobalKPMnodeeNBIDType:
+		node.Type = nodeTypeENB
+		plmnID = n.PlmnID
+		switch enbID := n.EnbID.(type) {
+		case *ENBID_Macro:
+			id, expectBits = (*BitString)(enbID), enbMacroBits
+		case *ENBID_Home:
+			id, expectBits = (*BitString)(enbID), enbHomeBits
+		case *ENBID_ShortMacro:
+			id, expectBits = (*BitString)(enbID), enbShortMacroBits
+		case *ENBID_LongMacro:
+			id, expectBits = (*BitString)(enbID), enbLongMacroBits
+		}
+	default:
+		return node, errors.New("Invalid input: unknown GlobalKPMnodeID type " + strconv.Itoa(int(nodeIDType)))
+	}
+
+	if id == nil {
+		return node, errors.New("Invalid input: missing node ID")
+	}
+	node.PLMN, err = DecodePLMNIdentity(octets(plmnID))
+	if err != nil {
+		return
+	}
+	node.ID, node.Bits, err = DecodeBitString(*id)
+	if err != nil {
+		return
+	}
+
+	if node.Type == nodeTypeGNB || node.Type == nodeTypeENGNB {
+		if node.Bits < gnbIDMinBits || node.Bits > gnbIDMaxBits {
+			return node, errors.New("Invalid input: illegal length of gNB ID")
+		}
+	} else if node.Bits != expectBits {
+		return node, errors.New("Invalid input: illegal length of eNB ID")
+	}
+	return
+}
+
+func (n NodeIdentity) String() string {
+	str := fmt.Sprintf("%s_%s_%s_%0*x", n.Type, n.PLMN.MCC, n.PLMN.MNC, (n.Bits+3)/4, n.ID)
+	if n.Bits != nodeIDDefaultBits[n.Type] {
+		str += "_" + strconv.Itoa(n.Bits)
+	}
+	return str
+}
+
+// ParseNodeIdentity parses the canonical form of a node ID
+func ParseNodeIdentity(str string) (node NodeIdentity, err error) {
+	for _, t := range []string{nodeTypeENGNB, nodeTypeNGENB, nodeTypeGNB, nodeTypeENB} {
+		if strings.HasPrefix(str, t+"_") {
+			node.Type = t
+			break
+		}
+	}
+	if node.Type == "" {
+		return node, errors.New("Invalid input: unknown node type in " + str)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(str, node.Type+"_"), "_")
+	if len(parts) != 3 && len(parts) != 4 {
+		return node, errors.New("Invalid input: illegal node ID " + str)
+	}
+	if len(parts[0]) != 3 || len(parts[1]) < 2 || len(parts[1]) > 3 {
+		return node, errors.New("Invalid input: illegal PLMN in node ID " + str)
+	}
+	node.PLMN, err = ParsePLMN(parts[0] + parts[1])
+	if err != nil {
+		return
+	}
+	node.ID, err = strconv.ParseUint(parts[2], 16, 64)
+	if err != nil {
+		return
+	}
+	node.Bits = nodeIDDefaultBits[node.Type]
+	if len(parts) == 4 {
+		node.Bits, err = strconv.Atoi(parts[3])
+	}
+	return
+}
+
+// DecodeSNSSAI decodes the 1 octet SST and the optional 3 octet SD
+func DecodeSNSSAI(sliceID SliceIDType) (snssai SNSSAI, err error) {
+	if sliceID.SST.Size != 1 || len(sliceID.SST.Buf) < 1 {
+		return snssai, errors.New("Invalid input: illegal length of SST")
+	}
+	snssai.SST = sliceID.SST.Buf[0]
+	if sliceID.SD != nil {
+		if sliceID.SD.Size != 3 || len(sliceID.SD.Buf) < 3 {
+			return snssai, errors.New("Invalid input: illegal length of SD")
+		}
+		sd := uint32(sliceID.SD.Buf[0])<<16 | uint32(sliceID.SD.Buf[1])<<8 | uint32(sliceID.SD.Buf[2])
+		snssai.SD = &sd
+	}
+	return
+}
+
+// ParseSNSSAI parses the canonical form of an S-NSSAI
+func ParseSNSSAI(str string) (snssai SNSSAI, err error) {
+	parts := strings.Split(str, "-")
+	if len(parts) > 2 {
+		return snssai, errors.New("Invalid input: illegal S-NSSAI " + str)
+	}
+	sst, err := strconv.ParseUint(parts[0], 10, 8)
+	if err != nil {
+		return
+	}
+	snssai.SST = uint8(sst)
+	if len(parts) == 2 {
+		sd, err := strconv.ParseUint(parts[1], 16, 24)
+		if err != nil {
+			return snssai, err
+		}
+		sd32 := uint32(sd)
+		snssai.SD = &sd32
+	}
+	return
+}
+
+func (s SNSSAI) Encode() SliceIDType {
+	sliceID := SliceIDType{SST: OctetString{Buf: []byte{s.SST}, Size: 1}}
+	if s.SD != nil {
+		sliceID.SD = &OctetString{Buf: []byte{byte(*s.SD >> 16), byte(*s.SD >> 8), byte(*s.SD)}, Size: 3}
+	}
+	return sliceID
+}
+
+func (s SNSSAI) String() string {
+	if s.SD == nil {
+		return strconv.Itoa(int(s.SST))
+	}
+	return fmt.Sprintf("%d-%06x", s.SST, *s.SD)
+}
+
+// octets returns the used part of an OCTET STRING
+func octets(o OctetString) []byte {
+	if o.Size >= 0 && o.Size <= len(o.Buf) {
+		return o.Buf[:o.Size]
+	}
+	return o.Buf
+}
+
+// plmnString and sliceString return the canonical form, or the hex dump of
+// identities that cannot be decoded
+func plmnString(plmnID *OctetString) string {
+	if plmnID == nil {
+		return ""
+	}
+	plmn, err := DecodePLMNIdentity(octets(*plmnID))
+	if err != nil {
+		return fmt.Sprintf("%x", plmnID.Buf)
+	}
+	return plmn.String()
+}
+
+func sliceString(sliceID *SliceIDType) string {
+	if sliceID == nil {
+		return ""
+	}
+	snssai, err := DecodeSNSSAI(*sliceID)
+	if err != nil {
+		str := fmt.Sprintf("%x", sliceID.SST.Buf)
+		if sliceID.SD != nil {
+			str += fmt.Sprintf("-%x", sliceID.SD.Buf)
+		}
+		return str
+	}
+	return snssai.String()
+}
+
+func nodeIDString(nodeIDType int32, nodeID interface{}) string {
+	node, err := DecodeGlobalKPMnodeID(nodeIDType, nodeID)
+	if err == nil {
+		return node.String()
+	}
+
+	var id interface{}
+	switch n := nodeID.(type) {
+	case *GlobalKPMnodegNBIDType:
+		id = n.GlobalgNBID.GnbID
+	case *GlobalKPMnodeengNBIDType:
+		id = n.GnbID
+	case *GlobalKPMnodengeNBIDType:
+		id = n.EnbID
+	case *GlobalKPMnodeeNBIDType:
+		id = n.EnbID
+	}
+	if bits := nodeIDBits(id); bits != nil {
+		return fmt.Sprintf("%x", bits.Buf)
+	}
+	return ""
+}
@@ -0,0 +1,277 @@
+package control
+
+import (
+	"bytes"
+	"testing"
+)
+
+var testPLMN = OctetString{Buf: []byte{0x13, 0x00, 0x14}, Size: 3} //310 410
+
+func TestDecodePLMNIdentity(t *testing.T) {
+	tests := []struct {
+		name    string
+		buf     []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "3 digit MNC", buf: []byte{0x13, 0x00, 0x14}, want: "310410"},
+		{name: "2 digit MNC with filler", buf: []byte{0x00, 0xf1, 0x10}, want: "00101"},
+		{name: "2 digit MNC", buf: []byte{0x32, 0xf4, 0x51}, want: "23415"},
+		{name: "3 digit MNC ending in 9", buf: []byte{0x21, 0x93, 0x54}, want: "123459"},
+		{name: "too short", buf: []byte{0x13, 0x00}, wantErr: true},
+		{name: "too long", buf: []byte{0x13, 0x00, 0x14, 0x00}, wantErr: true},
+		{name: "digit above 9 in MCC", buf: []byte{0x1a, 0x00, 0x14}, wantErr: true},
+		{name: "filler in MCC", buf: []byte{0xf3, 0x00, 0x14}, wantErr: true},
+		{name: "filler in the last MNC digit", buf: []byte{0x13, 0x00, 0xf4}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plmn, err := DecodePLMNIdentity(test.buf)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", plmn)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if plmn.String() != test.want {
+				t.Errorf("got %s, want %s", plmn, test.want)
+			}
+
+			parsed, err := ParsePLMN(test.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(parsed.Encode(), test.buf) {
+				t.Errorf("encoded %x, want %x", parsed.Encode(), test.buf)
+			}
+		})
+	}
+}
+
+func TestParsePLMN(t *testing.T) {
+	tests := []struct {
+		str     string
+		want    PLMNIdentity
+		wantErr bool
+	}{
+		{str: "310410", want: PLMNIdentity{"310", "410"}},
+		{str: "00101", want: PLMNIdentity{"001", "01"}},
+		{str: "310-410", want: PLMNIdentity{"310", "410"}},
+		{str: "001_01", want: PLMNIdentity{"001", "01"}},
+		{str: "3104", wantErr: true},
+		{str: "3104101", wantErr: true},
+		{str: "31a410", wantErr: true},
+	}
+
+	for _, test := range tests {
+		plmn, err := ParsePLMN(test.str)
+		if test.wantErr != (err != nil) || plmn != test.want {
+			t.Errorf("%q: got %+v, %v", test.str, plmn, err)
+		}
+	}
+}
+
+func TestDecodeGlobalKPMnodeID(t *testing.T) {
+	bs := func(buf []byte, unused int) BitString {
+		return BitString{Buf: buf, Size: len(buf), BitsUnused: unused}
+	}
+	gnb := func(id BitString) *GlobalKPMnodegNBIDType {
+		gnbID := GNBID(id)
+		return &GlobalKPMnodegNBIDType{GlobalgNBID: GlobalgNBIDType{PlmnID: testPLMN, GnbIDType: 1, GnbID: &gnbID}}
+	}
+	engnb := func(id BitString) *GlobalKPMnodeengNBIDType {
+		gnbID := ENGNBID(id)
+		return &GlobalKPMnodeengNBIDType{PlmnID: testPLMN, GnbIDType: 1, GnbID: &gnbID}
+	}
+	ngenb := func(id interface{}) *GlobalKPMnodengeNBIDType {
+		return &GlobalKPMnodengeNBIDType{PlmnID: testPLMN, EnbID: id}
+	}
+	enb := func(id interface{}) *GlobalKPMnodeeNBIDType {
+		return &GlobalKPMnodeeNBIDType{PlmnID: testPLMN, EnbID: id}
+	}
+	ngenbMacro := NGENBID_Macro(EncodeBitString(0xabcde, 20))
+	ngenbShort := NGENBID_ShortMacro(EncodeBitString(0x2abcd, 18))
+	ngenbLong := NGENBID_LongMacro(EncodeBitString(0x1abcde, 21))
+	enbMacro := ENBID_Macro(EncodeBitString(0xabcde, 20))
+	enbHome := ENBID_Home(EncodeBitString(0xabcdef1, 28))
+	enbShort := ENBID_ShortMacro(EncodeBitString(0x2abcd, 18))
+	enbLong := ENBID_LongMacro(EncodeBitString(0x1abcde, 21))
+	enbMacroWrongLength := ENBID_Macro(EncodeBitString(0xabcdef1, 28))
+	ngenbLongWrongLength := NGENBID_LongMacro(EncodeBitString(0xabcde, 20))
+
+	tests := []struct {
+		name     string
+		nodeType int32
+		nodeID   interface{}
+		want     string
+		wantErr  bool
+	}{
+		{name: "gNB 32 bits", nodeType: 1, nodeID: gnb(bs([]byte{0xb5, 0xc6, 0x77, 0x88}, 0)), want: "gnb_310_410_b5c67788"},
+		{name: "gNB 29 bits", nodeType: 1, nodeID: gnb(bs([]byte{0xb5, 0xc6, 0x77, 0x88}, 3)), want: "gnb_310_410_16b8cef1_29"},
+		{name: "gNB 24 bits", nodeType: 1, nodeID: gnb(bs([]byte{0x12, 0x34, 0x56}, 0)), want: "gnb_310_410_123456_24"},
+		{name: "gNB 22 bits", nodeType: 1, nodeID: gnb(EncodeBitString(0x2abcd, 22)), want: "gnb_310_410_02abcd_22"},
+		{name: "gNB 21 bits", nodeType: 1, nodeID: gnb(bs([]byte{0x12, 0x34, 0x50}, 3)), wantErr: true},
+		{name: "gNB 33 bits", nodeType: 1, nodeID: gnb(bs([]byte{0x12, 0x34, 0x56, 0x78, 0x80}, 7)), wantErr: true},
+		{name: "gNB missing ID", nodeType: 1, nodeID: &GlobalKPMnodegNBIDType{GlobalgNBID: GlobalgNBIDType{PlmnID: testPLMN}}, wantErr: true},
+		{name: "en-gNB 32 bits", nodeType: 2, nodeID: engnb(bs([]byte{0xb5, 0xc6, 0x77, 0x88}, 0)), want: "en_gnb_310_410_b5c67788"},
+		{name: "en-gNB 22 bits", nodeType: 2, nodeID: engnb(EncodeBitString(0x2abcd, 22)), want: "en_gnb_310_410_02abcd_22"},
+		{name: "ng-eNB macro", nodeType: 3, nodeID: ngenb(&ngenbMacro), want: "ng_enb_310_410_abcde"},
+		{name: "ng-eNB short macro", nodeType: 3, nodeID: ngenb(&ngenbShort), want: "ng_enb_310_410_2abcd_18"},
+		{name: "ng-eNB long macro", nodeType: 3, nodeID: ngenb(&ngenbLong), want: "ng_enb_310_410_1abcde_21"},
+		{name: "ng-eNB long macro of 20 bits", nodeType: 3, nodeID: ngenb(&ngenbLongWrongLength), wantErr: true},
+		{name: "eNB macro", nodeType: 4, nodeID: enb(&enbMacro), want: "enb_310_410_abcde"},
+		{name: "eNB home", nodeType: 4, nodeID: enb(&enbHome), want: "enb_310_410_abcdef1_28"},
+		{name: "eNB short macro", nodeType: 4, nodeID: enb(&enbShort), want: "enb_310_410_2abcd_18"},
+		{name: "eNB long macro", nodeType: 4, nodeID: enb(&enbLong), want: "enb_310_410_1abcde_21"},
+		{name: "eNB macro of 28 bits", nodeType: 4, nodeID: enb(&enbMacroWrongLength), wantErr: true},
+		{name: "eNB bad PLMN", nodeType: 4, nodeID: &GlobalKPMnodeeNBIDType{PlmnID: OctetString{Buf: []byte{0x13}, Size: 1}, EnbID: &enbMacro}, wantErr: true},
+		{name: "unknown type", nodeType: 5, nodeID: &enbMacro, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node, err := DecodeGlobalKPMnodeID(test.nodeType, test.nodeID)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", node)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if node.String() != test.want {
+				t.Errorf("got %s, want %s", node, test.want)
+			}
+
+			parsed, err := ParseNodeIdentity(test.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed != node {
+				t.Errorf("parsed %+v, want %+v", parsed, node)
+			}
+		})
+	}
+}
+
+func TestParseNodeIdentityRejectsMalformed(t *testing.T) {
+	for _, str := range []string{"", "xnb_310_410_1", "gnb_310_410", "gnb_310_410_1_2_3", "gnb_31_410_1", "gnb_310_410_xyz", "gnb_310_410_1_x"} {
+		if node, err := ParseNodeIdentity(str); err == nil {
+			t.Errorf("%q: got %+v, want an error", str, node)
+		}
+	}
+}
+
+func TestDecodeCGI(t *testing.T) {
+	tests := []struct {
+		name    string
+		nr      bool
+		cellID  BitString
+		want    string
+		wantErr bool
+	}{
+		{name: "NR 36 bits", nr: true, cellID: BitString{Buf: []byte{0x12, 0x34, 0x56, 0x78, 0x90}, Size: 5, BitsUnused: 4}, want: "310410-123456789"},
+		{name: "NR leading zeros", nr: true, cellID: EncodeBitString(0xb5c6701, 36), want: "310410-00b5c6701"},
+		{name: "NR 32 bits", nr: true, cellID: BitString{Buf: []byte{0x12, 0x34, 0x56, 0x78}, Size: 4}, wantErr: true},
+		{name: "NR 40 bits", nr: true, cellID: BitString{Buf: []byte{0x12, 0x34, 0x56, 0x78, 0x90}, Size: 5}, wantErr: true},
+		{name: "NR buffer shorter than size", nr: true, cellID: BitString{Buf: []byte{0x12, 0x34}, Size: 5, BitsUnused: 4}, wantErr: true},
+		{name: "NR unused bits out of range", nr: true, cellID: BitString{Buf: []byte{0x12, 0x34, 0x56, 0x78, 0x90}, Size: 5, BitsUnused: 8}, wantErr: true},
+		{name: "E-UTRA 28 bits", cellID: BitString{Buf: []byte{0xb5, 0xc6, 0x70, 0x10}, Size: 4, BitsUnused: 4}, want: "310410-b5c6701"},
+		{name: "E-UTRA leading zeros", cellID: EncodeBitString(0x1, 28), want: "310410-0000001"},
+		{name: "E-UTRA 32 bits", cellID: BitString{Buf: []byte{0xb5, 0xc6, 0x70, 0x10}, Size: 4}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cgi string
+			var err error
+			if test.nr {
+				cgi, err = DecodeNRCGI(NRCGIType{PlmnID: testPLMN, NRCellID: test.cellID})
+			} else {
+				cgi, err = DecodeEUTRACGI(testPLMN, test.cellID)
+			}
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", cgi)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cgi != test.want {
+				t.Errorf("got %s, want %s", cgi, test.want)
+			}
+
+			plmn, cellID, err := ParseCGI(cgi)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.nr {
+				if encoded, _ := DecodeNRCGI(EncodeNRCGI(plmn, cellID)); encoded != cgi {
+					t.Errorf("re-encoded %s, want %s", encoded, cgi)
+				}
+			} else if encoded, _ := DecodeEUTRACGI(OctetString{Buf: plmn.Encode(), Size: 3}, EncodeBitString(cellID, 28)); encoded != cgi {
+				t.Errorf("re-encoded %s, want %s", encoded, cgi)
+			}
+		})
+	}
+}
+
+func TestDecodeSNSSAI(t *testing.T) {
+	tests := []struct {
+		name     string
+		sliceID  SliceIDType
+		want     string
+		combined int32
+		wantErr  bool
+	}{
+		{name: "SST only", sliceID: SliceIDType{SST: OctetString{Buf: []byte{1}, Size: 1}}, want: "1", combined: 1 << 24},
+		{name: "SST and SD", sliceID: SliceIDType{SST: OctetString{Buf: []byte{1}, Size: 1}, SD: &OctetString{Buf: []byte{0x0a, 0x0b, 0x0c}, Size: 3}}, want: "1-0a0b0c", combined: 1<<24 | 0x0a0b0c},
+		{name: "SD of zero", sliceID: SliceIDType{SST: OctetString{Buf: []byte{2}, Size: 1}, SD: &OctetString{Buf: []byte{0, 0, 0}, Size: 3}}, want: "2-000000", combined: 2 << 24},
+		{name: "SST of 2 octets", sliceID: SliceIDType{SST: OctetString{Buf: []byte{1, 2}, Size: 2}}, wantErr: true},
+		{name: "empty SST", sliceID: SliceIDType{SST: OctetString{Size: 1}}, wantErr: true},
+		{name: "SD of 2 octets", sliceID: SliceIDType{SST: OctetString{Buf: []byte{1}, Size: 1}, SD: &OctetString{Buf: []byte{0x0a, 0x0b}, Size: 2}}, wantErr: true},
+	}
+
+	var e2sm *E2sm
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snssai, err := DecodeSNSSAI(test.sliceID)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", snssai)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if snssai.String() != test.want {
+				t.Errorf("got %s, want %s", snssai, test.want)
+			}
+			if combined, err := e2sm.ParseSliceID(test.sliceID); err != nil || combined != test.combined {
+				t.Errorf("combined %#x, %v, want %#x", combined, err, test.combined)
+			}
+
+			parsed, err := ParseSNSSAI(test.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded, _ := DecodeSNSSAI(parsed.Encode()); decoded.String() != test.want {
+				t.Errorf("re-encoded %s, want %s", decoded, test.want)
+			}
+		})
+	}
+
+	for _, str := range []string{"", "256", "1-0a0b0c-1", "1-1000000", "x"} {
+		if snssai, err := ParseSNSSAI(str); err == nil {
+			t.Errorf("%q: got %s, want an error", str, snssai)
+		}
+	}
+}
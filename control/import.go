@@ -0,0 +1,295 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+// E2AP PDU choices and procedure codes
+const (
+	e2apInitiatingMessage   = 1
+	e2apSuccessfulOutcome   = 2
+	e2apUnsuccessfulOutcome = 3
+
+	e2apProcedureE2setup            = 1
+	e2apProcedureIndication         = 5
+	e2apProcedureServiceUpdate      = 7
+	e2apProcedureSubscription       = 8
+	e2apProcedureSubscriptionDelete = 9
+)
+
+const defaultImportConnectTimeout = 30 * time.Second
+
+// sinks an Importer can write to, by name
+var importSinks = []string{"influxdb", "sql", "export", "kafka", "mqtt", "ves"}
+
+// sinks an Importer writes to unless told otherwise. The others feed live
+// consumers, which do not expect historic data, and are written to only when
+// asked for.
+var defaultImportSinks = []string{"influxdb", "sql", "export"}
+
+// ImportOptions configures an Importer
+type ImportOptions struct {
+	Sinks          []string      //names of the sinks to write to, defaultImportSinks when empty
+	ConnectTimeout time.Duration //how long to wait for InfluxDB, defaultImportConnectTimeout when zero
+}
+
+// ImportStats counts the E2AP PDUs handled by an Importer
+type ImportStats struct {
+	Indications          int `json:"indications"`
+	SubscriptionMessages int `json:"subscriptionMessages"`
+	SetupMessages        int `json:"setupMessages"` //E2 Setup Requests and RIC Service Updates, read for the measurement IDs
+	Skipped              int `json:"skipped"`       //PDUs of other procedures and answers to requests not captured
+	Failed               int `json:"failed"`        //PDUs that could not be decoded
+}
+
+// Importer feeds E2AP PDUs captured on the E2 interface through the decoding
+// and storage stages, so that a historic capture is stored as if kpimon had
+// received it live. The capture time takes the place of the wall clock and the
+// PDUs are handled one by one in capture order.
+//
+// Alarms are tracked but not raised and no VES fault events are sent, both
+// describe the current state of the network.
+type Importer struct {
+	c      *Control
+	influx *influxSink //nil when InfluxDB is not written to
+	last   time.Time   //capture time of the latest PDU
+	stats  ImportStats
+}
+
+// importAlarmer drops the alarms raised while importing
+type importAlarmer struct{}
+
+func (importAlarmer) raise(a *ActiveAlarm) error {
+	return nil
+}
+
+func (importAlarmer) clear(a *ActiveAlarm) error {
+	return nil
+}
+
+// NewImporter sets up the sinks selected by opts from the same environment as
+// the xApp and waits until InfluxDB is reachable. A sink asked for by name
+// must be configured, of the default sinks those configured are written to.
+func NewImporter(opts ImportOptions) (*Importer, error) {
+	names := opts.Sinks
+	if len(names) == 0 {
+		names = defaultImportSinks
+	}
+	selected := make(map[string]bool)
+	for _, name := range names {
+		if !contains(importSinks, name) {
+			return nil, fmt.Errorf("unknown sink %q, expected one of %v", name, importSinks)
+		}
+		selected[name] = true
+	}
+
+	c, err := newControl(func(sink string) bool { return selected[sink] })
+	if err != nil {
+		return nil, err
+	}
+	c.alarms.alarmer = importAlarmer{}
+	c.alarms.onChange = nil
+
+	if len(opts.Sinks) > 0 {
+		for _, name := range opts.Sinks {
+			if !hasSink(c.sinks, name) {
+				return nil, fmt.Errorf("sink %s is not configured", name)
+			}
+		}
+	}
+
+	i := &Importer{c: &c}
+	if c.influx != nil {
+		timeout := opts.ConnectTimeout
+		if timeout <= 0 {
+			timeout = defaultImportConnectTimeout
+		}
+		if err := c.influx.connectBy(time.Now().Add(timeout)); err != nil {
+			return nil, err
+		}
+		i.influx = c.influx
+	}
+	return i, nil
+}
+
+func hasSink(sinks []sink, name string) bool {
+	for _, s := range sinks {
+		if s.name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Import decodes one E2AP PDU of the E2 node ranName captured at the given
+// time. RIC indications are stored, subscription messages update the
+// subscription state like their RMR handlers, E2 Setup Requests and RIC
+// Service Updates give the catalog the measurement IDs of the node, other
+// procedures are skipped.
+func (i *Importer) Import(ranName string, captured time.Time, payload []byte) error {
+	var e2ap *E2ap
+	c := i.c
+
+	messageType, procedureCode, err := e2ap.GetPDUProcedure(payload)
+	if err != nil {
+		i.stats.Failed++
+		c.metrics.decodeError(decodeStageE2ap)
+		return err
+	}
+	if captured.After(i.last) {
+		i.last = captured
+	}
+
+	params := &xapp.RMRParams{Payload: payload, PayloadLen: len(payload), Meid: &xapp.RMRMeid{RanName: ranName}}
+	switch {
+	case messageType == e2apInitiatingMessage && procedureCode == e2apProcedureIndication:
+		ind, err := c.handleIndication(params, captured)
+		if err != nil {
+			i.stats.Failed++
+			return err
+		}
+		i.stats.Indications++
+		if ind != nil {
+			anomalies := c.observeIndication(ind)
+			c.store(&batch{ind: ind, anomalies: anomalies})
+		}
+		if rollups := c.rollup.flush(captured); len(rollups) > 0 {
+			c.store(&batch{rollups: rollups})
+		}
+		if c.ves != nil {
+			c.ves.flush(false)
+		}
+		return nil
+	case messageType == e2apInitiatingMessage && (procedureCode == e2apProcedureE2setup || procedureCode == e2apProcedureServiceUpdate):
+		if err := c.learnMeasurementIDs(ranName, payload); err != nil {
+			i.stats.Failed++
+			return err
+		}
+		i.stats.SetupMessages++
+		return nil
+	case messageType == e2apInitiatingMessage && procedureCode == e2apProcedureSubscription:
+		req, err := e2ap.GetSubscriptionRequestMessage(payload)
+		if err != nil {
+			i.stats.Failed++
+			return err
+		}
+		c.subs.requested(ranName, int(req.RequestID), int(req.RequestSequenceNumber), int(req.FuncID))
+		c.eventCreateExpiredMu.Lock()
+		c.eventCreateExpiredMap[ranName] = false
+		c.eventCreateExpiredMu.Unlock()
+	case messageType == e2apSuccessfulOutcome && procedureCode == e2apProcedureSubscription:
+		if !pending(c.eventCreateExpiredMu, c.eventCreateExpiredMap, ranName) {
+			i.stats.Skipped++
+			return nil
+		}
+		err = c.handleSubscriptionResponse(params)
+	case messageType == e2apUnsuccessfulOutcome && procedureCode == e2apProcedureSubscription:
+		if !pending(c.eventCreateExpiredMu, c.eventCreateExpiredMap, ranName) {
+			i.stats.Skipped++
+			return nil
+		}
+		err = c.handleSubscriptionFailure(params)
+	case messageType == e2apInitiatingMessage && procedureCode == e2apProcedureSubscriptionDelete:
+		c.subs.setState(ranName, subStateDeleting)
+		c.eventDeleteExpiredMu.Lock()
+		c.eventDeleteExpiredMap[ranName] = false
+		c.eventDeleteExpiredMu.Unlock()
+	case messageType == e2apSuccessfulOutcome && procedureCode == e2apProcedureSubscriptionDelete:
+		if !pending(c.eventDeleteExpiredMu, c.eventDeleteExpiredMap, ranName) {
+			i.stats.Skipped++
+			return nil
+		}
+		err = c.handleSubscriptionDeleteResponse(params)
+	case messageType == e2apUnsuccessfulOutcome && procedureCode == e2apProcedureSubscriptionDelete:
+		if !pending(c.eventDeleteExpiredMu, c.eventDeleteExpiredMap, ranName) {
+			i.stats.Skipped++
+			return nil
+		}
+		err = c.handleSubscriptionDeleteFailure(params)
+	default:
+		i.stats.Skipped++
+		return nil
+	}
+
+	if err != nil {
+		i.stats.Failed++
+		return err
+	}
+	i.stats.SubscriptionMessages++
+	return nil
+}
+
+// learnMeasurementIDs gives the catalog the MeasurementTypeIDs advertised by
+// the E2SM-KPM RAN functions of an E2 Setup Request or a RIC Service Update
+func (c *Control) learnMeasurementIDs(ranName string, payload []byte) error {
+	var e2ap *E2ap
+	var e2sm *E2sm
+
+	ranFunctions, err := e2ap.GetRanFunctionDefinitions(payload)
+	if err != nil {
+		c.metrics.decodeError(decodeStageE2ap)
+		return err
+	}
+	for _, ranFunction := range ranFunctions {
+		mappings, err := e2sm.GetMeasurementMappings(ranFunction.Definition)
+		if err != nil {
+			continue //a RAN function of another service model
+		}
+		c.catalog.advertise(ranName, mappings)
+	}
+	return nil
+}
+
+// pending tells whether a request of the node was captured and not answered
+// yet, the answer to a request sent before the capture started is skipped
+func pending(mu *sync.Mutex, expired map[string]bool, ranName string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	answered, ok := expired[ranName]
+	return ok && !answered
+}
+
+// Close stores the rollup windows still open at the end of the capture,
+// replays the points spooled meanwhile and finishes the export file
+func (i *Importer) Close() (ImportStats, error) {
+	c := i.c
+
+	end := i.last.Add(c.rollup.grace)
+	for _, window := range c.rollup.windows {
+		end = end.Add(window)
+	}
+	if rollups := c.rollup.flush(end); len(rollups) > 0 {
+		c.store(&batch{rollups: rollups})
+	}
+
+	if c.ves != nil {
+		c.ves.flush(true)
+	}
+	if i.influx != nil && i.influx.spool != nil {
+		for i.influx.replay() {
+		}
+		if !i.influx.spool.empty() {
+			xapp.Logger.Warn("Points are left in the influxdb spool, they are replayed by the next run")
+			log.Printf("Points are left in the influxdb spool, they are replayed by the next run")
+		}
+	}
+
+	var err error
+	if c.export != nil {
+		if err = c.export.close(); err != nil {
+			err = errors.New("failed to close export file: " + err.Error())
+		}
+	}
+	return i.stats, err
+}
+
+// Stats returns the PDUs handled so far
+func (i *Importer) Stats() ImportStats {
+	return i.stats
+}
@@ -0,0 +1,111 @@
+package control
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestImporter() *Importer {
+	return &Importer{c: &Control{
+		subs:                  newSubscriptionRegistry(),
+		eventCreateExpiredMap: make(map[string]bool),
+		eventDeleteExpiredMap: make(map[string]bool),
+		eventCreateExpiredMu:  &sync.Mutex{},
+		eventDeleteExpiredMu:  &sync.Mutex{},
+	}}
+}
+
+func TestImportSubscriptionRequest(t *testing.T) {
+	var e2ap *E2ap
+	payload, err := e2ap.SetSubscriptionRequestPayload(make([]byte, 1024), 1001, 7, 2, []byte{0x08, 0x0f}, 2,
+		1, []int64{1}, []int64{0}, []ActionDefinition{{}}, []SubsequentAction{{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := e2ap.GetSubscriptionRequestMessage(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.RequestID != 1001 || req.RequestSequenceNumber != 7 || req.FuncID != 2 {
+		t.Errorf("decoded %+v", req)
+	}
+
+	i := newTestImporter()
+	if err := i.Import("gnb-1", time.Unix(100, 0), payload); err != nil {
+		t.Fatal(err)
+	}
+	subs := i.c.subs.list()
+	if len(subs) != 1 || subs[0].SubID != 1001 || subs[0].RequestSN != 7 || subs[0].FuncID != 2 || subs[0].State != subStateRequested {
+		t.Errorf("got subscriptions %+v", subs)
+	}
+	if stats := i.Stats(); stats.SubscriptionMessages != 1 || stats.Skipped != 0 {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+// E2 Setup Request adding the E2SM-KPM RAN function 2, advertising
+// RRU.PrbUsedDl as ID 1, DRB.UEThpDl as ID 2 and RRC.ConnMean without ID, and
+// the RAN function 3 of another service model
+const testE2setupRequest = "00010080aa000001000a0080a20002000840808f000002808810184f52414e2d4532534d2d4b504d000018312e332e36" +
+	"2e312e342e312e35333134382e312e322e322e3205004b504d204d6f6e69746f7200010109004532204e6f6465204d6561737572656d656e" +
+	"740101000241805252552e50726255736564446c00000041404452422e5545546870446c00000101605252432e436f6e6e4d65616e0101" +
+	"01010001000840080000030200010001"
+
+func TestImportE2setupRequest(t *testing.T) {
+	payload, err := hex.DecodeString(testE2setupRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e2ap *E2ap
+	ranFunctions, err := e2ap.GetRanFunctionDefinitions(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranFunctions) != 2 || ranFunctions[0].ID != 2 || ranFunctions[0].Revision != 1 || ranFunctions[1].ID != 3 {
+		t.Fatalf("decoded RAN functions %+v", ranFunctions)
+	}
+	var e2sm *E2sm
+	if _, err := e2sm.GetMeasurementMappings(ranFunctions[1].Definition); err == nil {
+		t.Error("decoded the RAN function of another service model")
+	}
+
+	i := newTestImporter()
+	i.c.catalog, _ = newMeasurementCatalog()
+	if err := i.Import("gnb-1", time.Unix(100, 0), payload); err != nil {
+		t.Fatal(err)
+	}
+	if mappings := i.c.catalog.getMappings("gnb-1"); fmt.Sprint(mappings) != "[{1 RRU.PrbUsedDl 0} {2 DRB.UEThpDl 0}]" {
+		t.Errorf("got mappings %v", mappings)
+	}
+	if stats := i.Stats(); stats.SetupMessages != 1 || stats.Failed != 0 {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+func TestPendingRequest(t *testing.T) {
+	mu := &sync.Mutex{}
+	expired := map[string]bool{"requested": false, "answered": true}
+	tests := []struct {
+		ranName string
+		want    bool
+	}{
+		{"requested", true},
+		{"answered", false},
+		{"not captured", false},
+	}
+	for _, test := range tests {
+		if got := pending(mu, expired, test.ranName); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.ranName, got, test.want)
+		}
+	}
+}
+
+func TestNewImporterRejectsUnknownSink(t *testing.T) {
+	if _, err := NewImporter(ImportOptions{Sinks: []string{"influxdb", "carrier-pigeon"}}); err == nil {
+		t.Error("unknown sink accepted")
+	}
+}
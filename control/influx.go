@@ -0,0 +1,533 @@
+package control
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/influxdata/influxdb1-client/models"
+	influxdb "github.com/influxdata/influxdb1-client/v2"
+)
+
+const (
+	defaultInfluxUsername = "admin"
+	defaultInfluxTimeout  = 10 //seconds
+	influxConnectBackoff  = time.Minute
+	spoolReplayInterval   = 5 * time.Second
+)
+
+// errors of InfluxDB rejecting the points themselves, writing them again fails
+// the same way
+var permanentInfluxErrors = []string{"partial write", "unable to parse", "field type conflict", "beyond retention policy", "invalid"}
+
+// influxClient is the part of the InfluxDB 1.x and 2.x clients used by the sink
+type influxClient interface {
+	Ping(timeout time.Duration) (time.Duration, string, error)
+	Write(bp influxdb.BatchPoints) error
+	setup() error //creates the database and retention policy, or the bucket
+}
+
+// influx1Client is an InfluxDB 1.x client that creates the database and the
+// retention policy
+type influx1Client struct {
+	influxdb.Client
+	database          string
+	retentionPolicy   string
+	retentionDuration string
+}
+
+type influxSink struct {
+	client          influxClient //influxdb client
+	database        string
+	retentionPolicy string
+	precision       string
+	timeout         time.Duration
+	mu              sync.Mutex //serialises the writes of the storage stage and the replay
+	spool           *spool     //points that failed to write, nil when spooling is disabled
+}
+
+// newInfluxSink connects to InfluxDB 1.x, or to InfluxDB 2.x when a token is
+// configured. The credentials and the token can be read from files.
+func newInfluxSink() (*influxSink, error) {
+	tlsConfig, err := getEnvTLSConfig("influx")
+	if err != nil {
+		return nil, err
+	}
+	token, err := getEnvSecret("influxToken")
+	if err != nil {
+		return nil, err
+	}
+	retention := os.Getenv("influxRetentionDuration")
+	retentionPeriod, err := parseRetention(retention)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &influxSink{
+		database:        os.Getenv("influxDatabase"),
+		retentionPolicy: os.Getenv("influxRetentionPolicy"),
+		precision:       os.Getenv("influxPrecision"),
+		timeout:         time.Duration(getEnvInt("influxTimeout", defaultInfluxTimeout)) * time.Second,
+	}
+
+	if token != "" {
+		if _, ok := influx2Precisions[s.precision]; !ok {
+			return nil, errors.New("invalid influxPrecision " + s.precision + " for InfluxDB 2.x")
+		}
+		org, bucket := os.Getenv("influxOrg"), os.Getenv("influxBucket")
+		if org == "" || bucket == "" {
+			return nil, errors.New("influxOrg and influxBucket are required with influxToken")
+		}
+		s.client = &influx2Client{
+			addr:            os.Getenv("influxAddr"),
+			token:           token,
+			org:             org,
+			bucket:          bucket,
+			retentionPeriod: retentionPeriod,
+			http:            &http.Client{Timeout: s.timeout, Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig}},
+		}
+	} else {
+		username, err := getEnvSecret("influxUsername")
+		if err != nil {
+			return nil, err
+		}
+		password, err := getEnvSecret("influxPassword")
+		if err != nil {
+			return nil, err
+		}
+		if username == "" {
+			username = defaultInfluxUsername
+		}
+		if retention != "" && s.retentionPolicy == "" {
+			return nil, errors.New("influxRetentionDuration requires influxRetentionPolicy")
+		}
+		client, err := influxdb.NewHTTPClient(influxdb.HTTPConfig{
+			Addr:      os.Getenv("influxAddr"),
+			Username:  username,
+			Password:  password,
+			Timeout:   s.timeout,
+			TLSConfig: tlsConfig,
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.client = &influx1Client{Client: client, database: s.database, retentionPolicy: s.retentionPolicy, retentionDuration: retention}
+	}
+
+	if dir := os.Getenv("influxSpoolDir"); dir != "" {
+		if s.spool, err = newSpool(dir); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// parseRetention parses an InfluxQL duration such as 30d, 0 for INF
+func parseRetention(str string) (time.Duration, error) {
+	if str == "" || strings.EqualFold(str, "INF") {
+		return 0, nil
+	}
+	unit := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}[str[len(str)-1]]
+	if unit == 0 {
+		return time.ParseDuration(str)
+	}
+	n, err := strconv.Atoi(str[:len(str)-1])
+	if err != nil || n <= 0 {
+		return 0, errors.New("invalid retention duration " + str)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// connect checks that InfluxDB is reachable and sets up the schema, retrying
+// with a growing backoff until it succeeds. Writes failing meanwhile are
+// spooled when spooling is enabled.
+func (s *influxSink) connect() {
+	s.connectBy(time.Time{})
+}
+
+// connectBy is connect giving up with the last error once the next attempt
+// would be past the deadline, the zero time retries forever
+func (s *influxSink) connectBy(deadline time.Time) error {
+	backoff := time.Second
+	for {
+		_, version, err := s.client.Ping(s.timeout)
+		if err == nil {
+			if err = s.client.setup(); err == nil {
+				xapp.Logger.Info("Connected to influxdb %s", version)
+				log.Printf("Connected to influxdb %s", version)
+				return nil
+			}
+		}
+		if !deadline.IsZero() && time.Now().Add(backoff).After(deadline) {
+			return errors.New("failed to connect to influxdb: " + err.Error())
+		}
+		xapp.Logger.Error("Failed to connect to influxdb, retrying in %v: %v", backoff, err)
+		log.Printf("Failed to connect to influxdb, retrying in %v: %v", backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > influxConnectBackoff {
+			backoff = influxConnectBackoff
+		}
+	}
+}
+
+func (c *influx1Client) setup() error {
+	if c.database == "" {
+		return nil
+	}
+	if err := c.query("CREATE DATABASE " + quoteIdent(c.database)); err != nil {
+		return err
+	}
+	if c.retentionPolicy == "" || c.retentionDuration == "" {
+		return nil
+	}
+	policy := " RETENTION POLICY " + quoteIdent(c.retentionPolicy) + " ON " + quoteIdent(c.database) + " DURATION " + c.retentionDuration
+	err := c.query("CREATE" + policy + " REPLICATION 1 DEFAULT")
+	if err != nil && strings.Contains(err.Error(), "already exists") {
+		err = c.query("ALTER" + policy + " DEFAULT")
+	}
+	return err
+}
+
+func (c *influx1Client) query(command string) error {
+	resp, err := c.Query(influxdb.NewQuery(command, "", ""))
+	if err != nil {
+		return err
+	}
+	return resp.Error()
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.Replace(strings.Replace(name, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
+
+func (s *influxSink) name() string {
+	return "influxdb"
+}
+
+func (s *influxSink) write(b *batch) error {
+	bp, err := s.batchPoints()
+	if err != nil {
+		return err
+	}
+
+	for _, rollup := range b.rollups {
+		pt, err := influxdb.NewPoint("kpi_rollup", rollupTags(rollup), rollupFields(rollup), rollup.Start)
+		if err != nil {
+			return err
+		}
+		bp.AddPoint(pt)
+	}
+
+	for _, event := range b.anomalies {
+		pt, err := influxdb.NewPoint("kpi_anomaly", anomalyTags(event), anomalyFields(event), event.Time)
+		if err != nil {
+			return err
+		}
+		bp.AddPoint(pt)
+	}
+
+	if b.ind == nil {
+		return s.flush(bp)
+	}
+
+	for _, labelInfo := range indicationLabels(b.ind) {
+		tags := labelTags(labelInfo)
+		hierarchyTags(tags, b.ind.RanName, b.ind.Topology)
+		pt, err := influxdb.NewPoint("metrics", tags, labelFields(labelInfo), indicationTime(b.ind))
+		if err != nil {
+			return err
+		}
+		bp.AddPoint(pt)
+	}
+
+	for _, sample := range b.ind.Samples {
+		pt, err := influxdb.NewPoint("kpi", sampleTags(sample), map[string]interface{}{"value": sample.Value}, sample.Time)
+		if err != nil {
+			return err
+		}
+		bp.AddPoint(pt)
+	}
+
+	return s.flush(bp)
+}
+
+func (s *influxSink) batchPoints() (influxdb.BatchPoints, error) {
+	return influxdb.NewBatchPoints(influxdb.BatchPointsConfig{
+		Database:        s.database,
+		RetentionPolicy: s.retentionPolicy,
+		Precision:       s.precision,
+	})
+}
+
+// flush writes the points, or spools them when the write fails or earlier
+// points are still waiting in the spool, so that the points stay in order
+func (s *influxSink) flush(bp influxdb.BatchPoints) error {
+	if len(bp.Points()) == 0 {
+		return nil
+	}
+	if s.spool == nil {
+		return s.client.Write(bp)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.spool.empty() {
+		err := s.client.Write(bp)
+		if err == nil {
+			return nil
+		}
+		if permanentInfluxError(err) {
+			if e := s.spool.deadLetter(pointLines(bp), err); e != nil {
+				xapp.Logger.Error("Failed to keep dead letter: %v", e)
+				log.Printf("Failed to keep dead letter: %v", e)
+			}
+			return err
+		}
+		xapp.Logger.Warn("Failed to write influxdb, spooling %d points: %v", len(bp.Points()), err)
+		log.Printf("Failed to write influxdb, spooling %d points: %v", len(bp.Points()), err)
+	}
+	return s.spool.append(pointLines(bp))
+}
+
+// replayLoop writes the spooled points in order once InfluxDB is reachable
+// again. Points rejected by InfluxDB are moved to the dead letters.
+func (s *influxSink) replayLoop() {
+	ticker := time.NewTicker(spoolReplayInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for s.replay() {
+		}
+	}
+}
+
+// replay writes the next spooled record, false when there is nothing to
+// replay or the write failed
+func (s *influxSink) replay() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, next, err := s.spool.next()
+	if err != nil {
+		xapp.Logger.Error("Failed to read spool: %v", err)
+		log.Printf("Failed to read spool: %v", err)
+		return false
+	}
+	if record == nil {
+		return false
+	}
+
+	err = s.writeLines(record)
+	if err != nil && !permanentInfluxError(err) {
+		return false
+	}
+	if err != nil {
+		xapp.Logger.Error("Spooled points rejected by influxdb: %v", err)
+		log.Printf("Spooled points rejected by influxdb: %v", err)
+		if e := s.spool.deadLetter(record, err); e != nil {
+			xapp.Logger.Error("Failed to keep dead letter: %v", e)
+			log.Printf("Failed to keep dead letter: %v", e)
+			return false
+		}
+	}
+	if err := s.spool.commit(next, err == nil); err != nil {
+		xapp.Logger.Error("Failed to save spool cursor: %v", err)
+		log.Printf("Failed to save spool cursor: %v", err)
+	}
+	return true
+}
+
+func (s *influxSink) writeLines(lines []byte) error {
+	points, err := models.ParsePoints(lines)
+	if err != nil {
+		return errors.New("unable to parse spooled points: " + err.Error())
+	}
+	bp, err := s.batchPoints()
+	if err != nil {
+		return err
+	}
+	for _, pt := range points {
+		bp.AddPoint(influxdb.NewPointFrom(pt))
+	}
+	return s.client.Write(bp)
+}
+
+// pointLines returns the points in line protocol with nanosecond timestamps
+func pointLines(bp influxdb.BatchPoints) []byte {
+	lines := make([]string, len(bp.Points()))
+	for i, pt := range bp.Points() {
+		lines[i] = pt.String()
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// permanentInfluxError tells the points rejected by InfluxDB from the
+// failures to reach it
+func permanentInfluxError(err error) bool {
+	switch err.(type) {
+	case *url.Error, net.Error:
+		return false
+	}
+	for _, message := range permanentInfluxErrors {
+		if strings.Contains(err.Error(), message) {
+			return true
+		}
+	}
+	return false
+}
+
+// indicationLabels collects the measurement labels of a Format1 MeasInfoList
+// or of the label matching conditions of a Format2 MeasCondUEidList.
+func indicationLabels(ind *indication) (labels []*MeasLabelInfo) {
+	switch msg := ind.Message.IndMsg.(type) {
+	case *IndicationMessageFormat1:
+		for i := range msg.MeasInfoList {
+			for j := range msg.MeasInfoList[i].LabelInfoList {
+				labels = append(labels, &msg.MeasInfoList[i].LabelInfoList[j])
+			}
+		}
+	case *IndicationMessageFormat2:
+		for i := range msg.MeasInfoUeidList {
+			for _, cond := range msg.MeasInfoUeidList[i].MatchingCondList {
+				if labelInfo := matchingCondLabel(cond); labelInfo != nil {
+					labels = append(labels, labelInfo)
+				}
+			}
+		}
+	}
+	return
+}
+
+func matchingCondLabel(cond MatchingCond) *MeasLabelInfo {
+	switch labelInfo := cond.Condition.(type) {
+	case *MeasLabelInfo:
+		return labelInfo
+	case MeasLabelInfo:
+		return &labelInfo
+	}
+	return nil
+}
+
+func labelTags(labelInfo *MeasLabelInfo) map[string]string {
+	tags := make(map[string]string)
+	if labelInfo.PLMNID != nil {
+		tags["PLMNID"] = plmnString(labelInfo.PLMNID)
+	}
+	if labelInfo.SliceID != nil {
+		tags["SliceID"] = sliceString(labelInfo.SliceID)
+	}
+	return tags
+}
+
+// hierarchyTags adds the position of the reporting node in the topology
+func hierarchyTags(tags map[string]string, ranName string, h nodeHierarchy) {
+	tags["RanName"] = ranName
+	if h.NodeID != "" {
+		tags["NodeID"] = h.NodeID
+	}
+	if h.DUID != "" {
+		tags["DUID"] = h.DUID
+	}
+	if h.CUUPID != "" {
+		tags["CUUPID"] = h.CUUPID
+	}
+}
+
+func sampleTags(sample kpiSample) map[string]string {
+	tags := map[string]string{"Measurement": sample.Measurement}
+	hierarchyTags(tags, sample.RanName, nodeHierarchy{NodeID: sample.NodeID, DUID: sample.DUID, CUUPID: sample.CUUPID})
+	for key, value := range map[string]string{"CellID": sample.CellID, "UeID": sample.UeID, "PLMNID": sample.PLMNID, "SliceID": sample.SliceID, "Unit": sample.Unit} {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+	if sample.FiveQI > 0 {
+		tags["FiveQI"] = strconv.FormatInt(sample.FiveQI, 10)
+	}
+	if sample.QCI > 0 {
+		tags["QCI"] = strconv.FormatInt(sample.QCI, 10)
+	}
+	return tags
+}
+
+func rollupTags(rollup Rollup) map[string]string {
+	tags := sampleTags(kpiSample{
+		RanName:     rollup.RanName,
+		CellID:      rollup.CellID,
+		PLMNID:      rollup.PLMNID,
+		SliceID:     rollup.SliceID,
+		FiveQI:      rollup.FiveQI,
+		QCI:         rollup.QCI,
+		NodeID:      rollup.NodeID,
+		DUID:        rollup.DUID,
+		CUUPID:      rollup.CUUPID,
+		Measurement: rollup.Measurement,
+	})
+	tags["Window"] = rollup.Window
+	return tags
+}
+
+func rollupFields(rollup Rollup) map[string]interface{} {
+	return map[string]interface{}{
+		"count": rollup.Count,
+		"min":   rollup.Min,
+		"max":   rollup.Max,
+		"mean":  rollup.Mean,
+		"p95":   rollup.P95,
+		"sum":   rollup.Sum,
+	}
+}
+
+func anomalyTags(event AnomalyEvent) map[string]string {
+	tags := sampleTags(kpiSample{
+		RanName:     event.RanName,
+		CellID:      event.CellID,
+		PLMNID:      event.PLMNID,
+		SliceID:     event.SliceID,
+		FiveQI:      event.FiveQI,
+		QCI:         event.QCI,
+		NodeID:      event.NodeID,
+		DUID:        event.DUID,
+		CUUPID:      event.CUUPID,
+		Measurement: event.Measurement,
+	})
+	tags["Method"] = event.Method
+	return tags
+}
+
+func anomalyFields(event AnomalyEvent) map[string]interface{} {
+	return map[string]interface{}{
+		"value":    event.Value,
+		"expected": event.Expected,
+		"stddev":   event.StdDev,
+		"score":    event.Score,
+	}
+}
+
+func labelFields(labelInfo *MeasLabelInfo) map[string]interface{} {
+	fields := make(map[string]interface{})
+	fields["FiveQI"] = labelInfo.FiveQI
+	fields["QCI"] = labelInfo.QCI
+	fields["QCImax"] = labelInfo.QCImax
+	fields["QCImin"] = labelInfo.QCImin
+	fields["ARPmax"] = labelInfo.ARPmax
+	fields["ARPmin"] = labelInfo.ARPmin
+	fields["BitrateRange"] = labelInfo.BitrateRange
+	fields["LayerMU_MIMO"] = labelInfo.LayerMU_MIMO
+	fields["SUM"] = labelInfo.SUM
+	fields["DistBinX"] = labelInfo.DistBinX
+	fields["DistBinY"] = labelInfo.DistBinY
+	fields["DistBinZ"] = labelInfo.DistBinZ
+	fields["PreLabelOverride"] = labelInfo.PreLabelOverride
+	fields["StartEndInd"] = labelInfo.StartEndInd
+	return fields
+}
@@ -0,0 +1,162 @@
+package control
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	influxdb "github.com/influxdata/influxdb1-client/v2"
+)
+
+// InfluxDB 2.x write precisions by the 1.x precision of the batch points
+var influx2Precisions = map[string]string{"": "ns", "n": "ns", "ns": "ns", "u": "us", "us": "us", "ms": "ms", "s": "s"}
+
+// influx2Client writes to the InfluxDB 2.x API, authenticated by a token and
+// organised in buckets of an organisation
+type influx2Client struct {
+	addr            string
+	token           string
+	org             string
+	bucket          string
+	retentionPeriod time.Duration //retention of a created bucket, 0 for infinite
+	http            *http.Client
+}
+
+func (c *influx2Client) request(method string, path string, query url.Values, body []byte) (*http.Request, error) {
+	u := strings.TrimSuffix(c.addr, "/") + path
+	if query != nil {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Token "+c.token)
+	return req, nil
+}
+
+// do sends a request and decodes the JSON response into v, the error of a
+// failed request carries the message of the server
+func (c *influx2Client) do(req *http.Request, v interface{}) (int, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(body, &e) == nil && e.Message != "" {
+			return resp.StatusCode, fmt.Errorf("%s: %s", e.Code, e.Message)
+		}
+		return resp.StatusCode, errors.New(resp.Status)
+	}
+	if v == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *influx2Client) Ping(timeout time.Duration) (time.Duration, string, error) {
+	start := time.Now()
+	req, err := c.request(http.MethodGet, "/ping", nil, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	client := *c.http
+	client.Timeout = timeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return 0, "", errors.New("ping returned " + resp.Status)
+	}
+	return time.Since(start), resp.Header.Get("X-Influxdb-Version"), nil
+}
+
+func (c *influx2Client) Write(bp influxdb.BatchPoints) error {
+	precision, ok := influx2Precisions[bp.Precision()]
+	if !ok {
+		return errors.New("invalid precision " + bp.Precision() + " for InfluxDB 2.x")
+	}
+	var body bytes.Buffer
+	for _, pt := range bp.Points() {
+		body.WriteString(pt.PrecisionString(bp.Precision()))
+		body.WriteByte('\n')
+	}
+
+	req, err := c.request(http.MethodPost, "/api/v2/write", url.Values{"org": {c.org}, "bucket": {c.bucket}, "precision": {precision}}, body.Bytes())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	_, err = c.do(req, nil)
+	return err
+}
+
+// setup creates the bucket when it does not exist
+func (c *influx2Client) setup() error {
+	req, err := c.request(http.MethodGet, "/api/v2/buckets", url.Values{"org": {c.org}, "name": {c.bucket}}, nil)
+	if err != nil {
+		return err
+	}
+	var buckets struct {
+		Buckets []struct {
+			Name string `json:"name"`
+		} `json:"buckets"`
+	}
+	if _, err := c.do(req, &buckets); err != nil {
+		return err
+	}
+	if len(buckets.Buckets) > 0 {
+		return nil
+	}
+
+	req, err = c.request(http.MethodGet, "/api/v2/orgs", url.Values{"org": {c.org}}, nil)
+	if err != nil {
+		return err
+	}
+	var orgs struct {
+		Orgs []struct {
+			ID string `json:"id"`
+		} `json:"orgs"`
+	}
+	if _, err := c.do(req, &orgs); err != nil {
+		return err
+	}
+	if len(orgs.Orgs) == 0 {
+		return errors.New("unknown organisation " + c.org)
+	}
+
+	bucket := map[string]interface{}{"orgID": orgs.Orgs[0].ID, "name": c.bucket, "retentionRules": []interface{}{}}
+	if c.retentionPeriod > 0 {
+		bucket["retentionRules"] = []map[string]interface{}{{"type": "expire", "everySeconds": int64(c.retentionPeriod.Seconds())}}
+	}
+	body, err := json.Marshal(bucket)
+	if err != nil {
+		return err
+	}
+	req, err = c.request(http.MethodPost, "/api/v2/buckets", nil, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if status, err := c.do(req, nil); err != nil && status != http.StatusUnprocessableEntity {
+		return err //422 when the bucket was created meanwhile
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package control
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	kafkaFormatJSON = "json"
+	kafkaFormatAvro = "avro"
+)
+
+const (
+	defaultKafkaMeasurementTopic = "kpimon-kpi"
+	defaultKafkaAttempts         = 5
+	defaultKafkaBatchTimeout     = 10 //milliseconds
+	defaultKafkaWriteTimeout     = 10 //seconds
+)
+
+// KPIRecord is the JSON record of one measured value written to Kafka
+type KPIRecord struct {
+	RanName string `json:"ranName"`
+	StreamRecord
+}
+
+// kafkaRecord is a record to produce, keyed for partitioning
+type kafkaRecord struct {
+	Topic string
+	Key   []byte
+	Value []byte
+	Time  time.Time
+}
+
+// producer delivers records to the Kafka brokers, returning once they are
+// acknowledged
+type producer interface {
+	produce(records []kafkaRecord) error
+}
+
+// kafkaGoProducer produces through a segmentio kafka-go writer, which hashes
+// the record keys to partitions and retries failed deliveries
+type kafkaGoProducer struct {
+	writer  *kafka.Writer
+	timeout time.Duration
+}
+
+func newKafkaGoProducer(brokers []string) (*kafkaGoProducer, error) {
+	var acks kafka.RequiredAcks
+	switch os.Getenv("kafkaAcks") {
+	case "", "all":
+		acks = kafka.RequireAll
+	case "one":
+		acks = kafka.RequireOne
+	case "none":
+		acks = kafka.RequireNone
+	default:
+		return nil, errors.New("unknown kafkaAcks " + os.Getenv("kafkaAcks"))
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: acks,
+		MaxAttempts:  getEnvInt("kafkaAttempts", defaultKafkaAttempts),
+		BatchTimeout: time.Duration(getEnvInt("kafkaBatchTimeout", defaultKafkaBatchTimeout)) * time.Millisecond,
+	}
+	tlsConfig, err := getEnvTLSConfig("kafka")
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil && os.Getenv("kafkaTLS") == "true" {
+		tlsConfig = &tls.Config{} //verified against the system roots
+	}
+	if tlsConfig != nil {
+		writer.Transport = &kafka.Transport{TLS: tlsConfig}
+	}
+	return &kafkaGoProducer{
+		writer:  writer,
+		timeout: time.Duration(getEnvInt("kafkaWriteTimeout", defaultKafkaWriteTimeout)) * time.Second,
+	}, nil
+}
+
+func (p *kafkaGoProducer) produce(records []kafkaRecord) error {
+	msgs := make([]kafka.Message, len(records))
+	for i, r := range records {
+		msgs[i] = kafka.Message{Topic: r.Topic, Key: r.Key, Value: r.Value, Time: r.Time}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	return p.writer.WriteMessages(ctx, msgs...)
+}
+
+// kafkaSink writes every measured value to the measurement topic and every
+// whole indication to the indication topic. Measurements are keyed by node and
+// cell, or by node only, indications by node, so that the records of a cell
+// or node stay in order on one partition.
+type kafkaSink struct {
+	producer          producer
+	format            string
+	measurementTopic  string //empty when measurements are not written
+	indicationTopic   string //empty when indications are not written
+	partitionByNode   bool
+	measurementSchema int //Confluent schema registry IDs prefixed to the Avro records, 0 for none
+	indicationSchema  int
+}
+
+// newKafkaSink returns nil when no brokers are configured
+func newKafkaSink() (*kafkaSink, error) {
+	brokers := os.Getenv("kafkaBrokers")
+	if brokers == "" {
+		return nil, nil
+	}
+	p, err := newKafkaGoProducer(strings.Split(brokers, ","))
+	if err != nil {
+		return nil, err
+	}
+	return newKafkaSinkWithProducer(p)
+}
+
+func newKafkaSinkWithProducer(p producer) (*kafkaSink, error) {
+	s := &kafkaSink{
+		producer:          p,
+		format:            os.Getenv("kafkaFormat"),
+		measurementTopic:  os.Getenv("kafkaMeasurementTopic"),
+		indicationTopic:   os.Getenv("kafkaIndicationTopic"),
+		measurementSchema: getEnvInt("kafkaMeasurementSchemaId", 0),
+		indicationSchema:  getEnvInt("kafkaIndicationSchemaId", 0),
+	}
+	if s.format == "" {
+		s.format = kafkaFormatJSON
+	}
+	if s.format != kafkaFormatJSON && s.format != kafkaFormatAvro {
+		return nil, errors.New("unknown kafkaFormat " + s.format)
+	}
+	if s.measurementTopic == "" && s.indicationTopic == "" {
+		s.measurementTopic = defaultKafkaMeasurementTopic
+	}
+	switch os.Getenv("kafkaPartitionBy") {
+	case "", "cell":
+	case "node":
+		s.partitionByNode = true
+	default:
+		return nil, errors.New("unknown kafkaPartitionBy " + os.Getenv("kafkaPartitionBy"))
+	}
+	return s, nil
+}
+
+func (s *kafkaSink) name() string {
+	return "kafka"
+}
+
+func (s *kafkaSink) write(b *batch) error {
+	if b.ind == nil {
+		return nil
+	}
+
+	var records []kafkaRecord
+	if s.measurementTopic != "" {
+		for _, sample := range b.ind.Samples {
+			value, err := s.encodeSample(sample)
+			if err != nil {
+				return err
+			}
+			key := sample.RanName
+			if !s.partitionByNode {
+				key += "/" + sample.CellID
+			}
+			records = append(records, kafkaRecord{Topic: s.measurementTopic, Key: []byte(key), Value: value, Time: sample.Time})
+		}
+	}
+	if s.indicationTopic != "" {
+		value, err := s.encodeIndication(b.ind)
+		if err != nil {
+			return err
+		}
+		records = append(records, kafkaRecord{Topic: s.indicationTopic, Key: []byte(b.ind.RanName), Value: value, Time: indicationTime(b.ind)})
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return s.producer.produce(records)
+}
+
+func (s *kafkaSink) encodeSample(sample kpiSample) ([]byte, error) {
+	if s.format == kafkaFormatAvro {
+		return avroSample(avroHeader(s.measurementSchema), sample), nil
+	}
+	return json.Marshal(KPIRecord{
+		RanName: sample.RanName,
+		StreamRecord: StreamRecord{
+			Measurement: sample.Measurement,
+			Unit:        sample.Unit,
+			Value:       sample.Value,
+			Time:        sample.Time,
+			CellID:      sample.CellID,
+			UeID:        sample.UeID,
+			PLMNID:      sample.PLMNID,
+			SliceID:     sample.SliceID,
+			FiveQI:      sample.FiveQI,
+			QCI:         sample.QCI,
+			NodeID:      sample.NodeID,
+			DUID:        sample.DUID,
+			CUUPID:      sample.CUUPID,
+		},
+	})
+}
+
+func (s *kafkaSink) encodeIndication(ind *indication) ([]byte, error) {
+	if s.format == kafkaFormatAvro {
+		return avroIndication(avroHeader(s.indicationSchema), ind), nil
+	}
+	return json.Marshal(newStreamEvent(ind))
+}
+
+// avroHeader returns the Confluent wire format header, a zero magic byte and
+// the schema ID, when a schema ID is configured
+func avroHeader(schemaID int) []byte {
+	if schemaID == 0 {
+		return nil
+	}
+	buf := make([]byte, 5)
+	binary.BigEndian.PutUint32(buf[1:], uint32(schemaID))
+	return buf
+}
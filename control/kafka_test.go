@@ -0,0 +1,143 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeProducer records the produced records, failing with err when set
+type fakeProducer struct {
+	records []kafkaRecord
+	err     error
+}
+
+func (p *fakeProducer) produce(records []kafkaRecord) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.records = append(p.records, records...)
+	return nil
+}
+
+func newTestKafkaSink(t *testing.T, env map[string]string) (*kafkaSink, *fakeProducer) {
+	p := &fakeProducer{}
+	return newTestSink(t, env, func() (interface{}, error) { return newKafkaSinkWithProducer(p) }).(*kafkaSink), p
+}
+
+func TestKafkaSinkJSON(t *testing.T) {
+	s, p := newTestKafkaSink(t, map[string]string{"kafkaIndicationTopic": "kpimon-indications", "kafkaMeasurementTopic": "kpimon-kpi"})
+	ind := testIndication()
+	if err := s.write(&batch{ind: ind}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.write(&batch{rollups: []Rollup{{}}}); err != nil || len(p.records) != 3 {
+		t.Fatalf("got %d records, %v", len(p.records), err)
+	}
+
+	for i, key := range []string{"gnb-1/cell-1", "gnb-1/cell-2"} {
+		r := p.records[i]
+		if r.Topic != "kpimon-kpi" || string(r.Key) != key || !r.Time.Equal(ind.Received) {
+			t.Errorf("got record %s/%s at %v", r.Topic, r.Key, r.Time)
+		}
+	}
+	var record KPIRecord
+	if err := json.Unmarshal(p.records[1].Value, &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.RanName != "gnb-1" || record.Measurement != "DRB.UEThpDl" || record.Value != 12.5 || record.SliceID != "1-010203" || record.FiveQI != 9 {
+		t.Errorf("got record %+v", record)
+	}
+
+	r := p.records[2]
+	if r.Topic != "kpimon-indications" || string(r.Key) != "gnb-1" {
+		t.Errorf("got indication record %s/%s", r.Topic, r.Key)
+	}
+	var event StreamEvent
+	if err := json.Unmarshal(r.Value, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.RanName != "gnb-1" || event.RequestID != 1001 || event.IndSN != 7 || len(event.Records) != 2 {
+		t.Errorf("got indication %+v", event)
+	}
+}
+
+func TestKafkaSinkAvro(t *testing.T) {
+	s, p := newTestKafkaSink(t, map[string]string{"kafkaFormat": kafkaFormatAvro, "kafkaPartitionBy": "node", "kafkaMeasurementSchemaId": "258"})
+	ind := testIndication()
+	if err := s.write(&batch{ind: ind}); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.records) != 2 {
+		t.Fatalf("got %d records", len(p.records))
+	}
+	for i, r := range p.records {
+		if r.Topic != defaultKafkaMeasurementTopic || string(r.Key) != "gnb-1" {
+			t.Errorf("got record %s/%s", r.Topic, r.Key)
+		}
+		want := append([]byte{0, 0, 0, 1, 2}, avroSample(nil, ind.Samples[i])...)
+		if string(r.Value) != string(want) {
+			t.Errorf("got record %x, want %x", r.Value, want)
+		}
+	}
+}
+
+func TestKafkaSinkErrors(t *testing.T) {
+	s, p := newTestKafkaSink(t, map[string]string{})
+	p.err = errors.New("leader not available")
+	if err := s.write(&batch{ind: testIndication()}); err != p.err {
+		t.Errorf("got %v, want the producer error", err)
+	}
+
+	for _, env := range []map[string]string{
+		{"kafkaFormat": "protobuf"},
+		{"kafkaPartitionBy": "slice"},
+	} {
+		restore := setEnv(env)
+		if _, err := newKafkaSinkWithProducer(&fakeProducer{}); err == nil {
+			t.Errorf("%v accepted", env)
+		}
+		restore()
+	}
+}
+
+func TestKafkaProducerTLS(t *testing.T) {
+	tests := []struct {
+		env      map[string]string
+		tls      bool
+		insecure bool
+		fail     bool
+	}{
+		{env: map[string]string{}},
+		{env: map[string]string{"kafkaTLS": "true"}, tls: true},
+		{env: map[string]string{"kafkaInsecureSkipVerify": "true"}, tls: true, insecure: true},
+		{env: map[string]string{"kafkaCaFile": "/nonexistent/ca.pem"}, fail: true},
+		{env: map[string]string{"kafkaAcks": "some"}, fail: true},
+	}
+	for _, test := range tests {
+		restore := setEnv(test.env)
+		p, err := newKafkaGoProducer([]string{"localhost:9092"})
+		restore()
+		if test.fail {
+			if err == nil {
+				t.Errorf("%v accepted", test.env)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: %v", test.env, err)
+		}
+		transport, _ := p.writer.Transport.(*kafka.Transport)
+		if !test.tls {
+			if transport != nil {
+				t.Errorf("%v: TLS configured", test.env)
+			}
+			continue
+		}
+		if transport == nil || transport.TLS == nil || transport.TLS.InsecureSkipVerify != test.insecure {
+			t.Errorf("%v: got transport %+v", test.env, transport)
+		}
+	}
+}
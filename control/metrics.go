@@ -0,0 +1,350 @@
+package control
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultMetricsMaxSeries = 10000
+	defaultMetricsSeriesTTL = 300 //seconds without update before a KPI series is removed
+)
+
+const (
+	decodeStageE2ap       = "e2ap"
+	decodeStageE2smHeader = "e2sm_header"
+	decodeStageE2smMsg    = "e2sm_message"
+)
+
+var kpiLabelNames = []string{"node", "cell", "plmn", "slice", "fiveqi", "measurement"}
+
+// kpiMetrics exposes the decoded KPM measurements and the xApp internals to
+// Prometheus. The metrics are registered with the default registry, which is
+// what the xapp-frame metrics endpoint serves.
+type kpiMetrics struct {
+	kpiValue          *prometheus.GaugeVec
+	kpiSeriesDropped  prometheus.Counter
+	messages          *prometheus.CounterVec
+	decodeErrors      *prometheus.CounterVec
+	sinkWriteSeconds  *prometheus.HistogramVec
+	subscriptions     *prometheus.GaugeVec
+	indicationsLost   *prometheus.CounterVec
+	indicationsDupped *prometheus.CounterVec
+	indicationRestart *prometheus.CounterVec
+	clockSkewSeconds  *prometheus.GaugeVec
+	clockSkewExceeded *prometheus.CounterVec
+
+	mu        sync.Mutex
+	maxSeries int
+	ttl       time.Duration
+	lastSeen  map[string]kpiSeriesEntry //KPI series by joined label values
+}
+
+type kpiSeriesEntry struct {
+	labels  []string
+	updated time.Time
+}
+
+func newKpiMetrics(pipe *pipeline) *kpiMetrics {
+	m := &kpiMetrics{
+		kpiValue: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "kpimon",
+			Name:      "kpi_value",
+			Help:      "Latest value of a KPM measurement",
+		}, kpiLabelNames),
+		kpiSeriesDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "kpimon",
+			Name:      "kpi_series_dropped_total",
+			Help:      "KPM samples not exposed because the series limit was reached",
+		}),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "kpimon",
+			Name:      "rmr_messages_total",
+			Help:      "RMR messages received by message type",
+		}, []string{"type"}),
+		decodeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "kpimon",
+			Name:      "decode_errors_total",
+			Help:      "RIC Indication decoding failures by decoding stage",
+		}, []string{"stage"}),
+		sinkWriteSeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "kpimon",
+			Name:      "sink_write_seconds",
+			Help:      "Latency of writes to the storage sinks",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+		}, []string{"sink", "result"}),
+		subscriptions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "kpimon",
+			Name:      "subscription_state",
+			Help:      "Current RIC subscription state of an E2 node, 1 for the current state",
+		}, []string{"node", "state"}),
+		indicationsLost: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "kpimon",
+			Name:      "indications_lost_total",
+			Help:      "RIC Indications missing in the RICindicationSN sequence",
+		}, []string{"node"}),
+		indicationsDupped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "kpimon",
+			Name:      "indications_duplicate_total",
+			Help:      "Duplicate RIC Indications dropped",
+		}, []string{"node"}),
+		indicationRestart: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "kpimon",
+			Name:      "indication_sn_restarts_total",
+			Help:      "RICindicationSN sequences restarted by an E2 node without a new subscription",
+		}, []string{"node"}),
+		clockSkewSeconds: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "kpimon",
+			Name:      "clock_skew_seconds",
+			Help:      "Time between the end of the collection period reported by an E2 node and the reception of the indication",
+		}, []string{"node"}),
+		clockSkewExceeded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "kpimon",
+			Name:      "clock_skew_exceeded_total",
+			Help:      "RIC Indications with a clock skew beyond the threshold",
+		}, []string{"node"}),
+		maxSeries: getEnvInt("metricsMaxSeries", defaultMetricsMaxSeries),
+		ttl:       time.Duration(getEnvInt("metricsSeriesTTL", defaultMetricsSeriesTTL)) * time.Second,
+		lastSeen:  make(map[string]kpiSeriesEntry),
+	}
+
+	collectors := []prometheus.Collector{
+		m.kpiValue, m.kpiSeriesDropped, m.messages, m.decodeErrors, m.sinkWriteSeconds,
+		m.subscriptions, m.indicationsLost, m.indicationsDupped, m.indicationRestart, m.clockSkewSeconds, m.clockSkewExceeded,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "kpimon",
+			Name:      "intake_queue_depth",
+			Help:      "Messages waiting in the intake queue",
+		}, func() float64 { return float64(len(pipe.intake)) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "kpimon",
+			Name:      "storage_queue_depth",
+			Help:      "Batches waiting in the storage queue",
+		}, func() float64 { return float64(len(pipe.storage)) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "kpimon",
+			Name:      "intake_dropped_total",
+			Help:      "Messages dropped because the intake queue was full",
+		}, func() float64 { return float64(pipe.stats().IntakeDropped) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "kpimon",
+			Name:      "worker_dropped_total",
+			Help:      "RIC Indications dropped because the queue of their decode worker was full",
+		}, func() float64 { return float64(pipe.stats().WorkerDropped) }),
+	}
+	for i, w := range pipe.workers {
+		queue := w
+		collectors = append(collectors, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   "kpimon",
+			Name:        "worker_queue_depth",
+			Help:        "Messages waiting in a decode worker queue",
+			ConstLabels: prometheus.Labels{"worker": strconv.Itoa(i)},
+		}, func() float64 { return float64(len(queue)) }))
+	}
+	for _, q := range pipe.sinks {
+		q := q
+		labels := prometheus.Labels{"sink": q.sink.name()}
+		collectors = append(collectors, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   "kpimon",
+			Name:        "sink_queue_depth",
+			Help:        "Batches waiting in the queue of a sink",
+			ConstLabels: labels,
+		}, func() float64 { return float64(len(q.queue)) }), prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "kpimon",
+			Name:        "sink_dropped_total",
+			Help:        "Batches dropped because the queue of a sink was full",
+			ConstLabels: labels,
+		}, func() float64 { return float64(atomic.LoadUint64(&q.dropped)) }))
+	}
+
+	for _, collector := range collectors {
+		if err := prometheus.Register(collector); err != nil {
+			xapp.Logger.Error("Failed to register metric: %v", err)
+			log.Printf("Failed to register metric: %v", err)
+		}
+	}
+	return m
+}
+
+// registerRollup exposes the samples dropped from the rollups because they
+// arrived after their window was closed
+func (m *kpiMetrics) registerRollup(s *rollupStore) {
+	collector := prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: "kpimon",
+		Name:      "rollup_late_samples_total",
+		Help:      "KPM samples dropped from the rollups because their window was closed",
+	}, func() float64 { return float64(s.lateSamples()) })
+	if err := prometheus.Register(collector); err != nil {
+		xapp.Logger.Error("Failed to register metric: %v", err)
+		log.Printf("Failed to register metric: %v", err)
+	}
+}
+
+// registerAnomaly exposes the number of series of the anomaly detector and the
+// samples it skipped because of the series limit
+func (m *kpiMetrics) registerAnomaly(d *anomalyDetector) {
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "kpimon",
+			Name:      "anomaly_series",
+			Help:      "Series scored by the anomaly detector",
+		}, func() float64 {
+			series, _ := d.stats()
+			return float64(series)
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "kpimon",
+			Name:      "anomaly_skipped_total",
+			Help:      "KPM samples not scored because the anomaly series limit was reached",
+		}, func() float64 {
+			_, skipped := d.stats()
+			return float64(skipped)
+		}),
+	}
+	for _, collector := range collectors {
+		if err := prometheus.Register(collector); err != nil {
+			xapp.Logger.Error("Failed to register metric: %v", err)
+			log.Printf("Failed to register metric: %v", err)
+		}
+	}
+}
+
+// registerSpool exposes the size and the replay progress of the spool of a sink
+func (m *kpiMetrics) registerSpool(sinkName string, s *spool) {
+	labels := prometheus.Labels{"sink": sinkName}
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   "kpimon",
+			Name:        "spool_bytes",
+			Help:        "Bytes in the spool segments",
+			ConstLabels: labels,
+		}, func() float64 { return float64(s.stats().Bytes) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   "kpimon",
+			Name:        "spool_pending_bytes",
+			Help:        "Spooled bytes not replayed yet",
+			ConstLabels: labels,
+		}, func() float64 { return float64(s.stats().PendingBytes) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "kpimon",
+			Name:        "spool_replayed_total",
+			Help:        "Spooled records replayed",
+			ConstLabels: labels,
+		}, func() float64 { return float64(s.stats().Replayed) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "kpimon",
+			Name:        "spool_dead_letters_total",
+			Help:        "Records permanently rejected by the sink",
+			ConstLabels: labels,
+		}, func() float64 { return float64(s.stats().DeadLetters) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "kpimon",
+			Name:        "spool_dropped_segments_total",
+			Help:        "Spool segments removed by the size and age limits before being replayed",
+			ConstLabels: labels,
+		}, func() float64 { return float64(s.stats().DroppedSegments) }),
+	}
+	for _, collector := range collectors {
+		if err := prometheus.Register(collector); err != nil {
+			xapp.Logger.Error("Failed to register metric: %v", err)
+			log.Printf("Failed to register metric: %v", err)
+		}
+	}
+}
+
+// observeSamples sets the KPI gauges. Per-UE samples are not exposed to keep
+// the number of series bounded.
+func (m *kpiMetrics) observeSamples(samples []kpiSample) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range samples {
+		if s.UeID != "" {
+			continue
+		}
+		fiveQI := ""
+		if s.FiveQI > 0 {
+			fiveQI = strconv.FormatInt(s.FiveQI, 10)
+		}
+		labels := []string{s.RanName, s.CellID, s.PLMNID, s.SliceID, fiveQI, s.Measurement}
+		key := joinKey(labels)
+
+		if _, ok := m.lastSeen[key]; !ok && len(m.lastSeen) >= m.maxSeries {
+			m.kpiSeriesDropped.Inc()
+			continue
+		}
+		m.lastSeen[key] = kpiSeriesEntry{labels: labels, updated: time.Now()}
+		m.kpiValue.WithLabelValues(labels...).Set(s.Value)
+	}
+}
+
+// expireLoop removes KPI series that have not been updated within the TTL
+func (m *kpiMetrics) expireLoop() {
+	ticker := time.NewTicker(m.ttl / 2)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.mu.Lock()
+		for key, entry := range m.lastSeen {
+			if time.Since(entry.updated) > m.ttl {
+				m.kpiValue.DeleteLabelValues(entry.labels...)
+				delete(m.lastSeen, key)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+func (m *kpiMetrics) message(mtype int) {
+	m.messages.WithLabelValues(strconv.Itoa(mtype)).Inc()
+}
+
+func (m *kpiMetrics) decodeError(stage string) {
+	m.decodeErrors.WithLabelValues(stage).Inc()
+}
+
+func (m *kpiMetrics) sinkWrite(sinkName string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.sinkWriteSeconds.WithLabelValues(sinkName, result).Observe(time.Since(start).Seconds())
+}
+
+func (m *kpiMetrics) subscriptionState(ranName string, oldState string, newState string) {
+	if oldState != "" {
+		m.subscriptions.DeleteLabelValues(ranName, oldState)
+	}
+	m.subscriptions.WithLabelValues(ranName, newState).Set(1)
+}
+
+func (m *kpiMetrics) indicationSN(ranName string, result int, lost int) {
+	if result == indicationDuplicate {
+		m.indicationsDupped.WithLabelValues(ranName).Inc()
+		return
+	}
+	if result == indicationRestarted {
+		m.indicationRestart.WithLabelValues(ranName).Inc()
+	}
+	if lost > 0 {
+		m.indicationsLost.WithLabelValues(ranName).Add(float64(lost))
+	}
+}
+
+func (m *kpiMetrics) clockSkew(ranName string, skew time.Duration, exceeded bool) {
+	m.clockSkewSeconds.WithLabelValues(ranName).Set(skew.Seconds())
+	if exceeded {
+		m.clockSkewExceeded.WithLabelValues(ranName).Inc()
+	}
+}
+
+func joinKey(parts []string) string {
+	return strings.Join(parts, "\x00")
+}
@@ -0,0 +1,201 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	defaultMqttTopicPrefix = "kpimon"
+	defaultMqttClientID    = "kpimon"
+	defaultMqttQoS         = 0
+	defaultMqttTimeout     = 10 //seconds
+)
+
+// MqttSummary is the JSON payload published for a cell or slice KPI
+type MqttSummary struct {
+	Value  float64   `json:"value"`
+	Unit   string    `json:"unit,omitempty"`
+	Time   time.Time `json:"time"`
+	NodeID string    `json:"nodeId,omitempty"`
+}
+
+// MqttRollupSummary is the JSON payload published for a closed rollup window
+type MqttRollupSummary struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Count int       `json:"count"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Mean  float64   `json:"mean"`
+	P95   float64   `json:"p95"`
+}
+
+// mqttPublisher publishes a message and waits for its delivery according to
+// the QoS
+type mqttPublisher interface {
+	publish(topic string, qos byte, retained bool, payload []byte) error
+}
+
+type pahoPublisher struct {
+	client  mqtt.Client
+	timeout time.Duration
+}
+
+func newPahoPublisher(broker string) (*pahoPublisher, error) {
+	clientID := os.Getenv("mqttClientId")
+	if clientID == "" {
+		clientID = defaultMqttClientID
+	}
+	password, err := getEnvSecret("mqttPassword")
+	if err != nil {
+		return nil, err
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetUsername(os.Getenv("mqttUsername")).
+		SetPassword(password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true)
+
+	tlsConfig, err := getEnvTLSConfig("mqtt")
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	p := &pahoPublisher{
+		client:  mqtt.NewClient(opts),
+		timeout: time.Duration(getEnvInt("mqttTimeout", defaultMqttTimeout)) * time.Second,
+	}
+	p.client.Connect() //retried in the background until the broker is reachable
+	return p, nil
+}
+
+func (p *pahoPublisher) publish(topic string, qos byte, retained bool, payload []byte) error {
+	if !p.client.IsConnectionOpen() {
+		return errors.New("not connected to the MQTT broker")
+	}
+	token := p.client.Publish(topic, qos, retained, payload)
+	if !token.WaitTimeout(p.timeout) {
+		return errors.New("timeout publishing to " + topic)
+	}
+	return token.Error()
+}
+
+// mqttSink publishes the latest value of every cell and slice KPI, and the
+// closed rollup windows, to a topic hierarchy
+//
+//	<prefix>/<ranName>/<cellID>/<measurement>
+//	<prefix>/<ranName>/<cellID>/slices/<sliceID>/<measurement>
+//	<prefix>/<ranName>/<cellID>/<measurement>/rollup/<window>
+type mqttSink struct {
+	publisher mqttPublisher
+	prefix    string
+	qos       byte
+	retained  bool
+}
+
+// newMqttSink returns nil when no broker is configured
+func newMqttSink() (*mqttSink, error) {
+	broker := os.Getenv("mqttBroker")
+	if broker == "" {
+		return nil, nil
+	}
+	p, err := newPahoPublisher(broker)
+	if err != nil {
+		return nil, err
+	}
+	return newMqttSinkWithPublisher(p)
+}
+
+func newMqttSinkWithPublisher(p mqttPublisher) (*mqttSink, error) {
+	s := &mqttSink{
+		publisher: p,
+		prefix:    os.Getenv("mqttTopicPrefix"),
+		qos:       defaultMqttQoS,
+		retained:  os.Getenv("mqttRetained") != "false",
+	}
+	if s.prefix == "" {
+		s.prefix = defaultMqttTopicPrefix
+	}
+	if str := os.Getenv("mqttQoS"); str != "" {
+		qos, err := strconv.Atoi(str)
+		if err != nil || qos < 0 || qos > 2 {
+			return nil, errors.New("illegal mqttQoS " + str)
+		}
+		s.qos = byte(qos)
+	}
+	return s, nil
+}
+
+func (s *mqttSink) name() string {
+	return "mqtt"
+}
+
+func (s *mqttSink) write(b *batch) error {
+	var failed int
+	var err error
+	for _, rollup := range b.rollups {
+		if rollup.FiveQI != 0 || rollup.QCI != 0 || rollup.PLMNID != "" && rollup.SliceID == "" {
+			continue
+		}
+		topic := s.topic(rollup.RanName, rollup.CellID, rollup.SliceID, rollup.Measurement) + "/rollup/" + mqttTopicLevel(rollup.Window)
+		summary := MqttRollupSummary{Start: rollup.Start, End: rollup.End, Count: rollup.Count, Min: rollup.Min, Max: rollup.Max, Mean: rollup.Mean, P95: rollup.P95}
+		if e := s.publish(topic, summary); e != nil {
+			failed, err = failed+1, e
+		}
+	}
+
+	if b.ind != nil {
+		for _, sample := range b.ind.Samples {
+			if sample.UeID != "" || sample.FiveQI != 0 || sample.QCI != 0 || sample.PLMNID != "" && sample.SliceID == "" {
+				continue
+			}
+			topic := s.topic(sample.RanName, sample.CellID, sample.SliceID, sample.Measurement)
+			summary := MqttSummary{Value: sample.Value, Unit: sample.Unit, Time: sample.Time, NodeID: sample.NodeID}
+			if e := s.publish(topic, summary); e != nil {
+				failed, err = failed+1, e
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d publishes failed, last error: %v", failed, err)
+	}
+	return nil
+}
+
+func (s *mqttSink) publish(topic string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.publisher.publish(topic, s.qos, s.retained, payload)
+}
+
+func (s *mqttSink) topic(ranName string, cellID string, sliceID string, measurement string) string {
+	levels := []string{s.prefix, mqttTopicLevel(ranName), mqttTopicLevel(cellID)}
+	if sliceID != "" {
+		levels = append(levels, "slices", mqttTopicLevel(sliceID))
+	}
+	return strings.Join(append(levels, mqttTopicLevel(measurement)), "/")
+}
+
+// mqttTopicLevel replaces the characters that are not allowed in a topic level
+func mqttTopicLevel(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(s)
+}
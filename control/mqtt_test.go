@@ -0,0 +1,115 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mqttMessage struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  []byte
+}
+
+// fakePublisher records the published messages, failing the topics that
+// contain fail
+type fakePublisher struct {
+	messages []mqttMessage
+	fail     string
+}
+
+func (p *fakePublisher) publish(topic string, qos byte, retained bool, payload []byte) error {
+	if p.fail != "" && strings.Contains(topic, p.fail) {
+		return errors.New("timeout publishing to " + topic)
+	}
+	p.messages = append(p.messages, mqttMessage{topic: topic, qos: qos, retained: retained, payload: payload})
+	return nil
+}
+
+func newTestMqttSink(t *testing.T, env map[string]string) (*mqttSink, *fakePublisher) {
+	p := &fakePublisher{}
+	return newTestSink(t, env, func() (interface{}, error) { return newMqttSinkWithPublisher(p) }).(*mqttSink), p
+}
+
+func TestMqttSinkTopics(t *testing.T) {
+	s, p := newTestMqttSink(t, map[string]string{"mqttQoS": "1", "mqttTopicPrefix": "ric/kpimon"})
+	at := time.Unix(1600000000, 0).UTC()
+	b := &batch{
+		ind: &indication{RanName: "gnb-1", Samples: []kpiSample{
+			{RanName: "gnb-1", CellID: "cell/1", Measurement: "RRU.PrbUsedDl", Unit: "%", Value: 42, Time: at, NodeID: "gnb_001_001_00000001"},
+			{RanName: "gnb-1", CellID: "cell/1", SliceID: "1-010203", Measurement: "DRB.UEThpDl", Value: 12.5, Time: at},
+			{RanName: "gnb-1", CellID: "cell/1", UeID: "17", Measurement: "DRB.UEThpDl", Value: 1, Time: at},
+			{RanName: "gnb-1", CellID: "cell/1", FiveQI: 9, Measurement: "DRB.UEThpDl", Value: 2, Time: at},
+			{RanName: "gnb-1", CellID: "cell/1", PLMNID: "00101", Measurement: "DRB.UEThpDl", Value: 3, Time: at},
+		}},
+		rollups: []Rollup{
+			{SeriesLabels: SeriesLabels{RanName: "gnb-1", CellID: "cell/1", Measurement: "RRU.PrbUsedDl"}, Window: "1m", Start: at, End: at.Add(time.Minute), Count: 4, Min: 1, Max: 4, Mean: 2.5, P95: 4},
+			{SeriesLabels: SeriesLabels{RanName: "gnb-1", CellID: "cell/1", FiveQI: 9, Measurement: "DRB.UEThpDl"}, Window: "1m"},
+		},
+	}
+	if err := s.write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	topics := make([]string, len(p.messages))
+	for i, m := range p.messages {
+		topics[i] = m.topic
+		if m.qos != 1 || !m.retained {
+			t.Errorf("%s: published with QoS %d, retained %v", m.topic, m.qos, m.retained)
+		}
+	}
+	want := []string{
+		"ric/kpimon/gnb-1/cell_1/RRU.PrbUsedDl/rollup/1m",
+		"ric/kpimon/gnb-1/cell_1/RRU.PrbUsedDl",
+		"ric/kpimon/gnb-1/cell_1/slices/1-010203/DRB.UEThpDl",
+	}
+	if strings.Join(topics, " ") != strings.Join(want, " ") {
+		t.Fatalf("got topics %v, want %v", topics, want)
+	}
+
+	var rollup MqttRollupSummary
+	if err := json.Unmarshal(p.messages[0].payload, &rollup); err != nil {
+		t.Fatal(err)
+	}
+	if rollup.Count != 4 || rollup.Mean != 2.5 || rollup.P95 != 4 || !rollup.End.Equal(at.Add(time.Minute)) {
+		t.Errorf("got rollup %+v", rollup)
+	}
+	var summary MqttSummary
+	if err := json.Unmarshal(p.messages[1].payload, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary != (MqttSummary{Value: 42, Unit: "%", Time: at, NodeID: "gnb_001_001_00000001"}) {
+		t.Errorf("got summary %+v", summary)
+	}
+}
+
+func TestMqttSinkErrors(t *testing.T) {
+	s, p := newTestMqttSink(t, map[string]string{"mqttRetained": "false"})
+	p.fail = "cell-2"
+	b := &batch{ind: &indication{RanName: "gnb-1", Samples: []kpiSample{
+		{RanName: "gnb-1", CellID: "cell-1", Measurement: "RRU.PrbUsedDl", Value: 1},
+		{RanName: "gnb-1", CellID: "cell-2", Measurement: "RRU.PrbUsedDl", Value: 2},
+		{RanName: "gnb-1", CellID: "cell-2", Measurement: "RRU.PrbAvailDl", Value: 3},
+		{RanName: "gnb-1", CellID: "cell-3", Measurement: "RRU.PrbUsedDl", Value: 4},
+	}}}
+
+	err := s.write(b)
+	if err == nil || !strings.HasPrefix(err.Error(), "2 publishes failed") {
+		t.Errorf("got %v", err)
+	}
+	if len(p.messages) != 2 || p.messages[1].topic != "kpimon/gnb-1/cell-3/RRU.PrbUsedDl" || p.messages[1].retained {
+		t.Errorf("got messages %+v, want the others published", p.messages)
+	}
+
+	for _, qos := range []string{"3", "-1", "at-least-once"} {
+		restore := setEnv(map[string]string{"mqttQoS": qos})
+		if _, err := newMqttSinkWithPublisher(p); err == nil {
+			t.Errorf("mqttQoS %s accepted", qos)
+		}
+		restore()
+	}
+}
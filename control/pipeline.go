@@ -0,0 +1,328 @@
+package control
+
+import (
+	"errors"
+	"hash/fnv"
+	"log"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+const (
+	defaultDecodeWorkers    = 4
+	defaultIntakeQueueSize  = 1024
+	defaultWorkerQueueSize  = 256
+	defaultStorageQueueSize = 1024
+	defaultSinkQueueSize    = 256
+)
+
+// RMR message type of the RIC Indication, the only type the pipeline may drop
+const ricIndication = 12050
+
+// indication is a RIC Indication after both the E2AP and the E2SM decoding
+type indication struct {
+	RanName  string
+	Received time.Time
+	Msg      *DecodedIndicationMessage
+	Header   *IndicationHeader
+	Message  *IndicationMessage
+	Samples  []kpiSample
+	Topology nodeHierarchy
+	Start    time.Time     //collection start time reported by the node, zero when unknown
+	Granul   time.Duration //granularity period of the measurements
+}
+
+// batch is the unit of work of the storage stage
+type batch struct {
+	ind       *indication
+	rollups   []Rollup
+	anomalies []AnomalyEvent
+}
+
+// sink is a storage backend fed by the storage stage
+type sink interface {
+	name() string
+	write(b *batch) error
+}
+
+type PipelineStats struct {
+	IntakeDepth   int              `json:"intakeDepth"`
+	IntakeSize    int              `json:"intakeSize"`
+	WorkerDepths  []int            `json:"workerDepths"`
+	WorkerSize    int              `json:"workerSize"`
+	StorageDepth  int              `json:"storageDepth"`
+	StorageSize   int              `json:"storageSize"`
+	IntakeDropped uint64           `json:"intakeDropped"`
+	WorkerDropped uint64           `json:"workerDropped"`
+	Sinks         []SinkQueueStats `json:"sinks"`
+}
+
+type SinkQueueStats struct {
+	Name    string `json:"name"`
+	Depth   int    `json:"depth"`
+	Size    int    `json:"size"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// pipeline decouples RMR reception from decoding and storage. Messages are
+// sharded over the decode workers by RAN name, so that the messages of one E2
+// node are always handled in order by the same worker. Each sink is written
+// from its own queue, so that a slow sink holds up neither the others nor the
+// decoding.
+type pipeline struct {
+	intake        chan *xapp.RMRParams //bounded queue filled by Consume
+	workers       []chan *xapp.RMRParams
+	storage       chan *batch
+	sinks         []*sinkQueue
+	dropped       uint64 //indications dropped because the intake queue was full
+	workerDropped uint64 //indications dropped because their worker queue was full
+}
+
+// sinkQueue holds the batches waiting for one sink
+type sinkQueue struct {
+	sink    sink
+	queue   chan *batch
+	dropped uint64 //batches dropped because the queue was full
+}
+
+func newPipeline(sinks []sink) *pipeline {
+	p := &pipeline{
+		intake:  make(chan *xapp.RMRParams, getEnvInt("intakeQueueSize", defaultIntakeQueueSize)),
+		workers: make([]chan *xapp.RMRParams, getEnvInt("decodeWorkers", defaultDecodeWorkers)),
+		storage: make(chan *batch, getEnvInt("storageQueueSize", defaultStorageQueueSize)),
+	}
+	workerQueueSize := getEnvInt("workerQueueSize", defaultWorkerQueueSize)
+	for i := range p.workers {
+		p.workers[i] = make(chan *xapp.RMRParams, workerQueueSize)
+	}
+	sinkQueueSize := getEnvInt("sinkQueueSize", defaultSinkQueueSize)
+	for _, s := range sinks {
+		p.sinks = append(p.sinks, &sinkQueue{sink: s, queue: make(chan *batch, sinkQueueSize)})
+	}
+	return p
+}
+
+// enqueue queues a received message for decoding. A RIC Indication is dropped
+// when the intake queue is full. The other message types carry subscription
+// state or a request to answer, they wait for room instead.
+func (p *pipeline) enqueue(rp *xapp.RMRParams) error {
+	if rp.Mtype != ricIndication {
+		p.intake <- rp
+		return nil
+	}
+	select {
+	case p.intake <- rp:
+		return nil
+	default:
+		atomic.AddUint64(&p.dropped, 1)
+		return errors.New("intake queue is full, message type " + strconv.Itoa(rp.Mtype) + " is dropped")
+	}
+}
+
+// dispatch hands a message to the worker of its node. A RIC Indication is
+// dropped when that worker's queue is full, so that a node whose indications
+// cannot be kept up with does not hold up the others.
+func (p *pipeline) dispatch(rp *xapp.RMRParams) error {
+	queue := p.shard(rp)
+	if rp.Mtype != ricIndication {
+		queue <- rp
+		return nil
+	}
+	select {
+	case queue <- rp:
+		return nil
+	default:
+		atomic.AddUint64(&p.workerDropped, 1)
+		return errors.New("worker queue of {" + rp.Meid.RanName + "} is full, RIC Indication is dropped")
+	}
+}
+
+func (p *pipeline) shard(rp *xapp.RMRParams) chan *xapp.RMRParams {
+	if rp.Meid == nil {
+		return p.workers[0]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(rp.Meid.RanName))
+	return p.workers[h.Sum32()%uint32(len(p.workers))]
+}
+
+func (p *pipeline) stats() PipelineStats {
+	stats := PipelineStats{
+		IntakeDepth:   len(p.intake),
+		IntakeSize:    cap(p.intake),
+		WorkerDepths:  make([]int, len(p.workers)),
+		StorageDepth:  len(p.storage),
+		StorageSize:   cap(p.storage),
+		IntakeDropped: atomic.LoadUint64(&p.dropped),
+		WorkerDropped: atomic.LoadUint64(&p.workerDropped),
+		Sinks:         make([]SinkQueueStats, len(p.sinks)),
+	}
+	for i, w := range p.workers {
+		stats.WorkerDepths[i] = len(w)
+		stats.WorkerSize = cap(w)
+	}
+	for i, q := range p.sinks {
+		stats.Sinks[i] = SinkQueueStats{Name: q.sink.name(), Depth: len(q.queue), Size: cap(q.queue), Dropped: atomic.LoadUint64(&q.dropped)}
+	}
+	return stats
+}
+
+func (c *Control) startPipeline() {
+	for _, w := range c.pipe.workers {
+		go c.decodeLoop(w)
+	}
+	for _, q := range c.pipe.sinks {
+		go c.sinkLoop(q)
+	}
+	go c.storageLoop()
+	go c.dispatchLoop()
+	go c.metrics.expireLoop()
+	go c.latest.expireLoop()
+	go c.series.expireLoop()
+	go c.derived.expireLoop()
+	go c.rules.expireLoop()
+	go c.rollup.flushLoop(c.pipe.storage)
+	if c.anomaly != nil {
+		go c.anomaly.saveLoop()
+	}
+	if c.ves != nil {
+		go c.ves.sendLoop()
+	}
+	if c.export != nil {
+		go c.export.flushLoop()
+	}
+	if c.influx != nil {
+		go c.influx.connect()
+		if c.influx.spool != nil {
+			go c.influx.replayLoop()
+		}
+	}
+}
+
+func (c *Control) dispatchLoop() {
+	for msg := range c.pipe.intake {
+		if err := c.pipe.dispatch(msg); err != nil {
+			xapp.Logger.Error("Failed to dispatch message: %v", err)
+			log.Printf("Failed to dispatch message: %v", err)
+		}
+	}
+}
+
+func (c *Control) decodeLoop(queue chan *xapp.RMRParams) {
+	for msg := range queue {
+		xapp.Logger.Debug("Received message type: %d", msg.Mtype)
+		log.Printf("Received message type: %d", msg.Mtype)
+		switch msg.Mtype {
+		case ricIndication:
+			ind, err := c.handleIndication(msg, time.Now())
+			if err == nil && ind != nil {
+				anomalies := c.observeIndication(ind)
+				c.pipe.storage <- &batch{ind: ind, anomalies: anomalies}
+			}
+		case 12011:
+			c.handleSubscriptionResponse(msg)
+		case 12012:
+			c.handleSubscriptionFailure(msg)
+		case 12021:
+			c.handleSubscriptionDeleteResponse(msg)
+		case 12022:
+			c.handleSubscriptionDeleteFailure(msg)
+		case KPI_REPORT_REQ:
+			c.publisher.handleRequest(msg)
+		default:
+			err := errors.New("Message Type " + strconv.Itoa(msg.Mtype) + " is discarded")
+			xapp.Logger.Error("Unknown message type: %v", err)
+			log.Printf("Unknown message type: %v", err)
+		}
+	}
+}
+
+// observeIndication feeds a decoded indication to the in-memory consumers and
+// returns the anomalies found in its samples
+func (c *Control) observeIndication(ind *indication) (anomalies []AnomalyEvent) {
+	ind.Topology = c.topology.learn(ind)
+	c.topology.enrich(ind.Topology, ind.Samples)
+	c.metrics.observeSamples(ind.Samples)
+	c.latest.update(ind.Samples)
+	c.series.add(ind.Samples, ind.Received)
+	c.rollup.add(ind.Samples, ind.Received)
+	c.rules.evaluate(ind.Samples, ind.Received)
+	if c.anomaly != nil {
+		anomalies = c.anomaly.detect(ind.Samples, ind.Received)
+	}
+	c.stream.publish(ind)
+	c.publisher.publish(ind)
+	return
+}
+
+// storageLoop hands every batch to the queue of each sink. A sink whose
+// queue is full loses the batch, the other sinks still get it.
+func (c *Control) storageLoop() {
+	for b := range c.pipe.storage {
+		for _, q := range c.pipe.sinks {
+			select {
+			case q.queue <- b:
+			default:
+				atomic.AddUint64(&q.dropped, 1)
+				xapp.Logger.Warn("Queue of %s is full, batch is dropped", q.sink.name())
+				log.Printf("Queue of %s is full, batch is dropped", q.sink.name())
+			}
+		}
+	}
+}
+
+// sinkLoop writes the batches queued for one sink
+func (c *Control) sinkLoop(q *sinkQueue) {
+	for b := range q.queue {
+		c.write(q.sink, b)
+	}
+}
+
+// store writes a batch to every sink in turn and returns when all are done
+func (c *Control) store(b *batch) {
+	for _, s := range c.sinks {
+		c.write(s, b)
+	}
+}
+
+func (c *Control) write(s sink, b *batch) {
+	start := time.Now()
+	err := s.write(b)
+	c.metrics.sinkWrite(s.name(), start, err)
+	if err != nil {
+		xapp.Logger.Error("Failed to write %s: %v", s.name(), err)
+		log.Printf("Failed to write %s: %v", s.name(), err)
+	}
+}
+
+func getEnvInt(key string, def int) int {
+	str := os.Getenv(key)
+	if str == "" {
+		return def
+	}
+	value, err := strconv.Atoi(str)
+	if err != nil || value <= 0 {
+		xapp.Logger.Error("Invalid value %q for %s, using %d", str, key, def)
+		log.Printf("Invalid value %q for %s, using %d", str, key, def)
+		return def
+	}
+	return value
+}
+
+func getEnvFloat(key string, def float64) float64 {
+	str := os.Getenv(key)
+	if str == "" {
+		return def
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil || value <= 0 {
+		xapp.Logger.Error("Invalid value %q for %s, using %g", str, key, def)
+		log.Printf("Invalid value %q for %s, using %g", str, key, def)
+		return def
+	}
+	return value
+}
@@ -0,0 +1,136 @@
+package control
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+// blockingSink takes batches until it is told to hang
+type blockingSink struct {
+	sinkName string
+	written  chan *batch
+	release  chan struct{}
+}
+
+func (s *blockingSink) name() string {
+	return s.sinkName
+}
+
+func (s *blockingSink) write(b *batch) error {
+	if s.release != nil {
+		<-s.release
+	}
+	s.written <- b
+	return nil
+}
+
+// setEnv sets environment variables and returns a func restoring them
+func setEnv(env map[string]string) func() {
+	var restore []func()
+	for key, value := range env {
+		key := key
+		if old, ok := os.LookupEnv(key); ok {
+			restore = append(restore, func() { os.Setenv(key, old) })
+		} else {
+			restore = append(restore, func() { os.Unsetenv(key) })
+		}
+		os.Setenv(key, value)
+	}
+	return func() {
+		for _, f := range restore {
+			f()
+		}
+	}
+}
+
+func TestPipelineEnqueueDropsOnlyIndications(t *testing.T) {
+	defer setEnv(map[string]string{"intakeQueueSize": "1", "decodeWorkers": "1", "workerQueueSize": "1"})()
+	p := newPipeline(nil)
+
+	ind := &xapp.RMRParams{Mtype: ricIndication, Meid: &xapp.RMRMeid{RanName: "gnb-1"}}
+	if err := p.enqueue(ind); err != nil {
+		t.Fatalf("first indication: %v", err)
+	}
+	if err := p.enqueue(ind); err == nil {
+		t.Fatal("indication queued beyond the intake size")
+	}
+	if stats := p.stats(); stats.IntakeDropped != 1 {
+		t.Errorf("got %d dropped, want 1", stats.IntakeDropped)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.enqueue(&xapp.RMRParams{Mtype: 12011, Meid: &xapp.RMRMeid{RanName: "gnb-1"}})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("subscription response was not held until there was room")
+	case <-time.After(50 * time.Millisecond):
+	}
+	<-p.intake
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("subscription response not queued once there was room")
+	}
+	if msg := <-p.intake; msg.Mtype != 12011 {
+		t.Errorf("got message type %d, want 12011", msg.Mtype)
+	}
+}
+
+func TestPipelineDispatchDoesNotBlockOnFullWorker(t *testing.T) {
+	defer setEnv(map[string]string{"decodeWorkers": "1", "workerQueueSize": "1"})()
+	p := newPipeline(nil)
+
+	ind := &xapp.RMRParams{Mtype: ricIndication, Meid: &xapp.RMRMeid{RanName: "gnb-1"}}
+	if err := p.dispatch(ind); err != nil {
+		t.Fatalf("first indication: %v", err)
+	}
+	if err := p.dispatch(ind); err == nil {
+		t.Fatal("indication handed to a full worker queue")
+	}
+	if stats := p.stats(); stats.WorkerDropped != 1 {
+		t.Errorf("got %d dropped, want 1", stats.WorkerDropped)
+	}
+}
+
+func TestStorageSlowSinkDoesNotHoldUpOthers(t *testing.T) {
+	defer setEnv(map[string]string{"sinkQueueSize": "1"})()
+	slow := &blockingSink{sinkName: "slow", written: make(chan *batch, 10), release: make(chan struct{})}
+	fast := &blockingSink{sinkName: "fast", written: make(chan *batch, 10)}
+	p := newPipeline([]sink{slow, fast})
+	c := &Control{pipe: p, sinks: []sink{slow, fast}, metrics: newKpiMetrics(p)}
+	for _, q := range p.sinks {
+		go c.sinkLoop(q)
+	}
+	go c.storageLoop()
+
+	// the slow sink hangs on the first batch, holds the second in its queue
+	// and loses the third
+	for i := 0; i < 3; i++ {
+		p.storage <- &batch{}
+		select {
+		case <-fast.written:
+		case <-time.After(time.Second):
+			t.Fatalf("batch %d did not reach the fast sink", i)
+		}
+	}
+
+	stats := p.stats()
+	if len(stats.Sinks) != 2 || stats.Sinks[0].Name != "slow" || stats.Sinks[0].Dropped != 1 || stats.Sinks[1].Dropped != 0 {
+		t.Errorf("unexpected sink stats %+v", stats.Sinks)
+	}
+
+	close(slow.release)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-slow.written:
+		case <-time.After(time.Second):
+			t.Fatalf("batch %d did not reach the slow sink", i)
+		}
+	}
+}
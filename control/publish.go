@@ -0,0 +1,273 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+// RMR message types of the KPI reports published to other xApps
+const (
+	KPI_REPORT_REQ  = 30100 //subscribe or unsubscribe, JSON KPIReportRequest
+	KPI_REPORT_RESP = 30101 //returned to the sender of a request, JSON KPIReportResponse
+	KPI_REPORT      = 30102 //binary KPIReport, routed by message type, RMR SubId is the subscription it was built for
+)
+
+const (
+	kpiReportSubscribe   = "subscribe"
+	kpiReportUnsubscribe = "unsubscribe"
+)
+
+const (
+	defaultKpiReportMaxSize        = 2048 //payload bytes, larger reports are split
+	defaultKpiReportMaxSubscribers = 64
+)
+
+// KPIReportRequest is sent by an xApp to register interest in KPI reports.
+// Empty filters match every node, cell and measurement.
+type KPIReportRequest struct {
+	Action       string   `json:"action"`
+	ID           int      `json:"id,omitempty"` //subscription to update or remove
+	RanName      string   `json:"ranName,omitempty"`
+	CellIDs      []string `json:"cellIds,omitempty"`
+	Measurements []string `json:"measurements,omitempty"`
+	UE           bool     `json:"ue,omitempty"` //include the per-UE values
+}
+
+// KPIReportResponse is the reply to a KPIReportRequest
+type KPIReportResponse struct {
+	ID    int    `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// KPIReportSubscription is the interest of an xApp in KPI reports
+type KPIReportSubscription struct {
+	ID           int       `json:"id"`
+	Source       string    `json:"source"` //RMR endpoint of the requesting xApp
+	RanName      string    `json:"ranName,omitempty"`
+	CellIDs      []string  `json:"cellIds,omitempty"`
+	Measurements []string  `json:"measurements,omitempty"`
+	UE           bool      `json:"ue,omitempty"`
+	Created      time.Time `json:"created"`
+}
+
+// reportTransport carries the KPI report messages, RMR in the xApp.
+//
+// The subscription IDs are assigned by kpimon at run time, after the routes
+// are set up, so KPI_REPORT is routed by message type to every xApp declaring
+// it as received. The subscription ID travels in RMR SubId for the consumers
+// to keep the reports of their own subscriptions.
+type reportTransport interface {
+	send(mtype int, subID int, payload []byte) error
+	reply(req *xapp.RMRParams, mtype int, payload []byte) error
+}
+
+type rmrTransport struct{}
+
+func (rmrTransport) send(mtype int, subID int, payload []byte) error {
+	params := &xapp.RMRParams{Mtype: mtype, SubId: subID, Payload: payload, PayloadLen: len(payload)}
+	if !xapp.Rmr.Send(params, false) {
+		return errors.New("rmr.Send() failed")
+	}
+	return nil
+}
+
+func (rmrTransport) reply(req *xapp.RMRParams, mtype int, payload []byte) error {
+	req.Mtype = mtype
+	req.Payload = payload
+	req.PayloadLen = len(payload)
+	if !xapp.Rmr.Send(req, true) {
+		return errors.New("rmr.Send() failed")
+	}
+	return nil
+}
+
+// kpiPublisher publishes the decoded KPIs of every indication to the xApps that
+// subscribed to them
+type kpiPublisher struct {
+	mu             sync.Mutex
+	transport      reportTransport
+	maxSize        int
+	maxSubscribers int
+	nextID         int
+	subs           map[int]*KPIReportSubscription
+}
+
+func newKpiPublisher(transport reportTransport) *kpiPublisher {
+	return &kpiPublisher{
+		transport:      transport,
+		maxSize:        getEnvInt("kpiReportMaxSize", defaultKpiReportMaxSize),
+		maxSubscribers: getEnvInt("kpiReportMaxSubscribers", defaultKpiReportMaxSubscribers),
+		nextID:         1,
+		subs:           make(map[int]*KPIReportSubscription),
+	}
+}
+
+// handleRequest applies a KPI_REPORT_REQ and replies with a KPI_REPORT_RESP
+func (p *kpiPublisher) handleRequest(params *xapp.RMRParams) {
+	var resp KPIReportResponse
+	var req KPIReportRequest
+	if err := json.Unmarshal(params.Payload, &req); err != nil {
+		resp.Error = "invalid request: " + err.Error()
+	} else if resp.ID, err = p.apply(params.Src, req); err != nil {
+		resp.Error = err.Error()
+	}
+	if resp.Error != "" {
+		xapp.Logger.Warn("KPI report request from %s rejected: %s", params.Src, resp.Error)
+		log.Printf("KPI report request from %s rejected: %s", params.Src, resp.Error)
+	}
+
+	payload, _ := json.Marshal(resp)
+	if err := p.transport.reply(params, KPI_REPORT_RESP, payload); err != nil {
+		xapp.Logger.Error("Failed to send KPI_REPORT_RESP to %s: %v", params.Src, err)
+		log.Printf("Failed to send KPI_REPORT_RESP to %s: %v", params.Src, err)
+	}
+}
+
+func (p *kpiPublisher) apply(source string, req KPIReportRequest) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch req.Action {
+	case kpiReportSubscribe:
+		if req.ID != 0 {
+			if err := p.owned(source, req.ID); err != nil {
+				return 0, err
+			}
+		} else if len(p.subs) >= p.maxSubscribers {
+			return 0, errors.New("too many subscriptions")
+		}
+		sub := &KPIReportSubscription{
+			ID:           req.ID,
+			Source:       source,
+			RanName:      req.RanName,
+			CellIDs:      req.CellIDs,
+			Measurements: req.Measurements,
+			UE:           req.UE,
+			Created:      time.Now(),
+		}
+		if sub.ID == 0 {
+			sub.ID = p.nextID
+			p.nextID++
+		}
+		p.subs[sub.ID] = sub
+		xapp.Logger.Info("KPI report subscription %d of %s", sub.ID, source)
+		log.Printf("KPI report subscription %d of %s", sub.ID, source)
+		return sub.ID, nil
+	case kpiReportUnsubscribe:
+		if err := p.owned(source, req.ID); err != nil {
+			return 0, err
+		}
+		delete(p.subs, req.ID)
+		xapp.Logger.Info("KPI report subscription %d of %s removed", req.ID, source)
+		log.Printf("KPI report subscription %d of %s removed", req.ID, source)
+		return req.ID, nil
+	}
+	return 0, errors.New("unknown action " + req.Action)
+}
+
+// owned returns an error unless the subscription exists and was made by source,
+// so that an xApp cannot change or remove the subscriptions of another
+func (p *kpiPublisher) owned(source string, id int) error {
+	sub, ok := p.subs[id]
+	if !ok {
+		return errors.New("unknown subscription")
+	}
+	if sub.Source != source {
+		return errors.New("subscription " + strconv.Itoa(id) + " belongs to another xApp")
+	}
+	return nil
+}
+
+// publish sends the matching samples of an indication to every subscription,
+// one report per granularity period split into reports that fit the maximum
+// payload size
+func (p *kpiPublisher) publish(ind *indication) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	periods := samplePeriods(ind)
+	for _, sub := range p.subs {
+		if sub.RanName != "" && sub.RanName != ind.RanName {
+			continue
+		}
+		for _, period := range periods {
+			p.publishPeriod(sub, ind.RanName, period)
+		}
+	}
+}
+
+// publishPeriod sends the matching samples of one period to a subscription
+func (p *kpiPublisher) publishPeriod(sub *KPIReportSubscription, ranName string, period samplePeriod) {
+	report := &KPIReport{RanName: ranName, Time: period.start}
+	size := kpiReportHeaderSize + report.size()
+	for _, sample := range period.samples {
+		if !sub.match(sample) {
+			continue
+		}
+		entry := KPIReportEntry{
+			CellID:      sample.CellID,
+			UeID:        sample.UeID,
+			PLMNID:      sample.PLMNID,
+			SliceID:     sample.SliceID,
+			FiveQI:      uint16(sample.FiveQI),
+			Measurement: sample.Measurement,
+			Value:       sample.Value,
+		}
+		if len(report.Entries) > 0 && (size+entry.size() > p.maxSize || len(report.Entries) == 0xffff) {
+			p.send(sub, report)
+			report.Entries = report.Entries[:0]
+			size = kpiReportHeaderSize + report.size()
+		}
+		report.Entries = append(report.Entries, entry)
+		size += entry.size()
+	}
+	if len(report.Entries) > 0 {
+		p.send(sub, report)
+	}
+}
+
+func (p *kpiPublisher) send(sub *KPIReportSubscription, report *KPIReport) {
+	if err := p.transport.send(KPI_REPORT, sub.ID, report.Encode()); err != nil {
+		xapp.Logger.Error("Failed to send KPI_REPORT of subscription %d: %v", sub.ID, err)
+		log.Printf("Failed to send KPI_REPORT of subscription %d: %v", sub.ID, err)
+	}
+}
+
+func (p *kpiPublisher) list() []KPIReportSubscription {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	subs := make([]KPIReportSubscription, 0, len(p.subs))
+	for _, sub := range p.subs {
+		subs = append(subs, *sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].ID < subs[j].ID })
+	return subs
+}
+
+func (s *KPIReportSubscription) match(sample kpiSample) bool {
+	if sample.UeID != "" && !s.UE {
+		return false
+	}
+	return contains(s.CellIDs, sample.CellID) && contains(s.Measurements, sample.Measurement)
+}
+
+// contains reports whether value is in values, an empty list contains everything
+func contains(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+type sentReport struct {
+	mtype   int
+	subID   int
+	payload []byte
+}
+
+// fakeTransport records the KPI report messages instead of sending them
+type fakeTransport struct {
+	sent    []sentReport
+	replies []sentReport
+}
+
+func (t *fakeTransport) send(mtype int, subID int, payload []byte) error {
+	t.sent = append(t.sent, sentReport{mtype: mtype, subID: subID, payload: payload})
+	return nil
+}
+
+func (t *fakeTransport) reply(req *xapp.RMRParams, mtype int, payload []byte) error {
+	t.replies = append(t.replies, sentReport{mtype: mtype, subID: req.SubId, payload: payload})
+	return nil
+}
+
+// request sends a KPI_REPORT_REQ from source and returns the response
+func request(t *testing.T, p *kpiPublisher, source string, req KPIReportRequest) KPIReportResponse {
+	payload, _ := json.Marshal(req)
+	p.handleRequest(&xapp.RMRParams{Mtype: KPI_REPORT_REQ, Src: source, Payload: payload, PayloadLen: len(payload)})
+
+	replies := p.transport.(*fakeTransport).replies
+	last := replies[len(replies)-1]
+	if last.mtype != KPI_REPORT_RESP {
+		t.Fatalf("replied with message type %d", last.mtype)
+	}
+	var resp KPIReportResponse
+	if err := json.Unmarshal(last.payload, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestKpiPublisherSubscriptions(t *testing.T) {
+	defer setEnv(map[string]string{"kpiReportMaxSubscribers": "2"})()
+	transport := &fakeTransport{}
+	p := newKpiPublisher(transport)
+
+	resp := request(t, p, "xapp-a:4560", KPIReportRequest{Action: kpiReportSubscribe, RanName: "gnb-1"})
+	if resp.ID != 1 || resp.Error != "" {
+		t.Fatalf("subscribe: got %+v", resp)
+	}
+	resp = request(t, p, "xapp-b:4560", KPIReportRequest{Action: kpiReportSubscribe})
+	if resp.ID != 2 || resp.Error != "" {
+		t.Fatalf("second subscribe: got %+v", resp)
+	}
+	if resp = request(t, p, "xapp-c:4560", KPIReportRequest{Action: kpiReportSubscribe}); resp.Error == "" {
+		t.Error("subscription beyond kpiReportMaxSubscribers accepted")
+	}
+
+	resp = request(t, p, "xapp-a:4560", KPIReportRequest{Action: kpiReportSubscribe, ID: 1, Measurements: []string{"DRB.UEThpDl"}})
+	if resp.ID != 1 || resp.Error != "" {
+		t.Fatalf("update: got %+v", resp)
+	}
+	subs := p.list()
+	if len(subs) != 2 || subs[0].ID != 1 || subs[0].Source != "xapp-a:4560" || subs[0].RanName != "" || len(subs[0].Measurements) != 1 {
+		t.Errorf("got subscriptions %+v", subs)
+	}
+
+	for _, req := range []KPIReportRequest{
+		{Action: kpiReportSubscribe, ID: 9},
+		{Action: kpiReportUnsubscribe, ID: 9},
+		{Action: "pause", ID: 1},
+	} {
+		if resp = request(t, p, "xapp-a:4560", req); resp.Error == "" {
+			t.Errorf("%+v accepted", req)
+		}
+	}
+
+	for _, req := range []KPIReportRequest{
+		{Action: kpiReportSubscribe, ID: 1, RanName: "gnb-2"},
+		{Action: kpiReportUnsubscribe, ID: 1},
+	} {
+		if resp = request(t, p, "xapp-b:4560", req); resp.Error == "" {
+			t.Errorf("%+v of another xApp accepted", req)
+		}
+	}
+	if subs = p.list(); len(subs) != 2 || subs[0].Source != "xapp-a:4560" || subs[0].RanName != "" {
+		t.Errorf("got subscriptions %+v after requests of another xApp", subs)
+	}
+
+	if resp = request(t, p, "xapp-a:4560", KPIReportRequest{Action: kpiReportUnsubscribe, ID: 1}); resp.ID != 1 || resp.Error != "" {
+		t.Fatalf("unsubscribe: got %+v", resp)
+	}
+	if subs = p.list(); len(subs) != 1 || subs[0].ID != 2 {
+		t.Errorf("got subscriptions %+v after unsubscribing", subs)
+	}
+
+	p.handleRequest(&xapp.RMRParams{Mtype: KPI_REPORT_REQ, Src: "xapp-a:4560", Payload: []byte("{")})
+	var invalid KPIReportResponse
+	json.Unmarshal(transport.replies[len(transport.replies)-1].payload, &invalid)
+	if invalid.Error == "" {
+		t.Error("malformed request accepted")
+	}
+}
+
+func TestKpiPublisherFilters(t *testing.T) {
+	transport := &fakeTransport{}
+	p := newKpiPublisher(transport)
+	request(t, p, "xapp-a:4560", KPIReportRequest{Action: kpiReportSubscribe, RanName: "gnb-1", CellIDs: []string{"cell-1"}})
+	request(t, p, "xapp-b:4560", KPIReportRequest{Action: kpiReportSubscribe, Measurements: []string{"RRU.PrbUsedDl"}, UE: true})
+
+	ind := &indication{RanName: "gnb-1", Received: time.Unix(1600000000, 0), Samples: []kpiSample{
+		{CellID: "cell-1", Measurement: "DRB.UEThpDl", Value: 1},
+		{CellID: "cell-2", Measurement: "RRU.PrbUsedDl", Value: 2},
+		{CellID: "cell-1", UeID: "17", Measurement: "RRU.PrbUsedDl", Value: 3},
+	}}
+	p.publish(ind)
+	p.publish(&indication{RanName: "gnb-2", Received: time.Unix(1600000000, 0), Samples: []kpiSample{{CellID: "cell-1", Measurement: "DRB.UEThpDl"}}})
+
+	values := make(map[int][]float64)
+	for _, sent := range transport.sent {
+		if sent.mtype != KPI_REPORT {
+			t.Fatalf("sent message type %d", sent.mtype)
+		}
+		report, err := DecodeKPIReport(sent.payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.RanName != "gnb-1" || !report.Time.Equal(ind.Received) {
+			t.Errorf("got report of %s at %v", report.RanName, report.Time)
+		}
+		for _, e := range report.Entries {
+			values[sent.subID] = append(values[sent.subID], e.Value)
+		}
+	}
+	if fmt.Sprint(values[1]) != "[1]" || fmt.Sprint(values[2]) != "[2 3]" {
+		t.Errorf("got values by subscription %v", values)
+	}
+}
+
+func TestKpiPublisherPeriods(t *testing.T) {
+	transport := &fakeTransport{}
+	p := newKpiPublisher(transport)
+	request(t, p, "xapp-a:4560", KPIReportRequest{Action: kpiReportSubscribe})
+
+	start := time.Unix(1600000000, 0)
+	ind := &indication{RanName: "gnb-1", Received: start.Add(3 * time.Second), Start: start, Granul: time.Second}
+	for i := 2; i >= 0; i-- {
+		ind.Samples = append(ind.Samples, kpiSample{CellID: "cell-1", Measurement: "RRU.PrbUsedDl", Value: float64(i), Time: start.Add(time.Duration(i) * time.Second)})
+	}
+	p.publish(ind)
+
+	if len(transport.sent) != 3 {
+		t.Fatalf("got %d reports, want one per period", len(transport.sent))
+	}
+	for i, sent := range transport.sent {
+		report, err := DecodeKPIReport(sent.payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.Time.Equal(start.Add(time.Duration(i)*time.Second)) || len(report.Entries) != 1 || report.Entries[0].Value != float64(i) {
+			t.Errorf("report %d: got %+v", i, report)
+		}
+	}
+}
+
+func TestKpiPublisherSplitsReports(t *testing.T) {
+	const maxSize = 200
+	defer setEnv(map[string]string{"kpiReportMaxSize": fmt.Sprint(maxSize)})()
+	transport := &fakeTransport{}
+	p := newKpiPublisher(transport)
+	request(t, p, "xapp-a:4560", KPIReportRequest{Action: kpiReportSubscribe})
+
+	ind := &indication{RanName: "gnb-1", Received: time.Unix(1600000000, 0)}
+	for i := 0; i < 50; i++ {
+		ind.Samples = append(ind.Samples, kpiSample{CellID: fmt.Sprintf("cell-%d", i), SliceID: "1-010203", FiveQI: 9, Measurement: "DRB.UEThpDl", Value: float64(i)})
+	}
+	p.publish(ind)
+
+	if len(transport.sent) < 2 {
+		t.Fatalf("got %d reports, want the samples split", len(transport.sent))
+	}
+	next := 0
+	for _, sent := range transport.sent {
+		if len(sent.payload) > maxSize {
+			t.Errorf("report of %d bytes, larger than %d", len(sent.payload), maxSize)
+		}
+		report, err := DecodeKPIReport(sent.payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Entries) == 0 {
+			t.Error("empty report sent")
+		}
+		for _, e := range report.Entries {
+			if e.Value != float64(next) || e.FiveQI != 9 || e.SliceID != "1-010203" {
+				t.Fatalf("got entry %+v, want value %d", e, next)
+			}
+			next++
+		}
+	}
+	if next != len(ind.Samples) {
+		t.Errorf("got %d entries, want %d", next, len(ind.Samples))
+	}
+}
@@ -0,0 +1,160 @@
+package control
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// KPI report encoding version
+const kpiReportVersion = 1
+
+const (
+	kpiReportHeaderSize = 12 //version, reserved byte, unix time in milliseconds and entry count
+	kpiReportMaxString  = 255
+)
+
+// KPIReport is the compact report of KPI values published to other xApps.
+//
+// The encoding is big endian:
+//
+//	report = version(1) reserved(1) time(8, unix ms) count(2) ranName entry*
+//	entry  = cellID ueID plmnID sliceID fiveQI(2) measurement value(8, IEEE 754)
+//	string = length(1) bytes
+type KPIReport struct {
+	RanName string
+	Time    time.Time //start of the granularity period of the entries
+	Entries []KPIReportEntry
+}
+
+// KPIReportEntry is one KPI value of a cell, slice or UE
+type KPIReportEntry struct {
+	CellID      string
+	UeID        string
+	PLMNID      string
+	SliceID     string
+	FiveQI      uint16
+	Measurement string
+	Value       float64
+}
+
+// Encode returns the binary encoding of the report. Strings longer than 255
+// bytes are truncated.
+func (r *KPIReport) Encode() []byte {
+	buf := make([]byte, kpiReportHeaderSize, kpiReportHeaderSize+r.size())
+	buf[0] = kpiReportVersion
+	binary.BigEndian.PutUint64(buf[2:10], uint64(r.Time.UnixNano()/int64(time.Millisecond)))
+	binary.BigEndian.PutUint16(buf[10:12], uint16(len(r.Entries)))
+	buf = appendReportString(buf, r.RanName)
+	for _, e := range r.Entries {
+		buf = e.append(buf)
+	}
+	return buf
+}
+
+func (e *KPIReportEntry) append(buf []byte) []byte {
+	buf = appendReportString(buf, e.CellID)
+	buf = appendReportString(buf, e.UeID)
+	buf = appendReportString(buf, e.PLMNID)
+	buf = appendReportString(buf, e.SliceID)
+	buf = append(buf, byte(e.FiveQI>>8), byte(e.FiveQI))
+	buf = appendReportString(buf, e.Measurement)
+	var value [8]byte
+	binary.BigEndian.PutUint64(value[:], math.Float64bits(e.Value))
+	return append(buf, value[:]...)
+}
+
+// size returns the encoded size of the report without the header
+func (r *KPIReport) size() int {
+	size := 1 + reportStringLen(r.RanName)
+	for i := range r.Entries {
+		size += r.Entries[i].size()
+	}
+	return size
+}
+
+func (e *KPIReportEntry) size() int {
+	return 5 + reportStringLen(e.CellID) + reportStringLen(e.UeID) + reportStringLen(e.PLMNID) +
+		reportStringLen(e.SliceID) + 2 + reportStringLen(e.Measurement) + 8
+}
+
+func reportStringLen(s string) int {
+	if len(s) > kpiReportMaxString {
+		return kpiReportMaxString
+	}
+	return len(s)
+}
+
+func appendReportString(buf []byte, s string) []byte {
+	if len(s) > kpiReportMaxString {
+		s = s[:kpiReportMaxString]
+	}
+	buf = append(buf, byte(len(s)))
+	return append(buf, s...)
+}
+
+// DecodeKPIReport decodes a report published by kpimon
+func DecodeKPIReport(buf []byte) (*KPIReport, error) {
+	if len(buf) < kpiReportHeaderSize {
+		return nil, errors.New("KPI report too short")
+	}
+	if buf[0] != kpiReportVersion {
+		return nil, errors.New("unsupported KPI report version")
+	}
+	d := reportDecoder{buf: buf[kpiReportHeaderSize:]}
+	r := &KPIReport{
+		Time:    time.Unix(0, int64(binary.BigEndian.Uint64(buf[2:10]))*int64(time.Millisecond)),
+		RanName: d.string(),
+		Entries: make([]KPIReportEntry, binary.BigEndian.Uint16(buf[10:12])),
+	}
+	for i := range r.Entries {
+		e := &r.Entries[i]
+		e.CellID = d.string()
+		e.UeID = d.string()
+		e.PLMNID = d.string()
+		e.SliceID = d.string()
+		e.FiveQI = uint16(d.uint(2))
+		e.Measurement = d.string()
+		e.Value = math.Float64frombits(d.uint(8))
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return r, nil
+}
+
+// reportDecoder reads the fields of a report, the first error is kept and the
+// following reads return zero values
+type reportDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *reportDecoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.buf) < n {
+		d.err = errors.New("KPI report truncated")
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *reportDecoder) string() string {
+	n := d.take(1)
+	if n == nil {
+		return ""
+	}
+	return string(d.take(int(n[0])))
+}
+
+func (d *reportDecoder) uint(n int) (v uint64) {
+	for _, b := range d.take(n) {
+		v = v<<8 | uint64(b)
+	}
+	return
+}
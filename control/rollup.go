@@ -0,0 +1,217 @@
+package control
+
+import (
+	"errors"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+const (
+	defaultRollupWindows = "1m,15m,1h"
+	defaultRollupGrace   = 60 //seconds a window stays open after its end for late samples
+	rollupFlushInterval  = 10 * time.Second
+)
+
+// Rollup summarises the samples of one cell or slice level series over a window
+type Rollup struct {
+	SeriesLabels
+	Window string    `json:"window"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Count  int       `json:"count"`
+	Min    float64   `json:"min"`
+	Max    float64   `json:"max"`
+	Mean   float64   `json:"mean"`
+	P95    float64   `json:"p95"`
+	Sum    float64   `json:"sum"`
+}
+
+type rollupWindow struct {
+	labels SeriesLabels
+	window time.Duration
+	start  time.Time
+	values []float64
+}
+
+// nodeClock relates the sample times of a node to the clock of the receiver
+type nodeClock struct {
+	sample   time.Time //latest sample time of the node
+	received time.Time //receiver time the latest sample time was seen
+}
+
+// rollupStore aggregates the cell and slice samples into aligned windows of
+// every configured duration. The windows are cut from the sample times, and
+// closed once the clock of their node has passed their end by the grace
+// period. The clock of a node is its latest sample time advanced by the
+// receiver clock, the wall clock or the capture time of an import, so that a
+// node whose clock is behind or ahead still gets its windows. Samples arriving
+// after their window was closed are dropped and counted.
+type rollupStore struct {
+	mu      sync.Mutex
+	windows []time.Duration
+	grace   time.Duration
+	open    map[string]*rollupWindow
+	clocks  map[string]*nodeClock
+	late    uint64 //samples dropped because their window was closed
+}
+
+func newRollupStore() (*rollupStore, error) {
+	str := os.Getenv("rollupWindows")
+	if str == "" {
+		str = defaultRollupWindows
+	}
+
+	s := &rollupStore{
+		grace:  time.Duration(getEnvInt("rollupGrace", defaultRollupGrace)) * time.Second,
+		open:   make(map[string]*rollupWindow),
+		clocks: make(map[string]*nodeClock),
+	}
+	for _, w := range strings.Split(str, ",") {
+		window, err := time.ParseDuration(strings.TrimSpace(w))
+		if err != nil {
+			return nil, err
+		}
+		if window <= 0 {
+			return nil, errors.New("illegal rollup window " + w)
+		}
+		s.windows = append(s.windows, window)
+	}
+	return s, nil
+}
+
+// add puts the samples into their windows, per-UE samples are not rolled up.
+// now is the time the samples were received.
+func (s *rollupStore) add(samples []kpiSample, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sample := range samples {
+		clock, ok := s.clocks[sample.RanName]
+		if !ok {
+			clock = &nodeClock{}
+			s.clocks[sample.RanName] = clock
+		}
+		if sample.Time.After(clock.sample) {
+			clock.sample, clock.received = sample.Time, now
+		}
+	}
+
+	late := make(map[string]int)
+	for _, sample := range samples {
+		if sample.UeID != "" {
+			continue
+		}
+		labels := sampleLabels(sample)
+		cutoff := s.nodeTime(sample.RanName, now).Add(-s.grace)
+		for _, window := range s.windows {
+			start := sample.Time.Truncate(window)
+			if start.Add(window).Before(cutoff) {
+				late[sample.RanName]++
+				s.late++
+				continue
+			}
+			key := joinKey([]string{labels.key(), window.String(), strconv.FormatInt(start.UnixNano(), 10)})
+			w, ok := s.open[key]
+			if !ok {
+				w = &rollupWindow{labels: labels, window: window, start: start}
+				s.open[key] = w
+			}
+			w.values = append(w.values, sample.Value)
+		}
+	}
+	for ranName, n := range late {
+		xapp.Logger.Warn("%d late samples of {%s} dropped from the rollups", n, ranName)
+		log.Printf("%d late samples of {%s} dropped from the rollups", n, ranName)
+	}
+}
+
+// nodeTime returns the time on the clock of a node at the receiver time now
+func (s *rollupStore) nodeTime(ranName string, now time.Time) time.Time {
+	clock, ok := s.clocks[ranName]
+	if !ok {
+		return now
+	}
+	return clock.sample.Add(now.Sub(clock.received))
+}
+
+// lateSamples returns the number of samples dropped because their window was
+// closed
+func (s *rollupStore) lateSamples() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.late
+}
+
+// flush closes the windows whose grace period has passed on the clock of
+// their node
+func (s *rollupStore) flush(now time.Time) (rollups []Rollup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, w := range s.open {
+		if w.start.Add(w.window).After(s.nodeTime(w.labels.RanName, now).Add(-s.grace)) {
+			continue
+		}
+		delete(s.open, key)
+		rollups = append(rollups, w.summary())
+	}
+	sort.Slice(rollups, func(i, j int) bool { return rollups[i].Start.Before(rollups[j].Start) })
+	return
+}
+
+// flushLoop hands the closed windows to the storage stage
+func (s *rollupStore) flushLoop(storage chan<- *batch) {
+	ticker := time.NewTicker(rollupFlushInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		rollups := s.flush(now)
+		if len(rollups) == 0 {
+			continue
+		}
+		select {
+		case storage <- &batch{rollups: rollups}:
+		default:
+			xapp.Logger.Warn("Storage queue is full, %d rollups are dropped", len(rollups))
+			log.Printf("Storage queue is full, %d rollups are dropped", len(rollups))
+		}
+	}
+}
+
+func (w *rollupWindow) summary() Rollup {
+	values := append([]float64(nil), w.values...)
+	sort.Float64s(values)
+
+	r := Rollup{
+		SeriesLabels: w.labels,
+		Window:       w.window.String(),
+		Start:        w.start,
+		End:          w.start.Add(w.window),
+		Count:        len(values),
+		Min:          values[0],
+		Max:          values[len(values)-1],
+		P95:          percentile(values, 0.95),
+	}
+	for _, v := range values {
+		r.Sum += v
+	}
+	r.Mean = r.Sum / float64(len(values))
+	return r
+}
+
+// percentile returns the nearest rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,147 @@
+package control
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestRollupStore(t *testing.T, windows string) *rollupStore {
+	env := map[string]string{"rollupWindows": windows, "rollupGrace": "10"}
+	return newTestSink(t, env, func() (interface{}, error) { return newRollupStore() }).(*rollupStore)
+}
+
+func rollupSample(ranName string, at time.Time, value float64) kpiSample {
+	return kpiSample{RanName: ranName, CellID: "cell-1", Measurement: "RRU.PrbUsedDl", Value: value, Time: at}
+}
+
+func TestRollupStoreWindows(t *testing.T) {
+	s := newTestRollupStore(t, "1m,5m")
+	base := time.Unix(1600000000, 0).Truncate(time.Hour)
+
+	for i, offset := range []time.Duration{10 * time.Second, 50 * time.Second, 70 * time.Second} {
+		at := base.Add(offset)
+		ue := rollupSample("gnb-1", at, 100)
+		ue.UeID = "17"
+		s.add([]kpiSample{rollupSample("gnb-1", at, float64(2*i+1)), ue}, at.Add(time.Second))
+	}
+
+	if rollups := s.flush(base.Add(65 * time.Second)); len(rollups) != 0 {
+		t.Fatalf("got %+v within the grace period", rollups)
+	}
+	rollups := s.flush(base.Add(71 * time.Second))
+	if len(rollups) != 1 {
+		t.Fatalf("got %d rollups, want the first 1m window", len(rollups))
+	}
+	r := rollups[0]
+	if r.Window != "1m0s" || !r.Start.Equal(base) || !r.End.Equal(base.Add(time.Minute)) || r.RanName != "gnb-1" || r.UeID != "" {
+		t.Errorf("got rollup %+v", r)
+	}
+	if r.Count != 2 || r.Min != 1 || r.Max != 3 || r.Mean != 2 || r.Sum != 4 || r.P95 != 3 {
+		t.Errorf("got summary %+v", r)
+	}
+
+	rollups = s.flush(base.Add(6 * time.Minute))
+	if len(rollups) != 2 {
+		t.Fatalf("got %d rollups, want the second 1m and the 5m window", len(rollups))
+	}
+	for _, r := range rollups {
+		switch r.Window {
+		case "1m0s":
+			if !r.Start.Equal(base.Add(time.Minute)) || r.Count != 1 || r.Sum != 5 {
+				t.Errorf("got 1m rollup %+v", r)
+			}
+		case "5m0s":
+			if !r.Start.Equal(base) || r.Count != 3 || r.Min != 1 || r.Max != 5 || r.Mean != 3 {
+				t.Errorf("got 5m rollup %+v", r)
+			}
+		default:
+			t.Errorf("got rollup of window %s", r.Window)
+		}
+	}
+	if rollups = s.flush(base.Add(time.Hour)); len(rollups) != 0 {
+		t.Errorf("got %+v after all windows were closed", rollups)
+	}
+}
+
+func TestRollupStoreSkewedNode(t *testing.T) {
+	s := newTestRollupStore(t, "1m")
+	base := time.Unix(1600000000, 0).Truncate(time.Hour)
+
+	// gnb-1 is an hour behind the receiver, gnb-2 is in sync
+	s.add([]kpiSample{rollupSample("gnb-1", base.Add(10*time.Second), 1)}, base.Add(time.Hour+10*time.Second))
+	s.add([]kpiSample{rollupSample("gnb-1", base.Add(20*time.Second), 2)}, base.Add(time.Hour+20*time.Second))
+	if s.lateSamples() != 0 {
+		t.Fatalf("dropped %d samples of a node behind the receiver", s.lateSamples())
+	}
+
+	if rollups := s.flush(base.Add(time.Hour + 65*time.Second)); len(rollups) != 0 {
+		t.Fatalf("got %+v within the grace period of the node", rollups)
+	}
+	rollups := s.flush(base.Add(time.Hour + 71*time.Second))
+	if len(rollups) != 1 || rollups[0].RanName != "gnb-1" || !rollups[0].Start.Equal(base) || rollups[0].Count != 2 {
+		t.Fatalf("got %+v, want the window of gnb-1", rollups)
+	}
+	s.add([]kpiSample{rollupSample("gnb-2", base.Add(time.Hour+80*time.Second), 3)}, base.Add(time.Hour+80*time.Second))
+	if rollups = s.flush(base.Add(time.Hour + 2*time.Minute)); len(rollups) != 0 {
+		t.Fatalf("got %+v within the grace period of gnb-2", rollups)
+	}
+	rollups = s.flush(base.Add(time.Hour + 2*time.Minute + 11*time.Second))
+	if len(rollups) != 1 || rollups[0].RanName != "gnb-2" || !rollups[0].Start.Equal(base.Add(time.Hour+time.Minute)) {
+		t.Fatalf("got %+v, want the window of gnb-2", rollups)
+	}
+}
+
+func TestRollupStoreLateSamples(t *testing.T) {
+	s := newTestRollupStore(t, "1m,5m")
+	base := time.Unix(1600000000, 0).Truncate(time.Hour)
+
+	s.add([]kpiSample{rollupSample("gnb-1", base.Add(10*time.Second), 1)}, base.Add(11*time.Second))
+	s.add([]kpiSample{rollupSample("gnb-1", base.Add(2*time.Minute), 2)}, base.Add(2*time.Minute+time.Second))
+	s.add([]kpiSample{rollupSample("gnb-1", base.Add(20*time.Second), 3)}, base.Add(2*time.Minute+2*time.Second))
+	if s.lateSamples() != 1 {
+		t.Fatalf("got %d late samples, want the one of the closed 1m window", s.lateSamples())
+	}
+
+	for _, r := range s.flush(base.Add(time.Hour)) {
+		if r.Window == "1m0s" && r.Start.Equal(base) && r.Count != 1 {
+			t.Errorf("got 1m rollup %+v with the late sample", r)
+		}
+		if r.Window == "5m0s" && r.Count != 3 {
+			t.Errorf("got 5m rollup %+v without the late sample", r)
+		}
+	}
+}
+
+func TestRollupStoreWindowsInvalid(t *testing.T) {
+	for _, windows := range []string{"1m,x", "1m,0s", "-5m"} {
+		func() {
+			defer setEnv(map[string]string{"rollupWindows": windows})()
+			if _, err := newRollupStore(); err == nil {
+				t.Errorf("rollup windows %q accepted", windows)
+			}
+		}()
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	twenty := make([]float64, 20)
+	for i := range twenty {
+		twenty[i] = float64(i + 1)
+	}
+	for _, c := range []struct {
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{twenty, 0.95, 19},
+		{twenty, 1, 20},
+		{twenty, 0.5, 10},
+		{[]float64{5}, 0.95, 5},
+		{[]float64{1, 2}, 0, 1},
+		{[]float64{1, 2, 3, 4}, 0.5, 2},
+	} {
+		if got := percentile(c.sorted, c.p); got != c.want {
+			t.Errorf("percentile(%v, %v) = %v, want %v", c.sorted, c.p, got, c.want)
+		}
+	}
+}
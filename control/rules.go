@@ -0,0 +1,234 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultRuleStateTTL = 900 //seconds without a report before the state of a series is removed
+
+// ThresholdRule raises an alarm when a KPI crosses the threshold for Periods
+// consecutive reports, and clears it when the KPI is back beyond the clear
+// threshold for ClearPeriods consecutive reports
+type ThresholdRule struct {
+	Name            string   `json:"name"`
+	Measurement     string   `json:"measurement"`
+	Operator        string   `json:"operator"` //one of >, >=, < and <=
+	Threshold       float64  `json:"threshold"`
+	ClearThreshold  *float64 `json:"clearThreshold,omitempty"` //threshold when not set
+	Periods         int      `json:"periods,omitempty"`
+	ClearPeriods    int      `json:"clearPeriods,omitempty"`
+	Severity        string   `json:"severity,omitempty"`
+	SpecificProblem int      `json:"specificProblem,omitempty"`
+	RanName         string   `json:"ranName,omitempty"` //empty fields match every node, cell and slice
+	CellID          string   `json:"cellId,omitempty"`
+	SliceID         string   `json:"sliceId,omitempty"`
+}
+
+type ruleState struct {
+	breached int //consecutive reports beyond the threshold
+	cleared  int //consecutive reports back beyond the clear threshold
+	active   bool
+	last     time.Time
+	received time.Time //of the last report, series are expired on the clock of the receiver
+}
+
+// ruleEngine evaluates the threshold rules on every cell and slice KPI series
+type ruleEngine struct {
+	mu     sync.Mutex
+	rules  []ThresholdRule
+	ttl    time.Duration
+	state  map[string]*ruleState
+	alarms *alarmManager
+}
+
+func newRuleEngine(alarms *alarmManager) (*ruleEngine, error) {
+	e := &ruleEngine{
+		ttl:    time.Duration(getEnvInt("ruleStateTTL", defaultRuleStateTTL)) * time.Second,
+		state:  make(map[string]*ruleState),
+		alarms: alarms,
+	}
+
+	file := os.Getenv("rulesFile")
+	if file == "" {
+		return e, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &e.rules); err != nil {
+		return nil, err
+	}
+	for i := range e.rules {
+		rule := &e.rules[i]
+		if err := validateThresholdRule(rule); err != nil {
+			return nil, err
+		}
+		if rule.Periods <= 0 {
+			rule.Periods = 1
+		}
+		if rule.ClearPeriods <= 0 {
+			rule.ClearPeriods = 1
+		}
+		if rule.ClearThreshold == nil {
+			rule.ClearThreshold = &rule.Threshold
+		}
+		if rule.Severity == "" {
+			rule.Severity = "MAJOR"
+		}
+		if rule.SpecificProblem == 0 {
+			rule.SpecificProblem = defaultAlarmSpecificProblem
+		}
+	}
+	return e, nil
+}
+
+func validateThresholdRule(rule *ThresholdRule) error {
+	if rule.Name == "" || rule.Measurement == "" {
+		return errors.New("threshold rule without name or measurement")
+	}
+	switch rule.Operator {
+	case ">", ">=", "<", "<=":
+	default:
+		return errors.New("unknown operator " + rule.Operator + " of rule " + rule.Name)
+	}
+	switch rule.Severity {
+	case "", "CRITICAL", "MAJOR", "MINOR", "WARNING":
+	default:
+		return errors.New("unknown severity " + rule.Severity + " of rule " + rule.Name)
+	}
+	return nil
+}
+
+func (e *ruleEngine) evaluate(samples []kpiSample, received time.Time) {
+	if len(e.rules) == 0 {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, sample := range samples {
+		if sample.UeID != "" {
+			continue
+		}
+		for i := range e.rules {
+			rule := &e.rules[i]
+			if !rule.match(sample) {
+				continue
+			}
+			labels := sampleLabels(sample)
+			id := rule.Name + ":" + labels.id()
+			state, ok := e.state[id]
+			if !ok {
+				state = &ruleState{}
+				e.state[id] = state
+			}
+			if !sample.Time.After(state.last) {
+				continue
+			}
+			state.last = sample.Time
+			state.received = received
+
+			if compare(rule.Operator, sample.Value, rule.Threshold) {
+				state.breached++
+			} else {
+				state.breached = 0
+			}
+			if compare(rule.Operator, sample.Value, *rule.ClearThreshold) {
+				state.cleared = 0
+			} else {
+				state.cleared++
+			}
+
+			if !state.active && state.breached >= rule.Periods {
+				state.active = e.alarms.raise(&ActiveAlarm{
+					ID:              id,
+					Source:          "rule",
+					SeriesLabels:    labels,
+					Severity:        rule.Severity,
+					SpecificProblem: rule.SpecificProblem,
+					Value:           sample.Value,
+					Threshold:       rule.Threshold,
+					Description:     fmt.Sprintf("%s: %s %s %g for %d periods", rule.Name, sample.Measurement, rule.Operator, rule.Threshold, rule.Periods),
+					Raised:          sample.Time,
+				})
+			} else if state.active && state.cleared >= rule.ClearPeriods {
+				state.active = !e.alarms.clear(id)
+			}
+		}
+	}
+}
+
+// expireLoop removes the state of series that are no longer reported
+func (e *ruleEngine) expireLoop() {
+	ticker := time.NewTicker(e.ttl / 2)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		e.expire(now.Add(-e.ttl))
+	}
+}
+
+// expire removes the state of series last reported before the cutoff and
+// clears their alarms, which no report would clear anymore. The state is kept
+// for the next run when clearing fails.
+func (e *ruleEngine) expire(cutoff time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for id, state := range e.state {
+		if !state.received.Before(cutoff) {
+			continue
+		}
+		if state.active && !e.alarms.clear(id) {
+			continue
+		}
+		delete(e.state, id)
+	}
+}
+
+func (r *ThresholdRule) match(sample kpiSample) bool {
+	return r.Measurement == sample.Measurement &&
+		(r.RanName == "" || r.RanName == sample.RanName) &&
+		(r.CellID == "" || r.CellID == sample.CellID) &&
+		(r.SliceID == "" || r.SliceID == sample.SliceID)
+}
+
+func compare(operator string, value float64, threshold float64) bool {
+	switch operator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	}
+	return false
+}
+
+// id is a readable identification of a series for alarms
+func (l SeriesLabels) id() string {
+	parts := []string{l.RanName}
+	for _, part := range []string{l.CellID, l.PLMNID, l.SliceID} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if l.FiveQI > 0 {
+		parts = append(parts, fmt.Sprintf("5qi=%d", l.FiveQI))
+	}
+	if l.QCI > 0 {
+		parts = append(parts, fmt.Sprintf("qci=%d", l.QCI))
+	}
+	return strings.Join(append(parts, l.Measurement), "/")
+}
@@ -0,0 +1,132 @@
+package control
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestRuleEngine(t *testing.T, rules string, a alarmer) *ruleEngine {
+	file, remove := testConfigFile(t, rules)
+	defer remove()
+	return newTestSink(t, map[string]string{"rulesFile": file}, func() (interface{}, error) { return newRuleEngine(newAlarmManager(a)) }).(*ruleEngine)
+}
+
+func TestRuleEngineAlarms(t *testing.T) {
+	alarmer := &fakeAlarmer{}
+	e := newTestRuleEngine(t, `[{"name": "prb-high", "measurement": "RRU.PrbUsedDl", "operator": ">", "threshold": 90,
+		"clearThreshold": 80, "periods": 2, "severity": "CRITICAL", "cellId": "cell-1"}]`, alarmer)
+
+	start := time.Unix(1600000000, 0)
+	for i, value := range []float64{95, 85, 95, 95, 99, 85, 70, 95} {
+		e.evaluate([]kpiSample{
+			{RanName: "gnb-1", CellID: "cell-1", Measurement: "RRU.PrbUsedDl", Value: value, Time: start.Add(time.Duration(i) * time.Second)},
+			{RanName: "gnb-1", CellID: "cell-2", Measurement: "RRU.PrbUsedDl", Value: value, Time: start.Add(time.Duration(i) * time.Second)},
+			{RanName: "gnb-1", CellID: "cell-1", UeID: "17", Measurement: "RRU.PrbUsedDl", Value: value, Time: start.Add(time.Duration(i) * time.Second)},
+		}, start.Add(time.Duration(i)*time.Second))
+		if i == 4 && len(e.alarms.list()) != 1 {
+			t.Errorf("got active alarms %+v while breached", e.alarms.list())
+		}
+	}
+
+	if len(alarmer.raised) != 1 || len(alarmer.cleared) != 1 {
+		t.Fatalf("raised %d, cleared %d alarms", len(alarmer.raised), len(alarmer.cleared))
+	}
+	a := alarmer.raised[0]
+	if a.ID != "prb-high:gnb-1/cell-1/RRU.PrbUsedDl" || a.Source != "rule" || a.Severity != "CRITICAL" ||
+		a.SpecificProblem != defaultAlarmSpecificProblem || a.Value != 95 || a.Threshold != 90 || !a.Raised.Equal(start.Add(3*time.Second)) {
+		t.Errorf("raised %+v", a)
+	}
+	if a.Description != "prb-high: RRU.PrbUsedDl > 90 for 2 periods" {
+		t.Errorf("got description %q", a.Description)
+	}
+	if alarmer.cleared[0].ID != a.ID || len(e.alarms.list()) != 0 {
+		t.Errorf("cleared %+v", alarmer.cleared[0])
+	}
+}
+
+func TestRuleEngineRetriesAlarms(t *testing.T) {
+	alarmer := &fakeAlarmer{err: errors.New("alarm manager unavailable")}
+	e := newTestRuleEngine(t, `[{"name": "prb-low", "measurement": "RRU.PrbAvailDl", "operator": "<", "threshold": 10}]`, alarmer)
+
+	start := time.Unix(1600000000, 0)
+	report := func(i int, value float64) {
+		e.evaluate([]kpiSample{{RanName: "gnb-1", CellID: "cell-1", Measurement: "RRU.PrbAvailDl", Value: value, Time: start.Add(time.Duration(i) * time.Second)}}, start.Add(time.Duration(i)*time.Second))
+	}
+
+	report(0, 5)
+	if len(e.alarms.list()) != 0 {
+		t.Fatal("alarm active although raising it failed")
+	}
+	alarmer.err = nil
+	report(1, 5)
+	if len(alarmer.raised) != 1 || len(e.alarms.list()) != 1 {
+		t.Fatalf("alarm not raised again, raised %d", len(alarmer.raised))
+	}
+
+	alarmer.err = errors.New("alarm manager unavailable")
+	report(2, 50)
+	if len(e.alarms.list()) != 1 {
+		t.Fatal("alarm inactive although clearing it failed")
+	}
+	alarmer.err = nil
+	report(3, 50)
+	if len(alarmer.cleared) != 1 || len(e.alarms.list()) != 0 {
+		t.Errorf("alarm not cleared again, cleared %d", len(alarmer.cleared))
+	}
+}
+
+func TestRuleEngineExpire(t *testing.T) {
+	alarmer := &fakeAlarmer{}
+	e := newTestRuleEngine(t, `[{"name": "prb-high", "measurement": "RRU.PrbUsedDl", "operator": ">", "threshold": 90}]`, alarmer)
+
+	received := time.Unix(1600000000, 0)
+	report := func(cellID string, value float64, at time.Time) {
+		// the clock of the node is an hour behind the receiver
+		e.evaluate([]kpiSample{{RanName: "gnb-1", CellID: cellID, Measurement: "RRU.PrbUsedDl", Value: value, Time: at.Add(-time.Hour)}}, at)
+	}
+	report("cell-1", 95, received)
+	report("cell-2", 95, received)
+	report("cell-3", 50, received)
+	report("cell-2", 95, received.Add(10*time.Minute))
+	if len(e.alarms.list()) != 2 {
+		t.Fatalf("got active alarms %+v", e.alarms.list())
+	}
+
+	e.expire(received.Add(10 * time.Minute).Add(-e.ttl))
+	if len(e.state) != 3 {
+		t.Fatalf("got %d states, want those received within the TTL kept", len(e.state))
+	}
+
+	alarmer.err = errors.New("alarm manager unavailable")
+	e.expire(received.Add(time.Minute))
+	if len(e.state) != 2 || len(e.alarms.list()) != 2 {
+		t.Fatalf("got %d states, want the one of the alarm that failed to clear kept", len(e.state))
+	}
+	alarmer.err = nil
+	e.expire(received.Add(time.Minute))
+	if len(e.state) != 1 || len(alarmer.cleared) != 1 || alarmer.cleared[0].ID != "prb-high:gnb-1/cell-1/RRU.PrbUsedDl" {
+		t.Fatalf("got %d states, cleared %+v, want the alarm of cell-1 cleared", len(e.state), alarmer.cleared)
+	}
+
+	report("cell-1", 95, received.Add(20*time.Minute))
+	if len(alarmer.raised) != 3 {
+		t.Errorf("raised %d alarms, want the one of cell-1 raised again", len(alarmer.raised))
+	}
+}
+
+func TestRuleEngineRejectsInvalidRules(t *testing.T) {
+	for _, rules := range []string{
+		`[{"name": "no-measurement", "operator": ">", "threshold": 1}]`,
+		`[{"name": "bad-operator", "measurement": "RRU.PrbUsedDl", "operator": "!=", "threshold": 1}]`,
+		`[{"name": "bad-severity", "measurement": "RRU.PrbUsedDl", "operator": ">", "severity": "LOUD"}]`,
+	} {
+		file, remove := testConfigFile(t, rules)
+		restore := setEnv(map[string]string{"rulesFile": file})
+		if _, err := newRuleEngine(newAlarmManager(&fakeAlarmer{})); err == nil {
+			t.Errorf("%s accepted", rules)
+		}
+		restore()
+		remove()
+	}
+}
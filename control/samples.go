@@ -0,0 +1,152 @@
+package control
+
+import (
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// kpiSample is one measured value of an indication together with the labels
+// that identify its series
+type kpiSample struct {
+	RanName     string
+	CellID      string
+	PLMNID      string
+	SliceID     string
+	FiveQI      int64
+	QCI         int64
+	UeID        string
+	NodeID      string
+	DUID        string
+	CUUPID      string
+	Measurement string
+	Unit        string
+	Value       float64
+	Time        time.Time
+}
+
+// measurement slot a MeasurementRecordItem refers to
+type sampleSlot struct {
+	measurement string
+	label       *MeasLabelInfo
+	ueID        string
+}
+
+// indicationSamples pairs the MeasurementRecords of an indication with the
+// measurements they report. The record items of every MeasData entry follow
+// the order of the measurements, expanded by label for Format1 and by matched
+// UE for Format2.
+func indicationSamples(ind *indication) (samples []kpiSample) {
+	var slots []sampleSlot
+	var cellObjID *PrintableString
+	var measData []MeasurementRecord
+
+	switch msg := ind.Message.IndMsg.(type) {
+	case *IndicationMessageFormat1:
+		cellObjID = msg.CellObjID
+		measData = msg.MeasData
+		for i := range msg.MeasInfoList {
+			info := &msg.MeasInfoList[i]
+			name := measurementName(info.Measurement)
+			if len(info.LabelInfoList) == 0 {
+				slots = append(slots, sampleSlot{measurement: name})
+			}
+			for j := range info.LabelInfoList {
+				slots = append(slots, sampleSlot{measurement: name, label: &info.LabelInfoList[j]})
+			}
+		}
+	case *IndicationMessageFormat2:
+		cellObjID = msg.CellObjID
+		measData = msg.MeasData
+		for i := range msg.MeasInfoUeidList {
+			info := &msg.MeasInfoUeidList[i]
+			name := measurementName(info.Measurement)
+			var label *MeasLabelInfo
+			for _, cond := range info.MatchingCondList {
+				if label = matchingCondLabel(cond); label != nil {
+					break
+				}
+			}
+			if len(info.MatchedUeidList) == 0 {
+				slots = append(slots, sampleSlot{measurement: name, label: label})
+			}
+			for _, ueID := range info.MatchedUeidList {
+				slots = append(slots, sampleSlot{measurement: name, label: label, ueID: hex.EncodeToString(ueID.Buf)})
+			}
+		}
+	}
+
+	cellID := ""
+	if cellObjID != nil {
+		cellID = string(cellObjID.Buf)
+	}
+
+	for i, record := range measData {
+		sampleTime := ind.Received
+		if !ind.Start.IsZero() {
+			sampleTime = ind.Start.Add(time.Duration(i) * ind.Granul)
+		}
+		for k, item := range record.MeasRecord {
+			if k >= len(slots) {
+				break
+			}
+			value, ok := recordValue(item)
+			if !ok {
+				continue
+			}
+
+			sample := kpiSample{
+				RanName:     ind.RanName,
+				CellID:      cellID,
+				UeID:        slots[k].ueID,
+				Measurement: slots[k].measurement,
+				Value:       value,
+				Time:        sampleTime,
+			}
+			if label := slots[k].label; label != nil {
+				sample.PLMNID = plmnString(label.PLMNID)
+				sample.SliceID = sliceString(label.SliceID)
+				sample.FiveQI = label.FiveQI
+				sample.QCI = label.QCI
+			}
+			samples = append(samples, sample)
+		}
+	}
+	return
+}
+
+// measurementName returns the MeasurementTypeName, or the MeasurementTypeID
+// prefixed with "id:" when the node reported the measurement by ID
+func measurementName(measurement interface{}) string {
+	switch m := measurement.(type) {
+	case *PrintableString:
+		return string(m.Buf)
+	case PrintableString:
+		return string(m.Buf)
+	case MeasName:
+		return string(m.Buf)
+	case int64:
+		return "id:" + strconv.FormatInt(m, 10)
+	case MeasID:
+		return "id:" + strconv.FormatInt(int64(m), 10)
+	}
+	return ""
+}
+
+// recordValue returns the value of a MeasurementRecordItem, ok is false for
+// noValue records
+func recordValue(item MeasurementRecordItem) (value float64, ok bool) {
+	switch v := item.MeasRecordValue.(type) {
+	case int64:
+		return float64(v), true
+	case Integer:
+		var e2sm *E2sm
+		i, err := e2sm.ParseInteger(v.Buf, v.Size)
+		return float64(i), err == nil
+	case float64:
+		return v, true
+	case Real:
+		return float64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,173 @@
+package control
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// RICindicationSN is INTEGER (0..65535) and wraps around
+const indicationSNModulus = 65536
+
+// number of indications behind the newest one that are still accepted as reordered
+const indicationSNWindow = 64
+
+const (
+	indicationInOrder = iota
+	indicationReordered
+	indicationDuplicate
+	indicationRestarted
+	indicationUntracked
+)
+
+type subscriptionKey struct {
+	RanName   string
+	RequestID int32
+	RequestSN int32
+	FuncID    int32
+	ActionID  int32
+}
+
+type indicationSNState struct {
+	lastSN int32
+	seen   uint64 //bit i is set when lastSN-i has been received
+	valid  uint64 //bit i is set when lastSN-i is expected, i.e. not older than the first one
+}
+
+type NodeLossStats struct {
+	RanName    string  `json:"ranName"`
+	Received   uint64  `json:"received"`
+	Lost       uint64  `json:"lost"`
+	Duplicates uint64  `json:"duplicates"`
+	Reordered  uint64  `json:"reordered"`
+	Restarts   uint64  `json:"restarts"`
+	LossRate   float64 `json:"lossRate"`
+}
+
+type indicationSNTracker struct {
+	mu    sync.Mutex
+	subs  map[subscriptionKey]*indicationSNState //last RICindicationSN per subscription action
+	nodes map[string]*NodeLossStats              //loss counters per E2 node
+}
+
+func newIndicationSNTracker() *indicationSNTracker {
+	return &indicationSNTracker{
+		subs:  make(map[subscriptionKey]*indicationSNState),
+		nodes: make(map[string]*NodeLossStats),
+	}
+}
+
+// track records the RICindicationSN of an indication and returns whether it is
+// new (in order or reordered within the window), a duplicate or the first of a
+// restarted sequence, together with the number of indications that left the
+// window without having been received. A gap is only counted as lost once it
+// can no longer be filled by a reordered indication, so the count never goes
+// down. Indications without a RICindicationSN are not tracked.
+func (t *indicationSNTracker) track(ranName string, msg *DecodedIndicationMessage) (result int, lost int) {
+	if !msg.IndSNPresent {
+		return indicationUntracked, 0
+	}
+
+	key := subscriptionKey{ranName, msg.RequestID, msg.RequestSequenceNumber, msg.FuncID, msg.ActionID}
+	sn := msg.IndSN % indicationSNModulus
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats, ok := t.nodes[ranName]
+	if !ok {
+		stats = &NodeLossStats{RanName: ranName}
+		t.nodes[ranName] = stats
+	}
+
+	state, ok := t.subs[key]
+	if !ok {
+		t.subs[key] = &indicationSNState{lastSN: sn, seen: 1, valid: 1}
+		stats.Received++
+		stats.update()
+		return indicationInOrder, 0
+	}
+
+	ahead := (sn - state.lastSN + indicationSNModulus) % indicationSNModulus
+	if ahead == 0 {
+		stats.Duplicates++
+		return indicationDuplicate, 0
+	}
+
+	if ahead < indicationSNModulus/2 {
+		lost = state.advance(uint(ahead))
+		state.lastSN = sn
+		stats.Received++
+		stats.Lost += uint64(lost)
+		stats.update()
+		return indicationInOrder, lost
+	}
+
+	behind := uint(indicationSNModulus - ahead)
+	if behind >= indicationSNWindow {
+		// too far back to be a late indication, the node has restarted its
+		// numbering without a new subscription response
+		lost = bits.OnesCount64(state.valid &^ state.seen)
+		*state = indicationSNState{lastSN: sn, seen: 1, valid: 1}
+		stats.Received++
+		stats.Restarts++
+		stats.Lost += uint64(lost)
+		stats.update()
+		return indicationRestarted, lost
+	}
+	if state.seen&(1<<behind) != 0 {
+		stats.Duplicates++
+		return indicationDuplicate, 0
+	}
+
+	state.seen |= 1 << behind
+	state.valid |= 1 << behind
+	stats.Received++
+	stats.Reordered++
+	stats.update()
+	return indicationReordered, 0
+}
+
+// advance moves the window ahead to a newer RICindicationSN and returns the
+// number of expected indications pushed out of it without being received
+func (s *indicationSNState) advance(ahead uint) (lost int) {
+	if ahead >= indicationSNWindow {
+		// the whole window and the part of the gap beyond it are out
+		lost = bits.OnesCount64(s.valid&^s.seen) + int(ahead-indicationSNWindow)
+		s.seen, s.valid = 1, ^uint64(0)
+		return lost
+	}
+	lost = bits.OnesCount64((s.valid &^ s.seen) >> (indicationSNWindow - ahead))
+	s.seen = s.seen<<ahead | 1
+	s.valid = s.valid<<ahead | (1<<ahead - 1)
+	return lost
+}
+
+// reset forgets the RICindicationSN history of a node, e.g. when its
+// subscription is re-established and the sequence numbering restarts.
+func (t *indicationSNTracker) reset(ranName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key := range t.subs {
+		if key.RanName == ranName {
+			delete(t.subs, key)
+		}
+	}
+}
+
+func (t *indicationSNTracker) lossStats() []NodeLossStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make([]NodeLossStats, 0, len(t.nodes))
+	for _, s := range t.nodes {
+		stats = append(stats, *s)
+	}
+	return stats
+}
+
+func (s *NodeLossStats) update() {
+	if total := s.Received + s.Lost; total > 0 {
+		s.LossRate = float64(s.Lost) / float64(total)
+	}
+}
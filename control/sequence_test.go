@@ -0,0 +1,116 @@
+package control
+
+import "testing"
+
+func TestIndicationSNTracker(t *testing.T) {
+	type step struct {
+		sn      int32
+		absent  bool
+		result  int
+		lost    int
+		totLost uint64
+	}
+	tests := []struct {
+		name      string
+		steps     []step
+		reordered uint64
+		restarts  uint64
+	}{
+		{
+			name: "in order",
+			steps: []step{
+				{sn: 1, result: indicationInOrder},
+				{sn: 2, result: indicationInOrder},
+				{sn: 3, result: indicationInOrder},
+			},
+		},
+		{
+			name: "duplicate",
+			steps: []step{
+				{sn: 1, result: indicationInOrder},
+				{sn: 1, result: indicationDuplicate},
+			},
+		},
+		{
+			name: "absent sn is not tracked",
+			steps: []step{
+				{absent: true, result: indicationUntracked},
+				{absent: true, result: indicationUntracked},
+				{absent: true, result: indicationUntracked},
+			},
+		},
+		{
+			name: "reordered arrival fills the gap",
+			steps: []step{
+				{sn: 10, result: indicationInOrder},
+				{sn: 12, result: indicationInOrder},
+				{sn: 11, result: indicationReordered},
+				{sn: 11, result: indicationDuplicate},
+				{sn: 20, result: indicationInOrder},
+			},
+			reordered: 1,
+		},
+		{
+			name: "gap counted once it leaves the window",
+			steps: []step{
+				{sn: 10, result: indicationInOrder},
+				{sn: 12, result: indicationInOrder},
+				{sn: 74, result: indicationInOrder},
+				{sn: 75, result: indicationInOrder, lost: 1, totLost: 1},
+				{sn: 11, result: indicationRestarted, lost: 61, totLost: 62},
+			},
+			restarts: 1,
+		},
+		{
+			name: "gap larger than the window",
+			steps: []step{
+				{sn: 0, result: indicationInOrder},
+				{sn: 200, result: indicationInOrder, lost: 136, totLost: 136},
+			},
+		},
+		{
+			name: "wrap around",
+			steps: []step{
+				{sn: 65534, result: indicationInOrder},
+				{sn: 1, result: indicationInOrder},
+				{sn: 0, result: indicationReordered},
+				{sn: 65535, result: indicationReordered},
+			},
+			reordered: 2,
+		},
+		{
+			name: "restart without a new subscription",
+			steps: []step{
+				{sn: 30000, result: indicationInOrder},
+				{sn: 30002, result: indicationInOrder},
+				{sn: 0, result: indicationRestarted, lost: 1, totLost: 1},
+				{sn: 1, result: indicationInOrder, totLost: 1},
+				{sn: 2, result: indicationInOrder, totLost: 1},
+			},
+			restarts: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := newIndicationSNTracker()
+			for i, s := range test.steps {
+				msg := &DecodedIndicationMessage{RequestID: 1, FuncID: 2, IndSN: s.sn, IndSNPresent: !s.absent}
+				result, lost := tracker.track("gnb-1", msg)
+				if result != s.result || lost != s.lost {
+					t.Fatalf("step %d sn %d: got result %d lost %d, want %d %d", i, s.sn, result, lost, s.result, s.lost)
+				}
+				for _, stats := range tracker.lossStats() {
+					if stats.Lost != s.totLost {
+						t.Fatalf("step %d sn %d: got %d lost in total, want %d", i, s.sn, stats.Lost, s.totLost)
+					}
+				}
+			}
+			for _, stats := range tracker.lossStats() {
+				if stats.Reordered != test.reordered || stats.Restarts != test.restarts {
+					t.Errorf("got %d reordered %d restarts, want %d %d", stats.Reordered, stats.Restarts, test.reordered, test.restarts)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package control
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSeriesWindow    = 3600 //seconds of samples kept per series
+	defaultSeriesMaxPoints = 720
+	defaultSeriesMaxSeries = 2000
+)
+
+type SeriesLabels struct {
+	RanName     string `json:"ranName"`
+	CellID      string `json:"cellId,omitempty"`
+	UeID        string `json:"ueId,omitempty"`
+	PLMNID      string `json:"plmnId,omitempty"`
+	SliceID     string `json:"sliceId,omitempty"`
+	FiveQI      int64  `json:"fiveQI,omitempty"`
+	QCI         int64  `json:"qci,omitempty"`
+	Measurement string `json:"measurement"`
+	NodeID      string `json:"nodeId,omitempty"` //hierarchy of the node, not part of the series key
+	DUID        string `json:"duId,omitempty"`
+	CUUPID      string `json:"cuUpId,omitempty"`
+}
+
+type SeriesPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+type SeriesInfo struct {
+	SeriesLabels
+	Points int       `json:"points"`
+	First  time.Time `json:"first"`
+	Last   time.Time `json:"last"`
+}
+
+type SeriesData struct {
+	SeriesLabels
+	Points []SeriesPoint `json:"points"`
+}
+
+// seriesFilter selects series, empty fields match everything
+type seriesFilter struct {
+	RanName     string
+	CellID      string
+	UeID        string
+	SliceID     string
+	Measurement string
+}
+
+// ring is a fixed size circular buffer of the newest points of a series
+type ring struct {
+	labels   SeriesLabels
+	points   []SeriesPoint
+	head     int //index of the next write
+	count    int
+	received time.Time //of the newest point, series are expired on the clock of the receiver
+}
+
+// seriesStore keeps a bounded window of recent samples per KPI series
+type seriesStore struct {
+	mu        sync.RWMutex
+	window    time.Duration
+	maxPoints int
+	maxSeries int
+	series    map[string]*ring
+	dropped   uint64 //samples not stored because the series limit was reached
+}
+
+func newSeriesStore() *seriesStore {
+	return &seriesStore{
+		window:    time.Duration(getEnvInt("seriesWindow", defaultSeriesWindow)) * time.Second,
+		maxPoints: getEnvInt("seriesMaxPoints", defaultSeriesMaxPoints),
+		maxSeries: getEnvInt("seriesMaxSeries", defaultSeriesMaxSeries),
+		series:    make(map[string]*ring),
+	}
+}
+
+func (s *seriesStore) add(samples []kpiSample, received time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sample := range samples {
+		labels := sampleLabels(sample)
+		key := labels.key()
+		r, ok := s.series[key]
+		if !ok {
+			if len(s.series) >= s.maxSeries {
+				s.dropped++
+				continue
+			}
+			r = &ring{labels: labels, points: make([]SeriesPoint, s.maxPoints)}
+			s.series[key] = r
+		}
+		r.push(SeriesPoint{Time: sample.Time, Value: sample.Value})
+		r.received = received
+	}
+}
+
+// expire drops the series whose newest point was received before the cutoff
+func (s *seriesStore) expire(cutoff time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, r := range s.series {
+		if r.count == 0 || r.received.Before(cutoff) {
+			delete(s.series, key)
+		}
+	}
+}
+
+func (s *seriesStore) expireLoop() {
+	ticker := time.NewTicker(s.window / 10)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.expire(now.Add(-s.window))
+	}
+}
+
+func (s *seriesStore) list(filter seriesFilter) []SeriesInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	infos := []SeriesInfo{}
+	cutoff := time.Now().Add(-s.window)
+	for _, r := range s.series {
+		if !filter.match(r.labels) {
+			continue
+		}
+		points := r.between(cutoff, time.Now())
+		if len(points) == 0 {
+			continue
+		}
+		infos = append(infos, SeriesInfo{SeriesLabels: r.labels, Points: len(points), First: points[0].Time, Last: points[len(points)-1].Time})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].key() < infos[j].key() })
+	return infos
+}
+
+// query returns the points of the matching series between from and to. When
+// step is positive, the points are downsampled into buckets of step duration
+// aggregated with agg, one of avg, min, max, sum, last or count.
+func (s *seriesStore) query(filter seriesFilter, from time.Time, to time.Time, step time.Duration, agg string) ([]SeriesData, error) {
+	aggregate, ok := seriesAggregates[agg]
+	if !ok {
+		return nil, errors.New("unknown aggregation " + agg)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if cutoff := time.Now().Add(-s.window); from.Before(cutoff) {
+		from = cutoff
+	}
+
+	data := []SeriesData{}
+	for _, r := range s.series {
+		if !filter.match(r.labels) {
+			continue
+		}
+		points := r.between(from, to)
+		if len(points) == 0 {
+			continue
+		}
+		if step > 0 {
+			points = downsample(points, from, step, aggregate)
+		}
+		data = append(data, SeriesData{SeriesLabels: r.labels, Points: points})
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].key() < data[j].key() })
+	return data, nil
+}
+
+func (r *ring) push(p SeriesPoint) {
+	r.points[r.head] = p
+	r.head = (r.head + 1) % len(r.points)
+	if r.count < len(r.points) {
+		r.count++
+	}
+}
+
+// between returns the points with from <= time <= to, oldest first
+func (r *ring) between(from time.Time, to time.Time) []SeriesPoint {
+	points := make([]SeriesPoint, 0, r.count)
+	start := (r.head - r.count + len(r.points)) % len(r.points)
+	for i := 0; i < r.count; i++ {
+		p := r.points[(start+i)%len(r.points)]
+		if p.Time.Before(from) || p.Time.After(to) {
+			continue
+		}
+		points = append(points, p)
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	return points
+}
+
+var seriesAggregates = map[string]func(values []float64) float64{
+	"avg": func(values []float64) float64 {
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	},
+	"min": func(values []float64) float64 {
+		min := math.Inf(1)
+		for _, v := range values {
+			min = math.Min(min, v)
+		}
+		return min
+	},
+	"max": func(values []float64) float64 {
+		max := math.Inf(-1)
+		for _, v := range values {
+			max = math.Max(max, v)
+		}
+		return max
+	},
+	"sum": func(values []float64) float64 {
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	},
+	"last": func(values []float64) float64 {
+		return values[len(values)-1]
+	},
+	"count": func(values []float64) float64 {
+		return float64(len(values))
+	},
+}
+
+// downsample aggregates sorted points into buckets aligned on from, each bucket
+// is reported at its start time
+func downsample(points []SeriesPoint, from time.Time, step time.Duration, aggregate func([]float64) float64) []SeriesPoint {
+	result := []SeriesPoint{}
+	var values []float64
+	var bucket int64 = -1
+	for _, p := range points {
+		b := int64(p.Time.Sub(from) / step)
+		if b != bucket && len(values) > 0 {
+			result = append(result, SeriesPoint{Time: from.Add(time.Duration(bucket) * step), Value: aggregate(values)})
+			values = values[:0]
+		}
+		bucket = b
+		values = append(values, p.Value)
+	}
+	if len(values) > 0 {
+		result = append(result, SeriesPoint{Time: from.Add(time.Duration(bucket) * step), Value: aggregate(values)})
+	}
+	return result
+}
+
+func sampleLabels(sample kpiSample) SeriesLabels {
+	return SeriesLabels{
+		RanName:     sample.RanName,
+		CellID:      sample.CellID,
+		UeID:        sample.UeID,
+		PLMNID:      sample.PLMNID,
+		SliceID:     sample.SliceID,
+		FiveQI:      sample.FiveQI,
+		QCI:         sample.QCI,
+		Measurement: sample.Measurement,
+		NodeID:      sample.NodeID,
+		DUID:        sample.DUID,
+		CUUPID:      sample.CUUPID,
+	}
+}
+
+func (l SeriesLabels) key() string {
+	return joinKey([]string{l.RanName, l.CellID, l.UeID, l.PLMNID, l.SliceID,
+		strconv.FormatInt(l.FiveQI, 10), strconv.FormatInt(l.QCI, 10), l.Measurement})
+}
+
+func (f seriesFilter) match(l SeriesLabels) bool {
+	return (f.RanName == "" || f.RanName == l.RanName) &&
+		(f.CellID == "" || f.CellID == l.CellID) &&
+		(f.UeID == "" || f.UeID == l.UeID) &&
+		(f.SliceID == "" || f.SliceID == l.SliceID) &&
+		(f.Measurement == "" || f.Measurement == l.Measurement)
+}
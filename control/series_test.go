@@ -0,0 +1,125 @@
+package control
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestSeriesStore(maxPoints int, maxSeries int) *seriesStore {
+	return &seriesStore{window: time.Hour, maxPoints: maxPoints, maxSeries: maxSeries, series: make(map[string]*ring)}
+}
+
+func seriesSample(cellID string, at time.Time, value float64) kpiSample {
+	return kpiSample{RanName: "gnb-1", CellID: cellID, Measurement: "RRU.PrbUsedDl", Value: value, Time: at}
+}
+
+func TestRing(t *testing.T) {
+	r := &ring{points: make([]SeriesPoint, 3)}
+	base := time.Unix(1600000000, 0)
+	if points := r.between(base, base.Add(time.Hour)); len(points) != 0 {
+		t.Fatalf("got %v from an empty ring", points)
+	}
+
+	// out of order, the oldest two are overwritten
+	for i, offset := range []int{1, 2, 5, 3, 4} {
+		r.push(SeriesPoint{Time: base.Add(time.Duration(offset) * time.Second), Value: float64(i)})
+	}
+	if r.count != 3 || r.head != 2 {
+		t.Fatalf("got count %d, head %d", r.count, r.head)
+	}
+	if points := r.between(base, base.Add(time.Hour)); fmt.Sprint(points[0].Value, points[1].Value, points[2].Value) != "3 4 2" {
+		t.Errorf("got %v, want the newest three sorted by time", points)
+	}
+	if points := r.between(base.Add(4*time.Second), base.Add(5*time.Second)); len(points) != 2 {
+		t.Errorf("got %v, want the bounds included", points)
+	}
+}
+
+func TestSeriesStoreQuery(t *testing.T) {
+	s := newTestSeriesStore(100, 2)
+	base := time.Now().Truncate(time.Minute).Add(-30 * time.Minute)
+	for i := 0; i < 6; i++ {
+		at := base.Add(time.Duration(i) * 20 * time.Second)
+		s.add([]kpiSample{seriesSample("cell-1", at, float64(i)), seriesSample("cell-2", at, 10)}, at)
+	}
+	s.add([]kpiSample{seriesSample("cell-3", base, 1)}, base)
+	if len(s.series) != 2 || s.dropped != 1 {
+		t.Fatalf("got %d series, dropped %d, want the third beyond the limit dropped", len(s.series), s.dropped)
+	}
+
+	infos := s.list(seriesFilter{})
+	if len(infos) != 2 || infos[0].CellID != "cell-1" || infos[0].Points != 6 || !infos[0].First.Equal(base) || !infos[0].Last.Equal(base.Add(100*time.Second)) {
+		t.Fatalf("got series %+v", infos)
+	}
+
+	for _, c := range []struct {
+		agg  string
+		want string
+	}{
+		{"avg", "[1 3]"},
+		{"min", "[0 3]"},
+		{"max", "[2 3]"},
+		{"sum", "[3 3]"},
+		{"last", "[2 3]"},
+		{"count", "[3 1]"},
+	} {
+		// buckets of a minute from 10s before the first point, the points
+		// after 70s are left out
+		data, err := s.query(seriesFilter{CellID: "cell-1"}, base.Add(-10*time.Second), base.Add(70*time.Second), time.Minute, c.agg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != 1 || data[0].CellID != "cell-1" {
+			t.Fatalf("got %+v", data)
+		}
+		var values []float64
+		for i, p := range data[0].Points {
+			if want := base.Add(-10 * time.Second).Add(time.Duration(i) * time.Minute); !p.Time.Equal(want) {
+				t.Errorf("%s: got bucket %d at %v, want %v", c.agg, i, p.Time, want)
+			}
+			values = append(values, p.Value)
+		}
+		if fmt.Sprint(values) != c.want {
+			t.Errorf("%s: got %v, want %s", c.agg, values, c.want)
+		}
+	}
+
+	data, err := s.query(seriesFilter{}, base.Add(-2*time.Hour), base.Add(30*time.Second), 0, "avg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2 || len(data[0].Points) != 2 || len(data[1].Points) != 2 {
+		t.Errorf("got %+v, want the raw points up to 30s", data)
+	}
+	if _, err := s.query(seriesFilter{}, base, base, time.Minute, "median"); err == nil {
+		t.Error("unknown aggregation accepted")
+	}
+}
+
+func TestDownsampleGap(t *testing.T) {
+	from := time.Unix(1600000000, 0)
+	points := []SeriesPoint{{from, 1}, {from.Add(30 * time.Second), 3}, {from.Add(3 * time.Minute), 5}}
+	result := downsample(points, from, time.Minute, seriesAggregates["avg"])
+	if len(result) != 2 || result[0].Value != 2 || !result[1].Time.Equal(from.Add(3*time.Minute)) || result[1].Value != 5 {
+		t.Errorf("got %+v, want empty buckets skipped", result)
+	}
+}
+
+func TestSeriesStoreExpire(t *testing.T) {
+	s := newTestSeriesStore(10, 10)
+	received := time.Unix(1600000000, 0)
+	// the clock of the node is an hour behind the receiver
+	s.add([]kpiSample{seriesSample("cell-1", received.Add(-time.Hour), 1)}, received)
+	s.add([]kpiSample{seriesSample("cell-2", received.Add(-time.Hour), 1)}, received)
+	s.add([]kpiSample{seriesSample("cell-2", received.Add(-50*time.Minute), 2)}, received.Add(10*time.Minute))
+
+	s.expire(received.Add(10 * time.Minute).Add(-s.window))
+	if len(s.series) != 2 {
+		t.Fatalf("got %d series, want those received within the window kept", len(s.series))
+	}
+	s.expire(received.Add(time.Minute))
+	if len(s.series) != 1 || s.series[sampleLabels(seriesSample("cell-2", received, 0)).key()] == nil {
+		t.Errorf("got %d series, want the one of cell-1 expired", len(s.series))
+	}
+}
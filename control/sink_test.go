@@ -0,0 +1,50 @@
+package control
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestSink calls create with the environment set, the sink or engine it
+// returns is asserted to its type by the caller. The test fails when create
+// returns an error.
+func newTestSink(t *testing.T, env map[string]string, create func() (interface{}, error)) interface{} {
+	defer setEnv(env)()
+	s, err := create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// testConfigFile writes a configuration file, the returned function removes it
+func testConfigFile(t *testing.T, content string) (string, func()) {
+	f, err := ioutil.TempFile("", "kpimon-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		os.Remove(f.Name())
+		t.Fatal(err)
+	}
+	return f.Name(), func() { os.Remove(f.Name()) }
+}
+
+// testIndication is an indication of gnb-1 with a cell and a slice sample
+func testIndication() *indication {
+	at := time.Unix(1600000000, 0).UTC()
+	return &indication{
+		RanName:  "gnb-1",
+		Received: at,
+		Msg:      &DecodedIndicationMessage{RequestID: 1001, IndSN: 7},
+		Header:   &IndicationHeader{},
+		Message:  &IndicationMessage{},
+		Samples: []kpiSample{
+			{RanName: "gnb-1", CellID: "cell-1", Measurement: "RRU.PrbUsedDl", Value: 42, Time: at},
+			{RanName: "gnb-1", CellID: "cell-2", SliceID: "1-010203", FiveQI: 9, Measurement: "DRB.UEThpDl", Value: 12.5, Time: at},
+		},
+	}
+}
@@ -0,0 +1,311 @@
+package control
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSpoolSegmentSize = 8   //MiB
+	defaultSpoolMaxSize     = 512 //MiB
+	defaultSpoolMaxAge      = 24  //hours
+	spoolSegmentSuffix      = ".seg"
+	spoolCursorFile         = "cursor"
+	spoolDeadLetterFile     = "deadletter.log"
+	spoolRecordHeader       = 4 //length of a record
+)
+
+// SpoolStats is the state of a write-ahead spool
+type SpoolStats struct {
+	Segments        int    `json:"segments"`
+	Bytes           int64  `json:"bytes"`
+	PendingBytes    int64  `json:"pendingBytes"` //bytes not replayed yet
+	Replayed        uint64 `json:"replayed"`     //records replayed since the start
+	DeadLetters     uint64 `json:"deadLetters"`
+	DroppedSegments uint64 `json:"droppedSegments"` //segments removed by the size and age limits
+}
+
+type spoolSegment struct {
+	id       uint64
+	size     int64
+	modified time.Time
+}
+
+// spoolCursor is the replay position, persisted after every replayed record
+type spoolCursor struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+// spool is an append-only log of records split into segment files. Records
+// are replayed in order from the cursor, segments are removed once replayed
+// or when they exceed the size and age limits.
+type spool struct {
+	mu          sync.Mutex
+	dir         string
+	segmentSize int64
+	maxSize     int64
+	maxAge      time.Duration
+	segments    []*spoolSegment //oldest first, the last one is appended to
+	active      *os.File
+	cursor      spoolCursor
+	replayed    uint64
+	deadLetters uint64
+	dropped     uint64
+}
+
+func newSpool(dir string) (*spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &spool{
+		dir:         dir,
+		segmentSize: int64(getEnvInt("spoolSegmentSize", defaultSpoolSegmentSize)) << 20,
+		maxSize:     int64(getEnvInt("spoolMaxSize", defaultSpoolMaxSize)) << 20,
+		maxAge:      time.Duration(getEnvInt("spoolMaxAge", defaultSpoolMaxAge)) * time.Hour,
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), spoolSegmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), spoolSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, &spoolSegment{id: id, size: f.Size(), modified: f.ModTime()})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].id < s.segments[j].id })
+
+	if data, err := ioutil.ReadFile(filepath.Join(dir, spoolCursorFile)); err == nil {
+		if err := json.Unmarshal(data, &s.cursor); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(s.segments) > 0 && s.cursor.Segment < s.segments[0].id {
+		s.cursor = spoolCursor{Segment: s.segments[0].id}
+	}
+
+	if err := s.rotate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *spool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, spoolSegmentSuffix))
+}
+
+// rotate starts a new segment to append to
+func (s *spool) rotate() error {
+	var id uint64 = 1
+	if len(s.segments) > 0 {
+		id = s.segments[len(s.segments)-1].id + 1
+	}
+	f, err := os.OpenFile(s.segmentPath(id), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if s.active != nil {
+		s.active.Close()
+	}
+	s.active = f
+	s.segments = append(s.segments, &spoolSegment{id: id, modified: time.Now()})
+	if len(s.segments) == 1 || s.cursor.Segment == 0 {
+		s.cursor = spoolCursor{Segment: s.segments[0].id}
+	}
+	return nil
+}
+
+// append adds a record at the end of the log
+func (s *spool) append(record []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := make([]byte, spoolRecordHeader, spoolRecordHeader+len(record))
+	binary.BigEndian.PutUint32(buf, uint32(len(record)))
+	buf = append(buf, record...)
+
+	seg := s.segments[len(s.segments)-1]
+	if seg.size > 0 && seg.size+int64(len(buf)) > s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+		seg = s.segments[len(s.segments)-1]
+	}
+	if _, err := s.active.Write(buf); err != nil {
+		return err
+	}
+	seg.size += int64(len(buf))
+	seg.modified = time.Now()
+	s.enforceLimits()
+	return nil
+}
+
+// enforceLimits removes the oldest segments beyond the size and age limits,
+// the active segment is never removed
+func (s *spool) enforceLimits() {
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	for len(s.segments) > 1 {
+		oldest := s.segments[0]
+		if total <= s.maxSize && time.Since(oldest.modified) <= s.maxAge {
+			break
+		}
+		total -= oldest.size
+		s.dropped++
+		s.remove()
+	}
+}
+
+// remove deletes the oldest segment and moves the cursor past it
+func (s *spool) remove() {
+	os.Remove(s.segmentPath(s.segments[0].id))
+	s.segments = s.segments[1:]
+	if s.cursor.Segment < s.segments[0].id {
+		s.cursor = spoolCursor{Segment: s.segments[0].id}
+		s.saveCursor()
+	}
+}
+
+// next returns the record at the cursor and the position after it, nil when
+// every record has been replayed. The truncated tail of a segment, left by a
+// crash while appending, is skipped.
+func (s *spool) next() ([]byte, spoolCursor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		seg := s.segments[0]
+		if s.cursor.Offset >= seg.size {
+			if len(s.segments) == 1 {
+				return nil, s.cursor, nil
+			}
+			s.remove()
+			continue
+		}
+
+		record, err := s.read(seg)
+		if err == io.EOF {
+			s.cursor.Offset = seg.size
+			continue
+		} else if err != nil {
+			return nil, s.cursor, err
+		}
+		return record, spoolCursor{Segment: s.cursor.Segment, Offset: s.cursor.Offset + spoolRecordHeader + int64(len(record))}, nil
+	}
+}
+
+// read returns the record at the cursor, io.EOF when it is truncated
+func (s *spool) read(seg *spoolSegment) ([]byte, error) {
+	f, err := os.Open(s.segmentPath(seg.id))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var header [spoolRecordHeader]byte
+	if s.cursor.Offset+spoolRecordHeader > seg.size {
+		return nil, io.EOF
+	}
+	if _, err := f.ReadAt(header[:], s.cursor.Offset); err != nil {
+		return nil, err
+	}
+	record := make([]byte, binary.BigEndian.Uint32(header[:]))
+	if s.cursor.Offset+spoolRecordHeader+int64(len(record)) > seg.size {
+		return nil, io.EOF
+	}
+	if _, err := f.ReadAt(record, s.cursor.Offset+spoolRecordHeader); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// commit moves the cursor past a replayed or dead-lettered record
+func (s *spool) commit(next spoolCursor, replayed bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if next.Segment != s.cursor.Segment {
+		return nil //the segment was removed by the limits meanwhile
+	}
+	s.cursor = next
+	if replayed {
+		s.replayed++
+	}
+	return s.saveCursor()
+}
+
+func (s *spool) saveCursor() error {
+	data, err := json.Marshal(s.cursor)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(s.dir, spoolCursorFile)
+	if err := ioutil.WriteFile(file+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// empty reports whether every record has been replayed
+func (s *spool) empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.segments) == 1 && s.cursor.Offset >= s.segments[0].size
+}
+
+// deadLetter keeps a permanently rejected record for inspection
+func (s *spool) deadLetter(record []byte, reason error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(s.dir, spoolDeadLetterFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s.deadLetters++
+	_, err = fmt.Fprintf(f, "# %s %s\n%s\n", time.Now().UTC().Format(time.RFC3339), strings.Replace(reason.Error(), "\n", " ", -1), record)
+	return err
+}
+
+func (s *spool) stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := SpoolStats{
+		Segments:        len(s.segments),
+		Replayed:        s.replayed,
+		DeadLetters:     s.deadLetters,
+		DroppedSegments: s.dropped,
+	}
+	for _, seg := range s.segments {
+		stats.Bytes += seg.size
+		if seg.id > s.cursor.Segment {
+			stats.PendingBytes += seg.size
+		} else if seg.id == s.cursor.Segment {
+			stats.PendingBytes += seg.size - s.cursor.Offset
+		}
+	}
+	return stats
+}
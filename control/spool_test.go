@@ -0,0 +1,280 @@
+package control
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	influxdb "github.com/influxdata/influxdb1-client/v2"
+)
+
+// newTestSpool opens a spool in a new directory, the returned function removes
+// it
+func newTestSpool(t *testing.T) (*spool, string, func()) {
+	dir, err := ioutil.TempDir("", "kpimon-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newSpool(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, dir, func() {
+		s.active.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// replayAll returns the records from the cursor and commits them
+func replayAll(t *testing.T, s *spool) (records []string) {
+	for {
+		record, next, err := s.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record == nil {
+			return
+		}
+		records = append(records, string(record))
+		if err := s.commit(next, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSpoolOrder(t *testing.T) {
+	s, dir, cleanup := newTestSpool(t)
+	defer cleanup()
+	s.segmentSize = 24
+
+	if !s.empty() {
+		t.Fatal("new spool is not empty")
+	}
+	for i := 1; i <= 5; i++ {
+		if err := s.append([]byte(fmt.Sprintf("record-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.segments) != 3 {
+		t.Fatalf("got %d segments of 24 bytes, want 3", len(s.segments))
+	}
+
+	record, next, err := s.next()
+	if err != nil || string(record) != "record-1" {
+		t.Fatalf("got %q, %v", record, err)
+	}
+	if again, _, _ := s.next(); string(again) != "record-1" {
+		t.Fatalf("got %q before the commit, want the same record", again)
+	}
+	if err := s.commit(next, true); err != nil {
+		t.Fatal(err)
+	}
+	if record, _, _ = s.next(); string(record) != "record-2" {
+		t.Fatalf("got %q after the commit", record)
+	}
+
+	// the cursor survives a restart
+	s.active.Close()
+	if s, err = newSpool(dir); err != nil {
+		t.Fatal(err)
+	}
+	s.segmentSize = 24
+	if records := replayAll(t, s); strings.Join(records, ",") != "record-2,record-3,record-4,record-5" {
+		t.Errorf("replayed %v", records)
+	}
+	if !s.empty() || len(s.segments) != 1 {
+		t.Errorf("got %d segments after the replay, want the replayed ones removed", len(s.segments))
+	}
+	stats := s.stats()
+	if stats.Replayed != 4 || stats.PendingBytes != 0 {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+func TestSpoolTornWrite(t *testing.T) {
+	s, dir, cleanup := newTestSpool(t)
+	defer cleanup()
+
+	s.append([]byte("record-1"))
+	s.append([]byte("record-2"))
+
+	// a crash while appending leaves the header of a 100 byte record and part
+	// of it
+	torn := make([]byte, spoolRecordHeader, spoolRecordHeader+10)
+	binary.BigEndian.PutUint32(torn, 100)
+	if _, err := s.active.Write(append(torn, "record-3.."...)); err != nil {
+		t.Fatal(err)
+	}
+	s.active.Close()
+
+	s, err := newSpool(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.append([]byte("record-4")); err != nil {
+		t.Fatal(err)
+	}
+	if records := replayAll(t, s); strings.Join(records, ",") != "record-1,record-2,record-4" {
+		t.Errorf("replayed %v, want the torn record skipped", records)
+	}
+}
+
+func TestSpoolLimits(t *testing.T) {
+	s, _, cleanup := newTestSpool(t)
+	defer cleanup()
+	s.segmentSize, s.maxSize = 1, 30
+
+	for i := 1; i <= 4; i++ {
+		s.append([]byte(fmt.Sprintf("record-%d", i)))
+	}
+	if stats := s.stats(); stats.Segments != 2 || stats.DroppedSegments != 2 || stats.Bytes != 24 {
+		t.Fatalf("got stats %+v, want the oldest segments beyond 30 bytes dropped", stats)
+	}
+
+	s.maxSize = 1 << 20
+	s.maxAge = time.Hour
+	s.segments[0].modified = time.Now().Add(-2 * time.Hour)
+	s.append([]byte("record-5"))
+	if stats := s.stats(); stats.Segments != 2 || stats.DroppedSegments != 3 {
+		t.Fatalf("got stats %+v, want the segment older than an hour dropped", stats)
+	}
+	if records := replayAll(t, s); strings.Join(records, ",") != "record-4,record-5" {
+		t.Errorf("replayed %v", records)
+	}
+}
+
+// fakeInfluxClient fails the writes with the queued errors, and records the
+// points written
+type fakeInfluxClient struct {
+	errs    []error
+	calls   int
+	written []string
+}
+
+func (c *fakeInfluxClient) Ping(timeout time.Duration) (time.Duration, string, error) {
+	return 0, "", nil
+}
+
+func (c *fakeInfluxClient) Write(bp influxdb.BatchPoints) error {
+	c.calls++
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	for _, pt := range bp.Points() {
+		c.written = append(c.written, pt.Tags()["cell"])
+	}
+	return nil
+}
+
+func (c *fakeInfluxClient) setup() error { return nil }
+
+func testBatchPoints(t *testing.T, s *influxSink, cells ...string) influxdb.BatchPoints {
+	bp, err := s.batchPoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cell := range cells {
+		pt, err := influxdb.NewPoint("kpi", map[string]string{"cell": cell}, map[string]interface{}{"value": 1.0}, time.Unix(1600000000, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bp.AddPoint(pt)
+	}
+	return bp
+}
+
+func TestInfluxSinkSpool(t *testing.T) {
+	sp, dir, cleanup := newTestSpool(t)
+	defer cleanup()
+	unreachable := &url.Error{Op: "Post", URL: "http://influxdb:8086/write", Err: errors.New("connection refused")}
+	client := &fakeInfluxClient{errs: []error{unreachable}}
+	s := &influxSink{client: client, spool: sp}
+
+	if err := s.flush(testBatchPoints(t, s, "cell-1")); err != nil {
+		t.Fatalf("got %v, want the points spooled", err)
+	}
+	if err := s.flush(testBatchPoints(t, s, "cell-2")); err != nil || client.calls != 1 {
+		t.Fatalf("got %v after %d writes, want the points spooled behind the earlier ones", err, client.calls)
+	}
+
+	client.errs = []error{unreachable}
+	if s.replay() || sp.stats().Replayed != 0 {
+		t.Fatal("replayed while influxdb is unreachable")
+	}
+	for s.replay() {
+	}
+	if strings.Join(client.written, ",") != "cell-1,cell-2" || !sp.empty() {
+		t.Fatalf("wrote %v", client.written)
+	}
+
+	client.errs = []error{errors.New(`partial write: field type conflict: input field "value" on measurement "kpi" is type integer`)}
+	if err := s.flush(testBatchPoints(t, s, "cell-3")); err == nil || !sp.empty() {
+		t.Fatalf("got %v, want the rejected points not spooled", err)
+	}
+
+	client.errs = []error{unreachable, errors.New("unable to parse points")}
+	s.flush(testBatchPoints(t, s, "cell-4"))
+	s.flush(testBatchPoints(t, s, "cell-5"))
+	for s.replay() {
+	}
+	if strings.Join(client.written, ",") != "cell-1,cell-2,cell-5" || !sp.empty() {
+		t.Fatalf("wrote %v, want the rejected spooled points skipped", client.written)
+	}
+
+	stats := sp.stats()
+	if stats.DeadLetters != 2 || stats.Replayed != 3 {
+		t.Errorf("got stats %+v", stats)
+	}
+	letters, err := ioutil.ReadFile(filepath.Join(dir, spoolDeadLetterFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(letters), "cell=cell-3") || !strings.Contains(string(letters), "cell=cell-4") || strings.Contains(string(letters), "cell=cell-5") {
+		t.Errorf("got dead letters %s", letters)
+	}
+}
+
+func TestPermanentInfluxError(t *testing.T) {
+	for _, c := range []struct {
+		err       error
+		permanent bool
+	}{
+		{errors.New("partial write: points beyond retention policy dropped=1"), true},
+		{errors.New("unable to parse 'kpi value=': missing field value"), true},
+		{errors.New(`field type conflict: input field "value" on measurement "kpi" is type float`), true},
+		{errors.New("invalid field format"), true},
+		{errors.New("timeout"), false},
+		{errors.New("database not found: \"kpimon\""), false},
+		{&url.Error{Op: "Post", URL: "http://influxdb:8086/write?invalid", Err: errors.New("EOF")}, false},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("invalid argument")}, false},
+	} {
+		if got := permanentInfluxError(c.err); got != c.permanent {
+			t.Errorf("permanentInfluxError(%v) = %v, want %v", c.err, got, c.permanent)
+		}
+	}
+}
+
+func TestSpoolStatsDisabled(t *testing.T) {
+	for _, c := range []*Control{{}, {influx: &influxSink{}}} {
+		w := httptest.NewRecorder()
+		c.getSpoolStats(w, httptest.NewRequest(http.MethodGet, apiPrefix+"/spool", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("got status %d with influx %v, want 404", w.Code, c.influx)
+		}
+	}
+}
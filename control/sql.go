@@ -0,0 +1,291 @@
+package control
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	sqlDriver           = "postgres" //the schema and statements are PostgreSQL only
+	defaultSQLBatchSize = 500
+)
+
+// sqlMigrations are applied in order, the version of a migration is its index
+// plus one. Applied migrations must never be changed, new ones are appended.
+var sqlMigrations = []string{
+	`CREATE TABLE kpimon_nodes (
+		id SERIAL PRIMARY KEY,
+		ran_name TEXT NOT NULL UNIQUE,
+		node_id TEXT NOT NULL DEFAULT ''
+	);
+	CREATE TABLE kpimon_cells (
+		id SERIAL PRIMARY KEY,
+		node INTEGER NOT NULL REFERENCES kpimon_nodes (id),
+		cell_id TEXT NOT NULL,
+		UNIQUE (node, cell_id)
+	);
+	CREATE TABLE kpimon_measurements (
+		id SERIAL PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE,
+		unit TEXT NOT NULL DEFAULT '',
+		kind TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT ''
+	);
+	CREATE TABLE kpimon_samples (
+		time TIMESTAMPTZ NOT NULL,
+		cell INTEGER NOT NULL REFERENCES kpimon_cells (id),
+		measurement INTEGER NOT NULL REFERENCES kpimon_measurements (id),
+		ue_id TEXT NOT NULL DEFAULT '',
+		plmn_id TEXT NOT NULL DEFAULT '',
+		slice_id TEXT NOT NULL DEFAULT '',
+		five_qi SMALLINT NOT NULL DEFAULT 0,
+		qci SMALLINT NOT NULL DEFAULT 0,
+		value DOUBLE PRECISION NOT NULL
+	);
+	CREATE INDEX kpimon_samples_series ON kpimon_samples (cell, measurement, time DESC)`,
+
+	// the samples become a hypertable when the TimescaleDB extension is installed
+	`DO $$
+	BEGIN
+		IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb') THEN
+			PERFORM create_hypertable('kpimon_samples', 'time', if_not_exists => TRUE, migrate_data => TRUE);
+		END IF;
+	END
+	$$`,
+}
+
+var sqlSampleColumns = []string{"time", "cell", "measurement", "ue_id", "plmn_id", "slice_id", "five_qi", "qci", "value"}
+
+// sqlSink writes the samples to PostgreSQL or TimescaleDB. The nodes, cells and
+// measurements are normalised into their own tables, their IDs are cached.
+type sqlSink struct {
+	db        *sql.DB
+	catalog   *measurementCatalog
+	copy      bool //COPY the samples instead of multi-row inserts
+	batchSize int
+
+	mu           sync.Mutex
+	nodes        map[string]int64
+	cells        map[string]int64
+	measurements map[string]int64
+}
+
+// newSQLSink returns nil when no database is configured
+func newSQLSink(catalog *measurementCatalog) (*sqlSink, error) {
+	dsn, err := getEnvSecret("sqlDsn")
+	if err != nil || dsn == "" {
+		return nil, err
+	}
+	db, err := sql.Open(sqlDriver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return newSQLSinkWithDB(db, catalog, os.Getenv("sqlCopy") != "false")
+}
+
+func newSQLSinkWithDB(db *sql.DB, catalog *measurementCatalog, copy bool) (*sqlSink, error) {
+	s := &sqlSink{
+		db:           db,
+		catalog:      catalog,
+		copy:         copy,
+		batchSize:    getEnvInt("sqlBatchSize", defaultSQLBatchSize),
+		nodes:        make(map[string]int64),
+		cells:        make(map[string]int64),
+		measurements: make(map[string]int64),
+	}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate applies the migrations newer than the version of the schema, each
+// in its own transaction
+func (s *sqlSink) migrate() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS kpimon_schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied TIMESTAMPTZ NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var version int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM kpimon_schema_migrations`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(sqlMigrations) {
+		return errors.New("database schema version " + strconv.Itoa(version) + " is newer than kpimon")
+	}
+
+	for i := version; i < len(sqlMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqlMigrations[i]); err != nil {
+			tx.Rollback()
+			return errors.New("migration " + strconv.Itoa(i+1) + " failed: " + err.Error())
+		}
+		if _, err := tx.Exec(`INSERT INTO kpimon_schema_migrations (version, applied) VALUES ($1, $2)`, i+1, time.Now()); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlSink) name() string {
+	return "sql"
+}
+
+func (s *sqlSink) write(b *batch) error {
+	if b.ind == nil || len(b.ind.Samples) == 0 {
+		return nil
+	}
+
+	rows := make([][]interface{}, 0, len(b.ind.Samples))
+	for _, sample := range b.ind.Samples {
+		cell, err := s.cellID(sample)
+		if err != nil {
+			return err
+		}
+		measurement, err := s.measurementID(sample)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, []interface{}{sample.Time, cell, measurement, sample.UeID, sample.PLMNID, sample.SliceID, sample.FiveQI, sample.QCI, sample.Value})
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if s.copy {
+		err = s.copyRows(tx, rows)
+	} else {
+		err = s.insertRows(tx, rows)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlSink) copyRows(tx *sql.Tx, rows [][]interface{}) error {
+	stmt, err := tx.Prepare(pq.CopyIn("kpimon_samples", sqlSampleColumns...))
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if _, err := stmt.Exec(row...); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return err
+	}
+	return stmt.Close()
+}
+
+// insertRows inserts the rows with multi-row inserts of up to batchSize rows
+func (s *sqlSink) insertRows(tx *sql.Tx, rows [][]interface{}) error {
+	for len(rows) > 0 {
+		n := len(rows)
+		if n > s.batchSize {
+			n = s.batchSize
+		}
+
+		var query strings.Builder
+		query.WriteString("INSERT INTO kpimon_samples (" + strings.Join(sqlSampleColumns, ", ") + ") VALUES ")
+		args := make([]interface{}, 0, n*len(sqlSampleColumns))
+		for i, row := range rows[:n] {
+			if i > 0 {
+				query.WriteString(", ")
+			}
+			query.WriteByte('(')
+			for j := range row {
+				if j > 0 {
+					query.WriteString(", ")
+				}
+				query.WriteString("$" + strconv.Itoa(len(args)+j+1))
+			}
+			query.WriteByte(')')
+			args = append(args, row...)
+		}
+		if _, err := tx.Exec(query.String(), args...); err != nil {
+			return err
+		}
+		rows = rows[n:]
+	}
+	return nil
+}
+
+// cellID returns the ID of the cell of a sample, creating the node and the
+// cell when they are new
+func (s *sqlSink) cellID(sample kpiSample) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := sample.RanName + "\x00" + sample.CellID
+	if id, ok := s.cells[key]; ok {
+		return id, nil
+	}
+
+	node, ok := s.nodes[sample.RanName]
+	if !ok {
+		err := s.db.QueryRow(`INSERT INTO kpimon_nodes (ran_name, node_id) VALUES ($1, $2)
+			ON CONFLICT (ran_name) DO UPDATE SET node_id = EXCLUDED.node_id RETURNING id`, sample.RanName, sample.NodeID).Scan(&node)
+		if err != nil {
+			return 0, err
+		}
+		s.nodes[sample.RanName] = node
+	}
+
+	var id int64
+	err := s.db.QueryRow(`INSERT INTO kpimon_cells (node, cell_id) VALUES ($1, $2)
+		ON CONFLICT (node, cell_id) DO UPDATE SET cell_id = EXCLUDED.cell_id RETURNING id`, node, sample.CellID).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	s.cells[key] = id
+	return id, nil
+}
+
+// measurementID returns the ID of the measurement of a sample, adding it to
+// the measurements with its catalog definition when it is new
+func (s *sqlSink) measurementID(sample kpiSample) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := s.measurements[sample.Measurement]; ok {
+		return id, nil
+	}
+
+	def, ok := s.catalog.lookup(sample.Measurement)
+	if !ok {
+		def = MeasurementDef{Name: sample.Measurement, Unit: sample.Unit}
+	}
+	var id int64
+	err := s.db.QueryRow(`INSERT INTO kpimon_measurements (name, unit, kind, description) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE SET unit = EXCLUDED.unit, kind = EXCLUDED.kind, description = EXCLUDED.description RETURNING id`,
+		sample.Measurement, def.Unit, def.Kind, def.Description).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	s.measurements[sample.Measurement] = id
+	return id, nil
+}
@@ -0,0 +1,413 @@
+package control
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSQLDriver serves in-memory databases that understand the statements of
+// the SQL sink, keyed by the data source name
+type fakeSQLDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*fakeDB
+}
+
+var fakeSQL = &fakeSQLDriver{dbs: make(map[string]*fakeDB)}
+
+func init() {
+	sql.Register("kpimon-fake", fakeSQL)
+}
+
+type fakeDB struct {
+	mu           sync.Mutex
+	versions     []int64 //rows of kpimon_schema_migrations
+	applied      []int   //migrations executed, by version
+	fail         string  //statements containing fail return an error
+	ids          map[string]int64
+	samples      [][]driver.Value
+	transactions int
+}
+
+// openFakeDB opens a new, empty database
+func openFakeDB(t *testing.T, dsn string) (*sql.DB, *fakeDB) {
+	d := &fakeDB{ids: make(map[string]int64)}
+	fakeSQL.mu.Lock()
+	fakeSQL.dbs[dsn] = d
+	fakeSQL.mu.Unlock()
+
+	db, err := sql.Open("kpimon-fake", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, d
+}
+
+func (drv *fakeSQLDriver) Open(dsn string) (driver.Conn, error) {
+	drv.mu.Lock()
+	defer drv.mu.Unlock()
+	return &fakeConn{db: drv.dbs[dsn]}, nil
+}
+
+// fakeConn applies the statements of a transaction when it is committed
+type fakeConn struct {
+	db      *fakeDB
+	tx      bool
+	pending []func()
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.tx, c.pending = true, nil
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	for _, apply := range c.pending {
+		apply()
+	}
+	c.db.transactions++
+	c.tx, c.pending = false, nil
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.tx, c.pending = false, nil
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	d := s.conn.db
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.fail != "" && strings.Contains(s.query, d.fail) {
+		return nil, errors.New("statement failed")
+	}
+	var apply func()
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE IF NOT EXISTS kpimon_schema_migrations"):
+	case strings.HasPrefix(s.query, "INSERT INTO kpimon_schema_migrations"):
+		apply = func() { d.versions = append(d.versions, args[0].(int64)) }
+	case strings.HasPrefix(s.query, "INSERT INTO kpimon_samples"), strings.HasPrefix(s.query, "COPY "):
+		if len(args)%len(sqlSampleColumns) != 0 {
+			return nil, errors.New("got " + strconv.Itoa(len(args)) + " arguments")
+		}
+		rows := make([][]driver.Value, 0, len(args)/len(sqlSampleColumns))
+		for len(args) > 0 {
+			rows, args = append(rows, args[:len(sqlSampleColumns)]), args[len(sqlSampleColumns):]
+		}
+		apply = func() { d.samples = append(d.samples, rows...) }
+	default:
+		version := 0
+		for i, migration := range sqlMigrations {
+			if s.query == migration {
+				version = i + 1
+			}
+		}
+		if version == 0 {
+			return nil, errors.New("unexpected statement " + s.query)
+		}
+		apply = func() { d.applied = append(d.applied, version) }
+	}
+
+	if apply != nil {
+		if s.conn.tx {
+			s.conn.pending = append(s.conn.pending, apply)
+		} else {
+			apply()
+		}
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.conn.db
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.fail != "" && strings.Contains(s.query, d.fail) {
+		return nil, errors.New("statement failed")
+	}
+	var value int64
+	switch {
+	case strings.HasPrefix(s.query, "SELECT COALESCE(MAX(version), 0) FROM kpimon_schema_migrations"):
+		for _, v := range d.versions {
+			if v > value {
+				value = v
+			}
+		}
+	case strings.HasPrefix(s.query, "INSERT INTO kpimon_nodes"), strings.HasPrefix(s.query, "INSERT INTO kpimon_cells"), strings.HasPrefix(s.query, "INSERT INTO kpimon_measurements"):
+		table := strings.Fields(s.query)[2]
+		key := table + "/" + fakeValueString(args[0]) + "/" + fakeValueString(args[1])
+		if table == "kpimon_measurements" {
+			key = table + "/" + fakeValueString(args[0])
+		}
+		id, ok := d.ids[key]
+		if !ok {
+			id = int64(len(d.ids) + 1)
+			d.ids[key] = id
+		}
+		value = id
+	default:
+		return nil, errors.New("unexpected query " + s.query)
+	}
+	return &fakeRows{values: []int64{value}}, nil
+}
+
+func fakeValueString(v driver.Value) string {
+	if i, ok := v.(int64); ok {
+		return strconv.FormatInt(i, 10)
+	}
+	return v.(string)
+}
+
+// fakeRows is a result of a single int64 column
+type fakeRows struct {
+	values []int64
+}
+
+func (r *fakeRows) Columns() []string { return []string{"value"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+func TestSQLSinkMigrations(t *testing.T) {
+	catalog, err := newMeasurementCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, d := openFakeDB(t, t.Name())
+	defer db.Close()
+
+	if _, err := newSQLSinkWithDB(db, catalog, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.applied) != len(sqlMigrations) || len(d.versions) != len(sqlMigrations) {
+		t.Fatalf("applied migrations %v, recorded versions %v", d.applied, d.versions)
+	}
+	for i := range sqlMigrations {
+		if d.applied[i] != i+1 || d.versions[i] != int64(i+1) {
+			t.Fatalf("applied migrations %v, recorded versions %v, want them in order", d.applied, d.versions)
+		}
+	}
+	if d.transactions != len(sqlMigrations) {
+		t.Errorf("got %d transactions, want one per migration", d.transactions)
+	}
+
+	if _, err := newSQLSinkWithDB(db, catalog, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.applied) != len(sqlMigrations) || len(d.versions) != len(sqlMigrations) || d.transactions != len(sqlMigrations) {
+		t.Errorf("migrating again applied %v, recorded versions %v", d.applied, d.versions)
+	}
+
+	d.versions = append(d.versions, int64(len(sqlMigrations)+1))
+	if _, err := newSQLSinkWithDB(db, catalog, false); err == nil {
+		t.Error("schema newer than kpimon accepted")
+	}
+}
+
+func TestSQLSinkFailedMigration(t *testing.T) {
+	catalog, _ := newMeasurementCatalog()
+	db, d := openFakeDB(t, t.Name())
+	defer db.Close()
+
+	d.fail = "create_hypertable"
+	if _, err := newSQLSinkWithDB(db, catalog, false); err == nil || !strings.HasPrefix(err.Error(), "migration 2 failed") {
+		t.Fatalf("got %v", err)
+	}
+	if len(d.applied) != 1 || len(d.versions) != 1 {
+		t.Fatalf("applied migrations %v, recorded versions %v, want the failed one rolled back", d.applied, d.versions)
+	}
+
+	d.fail = ""
+	if _, err := newSQLSinkWithDB(db, catalog, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.applied) != 2 || d.applied[1] != 2 {
+		t.Errorf("applied migrations %v after retrying", d.applied)
+	}
+}
+
+func TestSQLSinkWrite(t *testing.T) {
+	catalog, _ := newMeasurementCatalog()
+	at := time.Unix(1600000000, 0)
+	samples := []kpiSample{
+		{RanName: "gnb-1", CellID: "cell-1", Measurement: "RRU.PrbUsedDl", Value: 1, Time: at},
+		{RanName: "gnb-1", CellID: "cell-2", Measurement: "RRU.PrbUsedDl", Value: 2, Time: at},
+		{RanName: "gnb-1", CellID: "cell-1", SliceID: "1-010203", FiveQI: 9, Measurement: "DRB.UEThpDl", Value: 3, Time: at},
+	}
+
+	defer setEnv(map[string]string{"sqlBatchSize": "2"})()
+	for _, copy := range []bool{false, true} {
+		db, d := openFakeDB(t, t.Name()+strconv.FormatBool(copy))
+		s, err := newSQLSinkWithDB(db, catalog, copy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.write(&batch{ind: &indication{Samples: samples}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.write(&batch{ind: &indication{Samples: samples[:1]}}); err != nil {
+			t.Fatal(err)
+		}
+		if len(d.samples) != 4 {
+			t.Fatalf("copy %v: got %d rows", copy, len(d.samples))
+		}
+		cell1, cell2 := d.ids["kpimon_cells/1/cell-1"], d.ids["kpimon_cells/1/cell-2"]
+		prb, thp := d.ids["kpimon_measurements/RRU.PrbUsedDl"], d.ids["kpimon_measurements/DRB.UEThpDl"]
+		if len(d.ids) != 5 || cell1 == 0 || cell2 == 0 || prb == 0 || thp == 0 {
+			t.Fatalf("copy %v: got IDs %v", copy, d.ids)
+		}
+		row := d.samples[2]
+		if !row[0].(time.Time).Equal(at) || row[1] != cell1 || row[2] != thp || row[5] != "1-010203" || row[6] != int64(9) || row[8] != float64(3) {
+			t.Errorf("copy %v: got row %v", copy, row)
+		}
+		if d.samples[3][1] != cell1 || d.samples[3][2] != prb {
+			t.Errorf("copy %v: got row %v of the cached cell", copy, d.samples[3])
+		}
+
+		d.fail = "kpimon_samples"
+		if err := s.write(&batch{ind: &indication{Samples: samples}}); err == nil || len(d.samples) != 4 {
+			t.Errorf("copy %v: got %v, %d rows after a failed write", copy, err, len(d.samples))
+		}
+		db.Close()
+	}
+}
+
+// withSearchPath sets the schema the statements of a connection use, in the
+// URL or the key/value form of a PostgreSQL DSN
+func withSearchPath(dsn string, schema string) string {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsn + " search_path=" + schema
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&search_path=" + schema
+	}
+	return dsn + "?search_path=" + schema
+}
+
+// TestSQLSinkPostgres runs the sink against the PostgreSQL database of
+// KPIMON_TEST_POSTGRES_DSN, in a schema of its own that is dropped afterwards
+func TestSQLSinkPostgres(t *testing.T) {
+	dsn := os.Getenv("KPIMON_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("KPIMON_TEST_POSTGRES_DSN not set")
+	}
+	admin, err := sql.Open(sqlDriver, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+	schema := "kpimon_test_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+
+	db, err := sql.Open(sqlDriver, withSearchPath(dsn, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	catalog, _ := newMeasurementCatalog()
+	at := time.Unix(1600000000, 0)
+	samples := []kpiSample{
+		{RanName: "gnb-1", CellID: "cell-1", Measurement: "RRU.PrbUsedDl", Value: 1, Time: at},
+		{RanName: "gnb-1", CellID: "cell-2", Measurement: "RRU.PrbUsedDl", Value: 2, Time: at},
+		{RanName: "gnb-1", CellID: "cell-1", SliceID: "1-010203", FiveQI: 9, Measurement: "DRB.UEThpDl", Value: 3, Time: at},
+		{RanName: "gnb-2", CellID: "cell-1", Measurement: "Vendor.Kpi", Unit: "ms", Value: 4, Time: at},
+	}
+
+	defer setEnv(map[string]string{"sqlBatchSize": "2"})()
+	for i, copy := range []bool{false, true} {
+		s, err := newSQLSinkWithDB(db, catalog, copy)
+		if err != nil {
+			t.Fatalf("copy %v: %v", copy, err)
+		}
+		for j := range samples {
+			samples[j].Value += float64(10 * i)
+		}
+		if err := s.write(&batch{ind: &indication{Samples: samples}}); err != nil {
+			t.Fatalf("copy %v: %v", copy, err)
+		}
+	}
+
+	var version int
+	if err := db.QueryRow(`SELECT MAX(version) FROM kpimon_schema_migrations`).Scan(&version); err != nil || version != len(sqlMigrations) {
+		t.Errorf("got schema version %d, %v", version, err)
+	}
+	var nodes, cells, measurements int
+	err = db.QueryRow(`SELECT (SELECT COUNT(*) FROM kpimon_nodes), (SELECT COUNT(*) FROM kpimon_cells), (SELECT COUNT(*) FROM kpimon_measurements)`).Scan(&nodes, &cells, &measurements)
+	if err != nil || nodes != 2 || cells != 3 || measurements != 3 {
+		t.Errorf("got %d nodes, %d cells, %d measurements, %v", nodes, cells, measurements, err)
+	}
+
+	rows, err := db.Query(`SELECT n.ran_name, c.cell_id, m.name, m.unit, s.slice_id, s.five_qi, s.value, s.time
+		FROM kpimon_samples s JOIN kpimon_cells c ON c.id = s.cell JOIN kpimon_nodes n ON n.id = c.node JOIN kpimon_measurements m ON m.id = s.measurement
+		ORDER BY s.value`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var ranName, cellID, measurement, unit, sliceID string
+		var fiveQI int64
+		var value float64
+		var sampleTime time.Time
+		if err := rows.Scan(&ranName, &cellID, &measurement, &unit, &sliceID, &fiveQI, &value, &sampleTime); err != nil {
+			t.Fatal(err)
+		}
+		if !sampleTime.Equal(at) {
+			t.Errorf("got time %v", sampleTime)
+		}
+		got = append(got, strings.Join([]string{ranName, cellID, measurement, unit, sliceID, strconv.FormatInt(fiveQI, 10), strconv.FormatFloat(value, 'g', -1, 64)}, "/"))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"gnb-1/cell-1/RRU.PrbUsedDl/PRB//0/1",
+		"gnb-1/cell-2/RRU.PrbUsedDl/PRB//0/2",
+		"gnb-1/cell-1/DRB.UEThpDl/kbit/s/1-010203/9/3",
+		"gnb-2/cell-1/Vendor.Kpi/ms//0/4",
+		"gnb-1/cell-1/RRU.PrbUsedDl/PRB//0/11",
+		"gnb-1/cell-2/RRU.PrbUsedDl/PRB//0/12",
+		"gnb-1/cell-1/DRB.UEThpDl/kbit/s/1-010203/9/13",
+		"gnb-2/cell-1/Vendor.Kpi/ms//0/14",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got samples\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
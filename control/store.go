@@ -0,0 +1,361 @@
+package control
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// measurement names mapped onto CellMetricsEntry and UeMetricsEntry
+const (
+	measPdcpSduVolumeDL = "DRB.PdcpSduVolumeDL"
+	measPdcpSduVolumeUL = "DRB.PdcpSduVolumeUL"
+	measPrbAvailDL      = "RRU.PrbAvailDl"
+	measPrbAvailUL      = "RRU.PrbAvailUl"
+	measPrbUsedDL       = "RRU.PrbUsedDl"
+	measPrbUsedUL       = "RRU.PrbUsedUl"
+)
+
+const defaultLatestTTL = 900 //seconds without update before a node, cell, slice or UE is removed
+
+type LatestValue struct {
+	Measurement string    `json:"measurement"`
+	Value       float64   `json:"value"`
+	Time        time.Time `json:"time"`
+	PLMNID      string    `json:"plmnId,omitempty"`
+	SliceID     string    `json:"sliceId,omitempty"`
+	FiveQI      int64     `json:"fiveQI,omitempty"`
+	QCI         int64     `json:"qci,omitempty"`
+}
+
+type NodeSummary struct {
+	RanName string    `json:"ranName"`
+	Cells   int       `json:"cells"`
+	Ues     int       `json:"ues"`
+	Updated time.Time `json:"updated"`
+}
+
+type CellSummary struct {
+	CellID  string    `json:"cellId"`
+	Slices  []string  `json:"slices"`
+	Updated time.Time `json:"updated"`
+}
+
+type CellLatest struct {
+	RanName      string           `json:"ranName"`
+	CellID       string           `json:"cellId"`
+	Metrics      CellMetricsEntry `json:"metrics"`
+	Measurements []LatestValue    `json:"measurements"`
+}
+
+type SliceLatest struct {
+	RanName      string        `json:"ranName"`
+	CellID       string        `json:"cellId"`
+	SliceID      string        `json:"sliceId"`
+	Measurements []LatestValue `json:"measurements"`
+}
+
+type UeLatest struct {
+	RanName      string         `json:"ranName"`
+	Metrics      UeMetricsEntry `json:"metrics"`
+	Measurements []LatestValue  `json:"measurements"`
+}
+
+type latestSeries map[string]LatestValue //latest value by measurement and labels
+
+type sliceLatest struct {
+	values latestSeries
+	seen   time.Time //local time of the last update, compared with the TTL
+}
+
+type cellLatest struct {
+	values  latestSeries
+	slices  map[string]*sliceLatest
+	updated time.Time
+	seen    time.Time
+}
+
+type ueLatest struct {
+	cellID  string
+	values  latestSeries
+	updated time.Time
+	seen    time.Time
+}
+
+type nodeLatest struct {
+	cells   map[string]*cellLatest
+	ues     map[string]*ueLatest
+	updated time.Time
+	seen    time.Time
+}
+
+// latestStore keeps the latest value of every KPI per node, cell, slice and UE
+type latestStore struct {
+	mu    sync.RWMutex
+	nodes map[string]*nodeLatest
+	ttl   time.Duration
+}
+
+func newLatestStore() *latestStore {
+	return &latestStore{
+		nodes: make(map[string]*nodeLatest),
+		ttl:   time.Duration(getEnvInt("latestTTL", defaultLatestTTL)) * time.Second,
+	}
+}
+
+func (s *latestStore) update(samples []kpiSample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, sample := range samples {
+		node, ok := s.nodes[sample.RanName]
+		if !ok {
+			node = &nodeLatest{cells: make(map[string]*cellLatest), ues: make(map[string]*ueLatest)}
+			s.nodes[sample.RanName] = node
+		}
+		node.updated = maxTime(node.updated, sample.Time)
+		node.seen = now
+
+		value := LatestValue{
+			Measurement: sample.Measurement,
+			Value:       sample.Value,
+			Time:        sample.Time,
+			PLMNID:      sample.PLMNID,
+			SliceID:     sample.SliceID,
+			FiveQI:      sample.FiveQI,
+			QCI:         sample.QCI,
+		}
+
+		if sample.UeID != "" {
+			ue, ok := node.ues[sample.UeID]
+			if !ok {
+				ue = &ueLatest{values: make(latestSeries)}
+				node.ues[sample.UeID] = ue
+			}
+			ue.cellID = sample.CellID
+			ue.updated = maxTime(ue.updated, sample.Time)
+			ue.seen = now
+			ue.values.set(value)
+			continue
+		}
+
+		cell, ok := node.cells[sample.CellID]
+		if !ok {
+			cell = &cellLatest{values: make(latestSeries), slices: make(map[string]*sliceLatest)}
+			node.cells[sample.CellID] = cell
+		}
+		cell.updated = maxTime(cell.updated, sample.Time)
+		cell.seen = now
+		if sample.SliceID == "" {
+			cell.values.set(value)
+			continue
+		}
+		slice, ok := cell.slices[sample.SliceID]
+		if !ok {
+			slice = &sliceLatest{values: make(latestSeries)}
+			cell.slices[sample.SliceID] = slice
+		}
+		slice.seen = now
+		slice.values.set(value)
+	}
+}
+
+// expire removes the nodes, cells, slices and UEs not updated since cutoff
+func (s *latestStore) expire(cutoff time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ranName, node := range s.nodes {
+		if node.seen.Before(cutoff) {
+			delete(s.nodes, ranName)
+			continue
+		}
+		for cellID, cell := range node.cells {
+			if cell.seen.Before(cutoff) {
+				delete(node.cells, cellID)
+				continue
+			}
+			for sliceID, slice := range cell.slices {
+				if slice.seen.Before(cutoff) {
+					delete(cell.slices, sliceID)
+				}
+			}
+		}
+		for ueID, ue := range node.ues {
+			if ue.seen.Before(cutoff) {
+				delete(node.ues, ueID)
+			}
+		}
+	}
+}
+
+// expireLoop removes the entries that have not been updated within the TTL
+func (s *latestStore) expireLoop() {
+	ticker := time.NewTicker(s.ttl / 2)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.expire(time.Now().Add(-s.ttl))
+	}
+}
+
+func (s *latestStore) listNodes() []NodeSummary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nodes := make([]NodeSummary, 0, len(s.nodes))
+	for ranName, node := range s.nodes {
+		nodes = append(nodes, NodeSummary{RanName: ranName, Cells: len(node.cells), Ues: len(node.ues), Updated: node.updated})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].RanName < nodes[j].RanName })
+	return nodes
+}
+
+func (s *latestStore) listCells(ranName string) ([]CellSummary, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	node, ok := s.nodes[ranName]
+	if !ok {
+		return nil, false
+	}
+	cells := make([]CellSummary, 0, len(node.cells))
+	for cellID, cell := range node.cells {
+		slices := make([]string, 0, len(cell.slices))
+		for sliceID := range cell.slices {
+			slices = append(slices, sliceID)
+		}
+		sort.Strings(slices)
+		cells = append(cells, CellSummary{CellID: cellID, Slices: slices, Updated: cell.updated})
+	}
+	sort.Slice(cells, func(i, j int) bool { return cells[i].CellID < cells[j].CellID })
+	return cells, true
+}
+
+func (s *latestStore) cell(ranName string, cellID string) (*CellLatest, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	node, ok := s.nodes[ranName]
+	if !ok {
+		return nil, false
+	}
+	cell, ok := node.cells[cellID]
+	if !ok {
+		return nil, false
+	}
+
+	latest := &CellLatest{RanName: ranName, CellID: cellID, Measurements: cell.values.list()}
+	if v, ok := cell.values.get(measPdcpSduVolumeDL); ok {
+		latest.Metrics.PDCPBytesDL = int64(v.Value)
+		latest.Metrics.MeasTimestampPDCPBytes = toTimestamp(v.Time)
+	}
+	if v, ok := cell.values.get(measPdcpSduVolumeUL); ok {
+		latest.Metrics.PDCPBytesUL = int64(v.Value)
+		latest.Metrics.MeasTimestampPDCPBytes = toTimestamp(v.Time)
+	}
+	if v, ok := cell.values.get(measPrbAvailDL); ok {
+		latest.Metrics.AvailPRBDL = int64(v.Value)
+		latest.Metrics.MeasTimestampPRB = toTimestamp(v.Time)
+	}
+	if v, ok := cell.values.get(measPrbAvailUL); ok {
+		latest.Metrics.AvailPRBUL = int64(v.Value)
+		latest.Metrics.MeasTimestampPRB = toTimestamp(v.Time)
+	}
+	return latest, true
+}
+
+func (s *latestStore) slice(ranName string, cellID string, sliceID string) (*SliceLatest, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	node, ok := s.nodes[ranName]
+	if !ok {
+		return nil, false
+	}
+	cell, ok := node.cells[cellID]
+	if !ok {
+		return nil, false
+	}
+	slice, ok := cell.slices[sliceID]
+	if !ok {
+		return nil, false
+	}
+	return &SliceLatest{RanName: ranName, CellID: cellID, SliceID: sliceID, Measurements: slice.values.list()}, true
+}
+
+func (s *latestStore) ue(ranName string, ueID string) (*UeLatest, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	node, ok := s.nodes[ranName]
+	if !ok {
+		return nil, false
+	}
+	ue, ok := node.ues[ueID]
+	if !ok {
+		return nil, false
+	}
+
+	latest := &UeLatest{RanName: ranName, Measurements: ue.values.list()}
+	latest.Metrics.UeID = ueID
+	latest.Metrics.ServingCellID = ue.cellID
+	if v, ok := ue.values.get(measPdcpSduVolumeDL); ok {
+		latest.Metrics.PDCPBytesDL = int64(v.Value)
+		latest.Metrics.MeasTimestampPDCPBytes = toTimestamp(v.Time)
+	}
+	if v, ok := ue.values.get(measPdcpSduVolumeUL); ok {
+		latest.Metrics.PDCPBytesUL = int64(v.Value)
+		latest.Metrics.MeasTimestampPDCPBytes = toTimestamp(v.Time)
+	}
+	if v, ok := ue.values.get(measPrbUsedDL); ok {
+		latest.Metrics.PRBUsageDL = int64(v.Value)
+		latest.Metrics.MeasTimestampPRB = toTimestamp(v.Time)
+	}
+	if v, ok := ue.values.get(measPrbUsedUL); ok {
+		latest.Metrics.PRBUsageUL = int64(v.Value)
+		latest.Metrics.MeasTimestampPRB = toTimestamp(v.Time)
+	}
+	return latest, true
+}
+
+func (l latestSeries) set(v LatestValue) {
+	key := joinKey([]string{v.Measurement, v.PLMNID, v.SliceID, strconv.FormatInt(v.FiveQI, 10), strconv.FormatInt(v.QCI, 10)})
+	if old, ok := l[key]; ok && old.Time.After(v.Time) {
+		return
+	}
+	l[key] = v
+}
+
+// get returns the most recent value of a measurement over all its labels
+func (l latestSeries) get(measurement string) (latest LatestValue, found bool) {
+	for _, v := range l {
+		if v.Measurement == measurement && (!found || v.Time.After(latest.Time)) {
+			latest = v
+			found = true
+		}
+	}
+	return
+}
+
+func (l latestSeries) list() []LatestValue {
+	values := make([]LatestValue, 0, len(l))
+	for _, v := range l {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Measurement < values[j].Measurement })
+	return values
+}
+
+func toTimestamp(t time.Time) Timestamp {
+	return Timestamp{TVsec: t.Unix(), TVnsec: int64(t.Nanosecond())}
+}
+
+func maxTime(a time.Time, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
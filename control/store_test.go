@@ -0,0 +1,36 @@
+package control
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatestStoreExpire(t *testing.T) {
+	s := newLatestStore()
+	at := time.Unix(1600000000, 0)
+	s.update([]kpiSample{
+		{RanName: "gnb-1", CellID: "cell-1", Measurement: measPrbAvailDL, Value: 100, Time: at},
+		{RanName: "gnb-1", CellID: "cell-2", SliceID: "1-010203", Measurement: measPrbUsedDL, Value: 10, Time: at},
+		{RanName: "gnb-1", CellID: "cell-1", UeID: "17", Measurement: measPrbUsedDL, Value: 5, Time: at},
+		{RanName: "gnb-2", CellID: "cell-1", Measurement: measPrbAvailDL, Value: 100, Time: at},
+	})
+	cutoff := time.Now()
+	s.update([]kpiSample{{RanName: "gnb-1", CellID: "cell-1", Measurement: measPrbAvailDL, Value: 90, Time: at.Add(time.Second)}})
+
+	s.expire(cutoff)
+	nodes := s.listNodes()
+	if len(nodes) != 1 || nodes[0].RanName != "gnb-1" || nodes[0].Cells != 1 || nodes[0].Ues != 0 {
+		t.Errorf("got nodes %+v", nodes)
+	}
+	if cell, ok := s.cell("gnb-1", "cell-1"); !ok || cell.Metrics.AvailPRBDL != 90 {
+		t.Errorf("got cell %+v", cell)
+	}
+	if _, ok := s.slice("gnb-1", "cell-2", "1-010203"); ok {
+		t.Error("slice of an expired cell kept")
+	}
+
+	s.expire(time.Now().Add(time.Second))
+	if nodes = s.listNodes(); len(nodes) != 0 {
+		t.Errorf("got nodes %+v after expiring everything", nodes)
+	}
+}
@@ -0,0 +1,348 @@
+package control
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+const (
+	defaultStreamClientBuffer = 64
+	defaultStreamMaxClients   = 16
+	streamHeartbeat           = 15 * time.Second
+)
+
+type StreamHeader struct {
+	GlobalKPMnodeIDType int32  `json:"globalKPMnodeIdType"`
+	PlmnID              string `json:"plmnId,omitempty"`
+	NodeID              string `json:"nodeId,omitempty"`
+	ColletStartTime     string `json:"colletStartTime,omitempty"`
+	FileFormatVersion   string `json:"fileFormatVersion,omitempty"`
+	SenderName          string `json:"senderName,omitempty"`
+	SenderType          string `json:"senderType,omitempty"`
+	VendorName          string `json:"vendorName,omitempty"`
+}
+
+type StreamMeasInfo struct {
+	Measurement string   `json:"measurement"`
+	Labels      int      `json:"labels"`
+	MatchedUes  []string `json:"matchedUes,omitempty"`
+}
+
+type StreamRecord struct {
+	Measurement string    `json:"measurement"`
+	Unit        string    `json:"unit,omitempty"`
+	Value       float64   `json:"value"`
+	Time        time.Time `json:"time"`
+	CellID      string    `json:"cellId,omitempty"`
+	UeID        string    `json:"ueId,omitempty"`
+	PLMNID      string    `json:"plmnId,omitempty"`
+	SliceID     string    `json:"sliceId,omitempty"`
+	FiveQI      int64     `json:"fiveQI,omitempty"`
+	QCI         int64     `json:"qci,omitempty"`
+	NodeID      string    `json:"nodeId,omitempty"`
+	DUID        string    `json:"duId,omitempty"`
+	CUUPID      string    `json:"cuUpId,omitempty"`
+}
+
+// StreamEvent is the JSON pushed to stream clients for every decoded indication
+type StreamEvent struct {
+	RanName      string           `json:"ranName"`
+	Received     time.Time        `json:"received"`
+	RequestID    int32            `json:"requestId"`
+	FuncID       int32            `json:"functionId"`
+	ActionID     int32            `json:"actionId"`
+	IndSN        int32            `json:"indicationSN"`
+	Format       int32            `json:"format"`
+	CellObjID    string           `json:"cellObjId,omitempty"`
+	GranulPeriod int64            `json:"granulPeriod"`
+	Header       StreamHeader     `json:"header"`
+	MeasInfo     []StreamMeasInfo `json:"measInfo"`
+	Records      []StreamRecord   `json:"records"`
+}
+
+type streamFilter struct {
+	RanName     string
+	CellID      string
+	Measurement string
+	UeID        string
+}
+
+type streamClient struct {
+	filter streamFilter
+	events chan []byte
+	done   chan struct{} //closed when the client is disconnected for being too slow
+}
+
+// streamHub fans decoded indications out to the connected stream clients. It
+// never blocks the caller: a client whose buffer is full is disconnected.
+type streamHub struct {
+	mu           sync.Mutex
+	clients      map[*streamClient]struct{}
+	clientBuffer int
+	maxClients   int
+}
+
+func newStreamHub() *streamHub {
+	return &streamHub{
+		clients:      make(map[*streamClient]struct{}),
+		clientBuffer: getEnvInt("streamClientBuffer", defaultStreamClientBuffer),
+		maxClients:   getEnvInt("streamMaxClients", defaultStreamMaxClients),
+	}
+}
+
+func (h *streamHub) subscribe(filter streamFilter) (*streamClient, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.clients) >= h.maxClients {
+		return nil, errors.New("too many stream clients")
+	}
+	client := &streamClient{filter: filter, events: make(chan []byte, h.clientBuffer), done: make(chan struct{})}
+	h.clients[client] = struct{}{}
+	return client, nil
+}
+
+func (h *streamHub) unsubscribe(client *streamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.clients, client)
+}
+
+func (h *streamHub) publish(ind *indication) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.clients) == 0 {
+		return
+	}
+
+	event := newStreamEvent(ind)
+	for client := range h.clients {
+		filtered, ok := client.filter.apply(event)
+		if !ok {
+			continue
+		}
+		data, err := json.Marshal(filtered)
+		if err != nil {
+			xapp.Logger.Error("Failed to encode stream event: %v", err)
+			log.Printf("Failed to encode stream event: %v", err)
+			continue
+		}
+		select {
+		case client.events <- data:
+		default:
+			xapp.Logger.Warn("Stream client is too slow and is disconnected")
+			log.Printf("Stream client is too slow and is disconnected")
+			delete(h.clients, client)
+			close(client.done)
+		}
+	}
+}
+
+// serve writes the events of a client as server-sent events until the client
+// goes away or is disconnected by the hub
+func (h *streamHub) serve(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	query := r.URL.Query()
+	client, err := h.subscribe(streamFilter{
+		RanName:     query.Get("node"),
+		CellID:      query.Get("cell"),
+		Measurement: query.Get("measurement"),
+		UeID:        query.Get("ue"),
+	})
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	defer h.unsubscribe(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case data := <-client.events:
+			if _, err := w.Write([]byte("event: indication\ndata: " + string(data) + "\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := w.Write([]byte(": heartbeat\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-client.done:
+			w.Write([]byte("event: disconnect\ndata: {\"reason\":\"client too slow\"}\n\n"))
+			flusher.Flush()
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func newStreamEvent(ind *indication) *StreamEvent {
+	event := &StreamEvent{
+		RanName:   ind.RanName,
+		Received:  ind.Received,
+		RequestID: ind.Msg.RequestID,
+		FuncID:    ind.Msg.FuncID,
+		ActionID:  ind.Msg.ActionID,
+		IndSN:     ind.Msg.IndSN,
+		Format:    ind.Message.IndMsgType,
+		MeasInfo:  []StreamMeasInfo{},
+		Records:   []StreamRecord{},
+	}
+
+	if hdr, ok := ind.Header.IndHdr.(*IndicationHeaderFormat1); ok {
+		event.Header = newStreamHeader(hdr)
+	}
+
+	switch msg := ind.Message.IndMsg.(type) {
+	case *IndicationMessageFormat1:
+		event.GranulPeriod = msg.GranulPeriod
+		if msg.CellObjID != nil {
+			event.CellObjID = string(msg.CellObjID.Buf)
+		}
+		for _, info := range msg.MeasInfoList {
+			event.MeasInfo = append(event.MeasInfo, StreamMeasInfo{Measurement: measurementName(info.Measurement), Labels: len(info.LabelInfoList)})
+		}
+	case *IndicationMessageFormat2:
+		event.GranulPeriod = msg.GranulPeriod
+		if msg.CellObjID != nil {
+			event.CellObjID = string(msg.CellObjID.Buf)
+		}
+		for _, info := range msg.MeasInfoUeidList {
+			measInfo := StreamMeasInfo{Measurement: measurementName(info.Measurement), Labels: len(info.MatchingCondList)}
+			for _, ueID := range info.MatchedUeidList {
+				measInfo.MatchedUes = append(measInfo.MatchedUes, hex.EncodeToString(ueID.Buf))
+			}
+			event.MeasInfo = append(event.MeasInfo, measInfo)
+		}
+	}
+
+	for _, s := range ind.Samples {
+		event.Records = append(event.Records, StreamRecord{
+			Measurement: s.Measurement,
+			Unit:        s.Unit,
+			Value:       s.Value,
+			Time:        s.Time,
+			CellID:      s.CellID,
+			UeID:        s.UeID,
+			PLMNID:      s.PLMNID,
+			SliceID:     s.SliceID,
+			FiveQI:      s.FiveQI,
+			QCI:         s.QCI,
+			NodeID:      s.NodeID,
+			DUID:        s.DUID,
+			CUUPID:      s.CUUPID,
+		})
+	}
+	return event
+}
+
+func newStreamHeader(hdr *IndicationHeaderFormat1) StreamHeader {
+	header := StreamHeader{GlobalKPMnodeIDType: hdr.GlobalKPMnodeIDType}
+
+	var plmnID *OctetString
+	switch id := hdr.GlobalKPMnodeID.(type) {
+	case *GlobalKPMnodegNBIDType:
+		plmnID = &id.GlobalgNBID.PlmnID
+	case *GlobalKPMnodeengNBIDType:
+		plmnID = &id.PlmnID
+	case *GlobalKPMnodengeNBIDType:
+		plmnID = &id.PlmnID
+	case *GlobalKPMnodeeNBIDType:
+		plmnID = &id.PlmnID
+	}
+	header.PlmnID = plmnString(plmnID)
+	header.NodeID = nodeIDString(hdr.GlobalKPMnodeIDType, hdr.GlobalKPMnodeID)
+
+	if hdr.ColletStartTime != nil {
+		header.ColletStartTime = hex.EncodeToString(hdr.ColletStartTime.Buf)
+	}
+	if hdr.FileFormatVersion != nil {
+		header.FileFormatVersion = string(hdr.FileFormatVersion.Buf)
+	}
+	if hdr.SenderName != nil {
+		header.SenderName = string(hdr.SenderName.Buf)
+	}
+	if hdr.SenderType != nil {
+		header.SenderType = string(hdr.SenderType.Buf)
+	}
+	if hdr.VendorName != nil {
+		header.VendorName = string(hdr.VendorName.Buf)
+	}
+	return header
+}
+
+// nodeIDBits returns the bit string of any of the gNB, en-gNB, ng-eNB and eNB
+// ID choices
+func nodeIDBits(nodeID interface{}) *BitString {
+	switch id := nodeID.(type) {
+	case *GNBID:
+		return (*BitString)(id)
+	case *ENGNBID:
+		return (*BitString)(id)
+	case *NGENBID_Macro:
+		return (*BitString)(id)
+	case *NGENBID_ShortMacro:
+		return (*BitString)(id)
+	case *NGENBID_LongMacro:
+		return (*BitString)(id)
+	case *ENBID_Macro:
+		return (*BitString)(id)
+	case *ENBID_Home:
+		return (*BitString)(id)
+	case *ENBID_ShortMacro:
+		return (*BitString)(id)
+	case *ENBID_LongMacro:
+		return (*BitString)(id)
+	}
+	return nil
+}
+
+// apply returns the event reduced to the records selected by the filter, ok
+// is false when the event does not match at all
+func (f streamFilter) apply(event *StreamEvent) (*StreamEvent, bool) {
+	if f.RanName != "" && f.RanName != event.RanName {
+		return nil, false
+	}
+	if f.CellID != "" && f.CellID != event.CellObjID {
+		return nil, false
+	}
+	if f.Measurement == "" && f.UeID == "" {
+		return event, true
+	}
+
+	filtered := *event
+	filtered.Records = []StreamRecord{}
+	for _, record := range event.Records {
+		if (f.Measurement == "" || f.Measurement == record.Measurement) && (f.UeID == "" || f.UeID == record.UeID) {
+			filtered.Records = append(filtered.Records, record)
+		}
+	}
+	if len(filtered.Records) == 0 {
+		return nil, false
+	}
+	return &filtered, true
+}
@@ -0,0 +1,94 @@
+package control
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestStreamFilter(t *testing.T) {
+	at := time.Unix(1600000000, 0)
+	event := &StreamEvent{RanName: "gnb-1", CellObjID: "cell-1", Records: []StreamRecord{
+		{Measurement: "RRU.PrbUsedDl", CellID: "cell-1", Time: at},
+		{Measurement: "DRB.UEThpDl", CellID: "cell-1", UeID: "17", Time: at},
+		{Measurement: "DRB.UEThpDl", CellID: "cell-1", UeID: "18", Time: at},
+	}}
+
+	for _, c := range []struct {
+		filter  streamFilter
+		records int //-1 when the event is filtered out
+	}{
+		{streamFilter{}, 3},
+		{streamFilter{RanName: "gnb-1", CellID: "cell-1"}, 3},
+		{streamFilter{RanName: "gnb-2"}, -1},
+		{streamFilter{CellID: "cell-2"}, -1},
+		{streamFilter{Measurement: "DRB.UEThpDl"}, 2},
+		{streamFilter{UeID: "17"}, 1},
+		{streamFilter{Measurement: "RRU.PrbUsedDl", UeID: "17"}, -1},
+		{streamFilter{Measurement: "RRC.ConnMean"}, -1},
+	} {
+		filtered, ok := c.filter.apply(event)
+		if !ok {
+			if c.records != -1 {
+				t.Errorf("filter %+v dropped the event", c.filter)
+			}
+			continue
+		}
+		if c.records == -1 || len(filtered.Records) != c.records {
+			t.Errorf("filter %+v kept %d records, want %d", c.filter, len(filtered.Records), c.records)
+		}
+	}
+	if len(event.Records) != 3 {
+		t.Errorf("the filters changed the event, got %d records", len(event.Records))
+	}
+}
+
+func TestStreamHubSlowClient(t *testing.T) {
+	h := &streamHub{clients: make(map[*streamClient]struct{}), clientBuffer: 2, maxClients: 2}
+	slow, err := h.subscribe(streamFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, err := h.subscribe(streamFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := h.subscribe(streamFilter{RanName: "gnb-2"})
+	if err == nil || other != nil {
+		t.Fatal("client beyond the limit accepted")
+	}
+
+	ind := testIndication()
+	ind.Message = format1Message()
+	for i := 0; i < 3; i++ {
+		h.publish(ind)
+		select {
+		case data := <-fast.events:
+			var event StreamEvent
+			if err := json.Unmarshal(data, &event); err != nil || event.RanName != "gnb-1" || event.CellObjID != "cell-1" {
+				t.Fatalf("got event %s, %v", data, err)
+			}
+		default:
+			t.Fatalf("event %d not sent to the fast client", i)
+		}
+	}
+
+	select {
+	case <-slow.done:
+	default:
+		t.Fatal("slow client not disconnected")
+	}
+	if _, ok := h.clients[slow]; ok || len(h.clients) != 1 || len(slow.events) != 2 {
+		t.Errorf("got %d clients, %d buffered events of the slow one", len(h.clients), len(slow.events))
+	}
+
+	// another publish leaves the disconnected client alone
+	h.publish(ind)
+	if len(h.clients) != 1 || len(fast.events) != 1 {
+		t.Errorf("got %d clients, %d events of the fast one", len(h.clients), len(fast.events))
+	}
+	h.unsubscribe(fast)
+	if _, err := h.subscribe(streamFilter{}); err != nil {
+		t.Errorf("got %v after the clients left", err)
+	}
+}
@@ -0,0 +1,81 @@
+package control
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	subStateRequested = "requested"
+	subStateActive    = "active"
+	subStateFailed    = "failed"
+	subStateExpired   = "expired"
+	subStateDeleting  = "deleting"
+	subStateDeleted   = "deleted"
+)
+
+type SubscriptionState struct {
+	RanName   string    `json:"ranName"`
+	SubID     int       `json:"subId"`
+	RequestSN int       `json:"requestSequenceNumber"`
+	FuncID    int       `json:"functionId"`
+	State     string    `json:"state"`
+	Updated   time.Time `json:"updated"`
+}
+
+// subscriptionRegistry keeps the state of the RIC subscription of every E2 node
+type subscriptionRegistry struct {
+	mu       sync.Mutex
+	subs     map[string]*SubscriptionState
+	onChange func(ranName string, oldState string, newState string)
+}
+
+func newSubscriptionRegistry() *subscriptionRegistry {
+	return &subscriptionRegistry{subs: make(map[string]*SubscriptionState)}
+}
+
+func (r *subscriptionRegistry) requested(ranName string, subID int, requestSN int, funcID int) {
+	r.mu.Lock()
+	sub, ok := r.subs[ranName]
+	if !ok {
+		sub = &SubscriptionState{RanName: ranName}
+		r.subs[ranName] = sub
+	}
+	sub.SubID = subID
+	sub.RequestSN = requestSN
+	sub.FuncID = funcID
+	r.mu.Unlock()
+
+	r.setState(ranName, subStateRequested)
+}
+
+// setState moves the subscription of a node to a new state, nodes without a
+// known subscription are ignored
+func (r *subscriptionRegistry) setState(ranName string, state string) {
+	r.mu.Lock()
+	sub, ok := r.subs[ranName]
+	if !ok {
+		r.mu.Unlock()
+		return
+	}
+	oldState := sub.State
+	sub.State = state
+	sub.Updated = time.Now()
+	onChange := r.onChange
+	r.mu.Unlock()
+
+	if onChange != nil && oldState != state {
+		onChange(ranName, oldState, state)
+	}
+}
+
+func (r *subscriptionRegistry) list() []SubscriptionState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subs := make([]SubscriptionState, 0, len(r.subs))
+	for _, sub := range r.subs {
+		subs = append(subs, *sub)
+	}
+	return subs
+}
@@ -0,0 +1,174 @@
+package control
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	ntpUnixOffset             = 2208988800 //seconds from the NTP epoch 1900 to the unix epoch 1970
+	defaultClockSkewThreshold = 5          //seconds
+	clockSkewSmoothing        = 0.1        //weight of a new observation in the mean skew
+)
+
+type ClockSkew struct {
+	RanName     string    `json:"ranName"`
+	Skew        float64   `json:"skewSeconds"`     //last observed skew
+	MeanSkew    float64   `json:"meanSkewSeconds"` //exponentially weighted mean of the skew
+	MaxSkew     float64   `json:"maxSkewSeconds"`  //largest absolute skew observed
+	Exceeded    uint64    `json:"exceeded"`        //observations beyond the threshold
+	Samples     uint64    `json:"samples"`
+	OutOfBounds bool      `json:"outOfBounds"`
+	Updated     time.Time `json:"updated"`
+}
+
+// clockSkewTracker compares the end of the collection period reported by a
+// node with the time the indication is received. A positive skew is the
+// reporting delay plus a node clock running behind, a negative skew means the
+// node clock runs ahead of the RIC.
+type clockSkewTracker struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	nodes     map[string]*ClockSkew
+}
+
+func newClockSkewTracker() *clockSkewTracker {
+	return &clockSkewTracker{
+		threshold: time.Duration(getEnvInt("clockSkewThreshold", defaultClockSkewThreshold)) * time.Second,
+		nodes:     make(map[string]*ClockSkew),
+	}
+}
+
+// observe records the skew of an indication, exceeded is true when it is
+// beyond the threshold
+func (t *clockSkewTracker) observe(ranName string, end time.Time, received time.Time) (skew time.Duration, exceeded bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	skew = received.Sub(end)
+	exceeded = skew > t.threshold || skew < -t.threshold
+
+	node, ok := t.nodes[ranName]
+	if !ok {
+		node = &ClockSkew{RanName: ranName, MeanSkew: skew.Seconds()}
+		t.nodes[ranName] = node
+	}
+	node.Skew = skew.Seconds()
+	node.MeanSkew += clockSkewSmoothing * (node.Skew - node.MeanSkew)
+	node.MaxSkew = math.Max(node.MaxSkew, math.Abs(node.Skew))
+	node.Samples++
+	if exceeded {
+		node.Exceeded++
+	}
+	node.OutOfBounds = exceeded
+	node.Updated = received
+	return
+}
+
+func (t *clockSkewTracker) list() []ClockSkew {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	nodes := make([]ClockSkew, 0, len(t.nodes))
+	for _, node := range t.nodes {
+		nodes = append(nodes, *node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].RanName < nodes[j].RanName })
+	return nodes
+}
+
+// ntpTime converts a KPM TimeStamp, the 4 octet NTP seconds optionally
+// followed by the 4 octet fraction, into a time. Nodes that put unix seconds
+// into the TimeStamp are recognised by a value before the unix epoch.
+func ntpTime(buf []byte) (time.Time, error) {
+	if len(buf) != 4 && len(buf) != 8 {
+		return time.Time{}, errors.New("Invalid input: illegal length of TimeStamp")
+	}
+
+	var sec, frac uint64
+	for _, b := range buf[:4] {
+		sec = sec<<8 | uint64(b)
+	}
+	for _, b := range buf[4:] {
+		frac = frac<<8 | uint64(b)
+	}
+
+	if sec >= ntpUnixOffset {
+		sec -= ntpUnixOffset
+	}
+	return time.Unix(int64(sec), int64(frac*1e9>>32)).UTC(), nil
+}
+
+// collectionPeriod returns the collection start time of an indication and the
+// granularity period of its measurements, ok is false when the header has no
+// usable start time
+func collectionPeriod(ind *indication) (start time.Time, granul time.Duration, ok bool) {
+	hdr, isFormat1 := ind.Header.IndHdr.(*IndicationHeaderFormat1)
+	if !isFormat1 || hdr.ColletStartTime == nil {
+		return
+	}
+	start, err := ntpTime(octets(*hdr.ColletStartTime))
+	if err != nil {
+		return
+	}
+
+	switch msg := ind.Message.IndMsg.(type) {
+	case *IndicationMessageFormat1:
+		granul = time.Duration(msg.GranulPeriod) * time.Millisecond
+	case *IndicationMessageFormat2:
+		granul = time.Duration(msg.GranulPeriod) * time.Millisecond
+	}
+	return start, granul, true
+}
+
+// measDataCount returns the number of granularity periods an indication reports
+func measDataCount(ind *indication) int {
+	switch msg := ind.Message.IndMsg.(type) {
+	case *IndicationMessageFormat1:
+		return len(msg.MeasData)
+	case *IndicationMessageFormat2:
+		return len(msg.MeasData)
+	}
+	return 0
+}
+
+// samplePeriod is the samples of an indication measured in one granularity
+// period
+type samplePeriod struct {
+	start   time.Time
+	samples []kpiSample
+}
+
+// samplePeriods groups the samples of an indication by their time, in time
+// order. Samples without a time belong to the period of the indication time.
+func samplePeriods(ind *indication) []samplePeriod {
+	var periods []samplePeriod
+	index := make(map[int64]int)
+	for _, sample := range ind.Samples {
+		at := sample.Time
+		if at.IsZero() {
+			at = indicationTime(ind)
+		}
+		i, ok := index[at.UnixNano()]
+		if !ok {
+			i = len(periods)
+			index[at.UnixNano()] = i
+			periods = append(periods, samplePeriod{start: at})
+		}
+		periods[i].samples = append(periods[i].samples, sample)
+	}
+	sort.Slice(periods, func(i, j int) bool { return periods[i].start.Before(periods[j].start) })
+	return periods
+}
+
+// indicationTime is the collection start time of an indication, or the time
+// it was received when the node did not report one
+func indicationTime(ind *indication) time.Time {
+	if ind.Start.IsZero() {
+		return ind.Received
+	}
+	return ind.Start
+}
@@ -0,0 +1,61 @@
+package control
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNtpTime(t *testing.T) {
+	at := time.Unix(1600000000, 0).UTC()
+	for _, c := range []struct {
+		name string
+		buf  []byte
+		want time.Time
+		err  bool
+	}{
+		{"4 octet NTP seconds", []byte{0xe3, 0x08, 0x8e, 0x80}, at, false},
+		{"8 octet NTP with fraction", []byte{0xe3, 0x08, 0x8e, 0x80, 0x80, 0, 0, 0}, at.Add(500 * time.Millisecond), false},
+		{"smallest fraction", []byte{0xe3, 0x08, 0x8e, 0x80, 0, 0, 0, 1}, at, false},
+		{"largest fraction", []byte{0xe3, 0x08, 0x8e, 0x80, 0xff, 0xff, 0xff, 0xff}, at.Add(999999999 * time.Nanosecond), false},
+		{"NTP epoch of the unix epoch", []byte{0x83, 0xaa, 0x7e, 0x80}, time.Unix(0, 0).UTC(), false},
+		{"unix seconds", []byte{0x5f, 0x5e, 0x10, 0x00}, at, false},
+		{"unix seconds with fraction", []byte{0x5f, 0x5e, 0x10, 0x00, 0x40, 0, 0, 0}, at.Add(250 * time.Millisecond), false},
+		{"empty", nil, time.Time{}, true},
+		{"2 octets", []byte{0xe3, 0x08}, time.Time{}, true},
+		{"6 octets", []byte{0xe3, 0x08, 0x8e, 0x80, 0, 0}, time.Time{}, true},
+		{"9 octets", make([]byte, 9), time.Time{}, true},
+	} {
+		got, err := ntpTime(c.buf)
+		if (err != nil) != c.err || !got.Equal(c.want) {
+			t.Errorf("%s: got %v, %v, want %v", c.name, got, err, c.want)
+		}
+	}
+}
+
+func TestCollectionPeriod(t *testing.T) {
+	start := time.Unix(1600000000, 0).UTC()
+	ntp := &OctetString{Buf: []byte{0xe3, 0x08, 0x8e, 0x80}, Size: 4}
+	header := func(collectStart *OctetString) *IndicationHeader {
+		return &IndicationHeader{IndHdrType: 1, IndHdr: &IndicationHeaderFormat1{ColletStartTime: collectStart}}
+	}
+
+	for _, c := range []struct {
+		name    string
+		header  *IndicationHeader
+		message *IndicationMessage
+		granul  time.Duration
+		ok      bool
+	}{
+		{"format 1 message", header(ntp), format1Message(), 100 * time.Millisecond, true},
+		{"format 2 message", header(ntp), format2Message(), 100 * time.Millisecond, true},
+		{"unknown message", header(ntp), &IndicationMessage{}, 0, true},
+		{"no start time", header(nil), format1Message(), 0, false},
+		{"invalid start time", header(&OctetString{Buf: []byte{1, 2, 3}, Size: 3}), format1Message(), 0, false},
+		{"unknown header", &IndicationHeader{}, format1Message(), 0, false},
+	} {
+		got, granul, ok := collectionPeriod(&indication{Header: c.header, Message: c.message})
+		if ok != c.ok || granul != c.granul || (ok && !got.Equal(start)) {
+			t.Errorf("%s: got %v, %v, %v", c.name, got, granul, ok)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package control
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	componentDU   = "du"
+	componentCUUP = "cu-up"
+)
+
+type TopologyCell struct {
+	CellID     string    `json:"cellId"`
+	PLMNs      []string  `json:"plmns"`
+	Slices     []string  `json:"slices"`
+	Components []string  `json:"components"`
+	Updated    time.Time `json:"updated"`
+}
+
+type TopologyComponent struct {
+	Type    string    `json:"type"`
+	ID      string    `json:"id,omitempty"`
+	Cells   []string  `json:"cells"`
+	PLMNs   []string  `json:"plmns"`
+	Slices  []string  `json:"slices"`
+	Updated time.Time `json:"updated"`
+}
+
+type TopologyNode struct {
+	RanName    string              `json:"ranName"`
+	NodeID     string              `json:"nodeId,omitempty"`
+	NodeType   string              `json:"nodeType,omitempty"`
+	PLMN       string              `json:"plmn,omitempty"`
+	SenderName string              `json:"senderName,omitempty"`
+	VendorName string              `json:"vendorName,omitempty"`
+	Components []TopologyComponent `json:"components"`
+	Cells      []TopologyCell      `json:"cells"`
+	Updated    time.Time           `json:"updated"`
+}
+
+// nodeHierarchy places a KPI in the topology of the node that reported it
+type nodeHierarchy struct {
+	NodeID string
+	DUID   string
+	CUUPID string
+}
+
+type stringSet map[string]struct{}
+
+type topoCell struct {
+	plmns      stringSet
+	slices     stringSet
+	components stringSet //keys of the components serving the cell
+	updated    time.Time
+}
+
+type topoComponent struct {
+	kind    string
+	id      string
+	cells   stringSet
+	plmns   stringSet
+	slices  stringSet
+	updated time.Time
+}
+
+type topoNode struct {
+	nodeID     string
+	nodeType   string
+	plmn       string
+	senderName string
+	vendorName string
+	components map[string]*topoComponent
+	cells      map[string]*topoCell
+	updated    time.Time
+}
+
+// topology is the model of the E2 nodes learned from the indications: the
+// global node ID and names of the header, the DU and CU-UP components it
+// identifies and the cells, PLMNs and slices of the measurement labels. The
+// KPM v2 header carries neither the cell nor the component names, and the
+// indication messages carry no PF containers, so CU-CP components and the
+// names of components are not learned.
+type topology struct {
+	mu    sync.RWMutex
+	nodes map[string]*topoNode
+}
+
+func newTopology() *topology {
+	return &topology{nodes: make(map[string]*topoNode)}
+}
+
+// learn updates the model from the header and the samples of an indication
+// and returns the hierarchy of the reporting node
+func (t *topology) learn(ind *indication) (h nodeHierarchy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	node := t.node(ind.RanName)
+	node.updated = maxTime(node.updated, ind.Received)
+
+	var reporters []*topoComponent
+	if hdr, ok := ind.Header.IndHdr.(*IndicationHeaderFormat1); ok {
+		if id, err := DecodeGlobalKPMnodeID(hdr.GlobalKPMnodeIDType, hdr.GlobalKPMnodeID); err == nil {
+			node.nodeID = id.String()
+			node.nodeType = id.Type
+			node.plmn = id.PLMN.String()
+		}
+		if hdr.SenderName != nil {
+			node.senderName = string(hdr.SenderName.Buf)
+		}
+		if hdr.VendorName != nil {
+			node.vendorName = string(hdr.VendorName.Buf)
+		}
+
+		if gnb, ok := hdr.GlobalKPMnodeID.(*GlobalKPMnodegNBIDType); ok {
+			if gnb.GnbDUID != nil {
+				h.DUID = integerString(gnb.GnbDUID)
+				reporters = append(reporters, node.component(componentDU, h.DUID))
+			}
+			if gnb.GnbCUUPID != nil {
+				h.CUUPID = integerString(gnb.GnbCUUPID)
+				reporters = append(reporters, node.component(componentCUUP, h.CUUPID))
+			}
+		}
+	}
+	for _, comp := range reporters {
+		comp.updated = maxTime(comp.updated, ind.Received)
+	}
+
+	for _, sample := range ind.Samples {
+		if sample.CellID != "" {
+			node.serve(reporters, sample.CellID, sample.PLMNID, sample.SliceID, sample.Time)
+		}
+	}
+
+	h.NodeID = node.nodeID
+	return
+}
+
+// enrich sets the node hierarchy of samples, a cell that is not attributed by
+// the header takes the DU and CU-UP known to serve it
+func (t *topology) enrich(h nodeHierarchy, samples []kpiSample) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for i := range samples {
+		sample := &samples[i]
+		sample.NodeID, sample.DUID, sample.CUUPID = h.NodeID, h.DUID, h.CUUPID
+		node, ok := t.nodes[sample.RanName]
+		if !ok {
+			continue
+		}
+		cell, ok := node.cells[sample.CellID]
+		if !ok {
+			continue
+		}
+		for key := range cell.components {
+			comp := node.components[key]
+			if comp.kind == componentDU && sample.DUID == "" {
+				sample.DUID = comp.id
+			} else if comp.kind == componentCUUP && sample.CUUPID == "" {
+				sample.CUUPID = comp.id
+			}
+		}
+	}
+}
+
+func (t *topology) list() []TopologyNode {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	nodes := make([]TopologyNode, 0, len(t.nodes))
+	for ranName, node := range t.nodes {
+		nodes = append(nodes, node.export(ranName))
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].RanName < nodes[j].RanName })
+	return nodes
+}
+
+func (t *topology) get(ranName string) (*TopologyNode, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	node, ok := t.nodes[ranName]
+	if !ok {
+		return nil, false
+	}
+	exported := node.export(ranName)
+	return &exported, true
+}
+
+func (t *topology) node(ranName string) *topoNode {
+	node, ok := t.nodes[ranName]
+	if !ok {
+		node = &topoNode{components: make(map[string]*topoComponent), cells: make(map[string]*topoCell)}
+		t.nodes[ranName] = node
+	}
+	return node
+}
+
+func (n *topoNode) component(kind string, id string) *topoComponent {
+	key := kind + "/" + id
+	comp, ok := n.components[key]
+	if !ok {
+		comp = &topoComponent{kind: kind, id: id, cells: make(stringSet), plmns: make(stringSet), slices: make(stringSet)}
+		n.components[key] = comp
+	}
+	return comp
+}
+
+// serve records that a cell serves a PLMN and slice through the components
+func (n *topoNode) serve(components []*topoComponent, cellID string, plmn string, slice string, updated time.Time) {
+	cell, ok := n.cells[cellID]
+	if !ok {
+		cell = &topoCell{plmns: make(stringSet), slices: make(stringSet), components: make(stringSet)}
+		n.cells[cellID] = cell
+	}
+	cell.updated = maxTime(cell.updated, updated)
+	cell.plmns.add(plmn)
+	cell.slices.add(slice)
+
+	for _, comp := range components {
+		cell.components.add(comp.kind + "/" + comp.id)
+		comp.cells.add(cellID)
+		comp.plmns.add(plmn)
+		comp.slices.add(slice)
+	}
+}
+
+func (n *topoNode) export(ranName string) TopologyNode {
+	node := TopologyNode{
+		RanName:    ranName,
+		NodeID:     n.nodeID,
+		NodeType:   n.nodeType,
+		PLMN:       n.plmn,
+		SenderName: n.senderName,
+		VendorName: n.vendorName,
+		Components: make([]TopologyComponent, 0, len(n.components)),
+		Cells:      make([]TopologyCell, 0, len(n.cells)),
+		Updated:    n.updated,
+	}
+	for _, comp := range n.components {
+		node.Components = append(node.Components, TopologyComponent{
+			Type:    comp.kind,
+			ID:      comp.id,
+			Cells:   comp.cells.list(),
+			PLMNs:   comp.plmns.list(),
+			Slices:  comp.slices.list(),
+			Updated: comp.updated,
+		})
+	}
+	sort.Slice(node.Components, func(i, j int) bool {
+		if node.Components[i].Type != node.Components[j].Type {
+			return node.Components[i].Type < node.Components[j].Type
+		}
+		return node.Components[i].ID < node.Components[j].ID
+	})
+	for cellID, cell := range n.cells {
+		node.Cells = append(node.Cells, TopologyCell{
+			CellID:     cellID,
+			PLMNs:      cell.plmns.list(),
+			Slices:     cell.slices.list(),
+			Components: cell.components.list(),
+			Updated:    cell.updated,
+		})
+	}
+	sort.Slice(node.Cells, func(i, j int) bool { return node.Cells[i].CellID < node.Cells[j].CellID })
+	return node
+}
+
+// add ignores empty strings
+func (s stringSet) add(str string) {
+	if str != "" {
+		s[str] = struct{}{}
+	}
+}
+
+func (s stringSet) list() []string {
+	list := make([]string, 0, len(s))
+	for str := range s {
+		list = append(list, str)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// integerString returns the decimal form of a big endian INTEGER
+func integerString(i *Integer) string {
+	var value uint64
+	for _, b := range i.Buf {
+		value = value<<8 | uint64(b)
+	}
+	return strconv.FormatUint(value, 10)
+}
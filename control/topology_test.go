@@ -0,0 +1,95 @@
+package control
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTopologyLearn(t *testing.T) {
+	topo := newTopology()
+	at := time.Unix(1600000000, 0)
+	header := gnbNodeHeader(0, nil)
+	hdr := header.IndHdr.(*IndicationHeaderFormat1)
+	nodeID, err := DecodeGlobalKPMnodeID(hdr.GlobalKPMnodeIDType, hdr.GlobalKPMnodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := topo.learn(&indication{RanName: "gnb-1", Received: at, Header: header, Samples: []kpiSample{
+		{RanName: "gnb-1", CellID: "cell-1", PLMNID: "00101", SliceID: "1-010203", Time: at},
+		{RanName: "gnb-1", CellID: "cell-1", PLMNID: "00102", Time: at},
+		{RanName: "gnb-1", CellID: "cell-2", PLMNID: "00101", Time: at},
+		{RanName: "gnb-1", Time: at},
+	}})
+	if h.NodeID != nodeID.String() || h.DUID != "1" || h.CUUPID != "128" {
+		t.Fatalf("got hierarchy %+v", h)
+	}
+
+	node, ok := topo.get("gnb-1")
+	if !ok {
+		t.Fatal("node not learned")
+	}
+	if node.NodeID != nodeID.String() || node.NodeType != nodeID.Type || node.SenderName != "du1" || !node.Updated.Equal(at) {
+		t.Errorf("got node %+v", node)
+	}
+	if len(node.Components) != 2 || node.Components[0].Type != componentCUUP || node.Components[0].ID != "128" || node.Components[1].Type != componentDU || node.Components[1].ID != "1" {
+		t.Fatalf("got components %+v", node.Components)
+	}
+	if du := node.Components[1]; fmt.Sprint(du.Cells, du.PLMNs, du.Slices) != "[cell-1 cell-2] [00101 00102] [1-010203]" {
+		t.Errorf("got DU %+v", du)
+	}
+	if len(node.Cells) != 2 {
+		t.Fatalf("got cells %+v", node.Cells)
+	}
+	if cell := node.Cells[0]; cell.CellID != "cell-1" || fmt.Sprint(cell.PLMNs, cell.Slices, cell.Components) != "[00101 00102] [1-010203] [cu-up/128 du/1]" {
+		t.Errorf("got cell %+v", cell)
+	}
+	if cell := node.Cells[1]; cell.CellID != "cell-2" || fmt.Sprint(cell.PLMNs, cell.Slices) != "[00101] []" {
+		t.Errorf("got cell %+v", cell)
+	}
+
+	if _, ok := topo.get("gnb-2"); ok {
+		t.Error("got an unknown node")
+	}
+	if nodes := topo.list(); len(nodes) != 1 || nodes[0].RanName != "gnb-1" {
+		t.Errorf("got nodes %+v", nodes)
+	}
+}
+
+func TestTopologyEnrich(t *testing.T) {
+	topo := newTopology()
+	at := time.Unix(1600000000, 0)
+	topo.learn(&indication{RanName: "gnb-1", Received: at, Header: gnbNodeHeader(0, nil), Samples: []kpiSample{
+		{RanName: "gnb-1", CellID: "cell-1", Time: at},
+	}})
+
+	// a node level report without DU and CU-UP IDs
+	gnbID := GNBID(*bitString(0xb5c67788, 32))
+	header := nodeHeader(1, &GlobalKPMnodegNBIDType{GlobalgNBID: GlobalgNBIDType{PlmnID: testPLMNOctets, GnbIDType: 1, GnbID: &gnbID}})
+	samples := []kpiSample{
+		{RanName: "gnb-1", CellID: "cell-1", Time: at},
+		{RanName: "gnb-1", CellID: "cell-9", Time: at},
+		{RanName: "gnb-2", CellID: "cell-1", Time: at},
+	}
+	h := topo.learn(&indication{RanName: "gnb-1", Received: at, Header: header, Samples: samples[:2]})
+	if h.NodeID == "" || h.DUID != "" || h.CUUPID != "" {
+		t.Fatalf("got hierarchy %+v", h)
+	}
+	topo.enrich(h, samples)
+
+	if s := samples[0]; s.NodeID != h.NodeID || s.DUID != "1" || s.CUUPID != "128" {
+		t.Errorf("got hierarchy %s/%s/%s of a known cell", s.NodeID, s.DUID, s.CUUPID)
+	}
+	if s := samples[1]; s.NodeID != h.NodeID || s.DUID != "" || s.CUUPID != "" {
+		t.Errorf("got hierarchy %s/%s/%s of a cell without components", s.NodeID, s.DUID, s.CUUPID)
+	}
+	if s := samples[2]; s.DUID != "" || s.CUUPID != "" {
+		t.Errorf("got hierarchy %s/%s/%s of an unknown node", s.NodeID, s.DUID, s.CUUPID)
+	}
+
+	topo.enrich(nodeHierarchy{NodeID: h.NodeID, DUID: "2"}, samples[:1])
+	if s := samples[0]; s.DUID != "2" || s.CUUPID != "128" {
+		t.Errorf("got hierarchy %s/%s/%s, want the DU of the header", s.NodeID, s.DUID, s.CUUPID)
+	}
+}
@@ -3,47 +3,62 @@ package control
 const MAX_SUBSCRIPTION_ATTEMPTS = 100
 
 type DecodedIndicationMessage struct {
-	RequestID             int32
-	RequestSequenceNumber int32
-	FuncID                int32
-	ActionID              int32
-	IndSN                 int32
-	IndType               int32
-	IndHeader             []byte
-	IndHeaderLength       int32
-	IndMessage            []byte
-	IndMessageLength      int32
-	CallProcessID         []byte
-	CallProcessIDLength   int32
+	RequestID             int32  `json:"requestId"`
+	RequestSequenceNumber int32  `json:"requestSequenceNumber"`
+	FuncID                int32  `json:"functionId"`
+	ActionID              int32  `json:"actionId"`
+	IndSN                 int32  `json:"indicationSN"`
+	IndSNPresent          bool   `json:"-"` //RICindicationSN is optional
+	IndType               int32  `json:"indicationType"`
+	IndHeader             []byte `json:"indicationHeader"`
+	IndHeaderLength       int32  `json:"-"`
+	IndMessage            []byte `json:"indicationMessage"`
+	IndMessageLength      int32  `json:"-"`
+	CallProcessID         []byte `json:"callProcessId"`
+	CallProcessIDLength   int32  `json:"-"`
+}
+
+type DecodedSubscriptionRequestMessage struct {
+	RequestID             int32 `json:"requestId"`
+	RequestSequenceNumber int32 `json:"requestSequenceNumber"`
+	FuncID                int32 `json:"functionId"`
 }
 
 type CauseItemType struct {
-	CauseType int32
-	CauseID   int32
+	CauseType int32 `json:"causeType"`
+	CauseID   int32 `json:"causeId"`
 }
 
 type ActionAdmittedListType struct {
-	ActionID [16]int32
-	Count    int
+	ActionID [16]int32 `json:"actionId"`
+	Count    int       `json:"-"`
 }
 
 type ActionNotAdmittedListType struct {
-	ActionID [16]int32
-	Cause    [16]CauseItemType
-	Count    int
+	ActionID [16]int32         `json:"actionId"`
+	Cause    [16]CauseItemType `json:"cause"`
+	Count    int               `json:"-"`
 }
 
 type DecodedSubscriptionResponseMessage struct {
-	RequestID             int32
-	RequestSequenceNumber int32
-	FuncID                int32
-	ActionAdmittedList    ActionAdmittedListType
-	ActionNotAdmittedList ActionNotAdmittedListType
+	RequestID             int32                     `json:"requestId"`
+	RequestSequenceNumber int32                     `json:"requestSequenceNumber"`
+	FuncID                int32                     `json:"functionId"`
+	ActionAdmittedList    ActionAdmittedListType    `json:"actionAdmittedList"`
+	ActionNotAdmittedList ActionNotAdmittedListType `json:"actionNotAdmittedList"`
+}
+
+// RanFunctionDefinition is a RAN function advertised by an E2 Setup Request
+// or a RIC Service Update
+type RanFunctionDefinition struct {
+	ID         int64  `json:"id"`
+	Revision   int64  `json:"revision"`
+	Definition []byte `json:"definition"`
 }
 
 type IntPair64 struct {
-	DL int64
-	UL int64
+	DL int64 `json:"dl"`
+	UL int64 `json:"ul"`
 }
 
 type OctetString struct {
@@ -72,31 +87,31 @@ type BitString struct {
 }
 
 type SubsequentAction struct {
-	IsValid              int
-	SubsequentActionType int64
-	TimeToWait           int64
+	IsValid              int   `json:"isValid"`
+	SubsequentActionType int64 `json:"subsequentActionType"`
+	TimeToWait           int64 `json:"timeToWait"`
 }
 
 type GNBID BitString
 
 type GlobalgNBIDType struct {
-	PlmnID    OctetString
-	GnbIDType int
-	GnbID     interface{}
+	PlmnID    OctetString `json:"plmnId"`
+	GnbIDType int         `json:"gnbIdType"`
+	GnbID     interface{} `json:"gnbId,omitempty"`
 }
 
 type GlobalKPMnodegNBIDType struct {
-	GlobalgNBID GlobalgNBIDType
-	GnbCUUPID   *Integer
-	GnbDUID     *Integer
+	GlobalgNBID GlobalgNBIDType `json:"globalGnbId"`
+	GnbCUUPID   *Integer        `json:"gnbCuUpId,omitempty"`
+	GnbDUID     *Integer        `json:"gnbDuId,omitempty"`
 }
 
 type ENGNBID BitString
 
 type GlobalKPMnodeengNBIDType struct {
-	PlmnID    OctetString
-	GnbIDType int
-	GnbID     interface{}
+	PlmnID    OctetString `json:"plmnId"`
+	GnbIDType int         `json:"gnbIdType"`
+	GnbID     interface{} `json:"gnbId,omitempty"`
 }
 
 type NGENBID_Macro BitString
@@ -106,9 +121,9 @@ type NGENBID_ShortMacro BitString
 type NGENBID_LongMacro BitString
 
 type GlobalKPMnodengeNBIDType struct {
-	PlmnID    OctetString
-	EnbIDType int
-	EnbID     interface{}
+	PlmnID    OctetString `json:"plmnId"`
+	EnbIDType int         `json:"enbIdType"`
+	EnbID     interface{} `json:"enbId,omitempty"`
 }
 
 type ENBID_Macro BitString
@@ -120,19 +135,19 @@ type ENBID_ShortMacro BitString
 type ENBID_LongMacro BitString
 
 type GlobalKPMnodeeNBIDType struct {
-	PlmnID    OctetString
-	EnbIDType int
-	EnbID     interface{}
+	PlmnID    OctetString `json:"plmnId"`
+	EnbIDType int         `json:"enbIdType"`
+	EnbID     interface{} `json:"enbId,omitempty"`
 }
 
 type NRCGIType struct {
-	PlmnID   OctetString
-	NRCellID BitString
+	PlmnID   OctetString `json:"plmnId"`
+	NRCellID BitString   `json:"nrCellId"`
 }
 
 type SliceIDType struct {
-	SST OctetString
-	SD  *OctetString
+	SST OctetString  `json:"sst"`
+	SD  *OctetString `json:"sd,omitempty"`
 }
 
 type GNB_DU_Name PrintableString
@@ -157,280 +172,280 @@ type GNB_CU_UP_Name PrintableString
 // }
 
 type IndicationHeaderFormat1 struct {
-	GlobalKPMnodeIDType int32
-	GlobalKPMnodeID     interface{}
-	ColletStartTime     *OctetString
-	FileFormatVersion   *PrintableString
-	SenderName          *PrintableString
-	SenderType          *PrintableString
-	VendorName          *PrintableString
-	NRCGI               *NRCGIType
-	PlmnID              *OctetString
-	SliceID             *SliceIDType
-	FiveQI              int64
-	Qci                 int64
-	UeMessageType       int32
-	GnbDUID             *Integer
-	GnbNameType         int32
-	GnbName             interface{}
-	GlobalgNBID         *GlobalgNBIDType
+	GlobalKPMnodeIDType int32            `json:"globalKPMnodeIdType"`
+	GlobalKPMnodeID     interface{}      `json:"globalKPMnodeId,omitempty"`
+	ColletStartTime     *OctetString     `json:"colletStartTime,omitempty"`
+	FileFormatVersion   *PrintableString `json:"fileFormatVersion,omitempty"`
+	SenderName          *PrintableString `json:"senderName,omitempty"`
+	SenderType          *PrintableString `json:"senderType,omitempty"`
+	VendorName          *PrintableString `json:"vendorName,omitempty"`
+	NRCGI               *NRCGIType       `json:"nrcgi,omitempty"`
+	PlmnID              *OctetString     `json:"plmnId,omitempty"`
+	SliceID             *SliceIDType     `json:"sliceId,omitempty"`
+	FiveQI              int64            `json:"fiveQI"`
+	Qci                 int64            `json:"qci"`
+	UeMessageType       int32            `json:"ueMessageType"`
+	GnbDUID             *Integer         `json:"gnbDuId,omitempty"`
+	GnbNameType         int32            `json:"gnbNameType"`
+	GnbName             interface{}      `json:"gnbName,omitempty"`
+	GlobalgNBID         *GlobalgNBIDType `json:"globalGnbId,omitempty"`
 }
 
 type IndicationHeader struct {
-	IndHdrType int32
-	IndHdr     interface{}
+	IndHdrType int32       `json:"format"`
+	IndHdr     interface{} `json:"header,omitempty"`
 }
 
 type FQIPERSlicesPerPlmnPerCellType struct {
-	FiveQI   int64
-	PrbUsage IntPair64
+	FiveQI   int64     `json:"fiveQI"`
+	PrbUsage IntPair64 `json:"prbUsage"`
 }
 
 type SlicePerPlmnPerCellType struct {
-	SliceID                         SliceIDType
-	FQIPERSlicesPerPlmnPerCells     [64]FQIPERSlicesPerPlmnPerCellType
-	FQIPERSlicesPerPlmnPerCellCount int
+	SliceID                         SliceIDType                        `json:"sliceId"`
+	FQIPERSlicesPerPlmnPerCells     [64]FQIPERSlicesPerPlmnPerCellType `json:"fqiPerSlicesPerPlmnPerCells"`
+	FQIPERSlicesPerPlmnPerCellCount int                                `json:"-"`
 }
 
 type DUPM5GCContainerType struct {
-	SlicePerPlmnPerCells     [1024]SlicePerPlmnPerCellType
-	SlicePerPlmnPerCellCount int
+	SlicePerPlmnPerCells     [1024]SlicePerPlmnPerCellType `json:"slicePerPlmnPerCells"`
+	SlicePerPlmnPerCellCount int                           `json:"-"`
 }
 
 type DUPMEPCPerQCIReportType struct {
-	QCI      int64
-	PrbUsage IntPair64
+	QCI      int64     `json:"qci"`
+	PrbUsage IntPair64 `json:"prbUsage"`
 }
 
 type DUPMEPCContainerType struct {
-	PerQCIReports     [256]DUPMEPCPerQCIReportType
-	PerQCIReportCount int
+	PerQCIReports     [256]DUPMEPCPerQCIReportType `json:"perQciReports"`
+	PerQCIReportCount int                          `json:"-"`
 }
 
 type ServedPlmnPerCellType struct {
-	PlmnID  OctetString
-	DUPM5GC *DUPM5GCContainerType
-	DUPMEPC *DUPMEPCContainerType
+	PlmnID  OctetString           `json:"plmnId"`
+	DUPM5GC *DUPM5GCContainerType `json:"duPm5gc,omitempty"`
+	DUPMEPC *DUPMEPCContainerType `json:"duPmEpc,omitempty"`
 }
 
 type CellResourceReportType struct {
-	NRCGI                  NRCGIType
-	TotalofAvailablePRBs   IntPair64
-	ServedPlmnPerCells     [12]ServedPlmnPerCellType
-	ServedPlmnPerCellCount int
+	NRCGI                  NRCGIType                 `json:"nrcgi"`
+	TotalofAvailablePRBs   IntPair64                 `json:"totalOfAvailablePrbs"`
+	ServedPlmnPerCells     [12]ServedPlmnPerCellType `json:"servedPlmnPerCells"`
+	ServedPlmnPerCellCount int                       `json:"-"`
 }
 
 type ODUPFContainerType struct {
-	CellResourceReports     [512]CellResourceReportType
-	CellResourceReportCount int
+	CellResourceReports     [512]CellResourceReportType `json:"cellResourceReports"`
+	CellResourceReportCount int                         `json:"-"`
 }
 
 type CUCPResourceStatusType struct {
-	NumberOfActiveUEs int64
+	NumberOfActiveUEs int64 `json:"numberOfActiveUes"`
 }
 
 type OCUCPPFContainerType struct {
-	GNBCUCPName        *PrintableString
-	CUCPResourceStatus CUCPResourceStatusType
+	GNBCUCPName        *PrintableString       `json:"gnbCuCpName,omitempty"`
+	CUCPResourceStatus CUCPResourceStatusType `json:"cuCpResourceStatus"`
 }
 
 type FQIPERSlicesPerPlmnType struct {
-	FiveQI      int64
-	PDCPBytesDL *Integer
-	PDCPBytesUL *Integer
+	FiveQI      int64    `json:"fiveQI"`
+	PDCPBytesDL *Integer `json:"pdcpBytesDl,omitempty"`
+	PDCPBytesUL *Integer `json:"pdcpBytesUl,omitempty"`
 }
 
 type SliceToReportType struct {
-	SliceID                  SliceIDType
-	FQIPERSlicesPerPlmns     [64]FQIPERSlicesPerPlmnType
-	FQIPERSlicesPerPlmnCount int
+	SliceID                  SliceIDType                 `json:"sliceId"`
+	FQIPERSlicesPerPlmns     [64]FQIPERSlicesPerPlmnType `json:"fqiPerSlicesPerPlmns"`
+	FQIPERSlicesPerPlmnCount int                         `json:"-"`
 }
 
 type CUUPPM5GCType struct {
-	SliceToReports     [1024]SliceToReportType
-	SliceToReportCount int
+	SliceToReports     [1024]SliceToReportType `json:"sliceToReports"`
+	SliceToReportCount int                     `json:"-"`
 }
 
 type CUUPPMEPCPerQCIReportType struct {
-	QCI         int64
-	PDCPBytesDL *Integer
-	PDCPBytesUL *Integer
+	QCI         int64    `json:"qci"`
+	PDCPBytesDL *Integer `json:"pdcpBytesDl,omitempty"`
+	PDCPBytesUL *Integer `json:"pdcpBytesUl,omitempty"`
 }
 
 type CUUPPMEPCType struct {
-	CUUPPMEPCPerQCIReports     [256]CUUPPMEPCPerQCIReportType
-	CUUPPMEPCPerQCIReportCount int
+	CUUPPMEPCPerQCIReports     [256]CUUPPMEPCPerQCIReportType `json:"cuUpPmEpcPerQciReports"`
+	CUUPPMEPCPerQCIReportCount int                            `json:"-"`
 }
 
 type CUUPPlmnType struct {
-	PlmnID    OctetString
-	CUUPPM5GC *CUUPPM5GCType
-	CUUPPMEPC *CUUPPMEPCType
+	PlmnID    OctetString    `json:"plmnId"`
+	CUUPPM5GC *CUUPPM5GCType `json:"cuUpPm5gc,omitempty"`
+	CUUPPMEPC *CUUPPMEPCType `json:"cuUpPmEpc,omitempty"`
 }
 
 type CUUPMeasurementContainerType struct {
-	CUUPPlmns     [12]CUUPPlmnType
-	CUUPPlmnCount int
+	CUUPPlmns     [12]CUUPPlmnType `json:"cuUpPlmns"`
+	CUUPPlmnCount int              `json:"-"`
 }
 
 type CUUPPFContainerItemType struct {
-	InterfaceType    int64
-	OCUUPPMContainer CUUPMeasurementContainerType
+	InterfaceType    int64                        `json:"interfaceType"`
+	OCUUPPMContainer CUUPMeasurementContainerType `json:"oCuUpPmContainer"`
 }
 
 type OCUUPPFContainerType struct {
-	GNBCUUPName              *PrintableString
-	CUUPPFContainerItems     [3]CUUPPFContainerItemType
-	CUUPPFContainerItemCount int
+	GNBCUUPName              *PrintableString           `json:"gnbCuUpName,omitempty"`
+	CUUPPFContainerItems     [3]CUUPPFContainerItemType `json:"cuUpPfContainerItems"`
+	CUUPPFContainerItemCount int                        `json:"-"`
 }
 
 type DUUsageReportUeResourceReportItemType struct {
-	CRNTI      Integer
-	PRBUsageDL int64
-	PRBUsageUL int64
+	CRNTI      Integer `json:"cRnti"`
+	PRBUsageDL int64   `json:"prbUsageDl"`
+	PRBUsageUL int64   `json:"prbUsageUl"`
 }
 
 type DUUsageReportCellResourceReportItemType struct {
-	NRCGI                     NRCGIType
-	UeResourceReportItems     [32]DUUsageReportUeResourceReportItemType
-	UeResourceReportItemCount int
+	NRCGI                     NRCGIType                                 `json:"nrcgi"`
+	UeResourceReportItems     [32]DUUsageReportUeResourceReportItemType `json:"ueResourceReportItems"`
+	UeResourceReportItemCount int                                       `json:"-"`
 }
 
 type DUUsageReportType struct {
-	CellResourceReportItems     [512]DUUsageReportCellResourceReportItemType
-	CellResourceReportItemCount int
+	CellResourceReportItems     [512]DUUsageReportCellResourceReportItemType `json:"cellResourceReportItems"`
+	CellResourceReportItemCount int                                          `json:"-"`
 }
 
 type CUCPUsageReportUeResourceReportItemType struct {
-	CRNTI          Integer
-	ServingCellRF  *OctetString
-	NeighborCellRF *OctetString
+	CRNTI          Integer      `json:"cRnti"`
+	ServingCellRF  *OctetString `json:"servingCellRf,omitempty"`
+	NeighborCellRF *OctetString `json:"neighborCellRf,omitempty"`
 }
 
 type CUCPUsageReportCellResourceReportItemType struct {
-	NRCGI                     NRCGIType
-	UeResourceReportItems     [32]CUCPUsageReportUeResourceReportItemType
-	UeResourceReportItemCount int
+	NRCGI                     NRCGIType                                   `json:"nrcgi"`
+	UeResourceReportItems     [32]CUCPUsageReportUeResourceReportItemType `json:"ueResourceReportItems"`
+	UeResourceReportItemCount int                                         `json:"-"`
 }
 
 type CUCPUsageReportType struct {
-	CellResourceReportItems     [16384]CUCPUsageReportCellResourceReportItemType
-	CellResourceReportItemCount int
+	CellResourceReportItems     [16384]CUCPUsageReportCellResourceReportItemType `json:"cellResourceReportItems"`
+	CellResourceReportItemCount int                                              `json:"-"`
 }
 
 type CUUPUsageReportUeResourceReportItemType struct {
-	CRNTI       Integer
-	PDCPBytesDL *Integer
-	PDCPBytesUL *Integer
+	CRNTI       Integer  `json:"cRnti"`
+	PDCPBytesDL *Integer `json:"pdcpBytesDl,omitempty"`
+	PDCPBytesUL *Integer `json:"pdcpBytesUl,omitempty"`
 }
 
 type CUUPUsageReportCellResourceReportItemType struct {
-	NRCGI                     NRCGIType
-	UeResourceReportItems     [32]CUUPUsageReportUeResourceReportItemType
-	UeResourceReportItemCount int
+	NRCGI                     NRCGIType                                   `json:"nrcgi"`
+	UeResourceReportItems     [32]CUUPUsageReportUeResourceReportItemType `json:"ueResourceReportItems"`
+	UeResourceReportItemCount int                                         `json:"-"`
 }
 
 type CUUPUsageReportType struct {
-	CellResourceReportItems     [512]CUUPUsageReportCellResourceReportItemType
-	CellResourceReportItemCount int
+	CellResourceReportItems     [512]CUUPUsageReportCellResourceReportItemType `json:"cellResourceReportItems"`
+	CellResourceReportItemCount int                                            `json:"-"`
 }
 
 type PFContainerType struct {
-	ContainerType int32
-	Container     interface{}
+	ContainerType int32       `json:"containerType"`
+	Container     interface{} `json:"container,omitempty"`
 }
 
 type RANContainerType struct {
-	Timestamp     OctetString
-	ContainerType int32
-	Container     interface{}
+	Timestamp     OctetString `json:"timestamp"`
+	ContainerType int32       `json:"containerType"`
+	Container     interface{} `json:"container,omitempty"`
 }
 
 type PMContainerType struct {
-	PFContainer  *PFContainerType
-	RANContainer *RANContainerType
+	PFContainer  *PFContainerType  `json:"pfContainer,omitempty"`
+	RANContainer *RANContainerType `json:"ranContainer,omitempty"`
 }
 
 type MeasLabelInfo struct {
-	PLMNID           *OctetString // PLMN_Identity_t
-	SliceID          *SliceIDType // SNSSAI
-	FiveQI           int64
-	QCI              int64
-	QCImax           int64
-	QCImin           int64
-	ARPmax           int64
-	ARPmin           int64
-	BitrateRange     int64
-	LayerMU_MIMO     int64
-	SUM              int64
-	DistBinX         int64
-	DistBinY         int64
-	DistBinZ         int64
-	PreLabelOverride int64
-	StartEndInd      int64
+	PLMNID           *OctetString `json:"plmnId,omitempty"`  // PLMN_Identity_t
+	SliceID          *SliceIDType `json:"sliceId,omitempty"` // SNSSAI
+	FiveQI           int64        `json:"fiveQI,omitempty"`
+	QCI              int64        `json:"qci,omitempty"`
+	QCImax           int64        `json:"qciMax,omitempty"`
+	QCImin           int64        `json:"qciMin,omitempty"`
+	ARPmax           int64        `json:"arpMax,omitempty"`
+	ARPmin           int64        `json:"arpMin,omitempty"`
+	BitrateRange     int64        `json:"bitrateRange,omitempty"`
+	LayerMU_MIMO     int64        `json:"layerMuMimo,omitempty"`
+	SUM              int64        `json:"sum,omitempty"`
+	DistBinX         int64        `json:"distBinX,omitempty"`
+	DistBinY         int64        `json:"distBinY,omitempty"`
+	DistBinZ         int64        `json:"distBinZ,omitempty"`
+	PreLabelOverride int64        `json:"preLabelOverride,omitempty"`
+	StartEndInd      int64        `json:"startEndInd,omitempty"`
 }
 
 type MeasInfoItem struct {
-	MeasType       int32
-	Measurement    interface{}
-	LabelInfoCount int
-	LabelInfoList  []MeasLabelInfo
+	MeasType       int32           `json:"measType"`
+	Measurement    interface{}     `json:"measurement,omitempty"`
+	LabelInfoCount int             `json:"-"`
+	LabelInfoList  []MeasLabelInfo `json:"labelInfoList"`
 }
 
 type TestConditionInfo struct {
-	TestConditionType int32
-	Expression        int32
-	ValueType         int32
-	Value             interface{}
+	TestConditionType int32       `json:"testConditionType"`
+	Expression        int32       `json:"expression"`
+	ValueType         int32       `json:"valueType"`
+	Value             interface{} `json:"value,omitempty"`
 }
 
 type MatchingCond struct {
-	ConditionType int32
-	Condition     interface{}
+	ConditionType int32       `json:"conditionType"`
+	Condition     interface{} `json:"condition,omitempty"`
 }
 
 type MeasInfoUeidItem struct {
-	MeasType          int32
-	Measurement       interface{}
-	MatchingCondCount int
-	MatchingCondList  []MatchingCond
-	MatchedUeidCount  int
-	MatchedUeidList   []OctetString
+	MeasType          int32          `json:"measType"`
+	Measurement       interface{}    `json:"measurement,omitempty"`
+	MatchingCondCount int            `json:"-"`
+	MatchingCondList  []MatchingCond `json:"matchingCondList"`
+	MatchedUeidCount  int            `json:"-"`
+	MatchedUeidList   []OctetString  `json:"matchedUeIdList"`
 }
 
 type MeasurementRecordItem struct {
-	MeasRecordType  int32
-	MeasRecordValue interface{}
+	MeasRecordType  int32       `json:"type"`
+	MeasRecordValue interface{} `json:"value,omitempty"`
 }
 
 type MeasurementRecord struct {
-	MeasRecordCount int
-	MeasRecord      []MeasurementRecordItem
+	MeasRecordCount int                     `json:"-"`
+	MeasRecord      []MeasurementRecordItem `json:"measRecord"`
 }
 
 type IndicationMessageFormat1 struct {
-	SubscriptID   *Integer
-	CellObjID     *PrintableString
-	GranulPeriod  int64
-	MeasInfoCount int
-	MeasInfoList  []MeasInfoItem
-	MeasDataCount int
-	MeasData      []MeasurementRecord
+	SubscriptID   *Integer            `json:"subscriptId,omitempty"`
+	CellObjID     *PrintableString    `json:"cellObjId,omitempty"`
+	GranulPeriod  int64               `json:"granulPeriod"`
+	MeasInfoCount int                 `json:"-"`
+	MeasInfoList  []MeasInfoItem      `json:"measInfoList"`
+	MeasDataCount int                 `json:"-"`
+	MeasData      []MeasurementRecord `json:"measData"`
 }
 
 type IndicationMessageFormat2 struct {
-	SubscriptID       *Integer
-	CellObjID         *PrintableString
-	GranulPeriod      int64
-	MeasInfoUeidCount int
-	MeasInfoUeidList  []MeasInfoUeidItem
-	MeasDataCount     int
-	MeasData          []MeasurementRecord
+	SubscriptID       *Integer            `json:"subscriptId,omitempty"`
+	CellObjID         *PrintableString    `json:"cellObjId,omitempty"`
+	GranulPeriod      int64               `json:"granulPeriod"`
+	MeasInfoUeidCount int                 `json:"-"`
+	MeasInfoUeidList  []MeasInfoUeidItem  `json:"measInfoUeIdList"`
+	MeasDataCount     int                 `json:"-"`
+	MeasData          []MeasurementRecord `json:"measData"`
 }
 
 type IndicationMessage struct {
-	IndMsgType int32
-	IndMsg     interface{}
+	IndMsgType int32       `json:"format"`
+	IndMsg     interface{} `json:"message,omitempty"`
 }
 
 type Timestamp struct {
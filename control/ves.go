@@ -0,0 +1,387 @@
+package control
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+const (
+	vesListenerVersion = "7.2.1"
+	vesHeaderVersion   = "4.1"
+	vesFieldsVersion   = "4.0"
+)
+
+const (
+	defaultVesBatchSize       = 100
+	defaultVesFlushInterval   = 5 //seconds
+	defaultVesQueueSize       = 1024
+	defaultVesAttempts        = 3
+	defaultVesTimeout         = 10 //seconds
+	defaultVesReportingEntity = "kpimon"
+	vesRetryBackoff           = time.Second
+)
+
+type vesCommonEventHeader struct {
+	Domain                  string `json:"domain"`
+	EventID                 string `json:"eventId"`
+	EventName               string `json:"eventName"`
+	EventType               string `json:"eventType,omitempty"`
+	Sequence                int64  `json:"sequence"`
+	Priority                string `json:"priority"`
+	ReportingEntityName     string `json:"reportingEntityName"`
+	SourceName              string `json:"sourceName"`
+	StartEpochMicrosec      int64  `json:"startEpochMicrosec"`
+	LastEpochMicrosec       int64  `json:"lastEpochMicrosec"`
+	Version                 string `json:"version"`
+	VesEventListenerVersion string `json:"vesEventListenerVersion"`
+	TimeZoneOffset          string `json:"timeZoneOffset,omitempty"`
+}
+
+type vesMeasurementFields struct {
+	MeasurementFieldsVersion string            `json:"measurementFieldsVersion"`
+	MeasurementInterval      float64           `json:"measurementInterval"`
+	AdditionalMeasurements   []vesNamedHashMap `json:"additionalMeasurements,omitempty"`
+	AdditionalFields         map[string]string `json:"additionalFields,omitempty"`
+}
+
+type vesNamedHashMap struct {
+	Name    string            `json:"name"`
+	HashMap map[string]string `json:"hashMap"`
+}
+
+type vesFaultFields struct {
+	FaultFieldsVersion         string            `json:"faultFieldsVersion"`
+	AlarmCondition             string            `json:"alarmCondition"`
+	EventSeverity              string            `json:"eventSeverity"`
+	EventSourceType            string            `json:"eventSourceType"`
+	SpecificProblem            string            `json:"specificProblem"`
+	VfStatus                   string            `json:"vfStatus"`
+	AlarmInterfaceA            string            `json:"alarmInterfaceA,omitempty"`
+	AlarmAdditionalInformation map[string]string `json:"alarmAdditionalInformation,omitempty"`
+}
+
+// vesEvent is one entry of the eventList of a VES event batch
+type vesEvent struct {
+	CommonEventHeader vesCommonEventHeader  `json:"commonEventHeader"`
+	MeasurementFields *vesMeasurementFields `json:"measurementFields,omitempty"`
+	FaultFields       *vesFaultFields       `json:"faultFields,omitempty"`
+}
+
+type vesEventBatch struct {
+	EventList []vesEvent `json:"eventList"`
+}
+
+// vesSink exports the indications as VES measurement events and the alarms as
+// VES fault events. Events are queued and POSTed in batches to the collector.
+type vesSink struct {
+	url             string
+	username        string
+	password        string
+	token           string
+	reportingEntity string
+	client          *http.Client
+	batchSize       int
+	flushInterval   time.Duration
+	attempts        int
+	queue           chan vesEvent
+	sequence        int64
+}
+
+// newVesSink returns nil when no collector is configured. The password and
+// the token can be read from files.
+func newVesSink() (*vesSink, error) {
+	url := os.Getenv("vesCollectorUrl")
+	if url == "" {
+		return nil, nil
+	}
+	password, err := getEnvSecret("vesPassword")
+	if err != nil {
+		return nil, err
+	}
+	token, err := getEnvSecret("vesToken")
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: os.Getenv("vesInsecureSkipVerify") == "true"},
+	}
+	s := &vesSink{
+		url:             url,
+		username:        os.Getenv("vesUsername"),
+		password:        password,
+		token:           token,
+		reportingEntity: os.Getenv("vesReportingEntity"),
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   time.Duration(getEnvInt("vesTimeout", defaultVesTimeout)) * time.Second,
+		},
+		batchSize:     getEnvInt("vesBatchSize", defaultVesBatchSize),
+		flushInterval: time.Duration(getEnvInt("vesFlushInterval", defaultVesFlushInterval)) * time.Second,
+		attempts:      getEnvInt("vesAttempts", defaultVesAttempts),
+		queue:         make(chan vesEvent, getEnvInt("vesQueueSize", defaultVesQueueSize)),
+	}
+	if s.token != "" && s.username != "" {
+		return nil, errors.New("vesToken and vesUsername are mutually exclusive")
+	}
+	if s.reportingEntity == "" {
+		s.reportingEntity = defaultVesReportingEntity
+	}
+	return s, nil
+}
+
+func (s *vesSink) name() string {
+	return "ves"
+}
+
+// write queues a measurement event for every granularity period of the
+// indication of the batch
+func (s *vesSink) write(b *batch) error {
+	if b.ind == nil || len(b.ind.Samples) == 0 {
+		return nil
+	}
+	for _, event := range s.measurementEvents(b.ind) {
+		if err := s.enqueue(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// alarm queues a fault event for a raised or cleared alarm
+func (s *vesSink) alarm(a *ActiveAlarm, raised bool) {
+	if err := s.enqueue(s.faultEvent(a, raised)); err != nil {
+		xapp.Logger.Error("Failed to export alarm %s: %v", a.ID, err)
+		log.Printf("Failed to export alarm %s: %v", a.ID, err)
+	}
+}
+
+func (s *vesSink) enqueue(event vesEvent) error {
+	select {
+	case s.queue <- event:
+		return nil
+	default:
+		return errors.New("VES queue is full, event " + event.CommonEventHeader.EventID + " is dropped")
+	}
+}
+
+func (s *vesSink) header(domain string, eventName string, sourceName string, start time.Time, last time.Time) vesCommonEventHeader {
+	seq := atomic.AddInt64(&s.sequence, 1)
+	return vesCommonEventHeader{
+		Domain:                  domain,
+		EventID:                 s.reportingEntity + "-" + strconv.FormatInt(seq, 10),
+		EventName:               eventName,
+		Sequence:                seq,
+		Priority:                "Normal",
+		ReportingEntityName:     s.reportingEntity,
+		SourceName:              sourceName,
+		StartEpochMicrosec:      start.UnixNano() / int64(time.Microsecond),
+		LastEpochMicrosec:       last.UnixNano() / int64(time.Microsecond),
+		Version:                 vesHeaderVersion,
+		VesEventListenerVersion: vesListenerVersion,
+		TimeZoneOffset:          "UTC+00:00",
+	}
+}
+
+// measurementEvents maps an indication to one measurement event per sample
+// time, that is per granularity period the indication reports
+func (s *vesSink) measurementEvents(ind *indication) []vesEvent {
+	periods := samplePeriods(ind)
+	events := make([]vesEvent, len(periods))
+	for i, period := range periods {
+		events[i] = s.measurementEvent(ind, period.start, period.samples)
+	}
+	return events
+}
+
+// measurementEvent maps the samples of one granularity period to a measurement
+// event, with one named hash map of measurement values per cell, slice, QoS
+// flow and UE
+func (s *vesSink) measurementEvent(ind *indication, start time.Time, samples []kpiSample) vesEvent {
+	last := ind.Received
+	if ind.Granul > 0 {
+		last = start.Add(ind.Granul)
+	}
+
+	fields := &vesMeasurementFields{
+		MeasurementFieldsVersion: vesFieldsVersion,
+		MeasurementInterval:      ind.Granul.Seconds(),
+		AdditionalFields:         make(map[string]string),
+	}
+	index := make(map[string]int)
+	for _, sample := range samples {
+		name := vesObjectName(sample)
+		i, ok := index[name]
+		if !ok {
+			i = len(fields.AdditionalMeasurements)
+			index[name] = i
+			fields.AdditionalMeasurements = append(fields.AdditionalMeasurements, vesNamedHashMap{Name: name, HashMap: make(map[string]string)})
+		}
+		fields.AdditionalMeasurements[i].HashMap[sample.Measurement] = strconv.FormatFloat(sample.Value, 'g', -1, 64)
+	}
+	for key, value := range map[string]string{"nodeId": ind.Topology.NodeID, "duId": ind.Topology.DUID, "cuUpId": ind.Topology.CUUPID} {
+		if value != "" {
+			fields.AdditionalFields[key] = value
+		}
+	}
+
+	header := s.header("measurement", "Measurement_KPM_"+s.reportingEntity, ind.RanName, start, last)
+	header.EventType = "KPM"
+	return vesEvent{CommonEventHeader: header, MeasurementFields: fields}
+}
+
+// vesObjectName identifies the measured object of a sample, for example
+// "cell=...,slice=1-000001,5qi=9"
+func vesObjectName(sample kpiSample) string {
+	name := "cell=" + sample.CellID
+	if sample.PLMNID != "" {
+		name += ",plmn=" + sample.PLMNID
+	}
+	if sample.SliceID != "" {
+		name += ",slice=" + sample.SliceID
+	}
+	if sample.FiveQI > 0 {
+		name += ",5qi=" + strconv.FormatInt(sample.FiveQI, 10)
+	}
+	if sample.QCI > 0 {
+		name += ",qci=" + strconv.FormatInt(sample.QCI, 10)
+	}
+	if sample.UeID != "" {
+		name += ",ue=" + sample.UeID
+	}
+	return name
+}
+
+// faultEvent maps an alarm to a fault event, a cleared alarm has the NORMAL
+// severity
+func (s *vesSink) faultEvent(a *ActiveAlarm, raised bool) vesEvent {
+	severity := a.Severity
+	last := a.Raised
+	if !raised {
+		severity = "NORMAL"
+		last = time.Now()
+	}
+
+	fields := &vesFaultFields{
+		FaultFieldsVersion: vesFieldsVersion,
+		AlarmCondition:     a.ID,
+		EventSeverity:      severity,
+		EventSourceType:    "other",
+		SpecificProblem:    a.Description,
+		VfStatus:           "Active",
+		AlarmInterfaceA:    a.CellID,
+		AlarmAdditionalInformation: map[string]string{
+			"source":          a.Source,
+			"measurement":     a.Measurement,
+			"value":           strconv.FormatFloat(a.Value, 'g', -1, 64),
+			"threshold":       strconv.FormatFloat(a.Threshold, 'g', -1, 64),
+			"specificProblem": strconv.Itoa(a.SpecificProblem),
+		},
+	}
+	header := s.header("fault", "Fault_"+s.reportingEntity+"_"+a.Source, a.RanName, a.Raised, last)
+	header.Priority = "High"
+	return vesEvent{CommonEventHeader: header, FaultFields: fields}
+}
+
+// sendLoop POSTs the queued events when a batch is full or the flush interval
+// has passed
+func (s *vesSink) sendLoop() {
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	var events []vesEvent
+	for {
+		select {
+		case event := <-s.queue:
+			events = append(events, event)
+			if len(events) < s.batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(events) == 0 {
+				continue
+			}
+		}
+		if err := s.post(events); err != nil {
+			xapp.Logger.Error("Failed to send %d VES events: %v", len(events), err)
+			log.Printf("Failed to send %d VES events: %v", len(events), err)
+		}
+		events = nil
+	}
+}
+
+// flush POSTs the queued events in full batches, and the last batch that is
+// not full when all is set. It takes the place of sendLoop where the events
+// are queued synchronously, as when importing a capture.
+func (s *vesSink) flush(all bool) {
+	for len(s.queue) >= s.batchSize || all && len(s.queue) > 0 {
+		var events []vesEvent
+		for len(events) < s.batchSize && len(s.queue) > 0 {
+			events = append(events, <-s.queue)
+		}
+		if err := s.post(events); err != nil {
+			xapp.Logger.Error("Failed to send %d VES events: %v", len(events), err)
+			log.Printf("Failed to send %d VES events: %v", len(events), err)
+		}
+	}
+}
+
+// post sends a batch to the eventBatch endpoint of the collector, retrying with a doubling backoff on network errors,
+// throttling and server errors
+func (s *vesSink) post(events []vesEvent) error {
+	body, err := json.Marshal(vesEventBatch{EventList: events})
+	if err != nil {
+		return err
+	}
+
+	backoff := vesRetryBackoff
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		retry, err = s.send(body)
+		if err == nil || !retry || attempt >= s.attempts {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (s *vesSink) send(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	} else if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("VES collector returned %s", resp.Status)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
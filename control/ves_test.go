@@ -0,0 +1,209 @@
+package control
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// vesCollector records the batches POSTed to it and answers with the queued
+// status codes, then with 202
+type vesCollector struct {
+	mu       sync.Mutex
+	batches  []vesEventBatch
+	auth     []string
+	statuses []int
+}
+
+func (c *vesCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	var batch vesEventBatch
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || json.Unmarshal(body, &batch) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.batches = append(c.batches, batch)
+	c.auth = append(c.auth, r.Header.Get("Authorization"))
+	status := http.StatusAccepted
+	if len(c.statuses) > 0 {
+		status, c.statuses = c.statuses[0], c.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newTestVesSink(t *testing.T, env map[string]string) (*vesSink, *vesCollector, func()) {
+	collector := &vesCollector{}
+	server := httptest.NewServer(collector)
+	env["vesCollectorUrl"] = server.URL + "/eventListener/v7/eventBatch"
+	s := newTestSink(t, env, func() (interface{}, error) {
+		s, err := newVesSink()
+		if err != nil {
+			server.Close()
+		}
+		return s, err
+	})
+	return s.(*vesSink), collector, server.Close
+}
+
+func TestVesSinkMeasurementEvents(t *testing.T) {
+	s, collector, done := newTestVesSink(t, map[string]string{"vesUsername": "kpimon", "vesPassword": "secret", "vesBatchSize": "2"})
+	defer done()
+
+	start := time.Unix(1600000000, 0)
+	ind := &indication{RanName: "gnb-1", Received: start.Add(time.Second), Start: start, Granul: time.Second, Samples: []kpiSample{
+		{CellID: "cell-1", Measurement: "RRU.PrbUsedDl", Value: 42},
+		{CellID: "cell-1", Measurement: "RRU.PrbAvailDl", Value: 58},
+		{CellID: "cell-1", SliceID: "1-010203", FiveQI: 9, Measurement: "DRB.UEThpDl", Value: 12.5},
+	}}
+	ind.Topology.NodeID = "gnb_001_001_00000001"
+	for i := 0; i < 3; i++ {
+		if err := s.write(&batch{ind: ind}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.write(&batch{ind: &indication{RanName: "gnb-1"}}); err != nil || len(s.queue) != 3 {
+		t.Fatalf("indication without samples queued, %d events, %v", len(s.queue), err)
+	}
+
+	s.flush(false)
+	if len(collector.batches) != 1 || len(collector.batches[0].EventList) != 2 || len(s.queue) != 1 {
+		t.Fatalf("got %d batches, %d events left queued", len(collector.batches), len(s.queue))
+	}
+	s.flush(true)
+	if len(collector.batches) != 2 || len(collector.batches[1].EventList) != 1 {
+		t.Fatalf("got %d batches after flushing all", len(collector.batches))
+	}
+	if collector.auth[0] != "Basic a3BpbW9uOnNlY3JldA==" {
+		t.Errorf("got authorization %q", collector.auth[0])
+	}
+
+	event := collector.batches[0].EventList[0]
+	header := event.CommonEventHeader
+	if header.Domain != "measurement" || header.EventType != "KPM" || header.SourceName != "gnb-1" || header.EventID != "kpimon-1" || header.Sequence != 1 ||
+		header.StartEpochMicrosec != 1600000000000000 || header.LastEpochMicrosec != 1600000001000000 || header.VesEventListenerVersion != vesListenerVersion {
+		t.Errorf("got header %+v", header)
+	}
+	if seq := collector.batches[1].EventList[0].CommonEventHeader.Sequence; seq != 3 {
+		t.Errorf("got sequence %d of the third event", seq)
+	}
+	fields := event.MeasurementFields
+	if fields == nil || fields.MeasurementInterval != 1 || fields.AdditionalFields["nodeId"] != "gnb_001_001_00000001" || len(fields.AdditionalMeasurements) != 2 {
+		t.Fatalf("got measurement fields %+v", fields)
+	}
+	cell, slice := fields.AdditionalMeasurements[0], fields.AdditionalMeasurements[1]
+	if cell.Name != "cell=cell-1" || cell.HashMap["RRU.PrbUsedDl"] != "42" || cell.HashMap["RRU.PrbAvailDl"] != "58" {
+		t.Errorf("got cell measurements %+v", cell)
+	}
+	if slice.Name != "cell=cell-1,slice=1-010203,5qi=9" || slice.HashMap["DRB.UEThpDl"] != "12.5" {
+		t.Errorf("got slice measurements %+v", slice)
+	}
+}
+
+func TestVesSinkMeasurementPeriods(t *testing.T) {
+	s, collector, done := newTestVesSink(t, map[string]string{})
+	defer done()
+
+	start := time.Unix(1600000000, 0)
+	ind := &indication{RanName: "gnb-1", Received: start.Add(3 * time.Second), Start: start, Granul: time.Second}
+	for i := 2; i >= 0; i-- {
+		at := start.Add(time.Duration(i) * time.Second)
+		ind.Samples = append(ind.Samples,
+			kpiSample{CellID: "cell-1", Measurement: "RRU.PrbUsedDl", Value: float64(10 + i), Time: at},
+			kpiSample{CellID: "cell-1", Measurement: "RRU.PrbAvailDl", Value: float64(90 - i), Time: at})
+	}
+	if err := s.write(&batch{ind: ind}); err != nil {
+		t.Fatal(err)
+	}
+	s.flush(true)
+
+	if len(collector.batches) != 1 || len(collector.batches[0].EventList) != 3 {
+		t.Fatalf("got batches %+v, want one event per period", collector.batches)
+	}
+	for i, event := range collector.batches[0].EventList {
+		header, fields := event.CommonEventHeader, event.MeasurementFields
+		at := start.Add(time.Duration(i) * time.Second)
+		if header.StartEpochMicrosec != at.UnixNano()/1000 || header.LastEpochMicrosec != at.Add(time.Second).UnixNano()/1000 || fields.MeasurementInterval != 1 {
+			t.Errorf("period %d: got header %+v, interval %g", i, header, fields.MeasurementInterval)
+		}
+		values := fields.AdditionalMeasurements[0].HashMap
+		if len(fields.AdditionalMeasurements) != 1 || values["RRU.PrbUsedDl"] != strconv.Itoa(10+i) || values["RRU.PrbAvailDl"] != strconv.Itoa(90-i) {
+			t.Errorf("period %d: got measurements %+v", i, fields.AdditionalMeasurements)
+		}
+	}
+}
+
+func TestVesSinkFaultEvents(t *testing.T) {
+	tokenFile, remove := testConfigFile(t, "token\n")
+	defer remove()
+	s, collector, done := newTestVesSink(t, map[string]string{"vesTokenFile": tokenFile})
+	defer done()
+
+	a := &ActiveAlarm{
+		SeriesLabels: SeriesLabels{RanName: "gnb-1", CellID: "cell-1", Measurement: "RRU.PrbUsedDl"},
+		ID:           "prb-high:gnb-1/cell-1/RRU.PrbUsedDl", Source: "rule", Severity: "CRITICAL", SpecificProblem: 8100,
+		Value: 95, Threshold: 90, Description: "prb-high: RRU.PrbUsedDl > 90 for 2 periods", Raised: time.Unix(1600000000, 0),
+	}
+	s.alarm(a, true)
+	s.alarm(a, false)
+	s.flush(true)
+
+	if len(collector.batches) != 1 || len(collector.batches[0].EventList) != 2 || collector.auth[0] != "Bearer token" {
+		t.Fatalf("got batches %+v, authorization %v", collector.batches, collector.auth)
+	}
+	raised, cleared := collector.batches[0].EventList[0], collector.batches[0].EventList[1]
+	if raised.CommonEventHeader.Domain != "fault" || raised.CommonEventHeader.EventName != "Fault_kpimon_rule" || raised.CommonEventHeader.Priority != "High" {
+		t.Errorf("got header %+v", raised.CommonEventHeader)
+	}
+	f := raised.FaultFields
+	if f == nil || f.AlarmCondition != a.ID || f.EventSeverity != "CRITICAL" || f.AlarmInterfaceA != "cell-1" || f.SpecificProblem != a.Description ||
+		f.AlarmAdditionalInformation["value"] != "95" || f.AlarmAdditionalInformation["specificProblem"] != "8100" {
+		t.Errorf("got fault fields %+v", f)
+	}
+	if cleared.FaultFields == nil || cleared.FaultFields.EventSeverity != "NORMAL" || cleared.FaultFields.AlarmCondition != a.ID {
+		t.Errorf("got fault fields %+v of the cleared alarm", cleared.FaultFields)
+	}
+}
+
+func TestVesSinkRetries(t *testing.T) {
+	s, collector, done := newTestVesSink(t, map[string]string{"vesAttempts": "2"})
+	defer done()
+	events := []vesEvent{s.faultEvent(&ActiveAlarm{ID: "a", Source: "rule", Severity: "MAJOR"}, true)}
+
+	collector.statuses = []int{http.StatusServiceUnavailable}
+	if err := s.post(events); err != nil || len(collector.batches) != 2 {
+		t.Errorf("got %d attempts after a server error, %v", len(collector.batches), err)
+	}
+
+	collector.batches = nil
+	collector.statuses = []int{http.StatusBadRequest}
+	if err := s.post(events); err == nil || len(collector.batches) != 1 {
+		t.Errorf("got %d attempts after a client error, %v", len(collector.batches), err)
+	}
+
+	collector.batches = nil
+	collector.statuses = []int{http.StatusTooManyRequests, http.StatusInternalServerError}
+	if err := s.post(events); err == nil || len(collector.batches) != 2 {
+		t.Errorf("got %d attempts when every attempt fails, %v", len(collector.batches), err)
+	}
+}
+
+func TestVesSinkQueueFull(t *testing.T) {
+	s, _, done := newTestVesSink(t, map[string]string{"vesQueueSize": "1"})
+	defer done()
+
+	ind := &indication{RanName: "gnb-1", Samples: []kpiSample{{CellID: "cell-1", Measurement: "RRU.PrbUsedDl", Value: 1}}}
+	if err := s.write(&batch{ind: ind}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.write(&batch{ind: ind}); err == nil {
+		t.Error("event queued beyond vesQueueSize")
+	}
+}
@@ -27,6 +27,50 @@ E2AP_PDU_t* decode_E2AP_PDU(const void* buffer, size_t buf_size)
     }
 }
 
+/* XER dump of an E2AP PDU, the returned string is freed by the caller */
+char* e2ap_print_pdu(void *buffer, size_t buf_size)
+{
+    E2AP_PDU_t *pdu = decode_E2AP_PDU(buffer, buf_size);
+    if ( pdu == NULL )
+        return NULL;
+
+    char *xer = NULL;
+    size_t xer_size = 0;
+    FILE *stream = open_memstream(&xer, &xer_size);
+    if ( stream == NULL ) {
+        ASN_STRUCT_FREE(asn_DEF_E2AP_PDU, pdu);
+        return NULL;
+    }
+    int ret = xer_fprint(stream, &asn_DEF_E2AP_PDU, pdu);
+    fclose(stream);
+    ASN_STRUCT_FREE(asn_DEF_E2AP_PDU, pdu);
+    if ( ret != 0 ) {
+        free(xer);
+        return NULL;
+    }
+    return xer;
+}
+
+/* E2AP PDU type, returns the PDU choice and sets the procedure code, -1 when the PDU cannot be decoded */
+int e2ap_get_pdu_procedure(void *buffer, size_t buf_size, long *procedure_code)
+{
+    E2AP_PDU_t *pdu = decode_E2AP_PDU(buffer, buf_size);
+    if ( pdu == NULL )
+        return -1;
+
+    int present = pdu->present;
+    if ( present == E2AP_PDU_PR_initiatingMessage )
+        *procedure_code = pdu->choice.initiatingMessage->procedureCode;
+    else if ( present == E2AP_PDU_PR_successfulOutcome )
+        *procedure_code = pdu->choice.successfulOutcome->procedureCode;
+    else if ( present == E2AP_PDU_PR_unsuccessfulOutcome )
+        *procedure_code = pdu->choice.unsuccessfulOutcome->procedureCode;
+    else
+        present = -1;
+    ASN_STRUCT_FREE(asn_DEF_E2AP_PDU, pdu);
+    return present;
+}
+
 /* RICsubscriptionRequest */
 long e2ap_get_ric_subscription_request_sequence_number(void *buffer, size_t buf_size)
 {
@@ -55,6 +99,37 @@ long e2ap_get_ric_subscription_request_sequence_number(void *buffer, size_t buf_
     return -1;
 }
 
+RICsubscriptionRequestMsg* e2ap_decode_ric_subscription_request_message(void *buffer, size_t buf_size)
+{
+    E2AP_PDU_t *pdu = decode_E2AP_PDU(buffer, buf_size);
+    if ( pdu != NULL && pdu->present == E2AP_PDU_PR_initiatingMessage)
+    {
+        InitiatingMessage_t* initiatingMessage = pdu->choice.initiatingMessage;
+        if ( initiatingMessage->procedureCode == ProcedureCode_id_RICsubscription
+            && initiatingMessage->value.present == InitiatingMessage__value_PR_RICsubscriptionRequest)
+        {
+            RICsubscriptionRequest_t *subscriptionRequest = &(initiatingMessage->value.choice.RICsubscriptionRequest);
+            RICsubscriptionRequestMsg *msg = (RICsubscriptionRequestMsg *)calloc(1, sizeof(RICsubscriptionRequestMsg));
+            for (int i = 0; i < subscriptionRequest->protocolIEs.list.count; ++i )
+            {
+                if (subscriptionRequest->protocolIEs.list.array[i]->id == ProtocolIE_ID_id_RICrequestID) {
+                    msg->requestorID = subscriptionRequest->protocolIEs.list.array[i]->value.choice.RICrequestID.ricRequestorID;
+                    msg->requestSequenceNumber = subscriptionRequest->protocolIEs.list.array[i]->value.choice.RICrequestID.ricInstanceID;
+                }
+                else if (subscriptionRequest->protocolIEs.list.array[i]->id == ProtocolIE_ID_id_RANfunctionID) {
+                    msg->ranfunctionID = subscriptionRequest->protocolIEs.list.array[i]->value.choice.RANfunctionID;
+                }
+            }
+            ASN_STRUCT_FREE(asn_DEF_E2AP_PDU, pdu);
+            return msg;
+        }
+    }
+
+    if(pdu != NULL) 
+        ASN_STRUCT_FREE(asn_DEF_E2AP_PDU, pdu);
+    return NULL;
+}
+
 ssize_t  e2ap_set_ric_subscription_request_sequence_number(void *buffer, size_t buf_size, long sequence_number)
 {
     E2AP_PDU_t *pdu = decode_E2AP_PDU(buffer, buf_size);
@@ -589,6 +664,7 @@ RICindicationMsg* e2ap_decode_ric_indication_message(void *buffer, size_t buf_si
                 }
                 else if(indication->protocolIEs.list.array[i]->id == ProtocolIE_ID_id_RICindicationSN) {
                     msg->indicationSN = indication->protocolIEs.list.array[i]->value.choice.RICindicationSN;
+                    msg->indicationSNPresent = 1;
                 }
                 else if(indication->protocolIEs.list.array[i]->id == ProtocolIE_ID_id_RICindicationType) {
                     msg->indicationType = indication->protocolIEs.list.array[i]->value.choice.RICindicationType;
@@ -662,3 +738,93 @@ void e2ap_free_decoded_ric_indication_message(RICindicationMsg* msg) {
     free(msg);
     msg = NULL;
 }
+
+/* copies the RAN function items of a RANfunctions-List */
+static int e2ap_add_ran_function_definitions(RANfunctionDefinitionList *list, RANfunctions_List_t *ranFunctions)
+{
+    for (int i = 0; i < ranFunctions->list.count && list->count < 256; ++i)
+    {
+        RANfunction_ItemIEs_t *itemIE = (RANfunction_ItemIEs_t *)ranFunctions->list.array[i];
+        if (itemIE->id != ProtocolIE_ID_id_RANfunction_Item
+            || itemIE->value.present != RANfunction_ItemIEs__value_PR_RANfunction_Item) {
+            continue;
+        }
+
+        RANfunction_Item_t *item = &itemIE->value.choice.RANfunction_Item;
+        RANfunctionDefinitionItem *definition = &list->ranFunction[list->count];
+        definition->ranFunctionDefinition = calloc(1, item->ranFunctionDefinition.size + 1);
+        if (!definition->ranFunctionDefinition) {
+            fprintf(stderr, "alloc RANfunctionDefinition failed\n");
+            return -1;
+        }
+
+        memcpy(definition->ranFunctionDefinition, item->ranFunctionDefinition.buf, item->ranFunctionDefinition.size);
+        definition->ranFunctionDefinitionSize = item->ranFunctionDefinition.size;
+        definition->ranFunctionID = item->ranFunctionID;
+        definition->ranFunctionRevision = item->ranFunctionRevision;
+        list->count++;
+    }
+    return 0;
+}
+
+/* RAN functions added by an E2setupRequest, or added and modified by a RICserviceUpdate */
+RANfunctionDefinitionList* e2ap_decode_ran_function_definitions(void *buffer, size_t buf_size)
+{
+    E2AP_PDU_t *pdu = decode_E2AP_PDU(buffer, buf_size);
+    if (pdu == NULL)
+        return NULL;
+
+    if (pdu->present != E2AP_PDU_PR_initiatingMessage) {
+        ASN_STRUCT_FREE(asn_DEF_E2AP_PDU, pdu);
+        return NULL;
+    }
+
+    InitiatingMessage_t* initiatingMessage = pdu->choice.initiatingMessage;
+    RANfunctionDefinitionList *list = NULL;
+    int ret = 0;
+    if (initiatingMessage->procedureCode == ProcedureCode_id_E2setup
+        && initiatingMessage->value.present == InitiatingMessage__value_PR_E2setupRequest)
+    {
+        E2setupRequest_t *setup = &initiatingMessage->value.choice.E2setupRequest;
+        list = (RANfunctionDefinitionList *)calloc(1, sizeof(RANfunctionDefinitionList));
+        for (int i = 0; list != NULL && ret == 0 && i < setup->protocolIEs.list.count; ++i )
+        {
+            E2setupRequestIEs_t *ie = setup->protocolIEs.list.array[i];
+            if (ie->id == ProtocolIE_ID_id_RANfunctionsAdded && ie->value.present == E2setupRequestIEs__value_PR_RANfunctions_List) {
+                ret = e2ap_add_ran_function_definitions(list, &ie->value.choice.RANfunctions_List);
+            }
+        }
+    }
+    else if (initiatingMessage->procedureCode == ProcedureCode_id_RICserviceUpdate
+        && initiatingMessage->value.present == InitiatingMessage__value_PR_RICserviceUpdate)
+    {
+        RICserviceUpdate_t *update = &initiatingMessage->value.choice.RICserviceUpdate;
+        list = (RANfunctionDefinitionList *)calloc(1, sizeof(RANfunctionDefinitionList));
+        for (int i = 0; list != NULL && ret == 0 && i < update->protocolIEs.list.count; ++i )
+        {
+            RICserviceUpdate_IEs_t *ie = update->protocolIEs.list.array[i];
+            if ((ie->id == ProtocolIE_ID_id_RANfunctionsAdded || ie->id == ProtocolIE_ID_id_RANfunctionsModified)
+                && ie->value.present == RICserviceUpdate_IEs__value_PR_RANfunctions_List) {
+                ret = e2ap_add_ran_function_definitions(list, &ie->value.choice.RANfunctions_List);
+            }
+        }
+    }
+
+    ASN_STRUCT_FREE(asn_DEF_E2AP_PDU, pdu);
+    if (ret != 0) {
+        e2ap_free_decoded_ran_function_definitions(list);
+        return NULL;
+    }
+    return list;
+}
+
+void e2ap_free_decoded_ran_function_definitions(RANfunctionDefinitionList* list) {
+    if(list == NULL) {
+        return;
+    }
+
+    for (int i = 0; i < list->count; ++i) {
+        free(list->ranFunction[i].ranFunctionDefinition);
+    }
+    free(list);
+}
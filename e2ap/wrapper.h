@@ -7,6 +7,8 @@
 #include "RICsubscriptionDeleteResponse.h"
 #include "RICcontrolRequest.h"
 #include "RICindication.h"
+#include "E2setupRequest.h"
+#include "RICserviceUpdate.h"
 #include "E2AP-PDU.h"
 #include "InitiatingMessage.h"
 #include "SuccessfulOutcome.h"
@@ -23,6 +25,7 @@ typedef struct RICindicationMessage {
 	long ranfunctionID;
 	long actionID;
 	long indicationSN;
+	int indicationSNPresent; /* RICindicationSN is optional */
 	long indicationType;
 	uint8_t *indicationHeader;
 	size_t indicationHeaderSize;
@@ -32,6 +35,12 @@ typedef struct RICindicationMessage {
 	size_t callProcessIDSize;
 } RICindicationMsg;
 
+typedef struct RICsubscriptionRequestMessage {
+	long requestorID;
+	long requestSequenceNumber;
+	long ranfunctionID;
+} RICsubscriptionRequestMsg;
+
 typedef struct RICcauseItem {
 	int ricCauseType;
 	long ricCauseID;
@@ -67,12 +76,27 @@ typedef struct RICSubsequentAction {
 	long timeToWait;
 } RICSubsequentAction;
 
+typedef struct RANfunctionDefinitionItem {
+	long ranFunctionID;
+	long ranFunctionRevision;
+	uint8_t *ranFunctionDefinition;
+	size_t ranFunctionDefinitionSize;
+} RANfunctionDefinitionItem;
+
+typedef struct RANfunctionDefinitionList {
+	RANfunctionDefinitionItem ranFunction[256];
+	int count;
+} RANfunctionDefinitionList;
+
 size_t encode_E2AP_PDU(E2AP_PDU_t* pdu, void* buffer, size_t buf_size);
 E2AP_PDU_t* decode_E2AP_PDU(const void* buffer, size_t buf_size);
+char* e2ap_print_pdu(void *buffer, size_t buf_size);
+int e2ap_get_pdu_procedure(void *buffer, size_t buf_size, long *procedure_code);
 
 /* RICsubscriptionRequest */
 long e2ap_get_ric_subscription_request_sequence_number(void *buffer, size_t buf_size);
 ssize_t  e2ap_set_ric_subscription_request_sequence_number(void *buffer, size_t buf_size, long sequence_number);
+RICsubscriptionRequestMsg* e2ap_decode_ric_subscription_request_message(void *buffer, size_t buf_size);
 ssize_t e2ap_encode_ric_subscription_request_message(void *buffer, size_t buf_size, long ricRequestorID, long ricRequestSequenceNumber, long ranFunctionID, void *eventTriggerDefinition, size_t eventTriggerDefinitionSize, int actionCount, long *actionIds, long* actionTypes, RICactionDefinition *actionDefinitions, RICSubsequentAction *subsequentActionTypes);
 
 /* RICsubscriptionResponse */
@@ -99,4 +123,8 @@ long e2ap_get_ric_subscription_delete_failure_sequence_number(void *buffer, size
 RICindicationMsg* e2ap_decode_ric_indication_message(void *buffer, size_t buf_size);
 void e2ap_free_decoded_ric_indication_message(RICindicationMsg* msg);
 
+/* E2setupRequest, RICserviceUpdate */
+RANfunctionDefinitionList* e2ap_decode_ran_function_definitions(void *buffer, size_t buf_size);
+void e2ap_free_decoded_ran_function_definitions(RANfunctionDefinitionList* list);
+
 #endif /* _WRAPPER_H_ */
@@ -83,3 +83,58 @@ E2SM_KPM_IndicationMessage_t* e2sm_decode_ric_indication_message(void *buffer, s
 void e2sm_free_ric_indication_message(E2SM_KPM_IndicationMessage_t* indMsg) {
 	ASN_STRUCT_FREE(asn_DEF_E2SM_KPM_IndicationMessage, indMsg);
 }
+
+/* RAN function definition of the E2setupRequest and RICserviceUpdate */
+E2SM_KPM_RANfunction_Description_t* e2sm_decode_ran_function_description(void *buffer, size_t buf_size) {
+	asn_dec_rval_t decode_result;
+	E2SM_KPM_RANfunction_Description_t *desc = 0;
+	decode_result = aper_decode_complete(NULL, &asn_DEF_E2SM_KPM_RANfunction_Description, (void **)&desc, buffer, buf_size);
+	if(decode_result.code == RC_OK) {
+		return desc;
+	}
+	else {
+		ASN_STRUCT_FREE(asn_DEF_E2SM_KPM_RANfunction_Description, desc);
+		return NULL;
+	}
+}
+
+void e2sm_free_ran_function_description(E2SM_KPM_RANfunction_Description_t* desc) {
+	ASN_STRUCT_FREE(asn_DEF_E2SM_KPM_RANfunction_Description, desc);
+}
+
+static char* e2sm_print(asn_TYPE_descriptor_t *td, void *sptr) {
+	char *xer = NULL;
+	size_t xer_size = 0;
+	FILE *stream = open_memstream(&xer, &xer_size);
+	if(stream == NULL) {
+		return NULL;
+	}
+	int ret = xer_fprint(stream, td, sptr);
+	fclose(stream);
+	if(ret != 0) {
+		free(xer);
+		return NULL;
+	}
+	return xer;
+}
+
+/* XER dumps of the indication header and message, the returned string is freed by the caller */
+char* e2sm_print_ric_indication_header(void *buffer, size_t buf_size) {
+	E2SM_KPM_IndicationHeader_t *indHdr = e2sm_decode_ric_indication_header(buffer, buf_size);
+	if(indHdr == NULL) {
+		return NULL;
+	}
+	char *xer = e2sm_print(&asn_DEF_E2SM_KPM_IndicationHeader, indHdr);
+	e2sm_free_ric_indication_header(indHdr);
+	return xer;
+}
+
+char* e2sm_print_ric_indication_message(void *buffer, size_t buf_size) {
+	E2SM_KPM_IndicationMessage_t *indMsg = e2sm_decode_ric_indication_message(buffer, buf_size);
+	if(indMsg == NULL) {
+		return NULL;
+	}
+	char *xer = e2sm_print(&asn_DEF_E2SM_KPM_IndicationMessage, indMsg);
+	e2sm_free_ric_indication_message(indMsg);
+	return xer;
+}
@@ -49,8 +49,12 @@
 #include "E2SM-KPM-IndicationMessage-Format1.h"
 #include "E2SM-KPM-IndicationMessage-Format2.h"
 #include "MatchingCondItem.h"
+#include "MatchingUEidList.h"
+#include "MatchingUEidItem.h"
 #include "MeasurementCondUEidItem.h"
 #include "TestCondInfo.h"
+#include "E2SM-KPM-RANfunction-Description.h"
+#include "RIC-ReportStyle-Item.h"
 
 
 extern ssize_t e2sm_encode_ric_event_trigger_definition(void *buffer, size_t buf_size, size_t event_trigger_count, long RT_periods);
@@ -59,5 +63,9 @@ extern E2SM_KPM_IndicationHeader_t* e2sm_decode_ric_indication_header(void *buff
 extern void e2sm_free_ric_indication_header(E2SM_KPM_IndicationHeader_t* indHdr);
 extern E2SM_KPM_IndicationMessage_t* e2sm_decode_ric_indication_message(void *buffer, size_t buf_size);
 extern void e2sm_free_ric_indication_message(E2SM_KPM_IndicationMessage_t* indMsg);
+extern E2SM_KPM_RANfunction_Description_t* e2sm_decode_ran_function_description(void *buffer, size_t buf_size);
+extern void e2sm_free_ran_function_description(E2SM_KPM_RANfunction_Description_t* desc);
+extern char* e2sm_print_ric_indication_header(void *buffer, size_t buf_size);
+extern char* e2sm_print_ric_indication_message(void *buffer, size_t buf_size);
 
 #endif /* _WRAPPER_H_ */